@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"log/slog"
 	"os"
@@ -10,8 +9,10 @@ import (
 	"syscall"
 
 	"github.com/ValueRetail/vrsky/internal/config"
+	"github.com/ValueRetail/vrsky/pkg/admin"
 	"github.com/ValueRetail/vrsky/pkg/component"
-	"github.com/ValueRetail/vrsky/pkg/io"
+	"github.com/ValueRetail/vrsky/pkg/pipeline"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
 )
 
 func main() {
@@ -25,62 +26,63 @@ func main() {
 		os.Exit(1)
 	}
 
-	slog.Info("Configuration loaded",
-		"input_type", cfg.InputType,
-		"output_type", cfg.OutputType)
-
-	// Create input from configuration
-	inputConfig, err := json.Marshal(cfg.InputConfig)
+	definition, err := cfg.Pipelines()
 	if err != nil {
-		slog.Error("Failed to marshal input config", "error", err)
+		slog.Error("Invalid pipeline definition", "error", err)
 		os.Exit(1)
 	}
 
-	input, err := io.NewInput(cfg.InputType, inputConfig)
+	slog.Info("Configuration loaded",
+		"pipeline_file", cfg.PipelineFile,
+		"pipelines", len(definition.Pipelines))
+
+	// Send spans to the configured exporter, flushing them on exit
+	shutdownTracing, err := tracing.Setup(context.Background(), "vrsky-consumer", cfg.TracingExporter)
 	if err != nil {
-		slog.Error("Failed to create input", "error", err)
+		slog.Error("Failed to set up tracing", "error", err)
 		os.Exit(1)
 	}
+	defer shutdownTracing(context.Background())
 
-	// Create output from configuration
-	outputConfig, err := json.Marshal(cfg.OutputConfig)
+	// Create every pipeline's input, output and consumer
+	pipelines, err := definition.Build()
 	if err != nil {
-		slog.Error("Failed to marshal output config", "error", err)
+		slog.Error("Failed to create pipelines", "error", err)
 		os.Exit(1)
 	}
 
-	output, err := io.NewOutput(cfg.OutputType, outputConfig)
-	if err != nil {
-		slog.Error("Failed to create output", "error", err)
+	// Serve the health probes for the life of the process
+	adminServer := admin.NewServer(cfg.AdminAddr, func() component.HealthStatus {
+		return pipeline.Health(pipelines)
+	})
+	adminServer.SetLivenessCheck(func() error {
+		return pipeline.Stalled(pipelines, cfg.StallTimeout)
+	})
+	for _, p := range pipelines {
+		adminServer.Register(p.Name+".input", p.Input)
+		adminServer.Register(p.Name+".output", p.Output)
+		if p.DeadLetter != nil {
+			adminServer.Register(p.Name+".dead_letter", p.DeadLetter)
+		}
+	}
+	if err := adminServer.Start(); err != nil {
+		slog.Error("Failed to start admin server", "error", err)
 		os.Exit(1)
 	}
-
-	// Create consumer
-	cons := component.New(input, output)
+	defer adminServer.Close(context.Background())
 
 	// Create context for graceful shutdown
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Start the consumer input and output
-	if err := input.Start(ctx); err != nil {
-		slog.Error("Failed to start input", "error", err)
-		os.Exit(1)
-	}
-
-	if err := output.Start(ctx); err != nil {
-		slog.Error("Failed to start output", "error", err)
-		os.Exit(1)
-	}
-
 	// Setup signal handling for graceful shutdown
-	sigChan := make(chan os.Signal, 1)
+	sigChan := make(chan os.Signal, 2)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start the main processing loop in a goroutine
+	// Run the pipelines' processing loops in a goroutine; they start their inputs and outputs
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- cons.Process(ctx, input, output)
+		errChan <- pipeline.Run(ctx, pipelines)
 	}()
 
 	// Wait for either an error or a signal
@@ -91,10 +93,22 @@ func main() {
 			os.Exit(1)
 		}
 	case sig := <-sigChan:
-		slog.Info("Received signal, shutting down",
-			"signal", sig.String())
+		slog.Info("Received signal, draining",
+			"signal", sig.String(),
+			"timeout", cfg.DrainTimeout)
+
+		// A second signal skips the drain
+		go func() {
+			sig := <-sigChan
+			slog.Warn("Received second signal, exiting without draining", "signal", sig.String())
+			os.Exit(1)
+		}()
+
+		// Stop accepting input, deliver what was accepted, then close
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), cfg.DrainTimeout)
+		defer stopCancel()
+		pipeline.Stop(stopCtx, pipelines)
 		cancel()
-		cons.Stop(ctx)
 	}
 }
 
@@ -7,6 +7,8 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/ValueRetail/vrsky/internal/config"
+	"github.com/ValueRetail/vrsky/pkg/admin"
 	"github.com/ValueRetail/vrsky/pkg/io"
 )
 
@@ -27,6 +29,19 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Serve the health probes
+	adminAddr, err := config.AdminAddr()
+	if err != nil {
+		logger.Error("Invalid admin configuration", "err", err)
+		os.Exit(1)
+	}
+	adminServer := admin.NewServer(adminAddr, nil)
+	adminServer.Register("output", producer)
+	if err := adminServer.Start(); err != nil {
+		logger.Error("Failed to start admin server", "err", err)
+		os.Exit(1)
+	}
+
 	// Handle signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -35,6 +50,7 @@ func main() {
 	<-sigChan
 
 	// Close producer
+	adminServer.Close(context.Background())
 	producer.Close()
 	logger.Info("File Producer closed")
 }
@@ -4,57 +4,177 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/pipeline"
 )
 
 // Config holds the application configuration loaded from environment variables
 type Config struct {
+	// PipelineFile is a pipeline definition file. When set, it replaces the INPUT_*,
+	// OUTPUT_* and PROCESSING_CONFIG variables.
+	PipelineFile string `json:"pipeline_file,omitempty"`
+
 	InputType    string          `json:"input_type"`
 	InputConfig  json.RawMessage `json:"input_config"`
 	OutputType   string          `json:"output_type"`
 	OutputConfig json.RawMessage `json:"output_config"`
+
+	// ProcessingConfig sets worker count and ordering for the processing loop (optional)
+	ProcessingConfig json.RawMessage `json:"processing_config,omitempty"`
+
+	// DrainTimeout bounds how long shutdown waits for accepted messages to be delivered
+	DrainTimeout time.Duration `json:"drain_timeout"`
+
+	// AdminAddr is where the /healthz, /readyz and /livez probes are served
+	AdminAddr string `json:"admin_addr"`
+
+	// StallTimeout is how long a loop holding messages may go without progress before /livez fails
+	StallTimeout time.Duration `json:"stall_timeout"`
+
+	// TracingExporter is where spans are sent: none (default) or otlp
+	TracingExporter string `json:"tracing_exporter"`
 }
 
 // Load reads configuration from environment variables
 func Load() (*Config, error) {
-	config := &Config{}
+	config := &Config{DrainTimeout: 30 * time.Second, StallTimeout: 5 * time.Minute}
+
+	if err := config.loadPipeline(); err != nil {
+		return nil, err
+	}
+
+	if drainTimeoutStr := os.Getenv("DRAIN_TIMEOUT"); drainTimeoutStr != "" {
+		drainTimeout, err := time.ParseDuration(drainTimeoutStr)
+		if err != nil || drainTimeout <= 0 {
+			return nil, fmt.Errorf("DRAIN_TIMEOUT is not a valid duration: %q", drainTimeoutStr)
+		}
+		config.DrainTimeout = drainTimeout
+	}
+
+	if stallTimeoutStr := os.Getenv("STALL_TIMEOUT"); stallTimeoutStr != "" {
+		stallTimeout, err := time.ParseDuration(stallTimeoutStr)
+		if err != nil || stallTimeout <= 0 {
+			return nil, fmt.Errorf("STALL_TIMEOUT is not a valid duration: %q", stallTimeoutStr)
+		}
+		config.StallTimeout = stallTimeout
+	}
+
+	adminAddr, err := AdminAddr()
+	if err != nil {
+		return nil, err
+	}
+	config.AdminAddr = adminAddr
+
+	// The OTLP exporter reads its endpoint and headers from the standard OTEL_EXPORTER_OTLP_* variables
+	config.TracingExporter = os.Getenv("TRACING_EXPORTER")
+
+	return config, nil
+}
+
+// loadPipeline reads PIPELINE_FILE, or the single pipeline given by the INPUT_*, OUTPUT_*
+// and PROCESSING_CONFIG variables
+func (config *Config) loadPipeline() error {
+	if pipelineFile := os.Getenv("PIPELINE_FILE"); pipelineFile != "" {
+		if os.Getenv("INPUT_TYPE") != "" || os.Getenv("OUTPUT_TYPE") != "" {
+			return fmt.Errorf("PIPELINE_FILE cannot be combined with INPUT_TYPE or OUTPUT_TYPE")
+		}
+		config.PipelineFile = pipelineFile
+		return nil
+	}
 
 	// Read input configuration
 	inputType := os.Getenv("INPUT_TYPE")
 	if inputType == "" {
-		return nil, fmt.Errorf("INPUT_TYPE environment variable is required")
+		return fmt.Errorf("INPUT_TYPE environment variable is required")
 	}
 	config.InputType = inputType
 
 	inputConfigStr := os.Getenv("INPUT_CONFIG")
 	if inputConfigStr == "" {
-		return nil, fmt.Errorf("INPUT_CONFIG environment variable is required")
+		return fmt.Errorf("INPUT_CONFIG environment variable is required")
 	}
 
 	// Validate JSON
 	var inputConfigObj interface{}
 	if err := json.Unmarshal([]byte(inputConfigStr), &inputConfigObj); err != nil {
-		return nil, fmt.Errorf("INPUT_CONFIG is not valid JSON: %w", err)
+		return fmt.Errorf("INPUT_CONFIG is not valid JSON: %w", err)
 	}
 	config.InputConfig = json.RawMessage(inputConfigStr)
 
 	// Read output configuration
 	outputType := os.Getenv("OUTPUT_TYPE")
 	if outputType == "" {
-		return nil, fmt.Errorf("OUTPUT_TYPE environment variable is required")
+		return fmt.Errorf("OUTPUT_TYPE environment variable is required")
 	}
 	config.OutputType = outputType
 
 	outputConfigStr := os.Getenv("OUTPUT_CONFIG")
 	if outputConfigStr == "" {
-		return nil, fmt.Errorf("OUTPUT_CONFIG environment variable is required")
+		return fmt.Errorf("OUTPUT_CONFIG environment variable is required")
 	}
 
 	// Validate JSON
 	var outputConfigObj interface{}
 	if err := json.Unmarshal([]byte(outputConfigStr), &outputConfigObj); err != nil {
-		return nil, fmt.Errorf("OUTPUT_CONFIG is not valid JSON: %w", err)
+		return fmt.Errorf("OUTPUT_CONFIG is not valid JSON: %w", err)
 	}
 	config.OutputConfig = json.RawMessage(outputConfigStr)
 
-	return config, nil
+	// Read optional processing configuration
+	if processingConfigStr := os.Getenv("PROCESSING_CONFIG"); processingConfigStr != "" {
+		var processingConfigObj interface{}
+		if err := json.Unmarshal([]byte(processingConfigStr), &processingConfigObj); err != nil {
+			return fmt.Errorf("PROCESSING_CONFIG is not valid JSON: %w", err)
+		}
+		config.ProcessingConfig = json.RawMessage(processingConfigStr)
+	}
+
+	return nil
+}
+
+// Pipelines returns the pipeline definition: the PIPELINE_FILE, or a pipeline named
+// "default" built from the INPUT_*, OUTPUT_* and PROCESSING_CONFIG variables
+func (config *Config) Pipelines() (*pipeline.Definition, error) {
+	if config.PipelineFile != "" {
+		return pipeline.LoadFile(config.PipelineFile)
+	}
+
+	spec := pipeline.Spec{
+		Name:   "default",
+		Input:  pipeline.ComponentSpec{Type: config.InputType},
+		Output: pipeline.ComponentSpec{Type: config.OutputType},
+	}
+	if err := json.Unmarshal(config.InputConfig, &spec.Input.Config); err != nil {
+		return nil, fmt.Errorf("INPUT_CONFIG must be a JSON object: %w", err)
+	}
+	if err := json.Unmarshal(config.OutputConfig, &spec.Output.Config); err != nil {
+		return nil, fmt.Errorf("OUTPUT_CONFIG must be a JSON object: %w", err)
+	}
+	if len(config.ProcessingConfig) > 0 {
+		if err := json.Unmarshal(config.ProcessingConfig, &spec.Processing); err != nil {
+			return nil, fmt.Errorf("PROCESSING_CONFIG must be a JSON object: %w", err)
+		}
+	}
+
+	definition := &pipeline.Definition{Pipelines: []pipeline.Spec{spec}}
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	return definition, nil
+}
+
+// AdminAddr returns the admin server address from ADMIN_PORT (default: 9090). Binaries
+// that take the rest of their configuration elsewhere use it on its own.
+func AdminAddr() (string, error) {
+	portStr := os.Getenv("ADMIN_PORT")
+	if portStr == "" {
+		return ":9090", nil
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", fmt.Errorf("ADMIN_PORT is not a valid port: %q", portStr)
+	}
+	return ":" + portStr, nil
 }
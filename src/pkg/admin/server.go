@@ -0,0 +1,209 @@
+// Package admin serves the probe and metrics endpoints every binary exposes on its admin port
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+)
+
+// checkTimeout bounds each component's health check
+const checkTimeout = 2 * time.Second
+
+// Server answers /livez, /readyz and /healthz, and serves Prometheus metrics at /metrics:
+//
+//   - /livez fails once the processing loop has stopped, or while the liveness check fails
+//     (e.g. the loop has stalled), so the process gets restarted
+//   - /readyz fails unless the loop is healthy and every registered component passes its check
+//   - /healthz reports the status and each check as JSON; it fails when /readyz would, except
+//     while draining, which is a healthy way to stop
+type Server struct {
+	addr     string
+	mux      *http.ServeMux
+	status   func() component.HealthStatus
+	liveness func() error
+
+	mu       sync.Mutex
+	checks   []check
+	server   *http.Server
+	listener net.Listener
+}
+
+type check struct {
+	name    string
+	checker component.HealthChecker
+}
+
+// Report is the /healthz response body
+type Report struct {
+	Status component.HealthStatus `json:"status"`
+	Checks map[string]string      `json:"checks"` // "ok" or the reason the check failed
+}
+
+// NewServer creates an admin server listening on addr. status reports the state of the
+// processing loop; nil means the binary has none and is healthy while it runs.
+func NewServer(addr string, status func() component.HealthStatus) *Server {
+	if status == nil {
+		status = func() component.HealthStatus { return component.HealthHealthy }
+	}
+	s := &Server{
+		addr:   addr,
+		mux:    http.NewServeMux(),
+		status: status,
+	}
+	s.mux.HandleFunc("/livez", s.handleLive)
+	s.mux.HandleFunc("/readyz", s.handleReady)
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+	s.mux.Handle("/metrics", metrics.Handler())
+	return s
+}
+
+// Register adds target to the readiness checks under name. Targets that do not implement
+// component.HealthChecker are skipped.
+func (s *Server) Register(name string, target any) {
+	checker, ok := target.(component.HealthChecker)
+	if !ok {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, check{name: name, checker: checker})
+}
+
+// SetLivenessCheck makes /livez fail while check returns an error, such as a processing
+// loop that has stopped making progress
+func (s *Server) SetLivenessCheck(check func() error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.liveness = check
+}
+
+// Start listens on the admin address and serves in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address %s: %w", s.addr, err)
+	}
+	server := &http.Server{
+		Handler:           s.mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	s.mu.Lock()
+	s.server = server
+	s.listener = listener
+	s.mu.Unlock()
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Admin server failed", "addr", s.addr, "error", err)
+		}
+	}()
+	slog.Info("Admin server listening", "addr", listener.Addr().String())
+	return nil
+}
+
+// Close stops the admin server, waiting for in-flight probes until ctx ends
+func (s *Server) Close(ctx context.Context) error {
+	s.mu.Lock()
+	server := s.server
+	s.mu.Unlock()
+	if server == nil {
+		return nil
+	}
+	return server.Shutdown(ctx)
+}
+
+// report runs every check in parallel
+func (s *Server) report(ctx context.Context) Report {
+	s.mu.Lock()
+	checks := append([]check(nil), s.checks...)
+	s.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	results := make([]string, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = "ok"
+			if err := c.checker.CheckHealth(ctx); err != nil {
+				results[i] = err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := Report{Status: s.status(), Checks: make(map[string]string, len(checks))}
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+	}
+	return report
+}
+
+func (r Report) checksPass() bool {
+	for _, result := range r.Checks {
+		if result != "ok" {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	if status := s.status(); status == component.HealthStopped {
+		http.Error(w, string(status), http.StatusServiceUnavailable)
+		return
+	}
+	s.mu.Lock()
+	liveness := s.liveness
+	s.mu.Unlock()
+	if liveness != nil {
+		if err := liveness(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	report := s.report(r.Context())
+	if report.Status != component.HealthHealthy {
+		http.Error(w, string(report.Status), http.StatusServiceUnavailable)
+		return
+	}
+	for name, result := range report.Checks {
+		if result != "ok" {
+			http.Error(w, name+": "+result, http.StatusServiceUnavailable)
+			return
+		}
+	}
+	w.Write([]byte("ok\n"))
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	report := s.report(r.Context())
+	code := http.StatusOK
+	switch {
+	case report.Status == component.HealthUnhealthy, report.Status == component.HealthStopped:
+		code = http.StatusServiceUnavailable
+	case report.Status == component.HealthHealthy && !report.checksPass():
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
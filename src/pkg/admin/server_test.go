@@ -0,0 +1,141 @@
+package admin_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/admin"
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// probe returns the status code and body of an admin endpoint
+func probe(t *testing.T, path string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Get("http://localhost:8790" + path)
+	if err != nil {
+		t.Fatalf("GET %s error = %v", path, err)
+	}
+	defer resp.Body.Close()
+	var body json.RawMessage
+	json.NewDecoder(resp.Body).Decode(&body)
+	return resp.StatusCode, body
+}
+
+// checker fails its health check with err once it is set
+type checker struct {
+	err atomic.Pointer[error]
+}
+
+func (c *checker) CheckHealth(ctx context.Context) error {
+	if err := c.err.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+func TestServer_Probes(t *testing.T) {
+	var status atomic.Value
+	output := &checker{}
+	server := admin.NewServer(":8790", func() component.HealthStatus { return status.Load().(component.HealthStatus) })
+	server.Register("output", output)
+	server.Register("no checks", componenttest.NewInput())
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer server.Close(context.Background())
+
+	unreachable := errors.New("connection refused")
+	tests := []struct {
+		status                 component.HealthStatus
+		checkFails             bool
+		livez, readyz, healthz int
+	}{
+		{component.HealthHealthy, false, http.StatusOK, http.StatusOK, http.StatusOK},
+		{component.HealthHealthy, true, http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		{component.HealthUnhealthy, false, http.StatusOK, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+		// Draining is a healthy way to stop, even once the components are closing
+		{component.HealthDraining, false, http.StatusOK, http.StatusServiceUnavailable, http.StatusOK},
+		{component.HealthDraining, true, http.StatusOK, http.StatusServiceUnavailable, http.StatusOK},
+		{component.HealthStopped, false, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		status.Store(tt.status)
+		output.err.Store(nil)
+		if tt.checkFails {
+			output.err.Store(&unreachable)
+		}
+
+		if code, _ := probe(t, "/livez"); code != tt.livez {
+			t.Errorf("%s, check failing %v: /livez = %d, want %d", tt.status, tt.checkFails, code, tt.livez)
+		}
+		if code, _ := probe(t, "/readyz"); code != tt.readyz {
+			t.Errorf("%s, check failing %v: /readyz = %d, want %d", tt.status, tt.checkFails, code, tt.readyz)
+		}
+		code, body := probe(t, "/healthz")
+		if code != tt.healthz {
+			t.Errorf("%s, check failing %v: /healthz = %d, want %d", tt.status, tt.checkFails, code, tt.healthz)
+		}
+		var report admin.Report
+		if err := json.Unmarshal(body, &report); err != nil {
+			t.Fatalf("/healthz body %s: %v", body, err)
+		}
+		want := "ok"
+		if tt.checkFails {
+			want = unreachable.Error()
+		}
+		if report.Status != tt.status || len(report.Checks) != 1 || report.Checks["output"] != want {
+			t.Errorf("/healthz = %s, want status %s and output %q", body, tt.status, want)
+		}
+	}
+}
+
+func TestServer_LivezFailsWhenStalled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Every write hangs until its context ends
+	output := &componenttest.Output{Fail: func(ctx context.Context, env *envelope.Envelope) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	// Idle with nothing pending is not a stall
+	idle := component.New(componenttest.NewInput(), output)
+	go idle.Process(ctx, componenttest.NewInput(), output)
+	time.Sleep(300 * time.Millisecond)
+	if err := idle.Stalled(200 * time.Millisecond); err != nil {
+		t.Errorf("Stalled() while idle = %v", err)
+	}
+
+	input := componenttest.NewInput(envelope.New())
+	producer := component.New(input, output)
+	producer.Start(context.Background())
+
+	server := admin.NewServer(":8790", producer.Health)
+	server.SetLivenessCheck(func() error { return producer.Stalled(200 * time.Millisecond) })
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer server.Close(context.Background())
+
+	go producer.Process(ctx, input, output)
+	time.Sleep(100 * time.Millisecond)
+	if code, _ := probe(t, "/livez"); code != http.StatusOK {
+		t.Errorf("/livez within the stall timeout = %d, want 200", code)
+	}
+	time.Sleep(300 * time.Millisecond)
+	if code, _ := probe(t, "/livez"); code != http.StatusServiceUnavailable {
+		t.Errorf("/livez with a hung write = %d, want 503", code)
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer stopCancel()
+	producer.Stop(stopCtx)
+}
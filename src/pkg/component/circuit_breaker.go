@@ -0,0 +1,311 @@
+package component
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// Gate is implemented by outputs that can pause the pipeline. Wait blocks until the
+// output is ready for another envelope or ctx is cancelled.
+type Gate interface {
+	Wait(ctx context.Context) error
+}
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"    // writes flow normally
+	CircuitOpen     = "open"      // writes (and reads, via Wait) are paused until open_timeout passes
+	CircuitHalfOpen = "half_open" // a single probe write decides whether to close or reopen
+)
+
+// CircuitBreakerConfig defines when a circuit breaker trips
+type CircuitBreakerConfig struct {
+	Window           string  `json:"window,omitempty"`            // Period over which the failure rate is measured (default: 60s)
+	FailureThreshold float64 `json:"failure_threshold,omitempty"` // Failure rate that opens the circuit, 0-1 (default: 0.5)
+	MinRequests      int     `json:"min_requests,omitempty"`      // Writes needed in the window before the rate counts (default: 10)
+	OpenTimeout      string  `json:"open_timeout,omitempty"`      // How long the circuit stays open before a probe (default: 30s)
+}
+
+// circuitBuckets splits the window so old results age out gradually
+const circuitBuckets = 10
+
+// minCircuitWindow keeps every bucket at least a millisecond wide
+const minCircuitWindow = circuitBuckets * time.Millisecond
+
+type circuitBucket struct {
+	start     time.Time
+	successes int
+	failures  int
+}
+
+// CircuitBreaker wraps an Output and stops writing to it while it keeps failing. While the
+// circuit is open, Write and Wait block until a probe is allowed, so the pipeline stops
+// reading instead of burning retries on envelopes that cannot be delivered. Permanent
+// errors mean the destination is up and count as successes.
+type CircuitBreaker struct {
+	output      Output
+	name        string
+	window      time.Duration
+	threshold   float64
+	minRequests int
+	openTimeout time.Duration
+	now         func() time.Time
+
+	mu        sync.Mutex
+	state     string
+	buckets   [circuitBuckets]circuitBucket
+	openUntil time.Time
+	probing   bool
+	changed   chan struct{} // Closed and replaced on every state change
+}
+
+// NewCircuitBreaker wraps output; name identifies it in logs
+func NewCircuitBreaker(output Output, name string, config CircuitBreakerConfig) (*CircuitBreaker, error) {
+	b := &CircuitBreaker{
+		output:      output,
+		name:        name,
+		window:      60 * time.Second,
+		threshold:   config.FailureThreshold,
+		minRequests: config.MinRequests,
+		openTimeout: 30 * time.Second,
+		now:         time.Now,
+		state:       CircuitClosed,
+		changed:     make(chan struct{}),
+	}
+	if config.Window != "" {
+		d, err := time.ParseDuration(config.Window)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid circuit breaker window %q", config.Window)
+		}
+		if d < minCircuitWindow {
+			return nil, fmt.Errorf("circuit breaker window must be at least %s", minCircuitWindow)
+		}
+		b.window = d
+	}
+	if config.OpenTimeout != "" {
+		d, err := time.ParseDuration(config.OpenTimeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid circuit breaker open_timeout %q", config.OpenTimeout)
+		}
+		b.openTimeout = d
+	}
+	if b.threshold == 0 {
+		b.threshold = 0.5
+	}
+	if b.threshold < 0 || b.threshold > 1 {
+		return nil, fmt.Errorf("circuit breaker failure_threshold must be between 0 and 1")
+	}
+	if b.minRequests <= 0 {
+		b.minRequests = 10
+	}
+	return b, nil
+}
+
+// Start starts the wrapped output
+func (b *CircuitBreaker) Start(ctx context.Context) error {
+	return b.output.Start(ctx)
+}
+
+// SetPipeline passes the pipeline name to the wrapped output
+func (b *CircuitBreaker) SetPipeline(name string) {
+	if member, ok := b.output.(PipelineMember); ok {
+		member.SetPipeline(name)
+	}
+}
+
+// Close closes the wrapped output
+func (b *CircuitBreaker) Close() error {
+	return b.output.Close()
+}
+
+// Write passes the envelope to the wrapped output, waiting first while the circuit is open
+func (b *CircuitBreaker) Write(ctx context.Context, env *envelope.Envelope) error {
+	probe, err := b.acquire(ctx, true)
+	if err != nil {
+		return err
+	}
+	err = b.output.Write(ctx, env)
+	b.result(ctx, probe, err)
+	return err
+}
+
+// WriteBatch passes the batch to the wrapped output, or writes the envelopes one at a time
+// if it cannot take batches. The batch counts as a single write.
+func (b *CircuitBreaker) WriteBatch(ctx context.Context, envs []*envelope.Envelope) error {
+	probe, err := b.acquire(ctx, true)
+	if err != nil {
+		return err
+	}
+	if batchOutput, ok := b.output.(BatchOutput); ok {
+		err = batchOutput.WriteBatch(ctx, envs)
+	} else {
+		failed := make(map[int]error)
+		for i, env := range envs {
+			if err := b.output.Write(ctx, env); err != nil {
+				failed[i] = err
+			}
+		}
+		err = NewBatchError(failed)
+	}
+	b.result(ctx, probe, err)
+	return err
+}
+
+// Wait blocks while the circuit is open. The pipeline calls it before reading so no
+// envelope is taken from the input while it cannot be delivered.
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	_, err := b.acquire(ctx, false)
+	return err
+}
+
+// State returns closed, open or half_open
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Health reports the circuit as unhealthy unless it is closed
+func (b *CircuitBreaker) Health() HealthStatus {
+	if b.State() == CircuitClosed {
+		return HealthHealthy
+	}
+	return HealthUnhealthy
+}
+
+// CheckHealth fails while the circuit is not closed, otherwise it asks the wrapped output
+func (b *CircuitBreaker) CheckHealth(ctx context.Context) error {
+	if state := b.State(); state != CircuitClosed {
+		return fmt.Errorf("circuit breaker %s", state)
+	}
+	if checker, ok := b.output.(HealthChecker); ok {
+		return checker.CheckHealth(ctx)
+	}
+	return nil
+}
+
+// acquire waits until a write may go ahead. In half-open state only one probe is let
+// through; with probe set the caller becomes that probe.
+func (b *CircuitBreaker) acquire(ctx context.Context, probe bool) (bool, error) {
+	for {
+		b.mu.Lock()
+		var wait <-chan time.Time
+		switch b.state {
+		case CircuitClosed:
+			b.mu.Unlock()
+			return false, nil
+		case CircuitOpen:
+			remaining := b.openUntil.Sub(b.now())
+			if remaining <= 0 {
+				b.setState(CircuitHalfOpen)
+				b.mu.Unlock()
+				continue
+			}
+			wait = time.After(remaining)
+		case CircuitHalfOpen:
+			if !b.probing {
+				b.probing = probe
+				b.mu.Unlock()
+				return probe, nil
+			}
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-changed:
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+}
+
+// result records the outcome of a write. A write cut short by its context says nothing
+// about the destination: it is not counted, and a cancelled probe leaves the circuit
+// half-open for the next write to probe again.
+func (b *CircuitBreaker) result(ctx context.Context, probe bool, err error) {
+	if ctx.Err() != nil {
+		if probe {
+			b.mu.Lock()
+			b.probing = false
+			b.notify()
+			b.mu.Unlock()
+		}
+		return
+	}
+	b.record(probe, err != nil && !IsPermanent(err))
+}
+
+// record adds a write result and moves between states
+func (b *CircuitBreaker) record(probe, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if probe {
+		b.probing = false
+		if failed {
+			b.open(1)
+			return
+		}
+		b.buckets = [circuitBuckets]circuitBucket{}
+		b.setState(CircuitClosed)
+		slog.Info("Circuit breaker closed", "output", b.name)
+		return
+	}
+	if b.state != CircuitClosed {
+		// Writes that started before the circuit opened do not change its state
+		return
+	}
+
+	now := b.now()
+	width := b.window / circuitBuckets
+	current := &b.buckets[now.UnixNano()/int64(width)%circuitBuckets]
+	if start := now.Truncate(width); !current.start.Equal(start) {
+		*current = circuitBucket{start: start}
+	}
+	if failed {
+		current.failures++
+	} else {
+		current.successes++
+	}
+
+	var successes, failures int
+	for _, bucket := range b.buckets {
+		if now.Sub(bucket.start) < b.window {
+			successes += bucket.successes
+			failures += bucket.failures
+		}
+	}
+	total := successes + failures
+	if failed && total >= b.minRequests && float64(failures)/float64(total) >= b.threshold {
+		b.open(float64(failures) / float64(total))
+	}
+}
+
+// open trips the circuit for open_timeout
+func (b *CircuitBreaker) open(failureRate float64) {
+	b.openUntil = b.now().Add(b.openTimeout)
+	b.setState(CircuitOpen)
+	slog.Warn("Circuit breaker opened, pausing writes",
+		"output", b.name,
+		"failure_rate", failureRate,
+		"retry_in", b.openTimeout)
+}
+
+// setState changes the state and wakes everyone waiting; the caller holds mu
+func (b *CircuitBreaker) setState(state string) {
+	b.state = state
+	b.notify()
+}
+
+// notify wakes everyone waiting on the circuit; the caller holds mu
+func (b *CircuitBreaker) notify() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
@@ -0,0 +1,190 @@
+package component_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+var errUnavailable = errors.New("service unavailable")
+
+// newBreaker wraps output in a breaker that opens at half of 4 or more writes failing
+func newBreaker(t *testing.T, output component.Output) *component.CircuitBreaker {
+	t.Helper()
+	breaker, err := component.NewCircuitBreaker(output, "test", component.CircuitBreakerConfig{
+		Window:           "10s",
+		FailureThreshold: 0.5,
+		MinRequests:      4,
+		OpenTimeout:      "100ms",
+	})
+	if err != nil {
+		t.Fatalf("NewCircuitBreaker() error = %v", err)
+	}
+	return breaker
+}
+
+func breakerWrite(breaker *component.CircuitBreaker, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	env := envelope.New()
+	env.ID = "msg-cb"
+	return breaker.Write(ctx, env)
+}
+
+func TestNewCircuitBreaker_Invalid(t *testing.T) {
+	tests := map[string]component.CircuitBreakerConfig{
+		"bad window":       {Window: "forever"},
+		"bad open_timeout": {OpenTimeout: "-1s"},
+		"bad threshold":    {FailureThreshold: 1.5},
+		"window too short": {Window: "5ns"},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := component.NewCircuitBreaker(&componenttest.Output{}, "test", config); err == nil {
+				t.Error("NewCircuitBreaker() should fail")
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	var healthy atomic.Bool
+	var writes atomic.Int32
+	breaker := newBreaker(t, &componenttest.Output{Fail: func(ctx context.Context, env *envelope.Envelope) error {
+		writes.Add(1)
+		if healthy.Load() {
+			return nil
+		}
+		return errUnavailable
+	}})
+
+	// Below min_requests the breaker stays closed despite every write failing
+	for i := 0; i < 3; i++ {
+		if err := breakerWrite(breaker, time.Second); err == nil {
+			t.Fatal("Write() should fail against an unavailable output")
+		}
+	}
+	if breaker.State() != component.CircuitClosed {
+		t.Fatalf("State() = %s after 3 failures, want closed", breaker.State())
+	}
+	if err := breakerWrite(breaker, time.Second); err == nil {
+		t.Fatal("Write() should fail against an unavailable output")
+	}
+	if breaker.State() != component.CircuitOpen || breaker.Health() != component.HealthUnhealthy {
+		t.Fatalf("State() = %s, Health() = %s; want open and unhealthy", breaker.State(), breaker.Health())
+	}
+
+	// While open, writes wait instead of reaching the output
+	sent := writes.Load()
+	if err := breakerWrite(breaker, 20*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Write() while open error = %v, want the context deadline", err)
+	}
+	if writes.Load() != sent {
+		t.Error("Write() reached the output while the circuit was open")
+	}
+
+	// A failed probe reopens the circuit
+	if err := breakerWrite(breaker, time.Second); err == nil {
+		t.Fatal("Probe should fail against an unavailable output")
+	}
+	if breaker.State() != component.CircuitOpen {
+		t.Fatalf("State() = %s after a failed probe, want open", breaker.State())
+	}
+
+	// A successful probe closes it again
+	healthy.Store(true)
+	if err := breakerWrite(breaker, time.Second); err != nil {
+		t.Fatalf("Probe error = %v", err)
+	}
+	if breaker.State() != component.CircuitClosed || breaker.Health() != component.HealthHealthy {
+		t.Errorf("State() = %s, Health() = %s; want closed and healthy", breaker.State(), breaker.Health())
+	}
+}
+
+func TestCircuitBreaker_CancelledProbeStaysHalfOpen(t *testing.T) {
+	var hanging atomic.Bool
+	var writes atomic.Int32
+	breaker := newBreaker(t, &componenttest.Output{Fail: func(ctx context.Context, env *envelope.Envelope) error {
+		writes.Add(1)
+		if hanging.Load() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return errUnavailable
+	}})
+
+	for i := 0; i < 4; i++ {
+		breakerWrite(breaker, time.Second)
+	}
+	if breaker.State() != component.CircuitOpen {
+		t.Fatalf("State() = %s after 4 failures, want open", breaker.State())
+	}
+
+	// The probe hangs until its context expires, which must neither close nor reopen the circuit
+	hanging.Store(true)
+	if err := breakerWrite(breaker, 300*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Probe error = %v, want the context deadline", err)
+	}
+	if breaker.State() != component.CircuitHalfOpen {
+		t.Fatalf("State() = %s after a cancelled probe, want half_open", breaker.State())
+	}
+
+	// The next write becomes the probe instead of waiting forever
+	sent := writes.Load()
+	breakerWrite(breaker, 50*time.Millisecond)
+	if writes.Load() == sent {
+		t.Error("No probe was sent after the cancelled one")
+	}
+}
+
+func TestCircuitBreaker_PermanentErrorsDoNotTrip(t *testing.T) {
+	breaker := newBreaker(t, &componenttest.Output{Fail: func(ctx context.Context, env *envelope.Envelope) error {
+		return &component.PermanentError{Err: errors.New("bad request")}
+	}})
+
+	for i := 0; i < 6; i++ {
+		if err := breakerWrite(breaker, time.Second); !component.IsPermanent(err) {
+			t.Fatalf("Write() error = %v, want a permanent error", err)
+		}
+	}
+	if breaker.State() != component.CircuitClosed {
+		t.Errorf("State() = %s, rejected writes should not open the circuit", breaker.State())
+	}
+}
+
+func TestGenericProducer_PausesInputWhileOpen(t *testing.T) {
+	breaker := newBreaker(t, &componenttest.Output{Fail: func(ctx context.Context, env *envelope.Envelope) error {
+		return errUnavailable
+	}})
+	for i := 0; i < 4; i++ {
+		breakerWrite(breaker, time.Second)
+	}
+
+	producer := component.New(nil, nil)
+	if err := producer.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if producer.Health() != component.HealthHealthy {
+		t.Fatalf("Health() = %s before Process, want healthy", producer.Health())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	input := componenttest.NewInput()
+	go producer.Process(ctx, input, breaker)
+
+	time.Sleep(20 * time.Millisecond)
+	if producer.Health() != component.HealthUnhealthy {
+		t.Errorf("Health() = %s with the circuit open, want unhealthy", producer.Health())
+	}
+	<-ctx.Done()
+	if reads := input.Reads(); reads != 0 {
+		t.Errorf("Input read %d times while the circuit was open", reads)
+	}
+}
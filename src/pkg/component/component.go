@@ -18,6 +18,7 @@ type HealthStatus string
 const (
 	HealthHealthy   HealthStatus = "healthy"
 	HealthUnhealthy HealthStatus = "unhealthy"
+	HealthDraining  HealthStatus = "draining" // Finishing accepted work before stopping
 	HealthStopped   HealthStatus = "stopped"
 )
 
@@ -41,3 +42,10 @@ type Component interface {
 	// Health returns the current health status of the component
 	Health() HealthStatus
 }
+
+// HealthChecker is implemented by inputs and outputs that can tell whether they are
+// connected to their source or destination. The admin server uses it for readiness.
+type HealthChecker interface {
+	// CheckHealth returns nil when the component can do its work, or an error saying why not
+	CheckHealth(ctx context.Context) error
+}
@@ -0,0 +1,132 @@
+// Package componenttest provides an input and outputs that stand in for real components in
+// tests of the processing loop
+package componenttest
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// Input returns its envelopes in order, then blocks until the context ends
+type Input struct {
+	mu    sync.Mutex
+	envs  []*envelope.Envelope
+	reads atomic.Int32
+}
+
+// NewInput returns an Input that reads envs
+func NewInput(envs ...*envelope.Envelope) *Input {
+	return &Input{envs: envs}
+}
+
+func (i *Input) Start(context.Context) error { return nil }
+func (i *Input) Close() error                { return nil }
+
+func (i *Input) Read(ctx context.Context) (*envelope.Envelope, error) {
+	i.reads.Add(1)
+	i.mu.Lock()
+	if len(i.envs) > 0 {
+		env := i.envs[0]
+		i.envs = i.envs[1:]
+		i.mu.Unlock()
+		return env, nil
+	}
+	i.mu.Unlock()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// Remaining returns the number of envelopes not read yet
+func (i *Input) Remaining() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.envs)
+}
+
+// Reads returns how many times Read was called
+func (i *Input) Reads() int {
+	return int(i.reads.Load())
+}
+
+// Output records the envelopes written to it. Each write takes Delay, then fails with the
+// error Fail returns when Fail is set.
+type Output struct {
+	Delay time.Duration
+	Fail  func(ctx context.Context, env *envelope.Envelope) error
+
+	active  atomic.Int32
+	peak    atomic.Int32
+	mu      sync.Mutex
+	written []*envelope.Envelope
+}
+
+func (o *Output) Start(context.Context) error { return nil }
+func (o *Output) Close() error                { return nil }
+
+func (o *Output) Write(ctx context.Context, env *envelope.Envelope) error {
+	active := o.active.Add(1)
+	defer o.active.Add(-1)
+	for peak := o.peak.Load(); active > peak && !o.peak.CompareAndSwap(peak, active); peak = o.peak.Load() {
+	}
+	time.Sleep(o.Delay)
+
+	if o.Fail != nil {
+		if err := o.Fail(ctx, env); err != nil {
+			return err
+		}
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.written = append(o.written, env)
+	return nil
+}
+
+// Written returns the envelopes written so far, in the order their writes finished
+func (o *Output) Written() []*envelope.Envelope {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]*envelope.Envelope(nil), o.written...)
+}
+
+// Active returns the number of writes in progress
+func (o *Output) Active() int {
+	return int(o.active.Load())
+}
+
+// Peak returns the most writes that were ever in progress at once
+func (o *Output) Peak() int {
+	return int(o.peak.Load())
+}
+
+// BatchOutput is an Output that also takes batches. The envelopes of a batch are written
+// one after the other, and the ones Fail rejects are reported in a component.BatchError.
+type BatchOutput struct {
+	Output
+	batches []int // Guarded by Output.mu
+}
+
+func (b *BatchOutput) WriteBatch(ctx context.Context, envs []*envelope.Envelope) error {
+	b.mu.Lock()
+	b.batches = append(b.batches, len(envs))
+	b.mu.Unlock()
+
+	failed := make(map[int]error)
+	for i, env := range envs {
+		if err := b.Write(ctx, env); err != nil {
+			failed[i] = err
+		}
+	}
+	return component.NewBatchError(failed)
+}
+
+// Batches returns the size of each batch written so far
+func (b *BatchOutput) Batches() []int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]int(nil), b.batches...)
+}
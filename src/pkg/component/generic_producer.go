@@ -2,9 +2,19 @@ package component
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
 )
 
 // GenericProducer implements the Producer interface with pluggable I/O
@@ -12,8 +22,28 @@ type GenericProducer struct {
 	name   string
 	input  Input
 	output Output
+	config ProcessingConfig
 	mu     sync.RWMutex
 	health HealthStatus
+
+	pipeline    string // Pipeline label on metrics, empty outside a pipeline
+	inputLabel  string // Component label on input metrics, e.g. "http-input"
+	outputLabel string // Component label on output metrics, e.g. "nats-output"
+
+	stages              []Stage
+	deadLetter          Output // Receives envelopes that failed a stage or a write (optional)
+	deadLetterRetryable bool   // Dead-letter writes that failed after retries, not only permanent failures
+
+	stopping    bool               // Stop has been called; a later Process returns at once
+	stopReading context.CancelFunc // Ends the read loop
+	loopDone    chan struct{}      // Closed when the read loop has exited
+	inflight    sync.WaitGroup     // Workers still writing
+	abortWrites context.CancelFunc // Cancels in-flight writes once Stop gives up waiting
+
+	// Loop progress, for Stalled
+	lastRead  atomic.Int64 // UnixNano of the last envelope read
+	lastWrite atomic.Int64 // UnixNano of the last write that finished, delivered or not
+	pending   atomic.Int64 // Envelopes read but not yet written, filtered or dead-lettered
 }
 
 // New creates a new generic producer
@@ -22,7 +52,32 @@ func New(input Input, output Output) *GenericProducer {
 		name:   "VRSky-Producer",
 		input:  input,
 		output: output,
+		config: ProcessingConfig{Workers: 1},
 		health: HealthStopped,
+
+		inputLabel:  "input",
+		outputLabel: "output",
+	}
+}
+
+// SetTypes names the input and output types (e.g. "http", "nats") in metrics
+func (p *GenericProducer) SetTypes(inputType, outputType string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.inputLabel = inputType + "-input"
+	p.outputLabel = outputType + "-output"
+}
+
+// SetPipeline labels the producer's metrics, and those of its input, output and dead
+// letter output, with the name of the pipeline they run in. Call it after SetDeadLetter.
+func (p *GenericProducer) SetPipeline(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pipeline = name
+	for _, target := range []any{p.input, p.output, p.deadLetter} {
+		if member, ok := target.(PipelineMember); ok {
+			member.SetPipeline(name)
+		}
 	}
 }
 
@@ -54,46 +109,208 @@ func (p *GenericProducer) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop gracefully shuts down the producer
+// SetStages runs stages, in order, on every envelope between reading and writing it
+func (p *GenericProducer) SetStages(stages ...Stage) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stages = stages
+}
+
+// SetDeadLetter writes envelopes that a stage failed on, or that the output rejected
+// permanently, to output with LastError set. With retryable, envelopes the output still
+// failed to deliver after its retries are dead-lettered too. Process starts the dead
+// letter output and Stop closes it.
+func (p *GenericProducer) SetDeadLetter(output Output, retryable bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadLetter = output
+	p.deadLetterRetryable = retryable
+}
+
+// Stop drains and shuts down the producer. An input that implements Drainer stops
+// accepting messages while the ones it already holds are read and written; other inputs
+// stop being read at once. Envelopes already read are written before the input and output
+// are closed. Whatever is unfinished when ctx expires is abandoned.
 func (p *GenericProducer) Stop(ctx context.Context) error {
-	slog.Info("Producer stopping")
+	slog.Info("Producer draining")
 
 	p.mu.Lock()
-	p.health = HealthStopped
+	p.health = HealthDraining
+	p.stopping = true
+	input, output, deadLetter := p.input, p.output, p.deadLetter
+	stopReading, loopDone, abortWrites := p.stopReading, p.loopDone, p.abortWrites
 	p.mu.Unlock()
 
-	if p.input != nil {
-		if err := p.input.Close(); err != nil {
+	// Stop taking in new messages; the loop keeps reading what the input already accepted.
+	// Process registers its workers before publishing loopDone, so once the loop has
+	// exited no more workers can be added and waiting for them is safe.
+	drained := true
+	if loopDone != nil {
+		if drainer, ok := input.(Drainer); ok {
+			if err := drainer.Drain(ctx); err != nil {
+				slog.Warn("Failed to drain input", "error", err)
+			}
+		} else {
+			stopReading()
+		}
+		drained = waitFor(ctx, loopDone)
+		stopReading()
+	}
+
+	// Let the workers write what was read
+	if loopDone != nil && drained {
+		inflight := make(chan struct{})
+		go func() {
+			p.inflight.Wait()
+			close(inflight)
+		}()
+		drained = waitFor(ctx, inflight)
+	}
+	if !drained {
+		slog.Warn("Drain deadline passed, abandoning unfinished messages")
+	}
+	if abortWrites != nil {
+		abortWrites()
+	}
+
+	if input != nil {
+		if err := input.Close(); err != nil {
 			slog.Error("Failed to close input", "error", err)
 		}
 	}
 
-	if p.output != nil {
-		if err := p.output.Close(); err != nil {
+	if output != nil {
+		if err := output.Close(); err != nil {
 			slog.Error("Failed to close output", "error", err)
 		}
 	}
+	if deadLetter != nil {
+		if err := deadLetter.Close(); err != nil {
+			slog.Error("Failed to close dead letter output", "error", err)
+		}
+	}
 
+	p.mu.Lock()
+	p.health = HealthStopped
+	p.mu.Unlock()
+
+	slog.Info("Producer stopped", "drained", drained)
+	return nil
+}
+
+// Stalled returns an error when the loop holds envelopes it has read but neither a read
+// nor a write has finished for longer than threshold, e.g. because a write is hung. An
+// idle loop with nothing pending has not stalled.
+func (p *GenericProducer) Stalled(threshold time.Duration) error {
+	pending := p.pending.Load()
+	if pending <= 0 {
+		return nil
+	}
+	last := max(p.lastRead.Load(), p.lastWrite.Load())
+	if idle := time.Since(time.Unix(0, last)); idle > threshold {
+		return fmt.Errorf("no progress for %s with %d messages pending", idle.Round(time.Second), pending)
+	}
 	return nil
 }
 
+// waitFor reports whether done was closed before ctx expired
+func waitFor(ctx context.Context, done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
 // Health returns the current health status
 func (p *GenericProducer) Health() HealthStatus {
 	p.mu.RLock()
-	defer p.mu.RUnlock()
-	return p.health
+	health, output := p.health, p.output
+	p.mu.RUnlock()
+
+	// An output that cannot take writes (e.g. an open circuit breaker) makes the producer unhealthy
+	if checker, ok := output.(interface{ Health() HealthStatus }); ok && health == HealthHealthy {
+		return checker.Health()
+	}
+	return health
 }
 
-// Configure sets up the producer configuration
+// Configure sets up the producer configuration from a ProcessingConfig JSON object
 func (p *GenericProducer) Configure(config []byte) error {
-	slog.Debug("Producer configured", "config_size", len(config))
+	processing := ProcessingConfig{}
+	if len(config) > 0 {
+		if err := json.Unmarshal(config, &processing); err != nil {
+			return fmt.Errorf("parse processing config: %w", err)
+		}
+	}
+	if err := processing.Validate(); err != nil {
+		return fmt.Errorf("processing config: %w", err)
+	}
+	if processing.Workers == 0 {
+		processing.Workers = 1
+	}
+
+	p.mu.Lock()
+	p.config = processing
+	p.mu.Unlock()
+
+	slog.Debug("Producer configured",
+		"workers", processing.Workers,
+		"order_by", processing.OrderBy,
+		"batch", processing.Batch != nil)
 	return nil
 }
 
-// Process runs the main producer loop: read from input, write to output
+// Process starts the input and output and runs the main producer loop: read from input,
+// write to output on the configured number of workers. It returns when ctx is cancelled or
+// Stop has drained the input. Writes that have started are not cancelled with ctx; Stop
+// waits for them. Process called after Stop returns at once.
 func (p *GenericProducer) Process(ctx context.Context, input Input, output Output) error {
+	readCtx, stopReading := context.WithCancel(ctx)
+	defer stopReading()
+	writeCtx, abortWrites := context.WithCancel(context.WithoutCancel(ctx))
+	loopDone := make(chan struct{})
+	defer close(loopDone)
+
+	// Batch only when the output can take batches
+	batchOutput, _ := output.(BatchOutput)
+	gate, _ := output.(Gate)
+
+	p.mu.Lock()
+	if p.stopping {
+		p.mu.Unlock()
+		abortWrites()
+		return nil
+	}
+	config := p.config
+	pipeline, inputLabel, outputLabel := p.pipeline, p.inputLabel, p.outputLabel
+	stages, deadLetter := p.stages, p.deadLetter
+	limits := unbatched
+	if config.Batch != nil {
+		if batchOutput != nil {
+			limits, _ = config.Batch.limits() // Validated by Configure
+		} else {
+			slog.Warn("Output does not support batches, writing envelopes one at a time")
+		}
+	}
+	// The workers join inflight under mu, before Stop can see loopDone and wait for them
+	pool := newWorkerPool(config.Workers, limits, func(envs []*envelope.Envelope) {
+		if len(envs) > 1 {
+			p.writeBatch(writeCtx, batchOutput, outputLabel, envs)
+		} else {
+			p.write(writeCtx, output, outputLabel, envs[0])
+		}
+		p.lastWrite.Store(time.Now().UnixNano())
+		p.pending.Add(-int64(len(envs)))
+	}, &p.inflight)
+	defer pool.close()
 	p.input = input
 	p.output = output
+	p.stopReading = stopReading
+	p.loopDone = loopDone
+	p.abortWrites = abortWrites
+	p.mu.Unlock()
 
 	// Start the input (connects to source)
 	if err := input.Start(ctx); err != nil {
@@ -104,33 +321,181 @@ func (p *GenericProducer) Process(ctx context.Context, input Input, output Outpu
 	if err := output.Start(ctx); err != nil {
 		return fmt.Errorf("failed to start output: %w", err)
 	}
+	if deadLetter != nil {
+		if err := deadLetter.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start dead letter output: %w", err)
+		}
+	}
+
+	// A new loop has not stalled, however long the last one was idle
+	p.lastRead.Store(time.Now().UnixNano())
+	p.lastWrite.Store(time.Now().UnixNano())
 
-	slog.Info("Producer starting main loop")
+	slog.Info("Producer starting main loop",
+		"workers", config.Workers,
+		"order_by", config.OrderBy,
+		"batch_size", limits.maxSize)
 
 	for {
 		select {
-		case <-ctx.Done():
-			slog.Info("Producer context cancelled")
+		case <-readCtx.Done():
+			slog.Info("Producer stopped reading")
 			return ctx.Err()
 		default:
 		}
 
+		// Hold off reading while the output is paused
+		if gate != nil {
+			if err := gate.Wait(readCtx); err != nil {
+				return nil // Context cancelled, exit gracefully
+			}
+		}
+
 		// Read message from input
-		env, err := input.Read(ctx)
+		env, err := input.Read(readCtx)
 		if err != nil {
-			if ctx.Err() != nil {
+			if errors.Is(err, ErrInputDrained) {
+				slog.Info("Input drained")
+				return nil
+			}
+			if readCtx.Err() != nil {
 				return nil // Context cancelled, exit gracefully
 			}
 			slog.Error("Failed to read from input", "error", err)
 			continue
 		}
 
-		// Write message to output
-		if err := output.Write(ctx, env); err != nil {
-			slog.Error("Failed to write to output",
-				"message_id", env.ID,
-				"error", err)
-			// Continue processing next message (error already logged and retried by output)
+		p.lastRead.Store(time.Now().UnixNano())
+		p.pending.Add(1)
+		metrics.Received(pipeline, inputLabel, env)
+		// The process span starts once the envelope is read, so it can continue the trace the
+		// envelope carries, and lasts until a worker takes the envelope
+		spanCtx, span := tracing.Start(ctx, inputLabel+" process", trace.SpanKindConsumer, env)
+		next, err := runStages(spanCtx, stages, env)
+		if err != nil {
+			tracing.End(span, err)
+			slog.Error("Stage failed", "message_id", env.ID, "error", err)
+			p.sendToDeadLetter(writeCtx, inputLabel, env, err)
+			p.pending.Add(-1)
+			continue
+		}
+		if next == nil {
+			span.End()
+			metrics.Dropped(pipeline, inputLabel, env, "filtered")
+			slog.Debug("Envelope filtered out", "message_id", env.ID)
+			p.pending.Add(-1)
+			continue
+		}
+		pool.dispatch(FieldValue(next, config.OrderBy), next)
+		span.End()
+	}
+}
+
+// runStages passes env through each stage in turn; nil means a stage dropped it
+func runStages(ctx context.Context, stages []Stage, env *envelope.Envelope) (*envelope.Envelope, error) {
+	for i, stage := range stages {
+		next, err := stage.Process(ctx, env)
+		if err != nil {
+			return nil, fmt.Errorf("stage %d: %w", i+1, err)
+		}
+		if next == nil {
+			return nil, nil
+		}
+		env = next
+	}
+	return env, nil
+}
+
+// sendToDeadLetter writes env to the dead letter output, or drops it when there is none
+func (p *GenericProducer) sendToDeadLetter(ctx context.Context, component string, env *envelope.Envelope, cause error) {
+	p.mu.RLock()
+	deadLetter, pipeline := p.deadLetter, p.pipeline
+	p.mu.RUnlock()
+
+	env.LastError = cause.Error()
+	if deadLetter == nil {
+		metrics.Dropped(pipeline, component, env, "failed")
+		return
+	}
+	if err := deadLetter.Write(ctx, env); err != nil {
+		metrics.Dropped(pipeline, component, env, "dead_letter_failed")
+		slog.Error("Failed to write to dead letter output", "message_id", env.ID, "error", err)
+		return
+	}
+	slog.Warn("Sent envelope to dead letter output", "message_id", env.ID, "error", cause)
+}
+
+// deadLetterFailed sends an envelope whose write failed with err to the dead letter
+// output, if the failure is one that should be dead-lettered
+func (p *GenericProducer) deadLetterFailed(ctx context.Context, component string, env *envelope.Envelope, err error) {
+	p.mu.RLock()
+	deadLetter, retryable := p.deadLetter, p.deadLetterRetryable
+	p.mu.RUnlock()
+	if deadLetter == nil || !(IsPermanent(err) || retryable) {
+		return
+	}
+	p.sendToDeadLetter(ctx, component, env, err)
+}
+
+// write sends one envelope to the output
+func (p *GenericProducer) write(ctx context.Context, output Output, component string, env *envelope.Envelope) {
+	p.mu.RLock()
+	pipeline := p.pipeline
+	p.mu.RUnlock()
+
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, component+" write", trace.SpanKindProducer, env)
+	err := output.Write(ctx, env)
+	tracing.End(span, err)
+	if err != nil {
+		metrics.Failed(pipeline, component, env, IsPermanent(err), time.Since(start))
+		slog.Error("Failed to write to output",
+			"message_id", env.ID,
+			"trace_id", env.TraceID,
+			"permanent", IsPermanent(err),
+			"error", err)
+		// Continue processing next message (error already logged and retried by output)
+		p.deadLetterFailed(ctx, component, env, err)
+		return
+	}
+	metrics.Written(pipeline, component, env, time.Since(start))
+}
+
+// writeBatch sends a batch of envelopes to the output. Every envelope in the batch gets
+// its own span, and is traced and counted with its own outcome and the batch's latency.
+// Only the envelopes that failed are dead-lettered.
+func (p *GenericProducer) writeBatch(ctx context.Context, output BatchOutput, component string, envs []*envelope.Envelope) {
+	p.mu.RLock()
+	pipeline := p.pipeline
+	p.mu.RUnlock()
+
+	start := time.Now()
+	spans := make([]trace.Span, len(envs))
+	for i, env := range envs {
+		_, spans[i] = tracing.Start(ctx, component+" write", trace.SpanKindProducer, env)
+	}
+	err := output.WriteBatch(ctx, envs)
+	elapsed := time.Since(start)
+	failed := BatchFailures(err, len(envs))
+	for i, env := range envs {
+		tracing.End(spans[i], failed[i])
+		if failed[i] != nil {
+			metrics.Failed(pipeline, component, env, IsPermanent(failed[i]), elapsed)
+		} else {
+			metrics.Written(pipeline, component, env, elapsed)
+		}
+	}
+	if err != nil {
+		slog.Error("Failed to write batch to output",
+			"batch_size", len(envs),
+			"failed", len(failed),
+			"first_message_id", envs[0].ID,
+			"permanent", IsPermanent(err),
+			"error", err)
+		for i, env := range envs {
+			if failed[i] != nil {
+				p.deadLetterFailed(ctx, component, env, failed[i])
+			}
 		}
 	}
 }
@@ -0,0 +1,109 @@
+package component_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestGenericProducer_Configure(t *testing.T) {
+	tests := map[string]string{
+		"negative workers": `{"workers":-1}`,
+		"unknown order_by": `{"order_by":"payload.id"}`,
+		"empty metadata":   `{"order_by":"metadata."}`,
+		"invalid json":     `{"workers":`,
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := component.New(nil, nil).Configure([]byte(config)); err == nil {
+				t.Error("Configure() should fail")
+			}
+		})
+	}
+	if err := component.New(nil, nil).Configure(nil); err != nil {
+		t.Errorf("Configure(nil) error = %v", err)
+	}
+}
+
+func TestGenericProducer_StopWhileProcessStarts(t *testing.T) {
+	// Stop may run before, during or after Process registers its workers
+	for i := 0; i < 50; i++ {
+		input := componenttest.NewInput()
+		output := &componenttest.Output{}
+		producer := component.New(input, output)
+		if err := producer.Configure([]byte(`{"workers":4}`)); err != nil {
+			t.Fatalf("Configure() error = %v", err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			producer.Process(ctx, input, output)
+			close(done)
+		}()
+		producer.Stop(context.Background())
+		cancel()
+		<-done
+	}
+
+	// Process after Stop returns at once instead of reading
+	input := componenttest.NewInput(envelope.New())
+	output := &componenttest.Output{}
+	producer := component.New(input, output)
+	producer.Stop(context.Background())
+	if err := producer.Process(context.Background(), input, output); err != nil {
+		t.Errorf("Process() after Stop error = %v", err)
+	}
+	if input.Remaining() != 1 {
+		t.Error("Process() read from the input after Stop")
+	}
+}
+
+func TestGenericProducer_DeadLettersOnlyFailedBatchEnvelopes(t *testing.T) {
+	var envs []*envelope.Envelope
+	for i := 0; i < 4; i++ {
+		env := envelope.New()
+		env.ID = fmt.Sprintf("msg-%d", i)
+		envs = append(envs, env)
+	}
+	input := componenttest.NewInput(envs...)
+	// Every other envelope is rejected
+	output := &componenttest.BatchOutput{Output: componenttest.Output{
+		Fail: func(ctx context.Context, env *envelope.Envelope) error {
+			if env.ID == "msg-1" || env.ID == "msg-3" {
+				return &component.PermanentError{Err: fmt.Errorf("%s rejected", env.ID)}
+			}
+			return nil
+		},
+	}}
+	deadLetter := &componenttest.Output{}
+
+	producer := component.New(input, output)
+	if err := producer.Configure([]byte(`{"batch":{"max_size":4,"linger":"50ms"}}`)); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	producer.SetDeadLetter(deadLetter, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	producer.Process(ctx, input, output)
+	producer.Stop(context.Background())
+
+	written, deadLettered := ids(output.Written()), ids(deadLetter.Written())
+	if fmt.Sprint(written) != "[msg-0 msg-2]" || fmt.Sprint(deadLettered) != "[msg-1 msg-3]" {
+		t.Errorf("Written %v and dead-lettered %v, want msg-0 and msg-2 written and the others dead-lettered",
+			written, deadLettered)
+	}
+}
+
+// ids returns the IDs of envs in order
+func ids(envs []*envelope.Envelope) []string {
+	ids := make([]string, len(envs))
+	for i, env := range envs {
+		ids[i] = env.ID
+	}
+	return ids
+}
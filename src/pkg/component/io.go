@@ -2,6 +2,10 @@ package component
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/ValueRetail/vrsky/pkg/envelope"
 )
@@ -21,6 +25,17 @@ type Input interface {
 	Close() error
 }
 
+// Drainer is implemented by inputs that can stop accepting new messages while still
+// handing out the ones they have already accepted. After Drain, Read returns buffered
+// messages and then ErrInputDrained.
+type Drainer interface {
+	// Drain stops accepting messages, waiting up to ctx for work in progress to be buffered.
+	Drain(ctx context.Context) error
+}
+
+// ErrInputDrained is returned by Read once a drained input has no messages left
+var ErrInputDrained = errors.New("input drained")
+
 // Output defines the interface for writing messages to external systems or queues.
 // Implementations include HTTP clients, NATS publishers, file writers, etc.
 type Output interface {
@@ -29,9 +44,105 @@ type Output interface {
 	Start(ctx context.Context) error
 
 	// Write sends an envelope to the output destination.
-	// Returns an error if the output fails.
+	// Returns an error if the output fails, a *PermanentError if retrying cannot help.
 	Write(ctx context.Context, env *envelope.Envelope) error
 
 	// Close gracefully shuts down the output destination.
 	Close() error
 }
+
+// BatchOutput is implemented by outputs that can deliver many envelopes in one operation,
+// such as a bulk API call. The pipeline uses WriteBatch when batching is configured.
+type BatchOutput interface {
+	Output
+
+	// WriteBatch sends the envelopes together, in order. Returns an error if any of them
+	// failed: a *BatchError (see NewBatchError) saying which ones, or any other error when
+	// the whole batch failed. It is a *PermanentError if retrying the failures cannot help.
+	WriteBatch(ctx context.Context, envs []*envelope.Envelope) error
+}
+
+// PipelineMember is implemented by inputs and outputs that record metrics of their own,
+// so they can label them with the pipeline they run in
+type PipelineMember interface {
+	SetPipeline(name string)
+}
+
+// Stage transforms or filters envelopes between the input and the output
+type Stage interface {
+	// Process returns the envelope to pass on, which may be env itself, or nil to drop it.
+	// An error sends the envelope to the dead letter output, if there is one.
+	Process(ctx context.Context, env *envelope.Envelope) (*envelope.Envelope, error)
+}
+
+// PermanentError marks a write failure that retrying cannot fix, such as a request the
+// destination rejected as invalid. Callers should dead-letter the envelope rather than
+// redeliver it.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// IsPermanent reports whether err, or any error it wraps, is a PermanentError
+func IsPermanent(err error) bool {
+	var permanent *PermanentError
+	return errors.As(err, &permanent)
+}
+
+// BatchError reports which envelopes of a batch failed. Envelopes not in Failed were
+// delivered.
+type BatchError struct {
+	Failed map[int]error // Errors by the envelope's index in the batch
+}
+
+func (e *BatchError) Error() string {
+	indexes := make([]int, 0, len(e.Failed))
+	for i := range e.Failed {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	messages := make([]string, len(indexes))
+	for n, i := range indexes {
+		messages[n] = fmt.Sprintf("message %d: %v", i, e.Failed[i])
+	}
+	return fmt.Sprintf("%d messages of the batch failed: %s", len(indexes), strings.Join(messages, "; "))
+}
+
+// NewBatchError returns nil when failed is empty, otherwise a *BatchError. The error is
+// permanent only when every failure is, so a batch with any retryable failure is retried.
+func NewBatchError(failed map[int]error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	err := &BatchError{Failed: failed}
+	for _, failure := range failed {
+		if !IsPermanent(failure) {
+			return err
+		}
+	}
+	return &PermanentError{Err: err}
+}
+
+// BatchFailures returns the error of each failed envelope in a batch of n that WriteBatch
+// returned err for. Without a *BatchError every envelope failed with err.
+func BatchFailures(err error, n int) map[int]error {
+	if err == nil {
+		return nil
+	}
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return batchErr.Failed
+	}
+	failed := make(map[int]error, n)
+	for i := 0; i < n; i++ {
+		failed[i] = err
+	}
+	return failed
+}
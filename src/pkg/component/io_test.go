@@ -0,0 +1,43 @@
+package component_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+)
+
+func TestNewBatchError(t *testing.T) {
+	rejected := &component.PermanentError{Err: errors.New("rejected")}
+	unavailable := errors.New("unavailable")
+
+	if err := component.NewBatchError(nil); err != nil {
+		t.Errorf("NewBatchError(nil) = %v, want nil", err)
+	}
+	if err := component.NewBatchError(map[int]error{1: rejected, 3: rejected}); !component.IsPermanent(err) {
+		t.Errorf("NewBatchError() = %v, want permanent when every failure is", err)
+	}
+	err := component.NewBatchError(map[int]error{3: unavailable, 1: rejected})
+	if component.IsPermanent(err) {
+		t.Errorf("NewBatchError() = %v, want retryable when any failure is", err)
+	}
+	if want := "2 messages of the batch failed: message 1: rejected; message 3: unavailable"; err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+}
+
+func TestBatchFailures(t *testing.T) {
+	unavailable := errors.New("unavailable")
+
+	if failed := component.BatchFailures(nil, 3); len(failed) != 0 {
+		t.Errorf("BatchFailures(nil) = %v, want none", failed)
+	}
+	if failed := component.BatchFailures(unavailable, 3); fmt.Sprint(failed) != "map[0:unavailable 1:unavailable 2:unavailable]" {
+		t.Errorf("BatchFailures() = %v, want every envelope failed", failed)
+	}
+	wrapped := fmt.Errorf("write batch: %w", component.NewBatchError(map[int]error{2: unavailable}))
+	if failed := component.BatchFailures(wrapped, 3); fmt.Sprint(failed) != "map[2:unavailable]" {
+		t.Errorf("BatchFailures() = %v, want only envelope 2", failed)
+	}
+}
@@ -0,0 +1,212 @@
+package component
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// ProcessingConfig controls how many envelopes a GenericProducer writes at once
+type ProcessingConfig struct {
+	Workers int `json:"workers,omitempty"` // Concurrent writes (default: 1)
+
+	// OrderBy keeps envelopes with the same key in order while others run in parallel:
+	// tenant_id, integration_id, metadata.<key> or header.<name>. Empty means no ordering.
+	OrderBy string `json:"order_by,omitempty"`
+
+	// Batch groups envelopes for outputs that implement BatchOutput
+	Batch *BatchConfig `json:"batch,omitempty"`
+}
+
+// BatchConfig limits the batches each worker collects. A batch is written when it reaches
+// MaxSize envelopes or MaxBytes of payload, or Linger after its first envelope arrived.
+type BatchConfig struct {
+	MaxSize  int    `json:"max_size,omitempty"`  // Envelopes per batch (default: 100)
+	MaxBytes int    `json:"max_bytes,omitempty"` // Payload bytes per batch (default: 1MB)
+	Linger   string `json:"linger,omitempty"`    // Longest wait for a batch to fill (default: 100ms)
+}
+
+// batchLimits are the parsed limits; a MaxSize of 1 writes every envelope on its own
+type batchLimits struct {
+	maxSize  int
+	maxBytes int
+	linger   time.Duration
+}
+
+// unbatched writes each envelope as soon as it arrives
+var unbatched = batchLimits{maxSize: 1}
+
+func (c *BatchConfig) limits() (batchLimits, error) {
+	limits := batchLimits{maxSize: c.MaxSize, maxBytes: c.MaxBytes, linger: 100 * time.Millisecond}
+	if limits.maxSize < 0 || limits.maxBytes < 0 {
+		return limits, fmt.Errorf("batch max_size and max_bytes must not be negative")
+	}
+	if limits.maxSize == 0 {
+		limits.maxSize = 100
+	}
+	if limits.maxBytes == 0 {
+		limits.maxBytes = 1 << 20
+	}
+	if c.Linger != "" {
+		d, err := time.ParseDuration(c.Linger)
+		if err != nil || d <= 0 {
+			return limits, fmt.Errorf("invalid batch linger %q", c.Linger)
+		}
+		limits.linger = d
+	}
+	return limits, nil
+}
+
+// Validate checks the configuration; Configure calls it
+func (c ProcessingConfig) Validate() error {
+	if c.Workers < 0 {
+		return fmt.Errorf("workers must not be negative")
+	}
+	if c.Batch != nil {
+		if _, err := c.Batch.limits(); err != nil {
+			return err
+		}
+	}
+	if c.OrderBy != "" && !ValidField(c.OrderBy) {
+		return fmt.Errorf("unsupported order_by %q (must be tenant_id, integration_id, metadata.<key> or header.<name>)", c.OrderBy)
+	}
+	return nil
+}
+
+// ValidField reports whether FieldValue can look up field
+func ValidField(field string) bool {
+	switch {
+	case field == "tenant_id", field == "integration_id":
+	case strings.HasPrefix(field, "metadata.") && len(field) > len("metadata."):
+	case strings.HasPrefix(field, "header.") && len(field) > len("header."):
+	default:
+		return false
+	}
+	return true
+}
+
+// FieldValue returns an envelope field used for ordering and filtering: tenant_id,
+// integration_id, metadata.<key> or header.<name>. It is empty when env has no value.
+func FieldValue(env *envelope.Envelope, field string) string {
+	switch {
+	case field == "tenant_id":
+		return env.TenantID
+	case field == "integration_id":
+		return env.IntegrationID
+	case strings.HasPrefix(field, "metadata."):
+		return env.Metadata[strings.TrimPrefix(field, "metadata.")]
+	case strings.HasPrefix(field, "header."):
+		// The HTTP input stores headers listed in metadata_headers under their lowercase name
+		return env.Metadata["header."+strings.ToLower(strings.TrimPrefix(field, "header."))]
+	}
+	return ""
+}
+
+// workerPool runs write on a fixed number of goroutines. Envelopes with a key always go to
+// the same worker, which handles them one at a time, so their order is kept. Envelopes
+// without a key go to whichever worker is free. Each worker collects its envelopes into
+// batches within the pool's limits.
+type workerPool struct {
+	shared chan *envelope.Envelope
+	keyed  []chan *envelope.Envelope
+	limits batchLimits
+}
+
+// newWorkerPool starts n workers, adding them to wg so the caller can wait for them to drain
+func newWorkerPool(n int, limits batchLimits, write func([]*envelope.Envelope), wg *sync.WaitGroup) *workerPool {
+	pool := &workerPool{
+		shared: make(chan *envelope.Envelope),
+		keyed:  make([]chan *envelope.Envelope, n),
+		limits: limits,
+	}
+	for i := range pool.keyed {
+		queue := make(chan *envelope.Envelope)
+		pool.keyed[i] = queue
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pool.run(queue, write)
+		}()
+	}
+	return pool
+}
+
+// run writes envelopes from the worker's own queue and the shared one until both are
+// closed, then writes whatever batch is still pending
+func (pool *workerPool) run(queue chan *envelope.Envelope, write func([]*envelope.Envelope)) {
+	var (
+		batch  []*envelope.Envelope
+		bytes  int
+		timer  *time.Timer
+		linger <-chan time.Time
+	)
+	flush := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, linger = nil, nil
+		}
+		if len(batch) > 0 {
+			write(batch)
+			batch, bytes = nil, 0
+		}
+	}
+	add := func(env *envelope.Envelope) {
+		// An envelope that would overflow max_bytes starts the next batch
+		if len(batch) > 0 && pool.limits.maxBytes > 0 && bytes+len(env.Payload) > pool.limits.maxBytes {
+			flush()
+		}
+		batch = append(batch, env)
+		bytes += len(env.Payload)
+		if len(batch) >= pool.limits.maxSize {
+			flush()
+		} else if timer == nil {
+			timer = time.NewTimer(pool.limits.linger)
+			linger = timer.C
+		}
+	}
+
+	shared := pool.shared
+	for queue != nil || shared != nil {
+		select {
+		case env, ok := <-queue:
+			if !ok {
+				queue = nil
+				continue
+			}
+			add(env)
+		case env, ok := <-shared:
+			if !ok {
+				shared = nil
+				continue
+			}
+			add(env)
+		case <-linger:
+			timer, linger = nil, nil
+			flush()
+		}
+	}
+	flush()
+}
+
+// dispatch hands env to a worker, blocking until one takes it
+func (pool *workerPool) dispatch(key string, env *envelope.Envelope) {
+	if key == "" {
+		pool.shared <- env
+		return
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	pool.keyed[hash.Sum32()%uint32(len(pool.keyed))] <- env
+}
+
+// close stops accepting envelopes; workers exit once they have written what they hold
+func (pool *workerPool) close() {
+	close(pool.shared)
+	for _, queue := range pool.keyed {
+		close(queue)
+	}
+}
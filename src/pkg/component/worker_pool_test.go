@@ -0,0 +1,107 @@
+package component_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestGenericProducer_WorkersKeepOrderPerKey(t *testing.T) {
+	var envs []*envelope.Envelope
+	for i := 0; i < 24; i++ {
+		env := envelope.New()
+		env.ID = fmt.Sprintf("msg-%02d", i)
+		env.IntegrationID = fmt.Sprintf("integration-%d", i%4)
+		envs = append(envs, env)
+	}
+	input := componenttest.NewInput(envs...)
+	output := &componenttest.Output{Delay: 20 * time.Millisecond}
+
+	producer := component.New(input, output)
+	if err := producer.Configure([]byte(`{"workers":8,"order_by":"integration_id"}`)); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		producer.Process(ctx, input, output)
+		close(done)
+	}()
+
+	// Stop while writes are still in flight; they must finish before Stop returns
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stopCancel()
+	<-done
+	producer.Stop(stopCtx)
+
+	read := 24 - input.Remaining()
+	written := output.Written()
+	if len(written) == 0 || len(written) != read {
+		t.Errorf("%d envelopes written, want all %d that were read", len(written), read)
+	}
+	if peak := output.Peak(); peak < 2 {
+		t.Errorf("Peak concurrency %d, want writes in parallel", peak)
+	}
+	for integration, ids := range idsBy(written, "integration_id") {
+		for i := 1; i < len(ids); i++ {
+			if ids[i] < ids[i-1] {
+				t.Errorf("%s written out of order: %v", integration, ids)
+				break
+			}
+		}
+	}
+	if output.Active() != 0 {
+		t.Error("Stop returned with writes still in flight")
+	}
+}
+
+func TestGenericProducer_Batches(t *testing.T) {
+	var envs []*envelope.Envelope
+	for i := 0; i < 11; i++ {
+		env := envelope.New()
+		env.ID = fmt.Sprintf("msg-%02d", i)
+		env.Payload = make([]byte, 100)
+		envs = append(envs, env)
+	}
+	input := componenttest.NewInput(envs...)
+	output := &componenttest.BatchOutput{}
+
+	producer := component.New(input, output)
+	if err := producer.Configure([]byte(`{"batch":{"max_size":5,"max_bytes":450,"linger":"50ms"}}`)); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	producer.Process(ctx, input, output)
+	producer.Stop(context.Background())
+
+	// max_bytes fills each batch at 4 envelopes, the rest go once the linger time passes
+	if batches, written := output.Batches(), output.Written(); fmt.Sprint(batches) != "[4 4 3]" || len(written) != 11 {
+		t.Errorf("Batches %v with %d envelopes written, want [4 4 3]", batches, len(written))
+	}
+}
+
+func TestBatchConfig_Invalid(t *testing.T) {
+	for _, config := range []string{`{"batch":{"max_size":-1}}`, `{"batch":{"linger":"later"}}`} {
+		if err := component.New(nil, nil).Configure([]byte(config)); err == nil {
+			t.Errorf("Configure(%s) should fail", config)
+		}
+	}
+}
+
+// idsBy groups the IDs of envs by the value of field, keeping their order
+func idsBy(envs []*envelope.Envelope, field string) map[string][]string {
+	ids := make(map[string][]string)
+	for _, env := range envs {
+		key := component.FieldValue(env, field)
+		ids[key] = append(ids[key], env.ID)
+	}
+	return ids
+}
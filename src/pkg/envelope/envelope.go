@@ -24,6 +24,13 @@ type Envelope struct {
 	CurrentStep int      `json:"current_step"` // Current position in pipeline
 	StepHistory []string `json:"step_history"` // Path through pipeline
 
+	// Metadata carries transport-specific attributes (e.g. original filename, headers)
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Tracing: the W3C traceparent of the step that last handled the envelope, and its trace ID
+	TraceParent string `json:"trace_parent,omitempty"`
+	TraceID     string `json:"trace_id,omitempty"`
+
 	// Timestamps
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
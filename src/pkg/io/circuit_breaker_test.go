@@ -0,0 +1,78 @@
+package io
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestNewOutput_InvalidCircuitBreaker(t *testing.T) {
+	tests := map[string]string{
+		"bad window":       `{"window":"forever"}`,
+		"bad open_timeout": `{"open_timeout":"-1s"}`,
+		"bad threshold":    `{"failure_threshold":1.5}`,
+		"window too short": `{"window":"5ns"}`,
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewOutput("http", []byte(`{"url":"http://example.com","circuit_breaker":`+config+`}`)); err == nil {
+				t.Error("NewOutput() should fail")
+			}
+		})
+	}
+
+	output, err := NewOutput("http", []byte(`{"url":"http://example.com"}`))
+	if err != nil {
+		t.Fatalf("NewOutput() error = %v", err)
+	}
+	if _, ok := output.(*component.CircuitBreaker); ok {
+		t.Error("Output wrapped without a circuit_breaker config")
+	}
+}
+
+func TestNewOutput_CircuitBreakerCountsUnavailableBackend(t *testing.T) {
+	var status atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer backend.Close()
+
+	output, err := NewOutput("http", []byte(`{"url":"`+backend.URL+`","retries":1,
+		"circuit_breaker":{"window":"10s","failure_threshold":0.5,"min_requests":4,"open_timeout":"100ms"}}`))
+	if err != nil {
+		t.Fatalf("NewOutput() error = %v", err)
+	}
+	breaker, ok := output.(*component.CircuitBreaker)
+	if !ok {
+		t.Fatalf("NewOutput() returned %T, want a circuit breaker", output)
+	}
+	write := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		env := envelope.New()
+		env.Payload = []byte(`{}`)
+		return breaker.Write(ctx, env)
+	}
+
+	// Rejected requests mean the backend is up, unavailable ones open the circuit
+	status.Store(http.StatusBadRequest)
+	for i := 0; i < 4; i++ {
+		write()
+	}
+	if breaker.State() != component.CircuitClosed {
+		t.Fatalf("State() = %s after 400 responses, want closed", breaker.State())
+	}
+	status.Store(http.StatusServiceUnavailable)
+	for i := 0; i < 4; i++ {
+		write()
+	}
+	if breaker.State() != component.CircuitOpen {
+		t.Errorf("State() = %s after 503 responses, want open", breaker.State())
+	}
+}
@@ -0,0 +1,173 @@
+package io
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported compression algorithms
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// compressionEncodingHeader is the NATS header carrying the compression algorithm
+const compressionEncodingHeader = "Content-Encoding"
+
+// defaultMaxDecompressedSize caps decompressed data unless configured otherwise (100MB)
+const defaultMaxDecompressedSize = int64(100 * 1024 * 1024)
+
+// errDecompressedTooLarge is returned when data expands beyond the configured maximum
+var errDecompressedTooLarge = errors.New("decompressed data exceeds maximum size")
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+// zstdWriter lazily creates the shared zstd encoder (safe for concurrent use)
+func zstdWriter() (*zstd.Encoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdErr
+}
+
+// normalizeCompression validates a configured algorithm; an empty value means no compression
+func normalizeCompression(algorithm string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(algorithm)) {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip, "gz":
+		return CompressionGzip, nil
+	case CompressionZstd, "zst":
+		return CompressionZstd, nil
+	default:
+		return "", fmt.Errorf("unsupported compression %q (must be none, gzip or zstd)", algorithm)
+	}
+}
+
+// compressionExtension returns the filename suffix (with leading dot) for an algorithm
+func compressionExtension(algorithm string) string {
+	switch algorithm {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// compressionFromExtension maps a filename suffix to an algorithm, or CompressionNone
+func compressionFromExtension(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".gz", ".gzip":
+		return CompressionGzip
+	case ".zst", ".zstd":
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// compressionFromMagic sniffs the algorithm from the leading bytes of data
+func compressionFromMagic(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(data, zstdMagic):
+		return CompressionZstd
+	default:
+		return CompressionNone
+	}
+}
+
+// compress encodes data with the given algorithm
+func compress(algorithm string, data []byte) ([]byte, error) {
+	switch algorithm {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("gzip compress: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("gzip compress: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		enc, err := zstdWriter()
+		if err != nil {
+			return nil, fmt.Errorf("zstd compress: %w", err)
+		}
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+}
+
+// decompress decodes data with the given algorithm. It fails with errDecompressedTooLarge
+// rather than expanding data beyond maxSize bytes.
+func decompress(algorithm string, data []byte, maxSize int64) ([]byte, error) {
+	var reader io.Reader
+	switch algorithm {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip decompress: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	case CompressionZstd:
+		// The window bounds the decoder's own buffers; it must be at least zstd's minimum
+		window := uint64(maxSize)
+		if window < zstd.MinWindowSize {
+			window = zstd.MinWindowSize
+		}
+		if window > zstd.MaxWindowSize {
+			window = zstd.MaxWindowSize
+		}
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(maxSize)),
+			zstd.WithDecoderMaxWindow(window))
+		if err != nil {
+			return nil, fmt.Errorf("zstd decompress: %w", err)
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algorithm)
+	}
+
+	// Read one byte past the limit to tell data of exactly maxSize from larger data
+	out, err := io.ReadAll(io.LimitReader(reader, maxSize+1))
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, fmt.Errorf("%s decompress: %w (%d bytes)", algorithm, errDecompressedTooLarge, maxSize)
+		}
+		return nil, fmt.Errorf("%s decompress: %w", algorithm, err)
+	}
+	if int64(len(out)) > maxSize {
+		return nil, fmt.Errorf("%s decompress: %w (%d bytes)", algorithm, errDecompressedTooLarge, maxSize)
+	}
+	return out, nil
+}
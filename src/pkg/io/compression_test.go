@@ -0,0 +1,105 @@
+package io
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCompression_RoundTrip(t *testing.T) {
+	payload := bytes.Repeat([]byte(`{"sku":"ABC-123","qty":1}`), 100)
+
+	for _, algorithm := range []string{CompressionNone, CompressionGzip, CompressionZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			compressed, err := compress(algorithm, payload)
+			if err != nil {
+				t.Fatalf("compress() error = %v", err)
+			}
+			if algorithm != CompressionNone && len(compressed) >= len(payload) {
+				t.Errorf("compress() did not shrink payload: %d >= %d", len(compressed), len(payload))
+			}
+			if got := compressionFromMagic(compressed); got != algorithm {
+				t.Errorf("compressionFromMagic() = %q, want %q", got, algorithm)
+			}
+
+			decompressed, err := decompress(algorithm, compressed, defaultMaxDecompressedSize)
+			if err != nil {
+				t.Fatalf("decompress() error = %v", err)
+			}
+			if !bytes.Equal(decompressed, payload) {
+				t.Error("decompress() did not restore original payload")
+			}
+		})
+	}
+}
+
+func TestCompression_Normalize(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", CompressionNone, false},
+		{"none", CompressionNone, false},
+		{"GZIP", CompressionGzip, false},
+		{"gz", CompressionGzip, false},
+		{"zstd", CompressionZstd, false},
+		{"zst", CompressionZstd, false},
+		{"brotli", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := normalizeCompression(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeCompression(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("normalizeCompression(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCompression_FromExtension(t *testing.T) {
+	tests := map[string]string{
+		"orders.csv.gz":   CompressionGzip,
+		"orders.csv.GZ":   CompressionGzip,
+		"orders.json.zst": CompressionZstd,
+		"orders.csv":      CompressionNone,
+	}
+
+	for path, want := range tests {
+		if got := compressionFromExtension(path); got != want {
+			t.Errorf("compressionFromExtension(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestCompression_DecompressCorruptData(t *testing.T) {
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd} {
+		if _, err := decompress(algorithm, []byte("definitely not compressed"), defaultMaxDecompressedSize); err == nil {
+			t.Errorf("decompress(%q) should fail on corrupt data", algorithm)
+		}
+	}
+}
+
+func TestCompression_DecompressLimit(t *testing.T) {
+	// 4MB of zeros compresses to a few kilobytes
+	payload := make([]byte, 4*1024*1024)
+
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			compressed, err := compress(algorithm, payload)
+			if err != nil {
+				t.Fatalf("compress() error = %v", err)
+			}
+
+			if _, err := decompress(algorithm, compressed, 1024*1024); !errors.Is(err, errDecompressedTooLarge) {
+				t.Errorf("decompress() error = %v, want errDecompressedTooLarge", err)
+			}
+			decompressed, err := decompress(algorithm, compressed, int64(len(payload)))
+			if err != nil || len(decompressed) != len(payload) {
+				t.Errorf("decompress() at exactly the limit = %d bytes, %v; want %d bytes", len(decompressed), err, len(payload))
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
+)
+
+func postWebhook(port string, body string) (int, error) {
+	resp, err := http.Post("http://localhost:"+port+"/webhook", "application/json", bytes.NewReader([]byte(body)))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func TestHTTPInput_Drain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input, err := NewHTTPInput([]byte(`{"port":"8786"}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	if err := input.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer input.Close()
+
+	for i := 0; i < 3; i++ {
+		if status, err := postWebhook("8786", fmt.Sprintf(`{"n":%d}`, i)); err != nil || status != http.StatusAccepted {
+			t.Fatalf("POST = %d, %v; want 202", status, err)
+		}
+	}
+
+	if err := input.Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	if _, err := postWebhook("8786", `{}`); err == nil {
+		t.Error("Webhook accepted after Drain")
+	}
+
+	// Buffered webhooks are still handed out, then the input reports it is drained
+	for i := 0; i < 3; i++ {
+		env, err := input.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read() %d error = %v", i, err)
+		}
+		if want := fmt.Sprintf(`{"n":%d}`, i); string(env.Payload) != want {
+			t.Errorf("Read() %d payload = %s, want %s", i, env.Payload, want)
+		}
+	}
+	if _, err := input.Read(ctx); !errors.Is(err, component.ErrInputDrained) {
+		t.Errorf("Read() after drain error = %v, want ErrInputDrained", err)
+	}
+}
+
+func TestHTTPInput_StartPortInUse(t *testing.T) {
+	first, _ := NewHTTPInput([]byte(`{"port":"8787"}`))
+	if err := first.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer first.Close()
+
+	second, _ := NewHTTPInput([]byte(`{"port":"8787"}`))
+	if err := second.Start(context.Background()); err == nil {
+		second.Close()
+		t.Error("Start() should fail when the port is taken")
+	}
+}
+
+func TestGenericProducer_StopDrainsInput(t *testing.T) {
+	input, err := NewHTTPInput([]byte(`{"port":"8788","buffer_size":50}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	output := &componenttest.Output{Delay: 10 * time.Millisecond}
+	producer := component.New(input, output)
+	if err := producer.Configure([]byte(`{"workers":2}`)); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	processErr := make(chan error, 1)
+	go func() {
+		processErr <- producer.Process(ctx, input, output)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 20; i++ {
+		if status, err := postWebhook("8788", `{}`); err != nil || status != http.StatusAccepted {
+			t.Fatalf("POST = %d, %v; want 202", status, err)
+		}
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stopCancel()
+	producer.Stop(stopCtx)
+
+	if written := len(output.Written()); written != 20 {
+		t.Errorf("%d of 20 accepted webhooks written before Stop returned", written)
+	}
+	if err := <-processErr; err != nil {
+		t.Errorf("Process() error = %v, want nil after a drain", err)
+	}
+	if producer.Health() != component.HealthStopped {
+		t.Errorf("Health() = %s, want stopped", producer.Health())
+	}
+}
@@ -0,0 +1,306 @@
+package io
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// Supported payload encryption schemes
+const (
+	EncryptionNone = "none"
+	EncryptionAge  = "age"
+	EncryptionPGP  = "pgp"
+)
+
+// signatureExtension is the suffix of detached signature files written next to payloads
+const signatureExtension = ".sig"
+
+// errSignatureInvalid marks payloads whose detached signature does not verify
+var errSignatureInvalid = errors.New("signature verification failed")
+
+// encryptionConverter encrypts payloads for a set of recipients, or decrypts them with a
+// set of identities, using either age or OpenPGP. Keys are loaded from disk once at
+// construction; payloads are only ever handled in memory.
+type encryptionConverter struct {
+	scheme string
+
+	ageRecipients []age.Recipient
+	ageIdentities []age.Identity
+	pgpKeys       openpgp.EntityList
+}
+
+// normalizeEncryption validates a configured scheme; an empty value means no encryption
+func normalizeEncryption(scheme string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(scheme)) {
+	case "", EncryptionNone:
+		return EncryptionNone, nil
+	case EncryptionAge:
+		return EncryptionAge, nil
+	case EncryptionPGP, "openpgp", "gpg":
+		return EncryptionPGP, nil
+	default:
+		return "", fmt.Errorf("unsupported encryption %q (must be none, age or pgp)", scheme)
+	}
+}
+
+// newEncryptingConverter loads recipients (age public keys, one per line, or an OpenPGP
+// public keyring) from recipientsFile. Returns nil when scheme is none.
+func newEncryptingConverter(scheme, recipientsFile string) (*encryptionConverter, error) {
+	scheme, err := normalizeEncryption(scheme)
+	if err != nil || scheme == EncryptionNone {
+		return nil, err
+	}
+	if recipientsFile == "" {
+		return nil, fmt.Errorf("%s encryption requires a recipients file", scheme)
+	}
+
+	data, err := os.ReadFile(recipientsFile)
+	if err != nil {
+		return nil, fmt.Errorf("read recipients file: %w", err)
+	}
+
+	c := &encryptionConverter{scheme: scheme}
+	switch scheme {
+	case EncryptionAge:
+		c.ageRecipients, err = age.ParseRecipients(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse age recipients: %w", err)
+		}
+	case EncryptionPGP:
+		c.pgpKeys, err = readPGPKeyRing(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse OpenPGP recipients: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// newDecryptingConverter loads identities (an age identity file or an OpenPGP private
+// keyring, optionally protected by passphrase) from identityFile. Returns nil when
+// scheme is none.
+func newDecryptingConverter(scheme, identityFile, passphrase string) (*encryptionConverter, error) {
+	scheme, err := normalizeEncryption(scheme)
+	if err != nil || scheme == EncryptionNone {
+		return nil, err
+	}
+	if identityFile == "" {
+		return nil, fmt.Errorf("%s decryption requires a key file", scheme)
+	}
+
+	data, err := os.ReadFile(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+
+	c := &encryptionConverter{scheme: scheme}
+	switch scheme {
+	case EncryptionAge:
+		c.ageIdentities, err = age.ParseIdentities(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse age identities: %w", err)
+		}
+	case EncryptionPGP:
+		c.pgpKeys, err = readPGPKeyRing(data)
+		if err != nil {
+			return nil, fmt.Errorf("parse OpenPGP private key: %w", err)
+		}
+		if err := decryptPGPPrivateKeys(c.pgpKeys, passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Extension returns the filename suffix for encrypted files
+func (c *encryptionConverter) Extension() string {
+	switch c.scheme {
+	case EncryptionAge:
+		return ".age"
+	case EncryptionPGP:
+		return ".pgp"
+	default:
+		return ""
+	}
+}
+
+// Encrypt encrypts plaintext for the configured recipients
+func (c *encryptionConverter) Encrypt(plaintext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+
+	switch c.scheme {
+	case EncryptionAge:
+		w, err = age.Encrypt(&buf, c.ageRecipients...)
+	case EncryptionPGP:
+		w, err = openpgp.Encrypt(&buf, c.pgpKeys, nil, &openpgp.FileHints{IsBinary: true}, nil)
+	default:
+		return nil, fmt.Errorf("unsupported encryption %q", c.scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s encrypt: %w", c.scheme, err)
+	}
+
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("%s encrypt: %w", c.scheme, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("%s encrypt: %w", c.scheme, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Decrypt decrypts ciphertext (binary or ASCII-armored) with the configured identities.
+// OpenPGP messages may be compressed, so it fails with errDecompressedTooLarge once the
+// plaintext exceeds maxSize bytes.
+func (c *encryptionConverter) Decrypt(ciphertext []byte, maxSize int64) ([]byte, error) {
+	var r io.Reader
+
+	switch c.scheme {
+	case EncryptionAge:
+		var src io.Reader = bytes.NewReader(ciphertext)
+		if bytes.HasPrefix(ciphertext, []byte(armor.Header)) {
+			src = armor.NewReader(src)
+		}
+		ar, err := age.Decrypt(src, c.ageIdentities...)
+		if err != nil {
+			return nil, fmt.Errorf("age decrypt: %w", err)
+		}
+		r = ar
+	case EncryptionPGP:
+		var src io.Reader = bytes.NewReader(ciphertext)
+		if bytes.HasPrefix(ciphertext, []byte("-----BEGIN PGP")) {
+			block, err := pgparmor.Decode(src)
+			if err != nil {
+				return nil, fmt.Errorf("pgp decrypt: %w", err)
+			}
+			src = block.Body
+		}
+		md, err := openpgp.ReadMessage(src, c.pgpKeys, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("pgp decrypt: %w", err)
+		}
+		if !md.IsEncrypted {
+			return nil, fmt.Errorf("pgp decrypt: message is not encrypted")
+		}
+		r = md.UnverifiedBody
+	default:
+		return nil, fmt.Errorf("unsupported encryption %q", c.scheme)
+	}
+
+	plaintext, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s decrypt: %w", c.scheme, err)
+	}
+	if int64(len(plaintext)) > maxSize {
+		return nil, fmt.Errorf("%s decrypt: %w (%d bytes)", c.scheme, errDecompressedTooLarge, maxSize)
+	}
+	return plaintext, nil
+}
+
+// encryptionFromExtension maps a filename suffix to an encryption scheme, or EncryptionNone
+func encryptionFromExtension(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".age":
+		return EncryptionAge
+	case ".pgp", ".gpg":
+		return EncryptionPGP
+	default:
+		return EncryptionNone
+	}
+}
+
+// loadPGPSigningKey loads the first private key from an OpenPGP keyring file for
+// producing detached signatures
+func loadPGPSigningKey(keyFile, passphrase string) (*openpgp.Entity, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("read signing key: %w", err)
+	}
+	keys, err := readPGPKeyRing(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse signing key: %w", err)
+	}
+	if err := decryptPGPPrivateKeys(keys, passphrase); err != nil {
+		return nil, err
+	}
+	for _, entity := range keys {
+		if entity.PrivateKey != nil {
+			return entity, nil
+		}
+	}
+	return nil, fmt.Errorf("signing key file %s contains no private key", keyFile)
+}
+
+// loadPGPKeyRing loads the OpenPGP public keys used to verify detached signatures
+func loadPGPKeyRing(keyringFile string) (openpgp.EntityList, error) {
+	data, err := os.ReadFile(keyringFile)
+	if err != nil {
+		return nil, fmt.Errorf("read signature keyring: %w", err)
+	}
+	keys, err := readPGPKeyRing(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse signature keyring: %w", err)
+	}
+	return keys, nil
+}
+
+// signDetached returns an ASCII-armored detached signature over data
+func signDetached(signer *openpgp.Entity, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := openpgp.ArmoredDetachSign(&buf, signer, bytes.NewReader(data), nil); err != nil {
+		return nil, fmt.Errorf("sign payload: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// verifyDetachedSignature checks a binary or ASCII-armored detached signature over data
+func verifyDetachedSignature(keyring openpgp.EntityList, data, signature []byte) error {
+	var err error
+	if bytes.HasPrefix(signature, []byte("-----BEGIN PGP")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(signature), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(signature), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", errSignatureInvalid, err)
+	}
+	return nil
+}
+
+// readPGPKeyRing parses a binary or ASCII-armored OpenPGP keyring
+func readPGPKeyRing(data []byte) (openpgp.EntityList, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("-----BEGIN PGP")) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// decryptPGPPrivateKeys unlocks passphrase-protected private keys in place
+func decryptPGPPrivateKeys(keys openpgp.EntityList, passphrase string) error {
+	for _, entity := range keys {
+		if entity.PrivateKey == nil || !entity.PrivateKey.Encrypted {
+			continue
+		}
+		if passphrase == "" {
+			return fmt.Errorf("OpenPGP private key is passphrase protected but no passphrase was configured")
+		}
+		if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+			return fmt.Errorf("unlock OpenPGP private key: %w", err)
+		}
+	}
+	return nil
+}
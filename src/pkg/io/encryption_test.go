@@ -0,0 +1,332 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	pgparmor "github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// writeAgeKeys writes a fresh age identity and its recipient to disk
+func writeAgeKeys(t *testing.T, dir string) (recipientsFile, identityFile string) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("GenerateX25519Identity() error = %v", err)
+	}
+	recipientsFile = filepath.Join(dir, "recipients.txt")
+	identityFile = filepath.Join(dir, "identity.txt")
+	if err := os.WriteFile(recipientsFile, []byte("# partner\n"+identity.Recipient().String()+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write recipients: %v", err)
+	}
+	if err := os.WriteFile(identityFile, []byte(identity.String()+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write identity: %v", err)
+	}
+	return recipientsFile, identityFile
+}
+
+// writePGPKeys writes a fresh OpenPGP key pair to disk as armored public and private keyrings
+func writePGPKeys(t *testing.T, dir, name string) (publicFile, privateFile string) {
+	t.Helper()
+	entity, err := openpgp.NewEntity(name, "", name+"@example.com", nil)
+	if err != nil {
+		t.Fatalf("NewEntity() error = %v", err)
+	}
+
+	var public, private bytes.Buffer
+	w, err := pgparmor.Encode(&public, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatalf("armor.Encode() error = %v", err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatalf("Serialize() error = %v", err)
+	}
+	w.Close()
+
+	w, err = pgparmor.Encode(&private, openpgp.PrivateKeyType, nil)
+	if err != nil {
+		t.Fatalf("armor.Encode() error = %v", err)
+	}
+	if err := entity.SerializePrivate(w, nil); err != nil {
+		t.Fatalf("SerializePrivate() error = %v", err)
+	}
+	w.Close()
+
+	publicFile = filepath.Join(dir, name+".pub.asc")
+	privateFile = filepath.Join(dir, name+".key.asc")
+	if err := os.WriteFile(publicFile, public.Bytes(), 0o600); err != nil {
+		t.Fatalf("Failed to write public key: %v", err)
+	}
+	if err := os.WriteFile(privateFile, private.Bytes(), 0o600); err != nil {
+		t.Fatalf("Failed to write private key: %v", err)
+	}
+	return publicFile, privateFile
+}
+
+func TestEncryptionConverter_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	ageRecipients, ageIdentity := writeAgeKeys(t, dir)
+	pgpPublic, pgpPrivate := writePGPKeys(t, dir, "partner")
+
+	tests := []struct {
+		scheme     string
+		recipients string
+		identity   string
+		extension  string
+	}{
+		{EncryptionAge, ageRecipients, ageIdentity, ".age"},
+		{EncryptionPGP, pgpPublic, pgpPrivate, ".pgp"},
+	}
+
+	plaintext := []byte(`{"card":"4111111111111111"}`)
+	for _, tt := range tests {
+		t.Run(tt.scheme, func(t *testing.T) {
+			encryptor, err := newEncryptingConverter(tt.scheme, tt.recipients)
+			if err != nil {
+				t.Fatalf("newEncryptingConverter() error = %v", err)
+			}
+			decryptor, err := newDecryptingConverter(tt.scheme, tt.identity, "")
+			if err != nil {
+				t.Fatalf("newDecryptingConverter() error = %v", err)
+			}
+			if encryptor.Extension() != tt.extension {
+				t.Errorf("Extension() = %q, want %q", encryptor.Extension(), tt.extension)
+			}
+
+			ciphertext, err := encryptor.Encrypt(plaintext)
+			if err != nil {
+				t.Fatalf("Encrypt() error = %v", err)
+			}
+			if bytes.Contains(ciphertext, []byte("4111111111111111")) {
+				t.Fatal("Ciphertext contains cleartext")
+			}
+
+			decrypted, err := decryptor.Decrypt(ciphertext, 1024)
+			if err != nil {
+				t.Fatalf("Decrypt() error = %v", err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("Decrypt() = %q, want %q", decrypted, plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptionConverter_WrongKey(t *testing.T) {
+	dir := t.TempDir()
+	ageRecipients, _ := writeAgeKeys(t, dir)
+	_, otherIdentity := writeAgeKeys(t, t.TempDir())
+
+	encryptor, err := newEncryptingConverter(EncryptionAge, ageRecipients)
+	if err != nil {
+		t.Fatalf("newEncryptingConverter() error = %v", err)
+	}
+	decryptor, err := newDecryptingConverter(EncryptionAge, otherIdentity, "")
+	if err != nil {
+		t.Fatalf("newDecryptingConverter() error = %v", err)
+	}
+
+	ciphertext, err := encryptor.Encrypt([]byte("secret"))
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	if _, err := decryptor.Decrypt(ciphertext, 1024); err == nil {
+		t.Error("Decrypt() with the wrong identity should fail")
+	}
+}
+
+func TestEncryptionConverter_CompressedPGPBeyondLimit(t *testing.T) {
+	dir := t.TempDir()
+	publicFile, privateFile := writePGPKeys(t, dir, "partner")
+	publicKey, err := os.ReadFile(publicFile)
+	if err != nil {
+		t.Fatalf("Failed to read public key: %v", err)
+	}
+	recipients, err := readPGPKeyRing(publicKey)
+	if err != nil {
+		t.Fatalf("readPGPKeyRing() error = %v", err)
+	}
+
+	// A megabyte of zeros compresses to a ciphertext of a few kilobytes, as long as the
+	// recipient's key says it accepts compressed messages
+	for _, identity := range recipients[0].Identities {
+		identity.SelfSignature.PreferredCompression = []uint8{uint8(packet.CompressionZLIB)}
+	}
+	var ciphertext bytes.Buffer
+	config := &packet.Config{DefaultCompressionAlgo: packet.CompressionZLIB, CompressionConfig: &packet.CompressionConfig{Level: 9}}
+	w, err := openpgp.Encrypt(&ciphertext, recipients, nil, nil, config)
+	if err != nil {
+		t.Fatalf("openpgp.Encrypt() error = %v", err)
+	}
+	w.Write(make([]byte, 1<<20))
+	w.Close()
+	if ciphertext.Len() > 16*1024 {
+		t.Fatalf("Ciphertext is %d bytes, want it compressed", ciphertext.Len())
+	}
+
+	decryptor, err := newDecryptingConverter(EncryptionPGP, privateFile, "")
+	if err != nil {
+		t.Fatalf("newDecryptingConverter() error = %v", err)
+	}
+	if _, err := decryptor.Decrypt(ciphertext.Bytes(), 64*1024); !errors.Is(err, errDecompressedTooLarge) {
+		t.Errorf("Decrypt() error = %v, want errDecompressedTooLarge", err)
+	}
+	if plaintext, err := decryptor.Decrypt(ciphertext.Bytes(), 1<<20); err != nil || len(plaintext) != 1<<20 {
+		t.Errorf("Decrypt() at the limit = %d bytes, %v; want the whole plaintext", len(plaintext), err)
+	}
+}
+
+func TestEncryptionConverter_Config(t *testing.T) {
+	if c, err := newEncryptingConverter("", ""); c != nil || err != nil {
+		t.Errorf("newEncryptingConverter(none) = %v, %v; want nil, nil", c, err)
+	}
+	if _, err := newEncryptingConverter("rot13", "keys"); err == nil {
+		t.Error("newEncryptingConverter() should reject unknown schemes")
+	}
+	if _, err := newEncryptingConverter(EncryptionAge, ""); err == nil {
+		t.Error("newEncryptingConverter() should require a recipients file")
+	}
+	if _, err := newDecryptingConverter(EncryptionPGP, filepath.Join(t.TempDir(), "missing.asc"), ""); err == nil {
+		t.Error("newDecryptingConverter() should fail for a missing key file")
+	}
+}
+
+func TestDetachedSignature(t *testing.T) {
+	dir := t.TempDir()
+	publicFile, privateFile := writePGPKeys(t, dir, "signer")
+	otherPublic, _ := writePGPKeys(t, dir, "other")
+
+	signer, err := loadPGPSigningKey(privateFile, "")
+	if err != nil {
+		t.Fatalf("loadPGPSigningKey() error = %v", err)
+	}
+	keyring, err := loadPGPKeyRing(publicFile)
+	if err != nil {
+		t.Fatalf("loadPGPKeyRing() error = %v", err)
+	}
+	otherKeyring, err := loadPGPKeyRing(otherPublic)
+	if err != nil {
+		t.Fatalf("loadPGPKeyRing() error = %v", err)
+	}
+
+	data := []byte("payload")
+	signature, err := signDetached(signer, data)
+	if err != nil {
+		t.Fatalf("signDetached() error = %v", err)
+	}
+
+	if err := verifyDetachedSignature(keyring, data, signature); err != nil {
+		t.Errorf("verifyDetachedSignature() error = %v", err)
+	}
+	if err := verifyDetachedSignature(keyring, []byte("tampered"), signature); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("verifyDetachedSignature() on tampered data = %v, want errSignatureInvalid", err)
+	}
+	if err := verifyDetachedSignature(otherKeyring, data, signature); !errors.Is(err, errSignatureInvalid) {
+		t.Errorf("verifyDetachedSignature() with unknown signer = %v, want errSignatureInvalid", err)
+	}
+}
+
+func TestFileEncryptionAndSigningRoundTrip(t *testing.T) {
+	keyDir := t.TempDir()
+	dir := t.TempDir()
+	errorDir := t.TempDir()
+	recipients, identity := writeAgeKeys(t, keyDir)
+	publicFile, privateFile := writePGPKeys(t, keyDir, "vrsky")
+
+	t.Setenv("FILE_OUTPUT_DIR", dir)
+	t.Setenv("FILE_OUTPUT_FILENAME_FORMAT", "{{.ID}}.{{.Extension}}")
+	t.Setenv("FILE_OUTPUT_COMPRESSION", "gzip")
+	t.Setenv("FILE_OUTPUT_ENCRYPTION", "age")
+	t.Setenv("FILE_OUTPUT_ENCRYPTION_RECIPIENTS_FILE", recipients)
+	t.Setenv("FILE_OUTPUT_SIGNING_KEY_FILE", privateFile)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	producer, err := NewFileProducer(logger)
+	if err != nil {
+		t.Fatalf("NewFileProducer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := producer.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer producer.Close()
+
+	payload := []byte(`{"customer":"Jane Doe","iban":"GB33BUKB20201555555555"}`)
+	env := envelope.New()
+	env.ID = "secret-1"
+	env.ContentType = "application/json"
+	env.Payload = payload
+
+	if err := producer.Write(ctx, env); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	written := filepath.Join(dir, "secret-1.json.gz.age")
+	raw, err := os.ReadFile(written)
+	if err != nil {
+		t.Fatalf("Expected encrypted file %s: %v", written, err)
+	}
+	if bytes.Contains(raw, []byte("GB33BUKB")) {
+		t.Fatal("Encrypted file contains cleartext")
+	}
+	if _, err := os.Stat(written + signatureExtension); err != nil {
+		t.Fatalf("Expected detached signature: %v", err)
+	}
+
+	t.Setenv("FILE_INPUT_DIR", dir)
+	t.Setenv("FILE_INPUT_ERROR_DIR", errorDir)
+	t.Setenv("FILE_INPUT_DECOMPRESSION", "auto")
+	t.Setenv("FILE_INPUT_DECRYPTION", "age")
+	t.Setenv("FILE_INPUT_DECRYPTION_KEY_FILE", identity)
+	t.Setenv("FILE_INPUT_SIGNATURE_KEYRING_FILE", publicFile)
+
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	content, err := consumer.readFileContent(written)
+	if err != nil {
+		t.Fatalf("readFileContent() error = %v", err)
+	}
+	if !bytes.Equal(content, payload) {
+		t.Errorf("readFileContent() = %q, want %q", content, payload)
+	}
+	if got := consumer.detectContentType(consumer.logicalFilePath(written)); got != "application/json" {
+		t.Errorf("content type = %q, want application/json", got)
+	}
+
+	// A tampered file fails verification and goes straight to the error directory
+	if err := os.WriteFile(written, append(raw, '!'), 0o644); err != nil {
+		t.Fatalf("Failed to tamper with file: %v", err)
+	}
+	if err := consumer.processFile(written); err != nil {
+		t.Fatalf("processFile() error = %v", err)
+	}
+	moved := filepath.Join(errorDir, time.Now().Format("2006-01-02"), filepath.Base(written))
+	if _, err := os.Stat(moved); err != nil {
+		t.Errorf("Tampered file not moved to error directory: %v", err)
+	}
+	if _, err := os.Stat(moved + signatureExtension); err != nil {
+		t.Errorf("Signature not moved alongside tampered file: %v", err)
+	}
+	errorMetadata, err := os.ReadFile(moved + ".error")
+	if err != nil || !strings.Contains(string(errorMetadata), "signature verification failed") {
+		t.Errorf("Error metadata should mention signature failure, got %q (err=%v)", errorMetadata, err)
+	}
+}
@@ -8,7 +8,9 @@ import (
 	"github.com/ValueRetail/vrsky/pkg/component"
 )
 
-// NewInput creates an Input handler based on type
+// NewInput creates an Input handler based on type. The file and SFTP inputs take their
+// FILE_INPUT_* settings from the config (see newFileSettings), or from the environment
+// when the config is empty.
 func NewInput(inputType string, configJSON json.RawMessage) (component.Input, error) {
 	switch inputType {
 	case "http":
@@ -16,21 +18,71 @@ func NewInput(inputType string, configJSON json.RawMessage) (component.Input, er
 	case "nats":
 		return NewNATSInput(configJSON)
 	case "file":
-		logger := slog.Default()
-		return NewFileConsumer(logger)
+		return newFileComponent("FILE_INPUT_", configJSON, nil, newFileConsumer)
+	case "sftp":
+		return newFileComponent("FILE_INPUT_", configJSON, nil, newSFTPConsumer)
+	case "s3":
+		return NewS3Input(configJSON)
 	default:
 		return nil, fmt.Errorf("unknown input type: %s", inputType)
 	}
 }
 
-// NewOutput creates an Output handler based on type
+// NewOutput creates an Output handler based on type. A "circuit_breaker" object in the
+// config wraps the output in a component.CircuitBreaker.
 func NewOutput(outputType string, configJSON json.RawMessage) (component.Output, error) {
+	output, err := newOutput(outputType, configJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var config struct {
+		CircuitBreaker *component.CircuitBreakerConfig `json:"circuit_breaker,omitempty"`
+	}
+	if len(configJSON) > 0 {
+		if err := json.Unmarshal(configJSON, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse %s output config: %w", outputType, err)
+		}
+	}
+	if config.CircuitBreaker == nil {
+		return output, nil
+	}
+	breaker, err := component.NewCircuitBreaker(output, outputType, *config.CircuitBreaker)
+	if err != nil {
+		return nil, fmt.Errorf("%s output: %w", outputType, err)
+	}
+	return breaker, nil
+}
+
+func newOutput(outputType string, configJSON json.RawMessage) (component.Output, error) {
 	switch outputType {
 	case "http":
 		return NewHTTPOutput(configJSON)
 	case "nats":
 		return NewNATSOutput(configJSON)
+	case "sftp":
+		// The circuit breaker is configured by NewOutput
+		return newFileComponent("FILE_OUTPUT_", configJSON, []string{"circuit_breaker"}, newSFTPProducer)
+	case "s3":
+		return NewS3Output(configJSON)
 	default:
 		return nil, fmt.Errorf("unknown output type: %s", outputType)
 	}
 }
+
+// newFileComponent creates a file or SFTP input or output with settings from configJSON
+func newFileComponent[T any](prefix string, configJSON json.RawMessage, ignore []string, create func(*slog.Logger, func(string) string) (T, error)) (T, error) {
+	var zero T
+	settings, err := newFileSettings(prefix, configJSON, ignore...)
+	if err != nil {
+		return zero, err
+	}
+	created, err := create(slog.Default(), settings.get)
+	if err != nil {
+		return zero, err
+	}
+	if err := settings.checkUnused(); err != nil {
+		return zero, err
+	}
+	return created, nil
+}
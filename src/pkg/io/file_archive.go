@@ -0,0 +1,308 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// errArchiveRejected marks archives that can never be processed (unsafe member paths,
+// oversized members). They are moved to the error directory without retrying.
+var errArchiveRejected = errors.New("archive rejected")
+
+// archiveMember is a single regular file extracted from an archive
+type archiveMember struct {
+	Name    string // Cleaned path of the member inside the archive
+	Content []byte
+}
+
+// isArchiveFile reports whether a file is an archive the consumer can expand
+func isArchiveFile(filePath string) bool {
+	name := strings.ToLower(filePath)
+	return strings.HasSuffix(name, ".zip") ||
+		strings.HasSuffix(name, ".tar") ||
+		strings.HasSuffix(name, ".tar.gz") ||
+		strings.HasSuffix(name, ".tgz")
+}
+
+// safeArchiveMemberPath cleans a member name and rejects names that would escape the
+// archive root (zip-slip), mirroring FileProducer's path traversal check
+func safeArchiveMemberPath(name string) (string, error) {
+	normalized := strings.ReplaceAll(name, "\\", "/")
+	if path.IsAbs(normalized) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("%w: absolute member path %q", errArchiveRejected, name)
+	}
+
+	root := string(os.PathSeparator) + "archive"
+	target := filepath.Join(root, filepath.FromSlash(normalized))
+	relPath, err := filepath.Rel(root, target)
+	if err != nil {
+		return "", fmt.Errorf("%w: resolve member path %q: %v", errArchiveRejected, name, err)
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(os.PathSeparator)) {
+		return "", fmt.Errorf("%w: path traversal detected in member %q", errArchiveRejected, name)
+	}
+
+	return filepath.ToSlash(relPath), nil
+}
+
+// walkArchiveMembers passes the regular files of an archive whose base name matches the
+// consumer's pattern to deliver, in archive order, reading one member at a time. Every
+// member's path and size are checked before the first is delivered, so a rejected archive
+// emits nothing. The first skip matching members are passed over unread. It returns the
+// number of matching members. logicalPath is the archive name after any transparent
+// decryption/decompression suffixes were stripped.
+func (f *FileConsumer) walkArchiveMembers(logicalPath string, content []byte, skip int, deliver func(archiveMember) error) (int, error) {
+	if strings.HasSuffix(strings.ToLower(logicalPath), ".zip") {
+		return f.walkZipMembers(bytes.NewReader(content), int64(len(content)), skip, deliver)
+	}
+
+	// Gzipped tarballs may already have been decompressed by readFileContent. The tar is
+	// read twice, once to check it and once to deliver, so each pass opens its own stream.
+	open := func() (io.Reader, func(), error) {
+		return bytes.NewReader(content), func() {}, nil
+	}
+	if compressionFromMagic(content) == CompressionGzip {
+		open = func() (io.Reader, func(), error) {
+			zr, err := gzip.NewReader(bytes.NewReader(content))
+			if err != nil {
+				return nil, nil, fmt.Errorf("open gzip stream: %w", err)
+			}
+			return zr, func() { zr.Close() }, nil
+		}
+	}
+	return f.walkTarMembers(open, skip, deliver)
+}
+
+// walkZipMembers delivers matching members of a zip archive
+func (f *FileConsumer) walkZipMembers(r io.ReaderAt, size int64, skip int, deliver func(archiveMember) error) (int, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return 0, fmt.Errorf("open zip archive: %w", err)
+	}
+
+	// The central directory lists every member, so they can all be checked up front
+	var entries []*zip.File
+	var paths []string
+	for _, entry := range zr.File {
+		memberPath, err := safeArchiveMemberPath(entry.Name)
+		if err != nil {
+			return 0, err
+		}
+		if !entry.Mode().IsRegular() || !f.matchesArchiveMember(memberPath) {
+			continue
+		}
+		if entry.UncompressedSize64 > uint64(f.maxArchiveMemberSize) {
+			return 0, f.oversizedMember(memberPath)
+		}
+		entries = append(entries, entry)
+		paths = append(paths, memberPath)
+	}
+
+	for i := skip; i < len(entries); i++ {
+		rc, err := entries[i].Open()
+		if err != nil {
+			return 0, fmt.Errorf("open zip member %s: %w", paths[i], err)
+		}
+		content, err := f.readArchiveMember(rc, paths[i])
+		rc.Close()
+		if err != nil {
+			return 0, err
+		}
+		if err := deliver(archiveMember{Name: paths[i], Content: content}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(entries), nil
+}
+
+// walkTarMembers delivers matching members of the tar stream open returns
+func (f *FileConsumer) walkTarMembers(open func() (io.Reader, func(), error), skip int, deliver func(archiveMember) error) (int, error) {
+	// First pass: check paths and sizes without reading any content
+	count := 0
+	err := f.scanTar(open, func(header *tar.Header, memberPath string, r io.Reader) error {
+		if header.Size > f.maxArchiveMemberSize {
+			return f.oversizedMember(memberPath)
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	// Second pass: read and deliver one member at a time
+	index := 0
+	err = f.scanTar(open, func(header *tar.Header, memberPath string, r io.Reader) error {
+		index++
+		if index <= skip {
+			return nil
+		}
+		content, err := f.readArchiveMember(r, memberPath)
+		if err != nil {
+			return err
+		}
+		return deliver(archiveMember{Name: memberPath, Content: content})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// scanTar calls fn for each matching member of the tar stream open returns, rejecting
+// unsafe member paths
+func (f *FileConsumer) scanTar(open func() (io.Reader, func(), error), fn func(header *tar.Header, memberPath string, r io.Reader) error) error {
+	r, closeStream, err := open()
+	if err != nil {
+		return err
+	}
+	defer closeStream()
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar archive: %w", err)
+		}
+
+		memberPath, err := safeArchiveMemberPath(header.Name)
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg || !f.matchesArchiveMember(memberPath) {
+			continue
+		}
+		if err := fn(header, memberPath, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// oversizedMember is the error for a member larger than the maximum member size
+func (f *FileConsumer) oversizedMember(memberPath string) error {
+	return fmt.Errorf("%w: member %s exceeds maximum size of %d bytes", errArchiveRejected, memberPath, f.maxArchiveMemberSize)
+}
+
+// readArchiveMember reads a member, enforcing the maximum member size
+func (f *FileConsumer) readArchiveMember(r io.Reader, memberPath string) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(r, f.maxArchiveMemberSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read member %s: %w", memberPath, err)
+	}
+	if int64(len(content)) > f.maxArchiveMemberSize {
+		return nil, f.oversizedMember(memberPath)
+	}
+	return content, nil
+}
+
+// matchesArchiveMember applies the configured file pattern to a member's base name
+func (f *FileConsumer) matchesArchiveMember(memberPath string) bool {
+	matched, err := filepath.Match(f.pattern, path.Base(memberPath))
+	return err == nil && matched
+}
+
+// processArchive emits one envelope per matching archive member. The archive is only
+// archived/deleted once every member has been delivered; a partially delivered archive
+// resumes from the first undelivered member on retry.
+func (f *FileConsumer) processArchive(filePath string) error {
+	// Check if already processed
+	isProcessed, err := f.isFileProcessed(filePath)
+	if err != nil {
+		f.logger.Warn("Failed to check if file was processed", "path", filePath, "err", err)
+	} else if isProcessed {
+		f.logger.Debug("Archive already processed, skipping", "path", filePath)
+		return nil
+	}
+
+	content, err := f.readFileContent(filePath)
+	if err != nil {
+		return f.handleReadFailure(filePath, err)
+	}
+
+	fileHash, err := f.calculateFileHash(filePath)
+	if err != nil {
+		f.logger.Warn("Failed to calculate file hash", "path", filePath, "err", err)
+		fileHash = ""
+	}
+
+	progressKey := filepath.Base(filePath) + ":" + fileHash
+	f.mu.Lock()
+	delivered := f.archiveProgress[progressKey]
+	f.mu.Unlock()
+
+	// Members are read and delivered one at a time, so only one is held in memory
+	var deliverErr error
+	members, err := f.walkArchiveMembers(f.logicalFilePath(filePath), content, delivered, func(member archiveMember) error {
+		content := member.Content
+		if algorithm := f.compressionFor(member.Name, content); algorithm != CompressionNone {
+			decompressed, err := decompress(algorithm, content, f.maxDecompressedSize)
+			if err != nil {
+				return fmt.Errorf("decompress member %s: %w", member.Name, err)
+			}
+			content = decompressed
+		}
+
+		env := envelope.New()
+		env.ID = uuid.New().String()
+		env.Source = f.source
+		env.Payload = content
+		env.PayloadSize = int64(len(content))
+		env.ContentType = f.detectContentType(f.logicalFilePath(member.Name))
+		env.Metadata = map[string]string{
+			"filename":       path.Base(member.Name),
+			"archive":        filepath.Base(filePath),
+			"archive_member": member.Name,
+		}
+
+		if err := f.deliverEnvelope(filePath, env); err != nil {
+			deliverErr = fmt.Errorf("deliver member %s: %w", member.Name, err)
+			return deliverErr
+		}
+		delivered++
+
+		f.logger.Debug("Delivered archive member", "archive", filepath.Base(filePath), "member", member.Name, "id", env.ID)
+		return nil
+	})
+	if deliverErr == nil && err != nil {
+		// A member that cannot be read or decompressed fails the archive like an unreadable file
+		deliverErr = f.handleReadFailure(filePath, err)
+		if deliverErr == nil {
+			f.mu.Lock()
+			delete(f.archiveProgress, progressKey)
+			f.mu.Unlock()
+			return nil
+		}
+	}
+	if deliverErr != nil {
+		f.mu.Lock()
+		f.archiveProgress[progressKey] = delivered
+		f.mu.Unlock()
+		return deliverErr
+	}
+
+	f.mu.Lock()
+	delete(f.archiveProgress, progressKey)
+	f.mu.Unlock()
+
+	f.finishFile(filePath, fileHash)
+
+	f.logger.Info("Processed archive", "filename", filepath.Base(filePath), "members", members)
+	return nil
+}
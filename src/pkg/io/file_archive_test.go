@@ -0,0 +1,442 @@
+package io
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testArchiveEntry struct {
+	name    string
+	content string
+}
+
+func writeTestZip(t *testing.T, path string, entries []testArchiveEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create zip: %v", err)
+	}
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+	for _, entry := range entries {
+		w, err := zw.Create(entry.name)
+		if err != nil {
+			t.Fatalf("Failed to add zip member: %v", err)
+		}
+		if _, err := w.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("Failed to write zip member: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to finalize zip: %v", err)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("Failed to backdate zip: %v", err)
+	}
+}
+
+func writeTestTarGz(t *testing.T, path string, entries []testArchiveEntry) {
+	t.Helper()
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create tar.gz: %v", err)
+	}
+	defer file.Close()
+
+	zw := gzip.NewWriter(file)
+	tw := tar.NewWriter(zw)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: 0o644, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("Failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatalf("Failed to write tar member: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("Failed to finalize tar: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Failed to finalize gzip: %v", err)
+	}
+}
+
+func TestSafeArchiveMemberPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"orders.csv", "orders.csv", false},
+		{"daily/orders.csv", "daily/orders.csv", false},
+		{"daily/../orders.csv", "orders.csv", false},
+		{"../orders.csv", "", true},
+		{"daily/../../orders.csv", "", true},
+		{"/etc/passwd", "", true},
+		{"..\\..\\windows\\system.ini", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := safeArchiveMemberPath(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("safeArchiveMemberPath(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+		if got != tt.want {
+			t.Errorf("safeArchiveMemberPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFileConsumer_ReadTarGzMembers(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FILE_INPUT_DIR", dir)
+	t.Setenv("FILE_INPUT_PATTERN", "*.csv")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	archivePath := filepath.Join(dir, "daily.tar.gz")
+	writeTestTarGz(t, archivePath, []testArchiveEntry{
+		{"stores/a.csv", "a"},
+		{"README.txt", "ignored"},
+		{"stores/b.csv", "b"},
+	})
+
+	content, err := consumer.readFileContent(archivePath)
+	if err != nil {
+		t.Fatalf("readFileContent() error = %v", err)
+	}
+	var members []archiveMember
+	count, err := consumer.walkArchiveMembers(archivePath, content, 0, func(member archiveMember) error {
+		members = append(members, member)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkArchiveMembers() error = %v", err)
+	}
+	if count != 2 || len(members) != 2 {
+		t.Fatalf("Expected 2 matching members, got %d (%d delivered)", count, len(members))
+	}
+	if members[0].Name != "stores/a.csv" || string(members[1].Content) != "b" {
+		t.Errorf("Unexpected members: %+v", members)
+	}
+}
+
+func TestFileConsumer_ArchiveMemberSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FILE_INPUT_DIR", dir)
+	t.Setenv("FILE_INPUT_ARCHIVE_MAX_MEMBER_SIZE", "4")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	archivePath := filepath.Join(dir, "big.zip")
+	writeTestZip(t, archivePath, []testArchiveEntry{{"big.csv", "more than four bytes"}})
+
+	content, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	delivered := 0
+	if _, err := consumer.walkArchiveMembers(archivePath, content, 0, func(archiveMember) error {
+		delivered++
+		return nil
+	}); err == nil {
+		t.Error("walkArchiveMembers() should reject oversized members")
+	}
+	if delivered != 0 {
+		t.Errorf("%d members delivered from a rejected archive, want 0", delivered)
+	}
+}
+
+func TestFileConsumer_TarMemberSizeCheckedBeforeDelivery(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FILE_INPUT_DIR", dir)
+	t.Setenv("FILE_INPUT_ARCHIVE_MAX_MEMBER_SIZE", "4")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	// The oversized member comes last, after one that would be delivered
+	archivePath := filepath.Join(dir, "big.tar.gz")
+	writeTestTarGz(t, archivePath, []testArchiveEntry{{"a.csv", "a"}, {"big.csv", "more than four bytes"}})
+	content, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	delivered := 0
+	if _, err := consumer.walkArchiveMembers(archivePath, content, 0, func(archiveMember) error {
+		delivered++
+		return nil
+	}); !errors.Is(err, errArchiveRejected) {
+		t.Errorf("walkArchiveMembers() error = %v, want errArchiveRejected", err)
+	}
+	if delivered != 0 {
+		t.Errorf("%d members delivered from a rejected archive, want 0", delivered)
+	}
+}
+
+func TestFileConsumer_WalkArchiveMembersSkipsDelivered(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("FILE_INPUT_DIR", dir)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	archivePath := filepath.Join(dir, "batch.tar.gz")
+	writeTestTarGz(t, archivePath, []testArchiveEntry{{"1.csv", "one"}, {"2.csv", "two"}, {"3.csv", "three"}})
+	content, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	var payloads []string
+	count, err := consumer.walkArchiveMembers(archivePath, content, 2, func(member archiveMember) error {
+		payloads = append(payloads, string(member.Content))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walkArchiveMembers() error = %v", err)
+	}
+	if count != 3 || len(payloads) != 1 || payloads[0] != "three" {
+		t.Errorf("walkArchiveMembers() = %d, delivered %v; want 3 members with only the last delivered", count, payloads)
+	}
+}
+
+func TestFileConsumer_ExpandsZipArchive(t *testing.T) {
+	inputDir := t.TempDir()
+	archiveDir := t.TempDir()
+	t.Setenv("FILE_INPUT_DIR", inputDir)
+	t.Setenv("FILE_INPUT_PATTERN", "*.csv")
+	t.Setenv("FILE_INPUT_POLL_INTERVAL", "100ms")
+	t.Setenv("FILE_INPUT_EXPAND_ARCHIVES", "true")
+	t.Setenv("FILE_INPUT_ARCHIVE_DIR", archiveDir)
+
+	writeTestZip(t, filepath.Join(inputDir, "vendor.zip"), []testArchiveEntry{
+		{"store-1.csv", "sku,qty\nA,1\n"},
+		{"notes.txt", "not a csv"},
+		{"nested/store-2.csv", "sku,qty\nB,2\n"},
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := consumer.Start(ctx); err != nil {
+		t.Skipf("Consumer could not start (NATS required): %v", err)
+	}
+	defer consumer.Close()
+
+	want := []struct{ filename, member, payload string }{
+		{"store-1.csv", "store-1.csv", "sku,qty\nA,1\n"},
+		{"store-2.csv", "nested/store-2.csv", "sku,qty\nB,2\n"},
+	}
+	for _, w := range want {
+		env, err := consumer.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if string(env.Payload) != w.payload {
+			t.Errorf("Payload = %q, want %q", env.Payload, w.payload)
+		}
+		if env.ContentType != "text/csv" {
+			t.Errorf("ContentType = %q, want text/csv", env.ContentType)
+		}
+		if env.Metadata["filename"] != w.filename || env.Metadata["archive_member"] != w.member || env.Metadata["archive"] != "vendor.zip" {
+			t.Errorf("Unexpected metadata: %v", env.Metadata)
+		}
+	}
+
+	// The archive is moved only after every member has been delivered
+	archived := filepath.Join(archiveDir, time.Now().Format("2006-01-02"), "vendor.zip")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := os.Stat(archived); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Archive was not moved to %s", archived)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestFileConsumer_ZipSlipArchiveMovedToError(t *testing.T) {
+	inputDir := t.TempDir()
+	errorDir := t.TempDir()
+	t.Setenv("FILE_INPUT_DIR", inputDir)
+	t.Setenv("FILE_INPUT_PATTERN", "*")
+	t.Setenv("FILE_INPUT_POLL_INTERVAL", "1h")
+	t.Setenv("FILE_INPUT_EXPAND_ARCHIVES", "true")
+	t.Setenv("FILE_INPUT_ERROR_DIR", errorDir)
+
+	archivePath := filepath.Join(inputDir, "evil.zip")
+	writeTestZip(t, archivePath, []testArchiveEntry{
+		{"ok.csv", "fine"},
+		{"../../etc/cron.d/evil", "pwned"},
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	if err := consumer.processArchive(archivePath); err != nil {
+		t.Fatalf("processArchive() error = %v", err)
+	}
+
+	if _, err := os.Stat(archivePath); !os.IsNotExist(err) {
+		t.Error("Unsafe archive should be removed from the input directory")
+	}
+	moved := filepath.Join(errorDir, time.Now().Format("2006-01-02"), "evil.zip")
+	if _, err := os.Stat(moved); err != nil {
+		t.Errorf("Unsafe archive not moved to error directory: %v", err)
+	}
+	if len(consumer.messages) != 0 {
+		t.Errorf("No members should be emitted from an unsafe archive, got %d", len(consumer.messages))
+	}
+}
+
+func TestFileConsumer_ArchiveResumesAfterPartialDelivery(t *testing.T) {
+	inputDir := t.TempDir()
+	t.Setenv("FILE_INPUT_DIR", inputDir)
+	t.Setenv("FILE_INPUT_PATTERN", "*.csv")
+	t.Setenv("FILE_INPUT_POLL_INTERVAL", "1h")
+	t.Setenv("FILE_INPUT_EXPAND_ARCHIVES", "true")
+
+	archivePath := filepath.Join(inputDir, "batch.zip")
+	writeTestZip(t, archivePath, []testArchiveEntry{
+		{"1.csv", "one"},
+		{"2.csv", "two"},
+		{"3.csv", "three"},
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewFileConsumer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := consumer.Start(ctx); err != nil {
+		t.Skipf("Consumer could not start (NATS required): %v", err)
+	}
+	defer consumer.Close()
+
+	// Simulate a previous attempt that delivered the first member before failing
+	hash, err := consumer.calculateFileHash(archivePath)
+	if err != nil {
+		t.Fatalf("calculateFileHash() error = %v", err)
+	}
+	consumer.archiveProgress["batch.zip:"+hash] = 1
+
+	if err := consumer.processArchive(archivePath); err != nil {
+		t.Fatalf("processArchive() error = %v", err)
+	}
+
+	for _, want := range []string{"two", "three"} {
+		env, err := consumer.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if string(env.Payload) != want {
+			t.Errorf("Payload = %q, want %q", env.Payload, want)
+		}
+	}
+	if len(consumer.archiveProgress) != 0 {
+		t.Error("Archive progress should be cleared once every member is delivered")
+	}
+}
+
+func TestFileConsumer_UndecompressableMemberMovedToError(t *testing.T) {
+	var bomb bytes.Buffer
+	zw := gzip.NewWriter(&bomb)
+	zw.Write(make([]byte, 64*1024))
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		member   string
+		attempts int // Polls before the archive is moved
+	}{
+		{"corrupt member is retried", "\x1f\x8b\x08\x00corrupt", 2},
+		{"member beyond the size limit is rejected", bomb.String(), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputDir := t.TempDir()
+			errorDir := t.TempDir()
+			t.Setenv("FILE_INPUT_DIR", inputDir)
+			t.Setenv("FILE_INPUT_PATTERN", "*")
+			t.Setenv("FILE_INPUT_POLL_INTERVAL", "1h")
+			t.Setenv("FILE_INPUT_EXPAND_ARCHIVES", "true")
+			t.Setenv("FILE_INPUT_DECOMPRESSION", "auto")
+			t.Setenv("FILE_INPUT_MAX_DECOMPRESSED_SIZE", "1024")
+			t.Setenv("FILE_INPUT_MAX_RETRIES", "2")
+			t.Setenv("FILE_INPUT_ERROR_DIR", errorDir)
+
+			archivePath := filepath.Join(inputDir, "batch.zip")
+			writeTestZip(t, archivePath, []testArchiveEntry{{"orders.csv.gz", tt.member}})
+
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+			consumer, err := NewFileConsumer(logger)
+			if err != nil {
+				t.Fatalf("NewFileConsumer() error = %v", err)
+			}
+
+			for attempt := 1; attempt < tt.attempts; attempt++ {
+				if err := consumer.processArchive(archivePath); err == nil {
+					t.Fatalf("processArchive() attempt %d should fail", attempt)
+				}
+				if _, err := os.Stat(archivePath); err != nil {
+					t.Fatalf("Archive should stay in place for a retry: %v", err)
+				}
+			}
+			if err := consumer.processArchive(archivePath); err != nil {
+				t.Fatalf("processArchive() error = %v", err)
+			}
+
+			moved := filepath.Join(errorDir, time.Now().Format("2006-01-02"), "batch.zip")
+			if _, err := os.Stat(moved); err != nil {
+				t.Errorf("Archive not moved to error directory: %v", err)
+			}
+			if len(consumer.archiveProgress) != 0 {
+				t.Error("Archive progress should be cleared once the archive is moved")
+			}
+		})
+	}
+}
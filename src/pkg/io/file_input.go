@@ -3,6 +3,7 @@ package io
 import (
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,13 +11,16 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 
 	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
 )
 
 // ProcessedFile tracks the hash and modification time of a processed file
@@ -38,42 +42,60 @@ type FileConsumer struct {
 	dir                   string
 	pattern               string
 	pollInterval          time.Duration
+	dirPerm               os.FileMode // Permissions of the input directory if Start creates it
+	natsURL               string
 	archiveDir            string
 	errorDir              string
 	deleteAfterProcessing bool
 	maxRetries            int
 	retryBackoffMs        int
 	archiveRetentionDays  int
+	decompression         string
+	maxDecompressedSize   int64
+	expandArchives        bool
+	maxArchiveMemberSize  int64
+	decryptor             *encryptionConverter
+	signatureKeyring      openpgp.EntityList
+	store                 fileStore
+	source                string
+	component             string // Component label on metrics
+	pipeline              string // Pipeline label on metrics
 
 	// Runtime
-	ctx            context.Context
-	cancel         context.CancelFunc
-	ticker         *time.Ticker
-	messages       chan *envelope.Envelope
-	subject        string
-	nc             *nats.Conn
-	logger         *slog.Logger
-	mu             sync.Mutex
-	closed         bool
-	closedOnce     sync.Once
-	processedFiles map[string]ProcessedFile
-	failedFiles    map[string]FileRetry
+	ctx             context.Context
+	cancel          context.CancelFunc
+	pollDone        chan struct{} // Closed once pollLoop has returned; nil before Start
+	messages        chan *envelope.Envelope
+	subject         string
+	nc              *nats.Conn
+	logger          *slog.Logger
+	mu              sync.Mutex
+	closed          bool
+	closedOnce      sync.Once
+	processedFiles  map[string]ProcessedFile
+	failedFiles     map[string]FileRetry
+	archiveProgress map[string]int
 }
 
 // NewFileConsumer creates a new file consumer from environment configuration
 func NewFileConsumer(logger *slog.Logger) (*FileConsumer, error) {
+	return newFileConsumer(logger, os.Getenv)
+}
+
+// newFileConsumer creates a file consumer from the FILE_INPUT_* settings getenv returns
+func newFileConsumer(logger *slog.Logger, getenv func(string) string) (*FileConsumer, error) {
 	// Read configuration from environment variables
-	dir := os.Getenv("FILE_INPUT_DIR")
+	dir := getenv("FILE_INPUT_DIR")
 	if dir == "" {
 		dir = "/tmp/file-input"
 	}
 
-	pattern := os.Getenv("FILE_INPUT_PATTERN")
+	pattern := getenv("FILE_INPUT_PATTERN")
 	if pattern == "" {
 		pattern = "*"
 	}
 
-	pollIntervalStr := os.Getenv("FILE_INPUT_POLL_INTERVAL")
+	pollIntervalStr := getenv("FILE_INPUT_POLL_INTERVAL")
 	pollInterval := 5 * time.Second
 	if pollIntervalStr != "" {
 		effectiveLogger := logger
@@ -87,26 +109,26 @@ func NewFileConsumer(logger *slog.Logger) (*FileConsumer, error) {
 			pollInterval = parsed
 		}
 	}
-	subject := os.Getenv("FILE_INPUT_NATS_SUBJECT")
+	subject := getenv("FILE_INPUT_NATS_SUBJECT")
 	if subject == "" {
 		subject = "file.input"
 	}
 
 	// Read archive/error directory configuration
-	archiveDir := os.Getenv("FILE_INPUT_ARCHIVE_DIR")
-	errorDir := os.Getenv("FILE_INPUT_ERROR_DIR")
-	deleteAfterProcessing := os.Getenv("FILE_INPUT_DELETE_AFTER_PROCESSING") == "true"
+	archiveDir := getenv("FILE_INPUT_ARCHIVE_DIR")
+	errorDir := getenv("FILE_INPUT_ERROR_DIR")
+	deleteAfterProcessing := getenv("FILE_INPUT_DELETE_AFTER_PROCESSING") == "true"
 
 	// Read retry configuration
 	maxRetries := 3
-	if maxRetriesStr := os.Getenv("FILE_INPUT_MAX_RETRIES"); maxRetriesStr != "" {
+	if maxRetriesStr := getenv("FILE_INPUT_MAX_RETRIES"); maxRetriesStr != "" {
 		if parsed, err := strconv.Atoi(maxRetriesStr); err == nil && parsed > 0 {
 			maxRetries = parsed
 		}
 	}
 
 	retryBackoffMs := 1000
-	if retryBackoffStr := os.Getenv("FILE_INPUT_RETRY_BACKOFF_MS"); retryBackoffStr != "" {
+	if retryBackoffStr := getenv("FILE_INPUT_RETRY_BACKOFF_MS"); retryBackoffStr != "" {
 		if parsed, err := strconv.Atoi(retryBackoffStr); err == nil && parsed > 0 {
 			retryBackoffMs = parsed
 		}
@@ -114,12 +136,55 @@ func NewFileConsumer(logger *slog.Logger) (*FileConsumer, error) {
 
 	// Read archive retention configuration
 	archiveRetentionDays := 30
-	if retentionStr := os.Getenv("FILE_INPUT_ARCHIVE_RETENTION_DAYS"); retentionStr != "" {
+	if retentionStr := getenv("FILE_INPUT_ARCHIVE_RETENTION_DAYS"); retentionStr != "" {
 		if parsed, err := strconv.Atoi(retentionStr); err == nil && parsed > 0 {
 			archiveRetentionDays = parsed
 		}
 	}
 
+	// Read decompression mode: none (default), auto (by extension, then magic bytes), gzip or zstd
+	decompression := strings.ToLower(getenv("FILE_INPUT_DECOMPRESSION"))
+	if decompression != "auto" {
+		normalized, err := normalizeCompression(decompression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FILE_INPUT_DECOMPRESSION: %w", err)
+		}
+		decompression = normalized
+	}
+	maxDecompressedSize := defaultMaxDecompressedSize
+	if sizeStr := getenv("FILE_INPUT_MAX_DECOMPRESSED_SIZE"); sizeStr != "" {
+		if parsed, err := strconv.ParseInt(sizeStr, 10, 64); err == nil && parsed > 0 {
+			maxDecompressedSize = parsed
+		}
+	}
+
+	// Read archive expansion configuration
+	expandArchives := getenv("FILE_INPUT_EXPAND_ARCHIVES") == "true"
+	maxArchiveMemberSize := int64(100 * 1024 * 1024)
+	if sizeStr := getenv("FILE_INPUT_ARCHIVE_MAX_MEMBER_SIZE"); sizeStr != "" {
+		if parsed, err := strconv.ParseInt(sizeStr, 10, 64); err == nil && parsed > 0 {
+			maxArchiveMemberSize = parsed
+		}
+	}
+
+	// Read decryption and signature verification configuration
+	decryptor, err := newDecryptingConverter(
+		getenv("FILE_INPUT_DECRYPTION"),
+		getenv("FILE_INPUT_DECRYPTION_KEY_FILE"),
+		getenv("FILE_INPUT_DECRYPTION_KEY_PASSPHRASE"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid FILE_INPUT_DECRYPTION configuration: %w", err)
+	}
+
+	var signatureKeyring openpgp.EntityList
+	if keyringFile := getenv("FILE_INPUT_SIGNATURE_KEYRING_FILE"); keyringFile != "" {
+		signatureKeyring, err = loadPGPKeyRing(keyringFile)
+		if err != nil {
+			return nil, fmt.Errorf("invalid FILE_INPUT_SIGNATURE_KEYRING_FILE: %w", err)
+		}
+	}
+
 	// Validate configuration
 	if err := validateFileInputConfig(dir, pattern, pollInterval); err != nil {
 		return nil, err
@@ -129,7 +194,21 @@ func NewFileConsumer(logger *slog.Logger) (*FileConsumer, error) {
 		logger = slog.Default()
 	}
 
-	bufferSizeStr := os.Getenv("FILE_INPUT_BUFFER_SIZE")
+	// Read the directory permissions and NATS server used by Start
+	dirPerm := os.FileMode(0755)
+	if permStr := getenv("FILE_INPUT_PERMISSIONS"); permStr != "" {
+		if parsed, err := strconv.ParseUint(permStr, 8, 32); err != nil {
+			logger.Warn("invalid FILE_INPUT_PERMISSIONS, using default", "value", permStr, "error", err, "default", dirPerm)
+		} else {
+			dirPerm = os.FileMode(parsed)
+		}
+	}
+	natsURL := getenv("FILE_INPUT_NATS_URL")
+	if natsURL == "" {
+		natsURL = nats.DefaultURL
+	}
+
+	bufferSizeStr := getenv("FILE_INPUT_BUFFER_SIZE")
 	bufferSize := 100
 	if bufferSizeStr != "" {
 		if parsed, err := strconv.Atoi(bufferSizeStr); err == nil && parsed > 0 {
@@ -140,6 +219,8 @@ func NewFileConsumer(logger *slog.Logger) (*FileConsumer, error) {
 		dir:                   dir,
 		pattern:               pattern,
 		pollInterval:          pollInterval,
+		dirPerm:               dirPerm,
+		natsURL:               natsURL,
 		subject:               subject,
 		archiveDir:            archiveDir,
 		errorDir:              errorDir,
@@ -147,10 +228,20 @@ func NewFileConsumer(logger *slog.Logger) (*FileConsumer, error) {
 		maxRetries:            maxRetries,
 		retryBackoffMs:        retryBackoffMs,
 		archiveRetentionDays:  archiveRetentionDays,
+		decompression:         decompression,
+		maxDecompressedSize:   maxDecompressedSize,
+		expandArchives:        expandArchives,
+		maxArchiveMemberSize:  maxArchiveMemberSize,
+		decryptor:             decryptor,
+		signatureKeyring:      signatureKeyring,
+		store:                 localFileStore{},
+		source:                "FileConsumer",
+		component:             "file-input",
 		logger:                logger,
 		messages:              make(chan *envelope.Envelope, bufferSize),
 		processedFiles:        make(map[string]ProcessedFile),
 		failedFiles:           make(map[string]FileRetry),
+		archiveProgress:       make(map[string]int),
 	}, nil
 }
 
@@ -164,53 +255,77 @@ func (f *FileConsumer) Start(ctx context.Context) error {
 	f.mu.Unlock()
 
 	// Create directory if it doesn't exist
-	dirPerm := os.FileMode(0755)
-	if permStr := os.Getenv("FILE_INPUT_PERMISSIONS"); permStr != "" {
-		if parsed, err := strconv.ParseUint(permStr, 8, 32); err != nil {
-			f.logger.Warn("invalid FILE_INPUT_PERMISSIONS, using default", "value", permStr, "error", err, "default", dirPerm)
-		} else {
-			dirPerm = os.FileMode(parsed)
-		}
-	}
-	if err := os.MkdirAll(f.dir, dirPerm); err != nil {
+	if err := f.store.MkdirAll(f.dir, f.dirPerm); err != nil {
 		return fmt.Errorf("create input directory: %w", err)
 	}
 
 	// Connect to NATS
-	natsURL := os.Getenv("FILE_INPUT_NATS_URL")
-	if natsURL == "" {
-		natsURL = nats.DefaultURL
-	}
-
-	nc, err := nats.Connect(natsURL)
+	nc, err := nats.Connect(f.natsURL)
 	if err != nil {
 		return fmt.Errorf("connect to NATS: %w", err)
 	}
-	f.nc = nc
 
-	// Create cancellable context
+	// Close may have run while connecting
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		nc.Close()
+		return fmt.Errorf("file consumer already stopped")
+	}
+	f.nc = nc
 	f.ctx, f.cancel = context.WithCancel(ctx)
+	f.pollDone = make(chan struct{})
+	f.mu.Unlock()
 
 	// Start polling goroutine
 	go f.pollLoop()
 
-	f.logger.Info("File Consumer started", "dir", f.dir, "pattern", f.pattern, "interval", f.pollInterval)
+	f.logger.Info("File Consumer started", "store", f.store.Describe(), "dir", f.dir, "pattern", f.pattern, "interval", f.pollInterval)
 	return nil
 }
 
+// CheckHealth reports whether the input directory and the NATS connection are usable
+func (f *FileConsumer) CheckHealth(ctx context.Context) error {
+	f.mu.Lock()
+	closed, nc := f.closed, f.nc
+	f.mu.Unlock()
+	if closed {
+		return fmt.Errorf("file consumer closed")
+	}
+	if _, err := f.store.Stat(f.dir); err != nil {
+		return fmt.Errorf("input directory on %s: %w", f.store.Describe(), err)
+	}
+	if nc != nil {
+		return natsConnHealth(nc)
+	}
+	return nil
+}
+
+// SetPipeline labels the consumer's metrics with the pipeline it runs in
+func (f *FileConsumer) SetPipeline(name string) {
+	f.pipeline = name
+}
+
+// Close stops polling and waits for the poll in progress, which may be delivering an
+// envelope, before closing the NATS connection and the messages channel
 func (f *FileConsumer) Close() error {
 	f.closedOnce.Do(func() {
 		f.mu.Lock()
-		defer f.mu.Unlock()
 		f.closed = true
-		if f.cancel != nil {
-			f.cancel()
+		cancel, pollDone, nc := f.cancel, f.pollDone, f.nc
+		f.mu.Unlock()
+
+		if cancel != nil {
+			cancel()
+		}
+		if pollDone != nil {
+			<-pollDone
 		}
-		if f.ticker != nil {
-			f.ticker.Stop()
+		if nc != nil {
+			nc.Close()
 		}
-		if f.nc != nil {
-			f.nc.Close()
+		if err := f.store.Close(); err != nil {
+			f.logger.Warn("Failed to close file store", "store", f.store.Describe(), "err", err)
 		}
 		close(f.messages)
 	})
@@ -228,20 +343,22 @@ func (f *FileConsumer) Read(ctx context.Context) (*envelope.Envelope, error) {
 		if !ok {
 			return nil, fmt.Errorf("messages channel closed")
 		}
+		metrics.SetQueueDepth(f.pipeline, f.component, len(f.messages))
 		return env, nil
 	}
 }
 
 // pollLoop runs in a goroutine and polls the directory for files
 func (f *FileConsumer) pollLoop() {
-	f.ticker = time.NewTicker(f.pollInterval)
-	defer f.ticker.Stop()
+	defer close(f.pollDone)
+	ticker := time.NewTicker(f.pollInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-f.ctx.Done():
 			return
-		case <-f.ticker.C:
+		case <-ticker.C:
 			f.processFiles()
 		}
 	}
@@ -253,15 +370,21 @@ func (f *FileConsumer) processFiles() {
 	globPattern := filepath.Join(f.dir, f.pattern)
 
 	// List files matching pattern
-	files, err := filepath.Glob(globPattern)
+	files, err := f.store.Glob(globPattern)
 	if err != nil {
 		f.logger.Error("Failed to glob files", "pattern", globPattern, "err", err)
 		return
 	}
 
+	// Archives are always picked up when expansion is enabled; the pattern then
+	// applies to their members instead
+	if f.expandArchives {
+		files = f.appendArchiveFiles(files)
+	}
+
 	for _, filePath := range files {
 		// Skip directories
-		info, err := os.Stat(filePath)
+		info, err := f.store.Stat(filePath)
 		if err != nil {
 			f.logger.Warn("Failed to stat file", "path", filePath, "err", err)
 			continue
@@ -270,6 +393,11 @@ func (f *FileConsumer) processFiles() {
 			continue
 		}
 
+		// Detached signatures are consumed together with the file they sign
+		if f.signatureKeyring != nil && strings.HasSuffix(filePath, signatureExtension) {
+			continue
+		}
+
 		// Check if file is locked
 		if f.isFileLocked(filePath) {
 			f.logger.Debug("File is locked, skipping", "path", filePath)
@@ -281,6 +409,14 @@ func (f *FileConsumer) processFiles() {
 			f.logger.Debug("Retrying failed file", "path", filePath)
 		}
 
+		// Expand archives into one envelope per member
+		if f.expandArchives && isArchiveFile(f.logicalFilePath(filePath)) {
+			if err := f.processArchive(filePath); err != nil {
+				f.logger.Error("Failed to process archive", "path", filePath, "err", err)
+			}
+			continue
+		}
+
 		// Process file
 		if err := f.processFile(filePath); err != nil {
 			f.logger.Error("Failed to process file", "path", filePath, "err", err)
@@ -293,9 +429,30 @@ func (f *FileConsumer) processFiles() {
 	}
 }
 
+// appendArchiveFiles adds archive files from the input directory that the glob did not match
+func (f *FileConsumer) appendArchiveFiles(files []string) []string {
+	entries, err := f.store.ReadDir(f.dir)
+	if err != nil {
+		f.logger.Warn("Failed to list input directory for archives", "dir", f.dir, "err", err)
+		return files
+	}
+
+	seen := make(map[string]bool, len(files))
+	for _, filePath := range files {
+		seen[filePath] = true
+	}
+	for _, entry := range entries {
+		filePath := filepath.Join(f.dir, entry.Name())
+		if !entry.IsDir() && isArchiveFile(f.logicalFilePath(filePath)) && !seen[filePath] {
+			files = append(files, filePath)
+		}
+	}
+	return files
+}
+
 // calculateFileHash computes SHA256 hash of first 64KB of file
 func (f *FileConsumer) calculateFileHash(filePath string) (string, error) {
-	file, err := os.Open(filePath)
+	file, err := f.store.Open(filePath)
 	if err != nil {
 		return "", err
 	}
@@ -315,7 +472,7 @@ func (f *FileConsumer) calculateFileHash(filePath string) (string, error) {
 func (f *FileConsumer) isFileProcessed(filePath string) (bool, error) {
 	fileName := filepath.Base(filePath)
 
-	info, err := os.Stat(filePath)
+	info, err := f.store.Stat(filePath)
 	if err != nil {
 		return false, err
 	}
@@ -358,10 +515,17 @@ func (f *FileConsumer) recordProcessedFile(filePath string, hash string, mtime i
 	delete(f.failedFiles, fileName)
 }
 
+// failedAttempts returns how many times processing a file has failed
+func (f *FileConsumer) failedAttempts(filePath string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.failedFiles[filepath.Base(filePath)].Attempts
+}
+
 // isFileLocked checks if file is currently open/being written
 func (f *FileConsumer) isFileLocked(filePath string) bool {
 	// Try to open file - if locked, this will fail
-	file, err := os.Open(filePath)
+	file, err := f.store.Open(filePath)
 	if err != nil {
 		// File is likely locked or has permission issues
 		return true
@@ -369,7 +533,7 @@ func (f *FileConsumer) isFileLocked(filePath string) bool {
 	defer file.Close()
 
 	// Check for recent modification (likely being written)
-	info, err := os.Stat(filePath)
+	info, err := f.store.Stat(filePath)
 	if err != nil {
 		return true
 	}
@@ -460,15 +624,16 @@ func (f *FileConsumer) moveToArchive(filePath string) error {
 	today := time.Now().Format("2006-01-02")
 	archivePath := filepath.Join(f.archiveDir, today)
 
-	if err := os.MkdirAll(archivePath, 0o755); err != nil {
+	if err := f.store.MkdirAll(archivePath, 0o755); err != nil {
 		return fmt.Errorf("create archive directory: %w", err)
 	}
 
 	// Move file
 	destPath := filepath.Join(archivePath, filepath.Base(filePath))
-	if err := os.Rename(filePath, destPath); err != nil {
+	if err := f.store.Rename(filePath, destPath); err != nil {
 		return fmt.Errorf("move to archive: %w", err)
 	}
+	f.moveSignature(filePath, destPath)
 
 	f.logger.Info("Moved file to archive", "source", filePath, "dest", destPath)
 	return nil
@@ -484,21 +649,22 @@ func (f *FileConsumer) moveToError(filePath string, errMsg string) error {
 	today := time.Now().Format("2006-01-02")
 	errorPath := filepath.Join(f.errorDir, today)
 
-	if err := os.MkdirAll(errorPath, 0o755); err != nil {
+	if err := f.store.MkdirAll(errorPath, 0o755); err != nil {
 		return fmt.Errorf("create error directory: %w", err)
 	}
 
 	// Move file
 	fileName := filepath.Base(filePath)
 	destPath := filepath.Join(errorPath, fileName)
-	if err := os.Rename(filePath, destPath); err != nil {
+	if err := f.store.Rename(filePath, destPath); err != nil {
 		return fmt.Errorf("move to error: %w", err)
 	}
+	f.moveSignature(filePath, destPath)
 
 	// Create .error metadata file
 	errorMetadataPath := destPath + ".error"
 	metadata := fmt.Sprintf("timestamp=%s\nerror=%s\n", time.Now().Format(time.RFC3339), errMsg)
-	if err := os.WriteFile(errorMetadataPath, []byte(metadata), 0o644); err != nil {
+	if err := f.store.WriteFile(errorMetadataPath, []byte(metadata), 0o644); err != nil {
 		f.logger.Warn("Failed to write error metadata", "path", errorMetadataPath, "err", err)
 	}
 
@@ -506,12 +672,27 @@ func (f *FileConsumer) moveToError(filePath string, errMsg string) error {
 	return nil
 }
 
+// moveSignature moves a file's detached signature alongside it, if verification is enabled
+func (f *FileConsumer) moveSignature(filePath, destPath string) {
+	if f.signatureKeyring == nil {
+		return
+	}
+	if err := f.store.Rename(filePath+signatureExtension, destPath+signatureExtension); err != nil && !errors.Is(err, os.ErrNotExist) {
+		f.logger.Warn("Failed to move detached signature", "source", filePath+signatureExtension, "err", err)
+	}
+}
+
 // handleProcessedFile determines what to do with a successfully processed file
 func (f *FileConsumer) handleProcessedFile(filePath string) error {
 	if f.deleteAfterProcessing {
-		if err := os.Remove(filePath); err != nil {
+		if err := f.store.Remove(filePath); err != nil {
 			return fmt.Errorf("delete processed file: %w", err)
 		}
+		if f.signatureKeyring != nil {
+			if err := f.store.Remove(filePath + signatureExtension); err != nil && !errors.Is(err, os.ErrNotExist) {
+				f.logger.Warn("Failed to delete detached signature", "path", filePath+signatureExtension, "err", err)
+			}
+		}
 		f.logger.Info("Deleted processed file", "path", filePath)
 		return nil
 	}
@@ -532,7 +713,7 @@ func (f *FileConsumer) cleanupOldArchives() {
 
 	cutoffTime := time.Now().AddDate(0, 0, -f.archiveRetentionDays)
 
-	entries, err := os.ReadDir(f.archiveDir)
+	entries, err := f.store.ReadDir(f.archiveDir)
 	if err != nil {
 		f.logger.Debug("Failed to read archive directory", "path", f.archiveDir, "err", err)
 		return
@@ -544,13 +725,13 @@ func (f *FileConsumer) cleanupOldArchives() {
 		}
 
 		dirPath := filepath.Join(f.archiveDir, entry.Name())
-		info, err := os.Stat(dirPath)
+		info, err := f.store.Stat(dirPath)
 		if err != nil {
 			continue
 		}
 
 		if info.ModTime().Before(cutoffTime) {
-			if err := os.RemoveAll(dirPath); err != nil {
+			if err := f.store.RemoveAll(dirPath); err != nil {
 				f.logger.Warn("Failed to cleanup old archive", "path", dirPath, "err", err)
 			} else {
 				f.logger.Info("Cleaned up old archive directory", "path", dirPath)
@@ -571,16 +752,9 @@ func (f *FileConsumer) processFile(filePath string) error {
 	}
 
 	// Read file contents
-	content, err := os.ReadFile(filePath)
+	content, err := f.readFileContent(filePath)
 	if err != nil {
-		f.recordFailedFile(filePath, err.Error())
-		if f.failedFiles[filepath.Base(filePath)].Attempts >= f.maxRetries {
-			if err := f.moveToError(filePath, fmt.Sprintf("max retries exceeded: %v", err)); err != nil {
-				f.logger.Error("Failed to move file to error directory", "path", filePath, "err", err)
-			}
-			return nil
-		}
-		return fmt.Errorf("read file: %w", err)
+		return f.handleReadFailure(filePath, err)
 	}
 
 	// Calculate file hash for reprocessing prevention
@@ -593,11 +767,24 @@ func (f *FileConsumer) processFile(filePath string) error {
 	// Create envelope using the proper structure
 	env := envelope.New()
 	env.ID = uuid.New().String()
-	env.Source = "FileConsumer"
+	env.Source = f.source
 	env.Payload = content
 	env.PayloadSize = int64(len(content))
-	env.ContentType = f.detectContentType(filePath)
+	env.ContentType = f.detectContentType(f.logicalFilePath(filePath))
+	env.Metadata = map[string]string{"filename": filepath.Base(filePath)}
 
+	if err := f.deliverEnvelope(filePath, env); err != nil {
+		return err
+	}
+	f.finishFile(filePath, fileHash)
+
+	f.logger.Info("Processed file", "filename", filepath.Base(filePath), "size", len(content), "id", env.ID)
+	return nil
+}
+
+// deliverEnvelope hands an envelope to Read() and publishes it to NATS.
+// Failures are recorded against filePath so the file is retried later.
+func (f *FileConsumer) deliverEnvelope(filePath string, env *envelope.Envelope) error {
 	// Check for context cancellation before attempting to send to the channel
 	if err := f.ctx.Err(); err != nil {
 		return err
@@ -607,6 +794,7 @@ func (f *FileConsumer) processFile(filePath string) error {
 	sendTimeout := 5 * time.Second
 	select {
 	case f.messages <- env:
+		metrics.SetQueueDepth(f.pipeline, f.component, len(f.messages))
 		// Only publish to NATS after successful channel send
 		data, err := envelope.Marshal(env)
 		if err != nil {
@@ -617,36 +805,133 @@ func (f *FileConsumer) processFile(filePath string) error {
 			f.recordFailedFile(filePath, err.Error())
 			return fmt.Errorf("publish to NATS: %w", err)
 		}
-		var mtime int64
+		return nil
+	case <-time.After(sendTimeout):
+		return fmt.Errorf("timeout sending envelope to messages channel (buffer may be full)")
+	case <-f.ctx.Done():
+		return f.ctx.Err()
+	}
+}
+
+// finishFile archives or deletes a fully delivered file and records it as processed
+func (f *FileConsumer) finishFile(filePath string, fileHash string) {
+	var mtime int64
+	info, err := f.store.Stat(filePath)
+	if err != nil {
+		// If the file has been moved or deleted after processing, we still
+		// record the current time to prevent unintended reprocessing.
+		mtime = time.Now().Unix()
+		f.logger.Debug("Failed to stat file after processing; using current time as mtime", "path", filePath, "err", err)
+	} else {
+		mtime = info.ModTime().Unix()
+	}
+
+	if err := f.handleProcessedFile(filePath); err != nil {
+		f.logger.Error("Failed to handle processed file", "path", filePath, "err", err)
+	}
+
+	// Record file as processed
+	f.recordProcessedFile(filePath, fileHash, mtime)
+}
+
+// handleReadFailure records a failed read and moves the file to the error directory once it
+// can never succeed (rejected content, or content that decompresses beyond the limit) or
+// has exhausted its retries. Returns nil when the file was moved.
+func (f *FileConsumer) handleReadFailure(filePath string, err error) error {
+	f.recordFailedFile(filePath, err.Error())
+
+	reason := ""
+	switch {
+	case errors.Is(err, errArchiveRejected), errors.Is(err, errSignatureInvalid), errors.Is(err, errDecompressedTooLarge):
+		reason = err.Error()
+	case f.failedAttempts(filePath) >= f.maxRetries:
+		reason = fmt.Sprintf("max retries exceeded: %v", err)
+	default:
+		return fmt.Errorf("read file: %w", err)
+	}
+
+	if err := f.moveToError(filePath, reason); err != nil {
+		f.logger.Error("Failed to move file to error directory", "path", filePath, "err", err)
+	}
+	return nil
+}
+
+// readFileContent reads a file, verifies its detached signature, then transparently
+// decrypts and decompresses it according to the configured modes. Decrypted content is
+// only ever held in memory.
+func (f *FileConsumer) readFileContent(filePath string) ([]byte, error) {
+	content, err := f.store.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature covers the file exactly as delivered
+	if f.signatureKeyring != nil {
+		signature, err := f.store.ReadFile(filePath + signatureExtension)
 		if err != nil {
-			// If the file has been moved or deleted after processing, we still
-			// record the current time to prevent unintended reprocessing.
-			mtime = time.Now().Unix()
-			f.logger.Debug("Failed to stat file after processing; using current time as mtime", "path", filePath, "err", err)
-		} else {
-			mtime = info.ModTime().Unix()
+			return nil, fmt.Errorf("read detached signature: %w", err)
+		}
+		if err := verifyDetachedSignature(f.signatureKeyring, content, signature); err != nil {
+			return nil, err
 		}
+	}
 
-		if err := f.handleProcessedFile(filePath); err != nil {
-			f.logger.Error("Failed to handle processed file", "path", filePath, "err", err)
+	if f.decryptor != nil {
+		content, err = f.decryptor.Decrypt(content, f.maxDecompressedSize)
+		if err != nil {
+			return nil, err
 		}
+	}
 
-		// Record file as processed
+	algorithm := f.compressionFor(f.stripEncryptionExtension(filePath), content)
+	if algorithm == CompressionNone {
+		return content, nil
+	}
 
-		// Record file as processed
-		f.recordProcessedFile(filePath, fileHash, mtime)
+	decompressed, err := decompress(algorithm, content, f.maxDecompressedSize)
+	if err != nil {
+		return nil, err
+	}
+	f.logger.Debug("Decompressed file", "path", filePath, "compression", algorithm, "compressed_size", len(content), "size", len(decompressed))
+	return decompressed, nil
+}
 
-		f.logger.Info("Processed file", "filename", filepath.Base(filePath), "size", len(content), "id", env.ID)
-		return nil
-	case <-time.After(sendTimeout):
-		return fmt.Errorf("timeout sending envelope to messages channel (buffer may be full)")
-	case <-f.ctx.Done():
-		return f.ctx.Err()
+// compressionFor resolves the compression algorithm for a file
+func (f *FileConsumer) compressionFor(filePath string, content []byte) string {
+	if f.decompression != "auto" {
+		return f.decompression
 	}
+	if algorithm := compressionFromExtension(filePath); algorithm != CompressionNone {
+		return algorithm
+	}
+	return compressionFromMagic(content)
+}
+
+// stripEncryptionExtension removes an .age/.pgp suffix when decryption is enabled
+func (f *FileConsumer) stripEncryptionExtension(filePath string) string {
+	if f.decryptor == nil || encryptionFromExtension(filePath) == EncryptionNone {
+		return filePath
+	}
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath))
+}
+
+// logicalFilePath strips encryption and compression suffixes that are handled transparently
+// (e.g. orders.csv.gz.age -> orders.csv)
+func (f *FileConsumer) logicalFilePath(filePath string) string {
+	filePath = f.stripEncryptionExtension(filePath)
+	if f.decompression == CompressionNone || compressionFromExtension(filePath) == CompressionNone {
+		return filePath
+	}
+	return strings.TrimSuffix(filePath, filepath.Ext(filePath))
 }
 
 // detectContentType determines the MIME type from file extension
 func (f *FileConsumer) detectContentType(filePath string) string {
+	return contentTypeForPath(filePath)
+}
+
+// contentTypeForPath determines the MIME type from a file or object key extension
+func contentTypeForPath(filePath string) string {
 	ext := filepath.Ext(filePath)
 	if ext == "" {
 		return "application/octet-stream"
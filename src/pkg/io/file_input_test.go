@@ -25,6 +25,51 @@ func TestFileConsumer_NewFileConsumer(t *testing.T) {
 	}
 }
 
+func TestNewFileSettings(t *testing.T) {
+	t.Setenv("FILE_INPUT_DIR", "/from/env")
+
+	settings, err := newFileSettings("FILE_INPUT_", []byte(`{"dir": "/data", "max_retries": 3, "delete_after_processing": true, "circuit_breaker": {}}`), "circuit_breaker")
+	if err != nil {
+		t.Fatalf("newFileSettings() error = %v", err)
+	}
+	if got := settings.get("FILE_INPUT_DIR"); got != "/data" {
+		t.Errorf("FILE_INPUT_DIR = %q, want the config's /data", got)
+	}
+	if got := settings.get("FILE_INPUT_MAX_RETRIES") + " " + settings.get("FILE_INPUT_DELETE_AFTER_PROCESSING"); got != "3 true" {
+		t.Errorf("Settings = %q, want 3 true", got)
+	}
+	if got := settings.get("FILE_INPUT_PATTERN"); got != "" {
+		t.Errorf("FILE_INPUT_PATTERN = %q, want unset", got)
+	}
+	if err := settings.checkUnused(); err != nil {
+		t.Errorf("checkUnused() error = %v", err)
+	}
+
+	// Without config the environment is used
+	settings, err = newFileSettings("FILE_INPUT_", []byte(`{"circuit_breaker": {}}`), "circuit_breaker")
+	if err != nil {
+		t.Fatalf("newFileSettings() error = %v", err)
+	}
+	if got := settings.get("FILE_INPUT_DIR"); got != "/from/env" {
+		t.Errorf("FILE_INPUT_DIR = %q, want /from/env", got)
+	}
+
+	for config, want := range map[string]string{
+		`{"dir": "/data", "sftp_hots": "x"}`: "unknown config fields: sftp_hots",
+		`{"dir": ["/data"]}`:                 "dir must be a string",
+		`["/data"]`:                          "config must be a JSON object",
+	} {
+		settings, err := newFileSettings("FILE_INPUT_", []byte(config))
+		if err == nil {
+			settings.get("FILE_INPUT_DIR")
+			err = settings.checkUnused()
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Config %s: error = %v, want %q", config, err, want)
+		}
+	}
+}
+
 func TestFileConsumer_ValidateFails_NegativePollInterval(t *testing.T) {
 	err := validateFileInputConfig("/tmp", "*", -1*time.Second)
 	if err == nil {
@@ -726,3 +726,135 @@ func TestFileProducerPayloadSizeValidation(t *testing.T) {
 		})
 	}
 }
+
+// TestFileCompressionRoundTrip tests that compressed producer output is transparently
+// decompressed by the consumer
+func TestFileCompressionRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		compression   string
+		decompression string
+		extension     string
+	}{
+		{"gzip", "auto", ".json.gz"},
+		{"zstd", "auto", ".json.zst"},
+		{"zstd", "zstd", ".json.zst"},
+	} {
+		t.Run(tc.compression+"-"+tc.decompression, func(t *testing.T) {
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+			dir := t.TempDir()
+
+			t.Setenv("FILE_OUTPUT_DIR", dir)
+			t.Setenv("FILE_OUTPUT_FILENAME_FORMAT", "{{.ID}}.{{.Extension}}")
+			t.Setenv("FILE_OUTPUT_COMPRESSION", tc.compression)
+
+			producer, err := NewFileProducer(logger)
+			if err != nil {
+				t.Fatalf("Failed to create producer: %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			if err := producer.Start(ctx); err != nil {
+				t.Fatalf("Failed to start producer: %v", err)
+			}
+			defer producer.Close()
+
+			payload := bytes.Repeat([]byte(`{"order":"A-1"}`), 50)
+			env := envelope.New()
+			env.ID = "compressed"
+			env.Payload = payload
+			env.ContentType = "application/json"
+
+			if err := producer.Write(ctx, env); err != nil {
+				t.Fatalf("Failed to write envelope: %v", err)
+			}
+
+			written := filepath.Join(dir, "compressed"+tc.extension)
+			raw, err := os.ReadFile(written)
+			if err != nil {
+				t.Fatalf("Expected compressed file %s: %v", written, err)
+			}
+			if bytes.Equal(raw, payload) {
+				t.Fatal("Output file was not compressed")
+			}
+
+			// Backdate the file so the consumer doesn't treat it as still being written
+			past := time.Now().Add(-time.Minute)
+			if err := os.Chtimes(written, past, past); err != nil {
+				t.Fatalf("Failed to backdate file: %v", err)
+			}
+
+			t.Setenv("FILE_INPUT_DIR", dir)
+			t.Setenv("FILE_INPUT_PATTERN", "*")
+			t.Setenv("FILE_INPUT_POLL_INTERVAL", "100ms")
+			t.Setenv("FILE_INPUT_DECOMPRESSION", tc.decompression)
+
+			consumer, err := NewFileConsumer(logger)
+			if err != nil {
+				t.Fatalf("Failed to create consumer: %v", err)
+			}
+			if err := consumer.Start(ctx); err != nil {
+				t.Skipf("Consumer could not start (NATS required): %v", err)
+			}
+			defer consumer.Close()
+
+			received, err := consumer.Read(ctx)
+			if err != nil {
+				t.Fatalf("Failed to read envelope: %v", err)
+			}
+			if !bytes.Equal(received.Payload, payload) {
+				t.Error("Consumer payload does not match original after decompression")
+			}
+			if received.ContentType != "application/json" {
+				t.Errorf("Expected content type application/json, got %s", received.ContentType)
+			}
+		})
+	}
+}
+
+// TestFileConsumerDecompressionByMagicBytes tests that auto mode sniffs compressed files
+// without a compression extension
+func TestFileConsumerDecompressionByMagicBytes(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	dir := t.TempDir()
+
+	t.Setenv("FILE_INPUT_DIR", dir)
+	t.Setenv("FILE_INPUT_DECOMPRESSION", "auto")
+
+	consumer, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("Failed to create consumer: %v", err)
+	}
+
+	compressed, err := compress(CompressionGzip, []byte("a,b,c\n1,2,3\n"))
+	if err != nil {
+		t.Fatalf("compress() error = %v", err)
+	}
+	path := filepath.Join(dir, "export.csv")
+	if err := os.WriteFile(path, compressed, 0o644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	content, err := consumer.readFileContent(path)
+	if err != nil {
+		t.Fatalf("readFileContent() error = %v", err)
+	}
+	if string(content) != "a,b,c\n1,2,3\n" {
+		t.Errorf("readFileContent() = %q, want decompressed CSV", content)
+	}
+
+	// With decompression disabled the raw bytes are passed through
+	t.Setenv("FILE_INPUT_DECOMPRESSION", "none")
+	passthrough, err := NewFileConsumer(logger)
+	if err != nil {
+		t.Fatalf("Failed to create consumer: %v", err)
+	}
+	raw, err := passthrough.readFileContent(path)
+	if err != nil {
+		t.Fatalf("readFileContent() error = %v", err)
+	}
+	if !bytes.Equal(raw, compressed) {
+		t.Error("readFileContent() should not decompress when disabled")
+	}
+}
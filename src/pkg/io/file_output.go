@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"math"
 	"os"
@@ -12,10 +14,11 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"syscall"
 	"text/template"
 	"time"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
+
 	"github.com/ValueRetail/vrsky/pkg/envelope"
 )
 
@@ -30,6 +33,10 @@ type FileProducer struct {
 	fsyncInterval  int
 	createSubdirs  bool
 	organizeBy     string
+	compression    string
+	encryptor      *encryptionConverter
+	signer         *openpgp.Entity
+	store          fileStore
 
 	// Runtime
 	absOutputDir     string
@@ -42,23 +49,28 @@ type FileProducer struct {
 
 // NewFileProducer creates a new file producer from environment configuration
 func NewFileProducer(logger *slog.Logger) (*FileProducer, error) {
+	return newFileProducer(logger, os.Getenv)
+}
+
+// newFileProducer creates a file producer from the FILE_OUTPUT_* settings getenv returns
+func newFileProducer(logger *slog.Logger, getenv func(string) string) (*FileProducer, error) {
 	// Initialize logger early so it's available for all operations
 	if logger == nil {
 		logger = slog.Default()
 	}
 
 	// Read configuration from environment variables
-	outputDir := os.Getenv("FILE_OUTPUT_DIR")
+	outputDir := getenv("FILE_OUTPUT_DIR")
 	if outputDir == "" {
 		outputDir = "/tmp/file-output"
 	}
 
-	fileNameFormat := os.Getenv("FILE_OUTPUT_FILENAME_FORMAT")
+	fileNameFormat := getenv("FILE_OUTPUT_FILENAME_FORMAT")
 	if fileNameFormat == "" {
 		fileNameFormat = "{{.ID}}.{{.Extension}}"
 	}
 
-	permissionsStr := os.Getenv("FILE_OUTPUT_PERMISSIONS")
+	permissionsStr := getenv("FILE_OUTPUT_PERMISSIONS")
 	permissions := os.FileMode(0o644)
 	if permissionsStr != "" {
 		if parsed, err := strconv.ParseInt(permissionsStr, 8, 32); err == nil {
@@ -70,7 +82,7 @@ func NewFileProducer(logger *slog.Logger) (*FileProducer, error) {
 
 	// Read chunk size for streaming writes (default: 64KB)
 	chunkSize := int64(64 * 1024)
-	if chunkSizeStr := os.Getenv("FILE_OUTPUT_CHUNK_SIZE"); chunkSizeStr != "" {
+	if chunkSizeStr := getenv("FILE_OUTPUT_CHUNK_SIZE"); chunkSizeStr != "" {
 		if parsed, err := strconv.ParseInt(chunkSizeStr, 10, 64); err == nil {
 			if parsed <= 0 {
 				logger.Warn("FILE_OUTPUT_CHUNK_SIZE must be positive; using default 64KB", "value", parsed)
@@ -82,20 +94,20 @@ func NewFileProducer(logger *slog.Logger) (*FileProducer, error) {
 		}
 	}
 
-	// Read max file size (default: 1GB)
-	maxFileSize := int64(1024 * 1024 * 1024)
-	if maxFileSizeStr := os.Getenv("FILE_OUTPUT_MAX_FILE_SIZE"); maxFileSizeStr != "" {
+	// Read max file size (default: 100MB)
+	maxFileSize := int64(100 * 1024 * 1024)
+	if maxFileSizeStr := getenv("FILE_OUTPUT_MAX_FILE_SIZE"); maxFileSizeStr != "" {
 		if parsed, err := strconv.ParseInt(maxFileSizeStr, 10, 64); err == nil {
 			maxFileSize = parsed
 		} else {
-			logger.Warn("Invalid FILE_OUTPUT_MAX_FILE_SIZE; using default 1GB", "value", maxFileSizeStr, "error", err)
+			logger.Warn("Invalid FILE_OUTPUT_MAX_FILE_SIZE; using default 100MB", "value", maxFileSizeStr, "error", err)
 		}
 	}
 
 	// Read fsync interval (default: 10 chunks)
 	// fsyncInterval = 0 means never fsync (valid), negative values are invalid
 	fsyncInterval := 10
-	if fsyncIntervalStr := os.Getenv("FILE_OUTPUT_FSYNC_INTERVAL"); fsyncIntervalStr != "" {
+	if fsyncIntervalStr := getenv("FILE_OUTPUT_FSYNC_INTERVAL"); fsyncIntervalStr != "" {
 		if parsed, err := strconv.ParseInt(fsyncIntervalStr, 10, 32); err == nil {
 			if parsed < 0 {
 				logger.Warn("FILE_OUTPUT_FSYNC_INTERVAL cannot be negative; using default 10", "value", parsed)
@@ -109,12 +121,12 @@ func NewFileProducer(logger *slog.Logger) (*FileProducer, error) {
 
 	// Read subdirectory creation flag (default: false)
 	createSubdirs := false
-	if createSubdirsStr := os.Getenv("FILE_OUTPUT_CREATE_SUBDIRS"); createSubdirsStr != "" {
+	if createSubdirsStr := getenv("FILE_OUTPUT_CREATE_SUBDIRS"); createSubdirsStr != "" {
 		createSubdirs = strings.ToLower(createSubdirsStr) == "true"
 	}
 
 	// Read organization strategy (default: "none")
-	organizeBy := os.Getenv("FILE_OUTPUT_ORGANIZE_BY")
+	organizeBy := getenv("FILE_OUTPUT_ORGANIZE_BY")
 	if organizeBy == "" {
 		organizeBy = "none"
 	}
@@ -124,21 +136,53 @@ func NewFileProducer(logger *slog.Logger) (*FileProducer, error) {
 		organizeBy = "none"
 	}
 
+	// Read compression algorithm (default: none)
+	compression, err := normalizeCompression(getenv("FILE_OUTPUT_COMPRESSION"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FILE_OUTPUT_COMPRESSION: %w", err)
+	}
+
+	// Read encryption configuration (default: none)
+	encryptor, err := newEncryptingConverter(getenv("FILE_OUTPUT_ENCRYPTION"), getenv("FILE_OUTPUT_ENCRYPTION_RECIPIENTS_FILE"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FILE_OUTPUT_ENCRYPTION configuration: %w", err)
+	}
+
+	// Read detached signature configuration (default: unsigned)
+	var signer *openpgp.Entity
+	if keyFile := getenv("FILE_OUTPUT_SIGNING_KEY_FILE"); keyFile != "" {
+		signer, err = loadPGPSigningKey(keyFile, getenv("FILE_OUTPUT_SIGNING_KEY_PASSPHRASE"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid FILE_OUTPUT_SIGNING_KEY_FILE: %w", err)
+		}
+	}
+
 	// Validate configuration
 	if err := validateFileOutputConfig(outputDir, fileNameFormat, permissions); err != nil {
 		return nil, err
 	}
 
+	// Parse and validate the filename template up front so misconfiguration fails fast
+	fileNameTemplate, err := parseFileNameTemplate(fileNameFormat)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FileProducer{
-		outputDir:      outputDir,
-		fileNameFormat: fileNameFormat,
-		permissions:    permissions,
-		chunkSize:      chunkSize,
-		maxFileSize:    maxFileSize,
-		fsyncInterval:  fsyncInterval,
-		createSubdirs:  createSubdirs,
-		organizeBy:     organizeBy,
-		logger:         logger,
+		outputDir:        outputDir,
+		fileNameFormat:   fileNameFormat,
+		permissions:      permissions,
+		chunkSize:        chunkSize,
+		maxFileSize:      maxFileSize,
+		fsyncInterval:    fsyncInterval,
+		createSubdirs:    createSubdirs,
+		organizeBy:       organizeBy,
+		compression:      compression,
+		encryptor:        encryptor,
+		signer:           signer,
+		store:            localFileStore{},
+		fileNameTemplate: fileNameTemplate,
+		logger:           logger,
 	}, nil
 }
 
@@ -153,25 +197,18 @@ func (f *FileProducer) Start(ctx context.Context) error {
 
 	// Create output directory if it doesn't exist
 	dirPermissions := f.permissions | 0o111
-	if err := os.MkdirAll(f.outputDir, dirPermissions); err != nil {
+	if err := f.store.MkdirAll(f.outputDir, dirPermissions); err != nil {
 		return fmt.Errorf("create output directory: %w", err)
 	}
 
 	// Cache the absolute output directory path for use in Write()
-	absDir, err := filepath.Abs(f.outputDir)
+	absDir, err := f.store.ResolvePath(f.outputDir)
 	if err != nil {
 		return fmt.Errorf("resolve output directory path: %w", err)
 	}
 	f.absOutputDir = absDir
 
-	// Parse and cache the filename template for use in Write()
-	tmpl, err := template.New("filename").Parse(f.fileNameFormat)
-	if err != nil {
-		return fmt.Errorf("invalid filename template: %w", err)
-	}
-	f.fileNameTemplate = tmpl
-
-	f.logger.Info("File Producer started", "dir", f.outputDir, "format", f.fileNameFormat, "permissions", fmt.Sprintf("%o", f.permissions))
+	f.logger.Info("File Producer started", "store", f.store.Describe(), "dir", f.outputDir, "format", f.fileNameFormat, "permissions", fmt.Sprintf("%o", f.permissions), "compression", f.compression, "encrypted", f.encryptor != nil, "signed", f.signer != nil)
 	return nil
 }
 
@@ -185,7 +222,7 @@ func (f *FileProducer) Write(ctx context.Context, env *envelope.Envelope) error
 	f.mu.Unlock()
 
 	// Verify that Start() has been called
-	if f.fileNameTemplate == nil {
+	if f.absOutputDir == "" {
 		return fmt.Errorf("file producer not started: call Start() before Write()")
 	}
 
@@ -194,8 +231,22 @@ func (f *FileProducer) Write(ctx context.Context, env *envelope.Envelope) error
 		return fmt.Errorf("invalid envelope: %w", err)
 	}
 
+	// Compress payload if configured
+	data, err := compress(f.compression, env.Payload)
+	if err != nil {
+		return fmt.Errorf("compress payload: %w", err)
+	}
+
+	// Encrypt after compressing so cleartext never reaches disk
+	if f.encryptor != nil {
+		data, err = f.encryptor.Encrypt(data)
+		if err != nil {
+			return fmt.Errorf("encrypt payload: %w", err)
+		}
+	}
+
 	// Check disk space availability
-	if err := f.checkDiskSpace(int64(len(env.Payload))); err != nil {
+	if err := f.checkDiskSpace(int64(len(data))); err != nil {
 		return fmt.Errorf("disk space check failed: %w", err)
 	}
 
@@ -210,6 +261,10 @@ func (f *FileProducer) Write(ctx context.Context, env *envelope.Envelope) error
 	if err != nil {
 		return fmt.Errorf("generate filename: %w", err)
 	}
+	fileName += compressionExtension(f.compression)
+	if f.encryptor != nil {
+		fileName += f.encryptor.Extension()
+	}
 
 	// Construct output directory (with organization subdirectory if applicable)
 	outputDir := f.outputDir
@@ -217,7 +272,7 @@ func (f *FileProducer) Write(ctx context.Context, env *envelope.Envelope) error
 		outputDir = filepath.Join(f.outputDir, organizedPath)
 		// Create subdirectory structure
 		dirPermissions := f.permissions | 0o111
-		if err := os.MkdirAll(outputDir, dirPermissions); err != nil {
+		if err := f.store.MkdirAll(outputDir, dirPermissions); err != nil {
 			return fmt.Errorf("create subdirectory: %w", err)
 		}
 	}
@@ -225,25 +280,15 @@ func (f *FileProducer) Write(ctx context.Context, env *envelope.Envelope) error
 	// Construct full path
 	filePath := filepath.Join(outputDir, fileName)
 
-	// Sanitize path to prevent directory traversal
-	absPath, err := filepath.Abs(filePath)
+	// Sanitize path to prevent directory traversal. Symlinks in the target path are
+	// resolved so a link cannot point outside the output directory.
+	resolvedAbsPath, err := f.store.ResolvePath(filePath)
 	if err != nil {
-		return fmt.Errorf("resolve absolute path: %w", err)
-	}
-	// Resolve symlinks in the target path. The file may not exist yet, so
-	// ignore "not exist" errors and fall back to the absolute path.
-	resolvedAbsPath := absPath
-	if resolved, err := filepath.EvalSymlinks(absPath); err == nil {
-		resolvedAbsPath = resolved
-	} else if !os.IsNotExist(err) {
-		return fmt.Errorf("resolve symlinks for target path: %w", err)
+		return fmt.Errorf("resolve target path: %w", err)
 	}
 
-	// Use cached absolute output directory (calculated in Start())
-	absOutputDir := f.absOutputDir
-
-	// Resolve symlinks in the output directory
-	resolvedOutputDir, err := filepath.EvalSymlinks(absOutputDir)
+	// Resolve symlinks in the cached output directory (calculated in Start())
+	resolvedOutputDir, err := f.store.ResolvePath(f.absOutputDir)
 	if err != nil {
 		return fmt.Errorf("resolve symlinks for output directory: %w", err)
 	}
@@ -257,7 +302,7 @@ func (f *FileProducer) Write(ctx context.Context, env *envelope.Envelope) error
 	}
 
 	// Open file for writing
-	file, err := os.OpenFile(resolvedAbsPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.permissions)
+	file, err := f.store.Create(resolvedAbsPath, f.permissions)
 	if err != nil {
 		return fmt.Errorf("open file: %w", err)
 	}
@@ -268,41 +313,47 @@ func (f *FileProducer) Write(ctx context.Context, env *envelope.Envelope) error
 	}()
 
 	// Write payload using streaming approach with checksums
-	checksum, err := f.streamWrite(file, env.Payload)
+	checksum, err := f.streamWrite(file, data)
 	if err != nil {
 		// Attempt to remove partially written file
-		_ = os.Remove(resolvedAbsPath)
+		_ = f.store.Remove(resolvedAbsPath)
 		return fmt.Errorf("stream write: %w", err)
 	}
 
-	f.logger.Info("Wrote file", "filename", fileName, "size", len(env.Payload), "id", env.ID, "checksum", checksum)
+	// Write a detached signature over the file exactly as stored
+	if f.signer != nil {
+		if err := f.writeSignature(resolvedAbsPath, data); err != nil {
+			_ = f.store.Remove(resolvedAbsPath)
+			return err
+		}
+	}
+
+	f.logger.Info("Wrote file", "filename", fileName, "size", len(env.Payload), "written", len(data), "compression", f.compression, "id", env.ID, "checksum", checksum)
 	return nil
 }
 
-// checkDiskSpace verifies that the output directory has sufficient free space
-func (f *FileProducer) checkDiskSpace(requiredSize int64) error {
-	var stat syscall.Statfs_t
-	if err := syscall.Statfs(f.absOutputDir, &stat); err != nil {
-		return fmt.Errorf("check disk space: %w", err)
+// writeSignature writes an ASCII-armored detached signature next to the written file
+func (f *FileProducer) writeSignature(filePath string, data []byte) error {
+	signature, err := signDetached(f.signer, data)
+	if err != nil {
+		return err
 	}
-
-	// Calculate available space in bytes, guarding against integer overflow
-	bavail := int64(stat.Bavail)
-	bsize := int64(stat.Bsize)
-	if bavail < 0 {
-		bavail = 0
+	if err := f.store.WriteFile(filePath+signatureExtension, signature, f.permissions); err != nil {
+		return fmt.Errorf("write detached signature: %w", err)
 	}
-	if bsize < 0 {
-		bsize = 0
+	return nil
+}
+
+// checkDiskSpace verifies that the output directory has sufficient free space.
+// Stores that cannot report free space (e.g. SFTP servers without statvfs) are not checked.
+func (f *FileProducer) checkDiskSpace(requiredSize int64) error {
+	available, err := f.store.FreeSpace(f.absOutputDir)
+	if errors.Is(err, errFreeSpaceUnknown) {
+		f.logger.Debug("Free space unknown, skipping disk space check", "store", f.store.Describe())
+		return nil
 	}
-	var available int64
-	if bavail == 0 || bsize == 0 {
-		available = 0
-	} else if bavail > math.MaxInt64/bsize {
-		// Cap at MaxInt64 to avoid overflow while representing "very large" free space
-		available = math.MaxInt64
-	} else {
-		available = bavail * bsize
+	if err != nil {
+		return err
 	}
 
 	// Require 2x the file size to be safe (avoid running disk out of space).
@@ -310,7 +361,7 @@ func (f *FileProducer) checkDiskSpace(requiredSize int64) error {
 	// Note: the limit (~4.6 EiB) is derived from int64 and is an internal safety bound,
 	//       not an application-level maximum file size.
 	if requiredSize > math.MaxInt64/2 {
-		return fmt.Errorf("internal size limit exceeded while checking disk space: required=%d bytes, max-safely-checkable=%d bytes", requiredSize, math.MaxInt64/2)
+		return fmt.Errorf("required size too large to check disk space safely: required=%d bytes, max-safely-checkable=%d bytes", requiredSize, math.MaxInt64/2)
 	}
 	required := requiredSize * 2
 	if available < required {
@@ -382,7 +433,7 @@ func (f *FileProducer) getOrganizedPath(env *envelope.Envelope) (string, error)
 
 // streamWrite writes payload from a reader to a file in chunks with periodic fsync
 // Returns the SHA256 checksum of the written data
-func (f *FileProducer) streamWrite(file *os.File, payload []byte) (string, error) {
+func (f *FileProducer) streamWrite(file storeFile, payload []byte) (string, error) {
 	hash := sha256.New()
 	bytesWritten := int64(0)
 	chunksWritten := 0
@@ -428,6 +479,20 @@ func (f *FileProducer) streamWrite(file *os.File, payload []byte) (string, error
 	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
 
+// CheckHealth reports whether the output directory is usable
+func (f *FileProducer) CheckHealth(ctx context.Context) error {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return fmt.Errorf("file producer closed")
+	}
+	if _, err := f.store.Stat(f.outputDir); err != nil {
+		return fmt.Errorf("output directory on %s: %w", f.store.Describe(), err)
+	}
+	return nil
+}
+
 // Close gracefully stops the file producer
 func (f *FileProducer) Close() error {
 	f.closedOnce.Do(func() {
@@ -435,6 +500,10 @@ func (f *FileProducer) Close() error {
 		f.closed = true
 		f.mu.Unlock()
 
+		if err := f.store.Close(); err != nil {
+			f.logger.Warn("Failed to close file store", "store", f.store.Describe(), "err", err)
+		}
+
 		f.logger.Info("File Producer closed")
 	})
 
@@ -453,17 +522,9 @@ func (f *FileProducer) generateFileName(env *envelope.Envelope) (string, error)
 		)
 	}
 
-	// Prepare template data
-	data := map[string]any{
-		"ID":        env.ID,
-		"Source":    safeSource,
-		"Extension": f.deriveExtension(env.ContentType),
-		"Timestamp": env.CreatedAt.Format(time.RFC3339),
-	}
-
 	// Use cached template for better performance
 	var buf bytes.Buffer
-	if err := f.fileNameTemplate.Execute(&buf, data); err != nil {
+	if err := f.fileNameTemplate.Execute(&buf, newFileNameData(env, safeSource)); err != nil {
 		return "", fmt.Errorf("failed to execute filename template: %w", err)
 	}
 
@@ -478,8 +539,80 @@ func (f *FileProducer) generateFileName(env *envelope.Envelope) (string, error)
 	return fileName, nil
 }
 
+// fileNameData is the data passed to the filename template
+type fileNameData struct {
+	ID            string
+	TenantID      string
+	IntegrationID string
+	Source        string
+	ContentType   string
+	Extension     string
+	Timestamp     string // RFC3339, kept for backwards compatibility; prefer CreatedAt with a custom layout
+	CreatedAt     time.Time
+	Metadata      map[string]string
+
+	payload    []byte
+	validating bool
+}
+
+// newFileNameData prepares the template data for an envelope
+func newFileNameData(env *envelope.Envelope, source string) fileNameData {
+	return fileNameData{
+		ID:            env.ID,
+		TenantID:      env.TenantID,
+		IntegrationID: env.IntegrationID,
+		Source:        source,
+		ContentType:   env.ContentType,
+		Extension:     extensionForContentType(env.ContentType),
+		Timestamp:     env.CreatedAt.Format(time.RFC3339),
+		CreatedAt:     env.CreatedAt,
+		Metadata:      env.Metadata,
+		payload:       env.Payload,
+	}
+}
+
+// JSON returns the value at a dotted path inside the JSON payload, e.g. {{.JSON "order.id"}}
+func (d fileNameData) JSON(path string) (string, error) {
+	if d.validating {
+		return "", nil
+	}
+	return lookupJSONPath(d.payload, path)
+}
+
+// parseFileNameTemplate parses the filename template and executes it once against
+// sample data so that unknown fields and bad function calls are reported at construction
+func parseFileNameTemplate(format string) (*template.Template, error) {
+	tmpl, err := template.New("filename").Funcs(templateFuncs()).Option("missingkey=zero").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filename template: %w", err)
+	}
+
+	sample := fileNameData{
+		ID:            "00000000-0000-0000-0000-000000000000",
+		TenantID:      "tenant",
+		IntegrationID: "integration",
+		Source:        "source",
+		ContentType:   "application/octet-stream",
+		Extension:     "bin",
+		Timestamp:     time.Unix(0, 0).UTC().Format(time.RFC3339),
+		CreatedAt:     time.Unix(0, 0).UTC(),
+		Metadata:      map[string]string{},
+		validating:    true,
+	}
+	if err := tmpl.Execute(io.Discard, sample); err != nil {
+		return nil, fmt.Errorf("invalid filename template: %w", err)
+	}
+
+	return tmpl, nil
+}
+
 // deriveExtension maps content type to file extension (without leading dot)
 func (f *FileProducer) deriveExtension(contentType string) string {
+	return extensionForContentType(contentType)
+}
+
+// extensionForContentType maps content type to file extension (without leading dot)
+func extensionForContentType(contentType string) string {
 	switch {
 	case strings.Contains(contentType, "application/json"):
 		return "json"
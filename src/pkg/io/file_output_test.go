@@ -930,3 +930,150 @@ func TestFileProducer_DiskSpaceOverflowProtection(t *testing.T) {
 
 	producer.Close()
 }
+
+// Test 21: Envelope fields, metadata, payload lookups and helper funcs in filename templates
+func TestFileProducer_RichFileNameTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   string
+		expected string
+	}{
+		{"tenant and integration", "{{.TenantID}}-{{.IntegrationID}}-{{.ID}}.{{.Extension}}", "acme-orders-test-123.json"},
+		{"custom date layout", "{{.CreatedAt.Format \"20060102\"}}-{{.ID}}", "20260203-test-123"},
+		{"date func", "{{date \"2006-01-02\" .CreatedAt}}.{{.Extension}}", "2026-02-03.json"},
+		{"metadata", "{{.Metadata.region}}-{{.ID}}", "eu-west-test-123"},
+		{"missing metadata with default", "{{.Metadata.missing | default \"none\"}}-{{.ID}}", "none-test-123"},
+		{"payload json path", "order-{{.JSON \"order.id\"}}.{{.Extension}}", "order-A-42.json"},
+		{"payload array index", "{{.JSON \"order.lines.1.sku\"}}", "SKU-2"},
+		{"lower and slug", "{{lower .TenantID}}-{{slug (.JSON \"order.customer\")}}", "acme-jane-o-connor-ltd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			t.Setenv("FILE_OUTPUT_DIR", tmpDir)
+			t.Setenv("FILE_OUTPUT_FILENAME_FORMAT", tt.format)
+
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+			producer, err := NewFileProducer(logger)
+			if err != nil {
+				t.Fatalf("NewFileProducer() error = %v", err)
+			}
+
+			env := envelope.New()
+			env.ID = "test-123"
+			env.TenantID = "acme"
+			env.IntegrationID = "orders"
+			env.CreatedAt = time.Date(2026, 2, 3, 10, 30, 45, 0, time.UTC)
+			env.ContentType = "application/json"
+			env.Metadata = map[string]string{"region": "eu-west"}
+			env.Payload = []byte(`{"order":{"id":"A-42","customer":"Jane O'Connor Ltd.","lines":[{"sku":"SKU-1"},{"sku":"SKU-2"}]}}`)
+
+			fileName, err := producer.generateFileName(env)
+			if err != nil {
+				t.Fatalf("generateFileName() error = %v", err)
+			}
+			if fileName != tt.expected {
+				t.Errorf("generateFileName() = %q, want %q", fileName, tt.expected)
+			}
+		})
+	}
+}
+
+// Test 22: Invalid filename templates are rejected at construction
+func TestFileProducer_InvalidFileNameTemplate(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+	}{
+		{"syntax error", "{{.ID"},
+		{"unknown field", "{{.Tenant}}.{{.Extension}}"},
+		{"unknown function", "{{shout .ID}}"},
+		{"wrong argument type", "{{date \"2006\" .ID}}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("FILE_OUTPUT_DIR", t.TempDir())
+			t.Setenv("FILE_OUTPUT_FILENAME_FORMAT", tt.format)
+
+			logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+			if _, err := NewFileProducer(logger); err == nil {
+				t.Errorf("NewFileProducer() with format %q should fail", tt.format)
+			}
+		})
+	}
+}
+
+// Test 23: JSON path lookup failures surface as write errors
+func TestFileProducer_FileNameJSONPathErrors(t *testing.T) {
+	tmpDir := t.TempDir()
+	t.Setenv("FILE_OUTPUT_DIR", tmpDir)
+	t.Setenv("FILE_OUTPUT_FILENAME_FORMAT", "{{.JSON \"order.id\"}}.{{.Extension}}")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	producer, err := NewFileProducer(logger)
+	if err != nil {
+		t.Fatalf("NewFileProducer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := producer.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer producer.Close()
+
+	for _, payload := range []string{`not json`, `{"order":{}}`} {
+		env := envelope.New()
+		env.ID = "test-json-error"
+		env.ContentType = "application/json"
+		env.Payload = []byte(payload)
+
+		if err := producer.Write(ctx, env); err == nil {
+			t.Errorf("Write() with payload %q should fail", payload)
+		}
+	}
+}
+
+// Test 24: A symlinked subdirectory cannot redirect new files outside the output directory
+func TestFileProducer_SymlinkedSubdirectoryRejected(t *testing.T) {
+	tmpDir := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(tmpDir, "escape")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	t.Setenv("FILE_OUTPUT_DIR", tmpDir)
+	t.Setenv("FILE_OUTPUT_FILENAME_FORMAT", "{{.ID}}.{{.Extension}}")
+	t.Setenv("FILE_OUTPUT_CREATE_SUBDIRS", "true")
+	t.Setenv("FILE_OUTPUT_ORGANIZE_BY", "source")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	producer, err := NewFileProducer(logger)
+	if err != nil {
+		t.Fatalf("NewFileProducer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := producer.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer producer.Close()
+
+	env := envelope.New()
+	env.ID = "test-symlink"
+	env.Source = "escape"
+	env.ContentType = "application/json"
+	env.Payload = []byte(`{}`)
+
+	if err := producer.Write(ctx, env); err == nil || !strings.Contains(err.Error(), "path traversal") {
+		t.Errorf("Write() error = %v, want path traversal", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("File written outside the output directory: %v", entries)
+	}
+}
@@ -0,0 +1,85 @@
+package io
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// fileSettings supplies the FILE_INPUT_* or FILE_OUTPUT_* settings of a file or SFTP
+// component, from a pipeline's config or from the environment
+type fileSettings struct {
+	prefix string
+	values map[string]string // Settings by variable name; nil reads the environment
+	used   map[string]bool
+}
+
+// newFileSettings reads the settings in configJSON for a component whose variables start
+// with prefix. Each key is a variable name without the prefix, in lower case, so
+// {"dir": "/data", "sftp_host": "sftp.example.com"} sets FILE_INPUT_DIR and
+// FILE_INPUT_SFTP_HOST. Values are strings, numbers or booleans. Without config, or with
+// an empty object, the environment variables are used. Keys in ignore are handled by the
+// caller.
+func newFileSettings(prefix string, configJSON json.RawMessage, ignore ...string) (*fileSettings, error) {
+	settings := &fileSettings{prefix: prefix, used: make(map[string]bool)}
+	if len(bytes.TrimSpace(configJSON)) == 0 {
+		return settings, nil
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, fmt.Errorf("config must be a JSON object: %w", err)
+	}
+	for _, key := range ignore {
+		delete(config, key)
+	}
+	if len(config) == 0 {
+		return settings, nil
+	}
+
+	settings.values = make(map[string]string, len(config))
+	for key, raw := range config {
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", key, err)
+		}
+		name := prefix + strings.ToUpper(key)
+		switch value := value.(type) {
+		case string:
+			settings.values[name] = value
+		case float64, bool:
+			settings.values[name] = strings.TrimSpace(string(raw))
+		default:
+			return nil, fmt.Errorf("%s must be a string, number or boolean", key)
+		}
+	}
+	return settings, nil
+}
+
+// get returns the setting for a variable name, e.g. FILE_INPUT_DIR, or "" if it is not set
+func (s *fileSettings) get(name string) string {
+	if s.values == nil {
+		return os.Getenv(name)
+	}
+	s.used[name] = true
+	return s.values[name]
+}
+
+// checkUnused fails if the config has keys no setting was read for, which are misspelt
+// or belong to another component type
+func (s *fileSettings) checkUnused() error {
+	var unknown []string
+	for name := range s.values {
+		if !s.used[name] {
+			unknown = append(unknown, strings.ToLower(strings.TrimPrefix(name, s.prefix)))
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown config fields: %s", strings.Join(unknown, ", "))
+}
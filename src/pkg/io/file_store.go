@@ -0,0 +1,142 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// errFreeSpaceUnknown is returned by stores that cannot report free space
+var errFreeSpaceUnknown = errors.New("free space unknown")
+
+// fileStore abstracts the file system FileConsumer and FileProducer operate on, so the
+// same polling, archiving, retry and templating logic works against local disk and
+// remote servers.
+type fileStore interface {
+	Glob(pattern string) ([]string, error)
+	ReadDir(dir string) ([]os.FileInfo, error)
+	Stat(path string) (os.FileInfo, error)
+	Open(path string) (io.ReadCloser, error)
+	ReadFile(path string) ([]byte, error)
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	Create(path string, perm os.FileMode) (storeFile, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Rename(oldPath, newPath string) error
+	Remove(path string) error
+	RemoveAll(path string) error
+
+	// ResolvePath returns the absolute, symlink-resolved form of path. Paths that do
+	// not exist yet resolve to their absolute form.
+	ResolvePath(path string) (string, error)
+
+	// FreeSpace returns the bytes available in the file system holding path, or
+	// errFreeSpaceUnknown when the store cannot tell
+	FreeSpace(path string) (int64, error)
+
+	// Describe returns a human-readable location for logs, e.g. "sftp://host:22"
+	Describe() string
+
+	Close() error
+}
+
+// storeFile is a file opened for writing on a fileStore
+type storeFile interface {
+	io.WriteCloser
+	Sync() error
+}
+
+// localFileStore is the fileStore backed by the local file system
+type localFileStore struct{}
+
+func (localFileStore) Glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+func (localFileStore) ReadDir(dir string) ([]os.FileInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// Entry vanished between listing and stat
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+func (localFileStore) Stat(path string) (os.FileInfo, error) { return os.Stat(path) }
+
+func (localFileStore) Open(path string) (io.ReadCloser, error) { return os.Open(path) }
+
+func (localFileStore) ReadFile(path string) ([]byte, error) { return os.ReadFile(path) }
+
+func (localFileStore) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+func (localFileStore) Create(path string, perm os.FileMode) (storeFile, error) {
+	return os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+}
+
+func (localFileStore) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+
+func (localFileStore) Rename(oldPath, newPath string) error { return os.Rename(oldPath, newPath) }
+
+func (localFileStore) Remove(path string) error { return os.Remove(path) }
+
+func (localFileStore) RemoveAll(path string) error { return os.RemoveAll(path) }
+
+func (localFileStore) ResolvePath(path string) (string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("resolve absolute path: %w", err)
+	}
+	resolved, err := filepath.EvalSymlinks(absPath)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("resolve symlinks: %w", err)
+	}
+
+	// The file may not exist yet; resolve its directory so a symlinked parent is still caught
+	resolvedDir, err := filepath.EvalSymlinks(filepath.Dir(absPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return absPath, nil
+		}
+		return "", fmt.Errorf("resolve symlinks: %w", err)
+	}
+	return filepath.Join(resolvedDir, filepath.Base(absPath)), nil
+}
+
+func (localFileStore) FreeSpace(path string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, fmt.Errorf("check disk space: %w", err)
+	}
+	return freeBytes(int64(stat.Bavail), int64(stat.Bsize)), nil
+}
+
+func (localFileStore) Describe() string { return "local" }
+
+func (localFileStore) Close() error { return nil }
+
+// freeBytes multiplies available blocks by block size, guarding against integer overflow
+func freeBytes(bavail, bsize int64) int64 {
+	if bavail <= 0 || bsize <= 0 {
+		return 0
+	}
+	if bavail > math.MaxInt64/bsize {
+		// Cap at MaxInt64 to avoid overflow while representing "very large" free space
+		return math.MaxInt64
+	}
+	return bavail * bsize
+}
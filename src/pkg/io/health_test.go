@@ -0,0 +1,65 @@
+package io
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestHTTPInput_CheckHealth(t *testing.T) {
+	input, err := NewHTTPInput([]byte(`{"port":"8789"}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	if err := input.CheckHealth(context.Background()); err == nil {
+		t.Error("CheckHealth() before Start should fail")
+	}
+
+	if err := input.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if err := input.CheckHealth(context.Background()); err != nil {
+		t.Errorf("CheckHealth() while listening error = %v", err)
+	}
+
+	input.Close()
+	if err := input.CheckHealth(context.Background()); err == nil {
+		t.Error("CheckHealth() after Close should fail")
+	}
+}
+
+func TestHTTPOutput_CheckHealth(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusServiceUnavailable)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer backend.Close()
+
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `","retries":1}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	if err := output.CheckHealth(context.Background()); err != nil {
+		t.Errorf("CheckHealth() before any delivery error = %v", err)
+	}
+
+	// A backend that stops answering makes the output unreachable until a delivery succeeds
+	output.Write(context.Background(), envelope.New())
+	if err := output.CheckHealth(context.Background()); err == nil {
+		t.Error("CheckHealth() after a failed delivery should fail")
+	}
+	status.Store(http.StatusOK)
+	if err := output.Write(context.Background(), envelope.New()); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if err := output.CheckHealth(context.Background()); err != nil {
+		t.Errorf("CheckHealth() after the backend recovered error = %v", err)
+	}
+}
@@ -0,0 +1,488 @@
+package io
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported HTTP input authentication types
+const (
+	HTTPAuthHMAC   = "hmac"
+	HTTPAuthAPIKey = "api_key"
+	HTTPAuthJWT    = "jwt"
+)
+
+// Supported HMAC signature styles
+const (
+	HMACStyleGitHub  = "github"  // X-Hub-Signature-256: sha256=<hex of HMAC(body)>
+	HMACStyleStripe  = "stripe"  // Stripe-Signature: t=<unix>,v1=<hex of HMAC("t.body")>
+	HMACStyleShopify = "shopify" // X-Shopify-Hmac-Sha256: <base64 of HMAC(body)>
+	HMACStyleGeneric = "generic" // configurable headers, hex HMAC of body or "timestamp.body"
+)
+
+// HTTPAuthConfig configures request authentication for the HTTP input.
+// Exactly one mechanism is active, selected by Type.
+type HTTPAuthConfig struct {
+	Type string `json:"type"` // "hmac", "api_key" or "jwt"
+
+	// HMAC signatures
+	Style           string `json:"style,omitempty"`            // github, stripe, shopify or generic (default: generic)
+	Secret          string `json:"secret,omitempty"`           // Shared secret
+	SecretEnv       string `json:"secret_env,omitempty"`       // Environment variable holding the shared secret
+	SignatureHeader string `json:"signature_header,omitempty"` // Generic style only (default: X-Signature)
+	TimestampHeader string `json:"timestamp_header,omitempty"` // Generic style only; when set the timestamp is signed and checked
+	Tolerance       string `json:"tolerance,omitempty"`        // Maximum timestamp age (default: 5m)
+
+	// API keys
+	Header  string            `json:"header,omitempty"`   // Header carrying the key (default: X-API-Key)
+	APIKeys map[string]string `json:"api_keys,omitempty"` // Tenant ID -> API key
+
+	// JWT bearer tokens
+	JWKSFile       string   `json:"jwks_file,omitempty"`       // Local JWKS file with the verification keys
+	Issuer         string   `json:"issuer,omitempty"`          // Required "iss" claim
+	Audience       string   `json:"audience,omitempty"`        // Required "aud" claim
+	TenantClaim    string   `json:"tenant_claim,omitempty"`    // Claim copied to the envelope tenant ID
+	RequiredScopes []string `json:"required_scopes,omitempty"` // Scopes that must all be present in "scope"/"scp"
+	Leeway         string   `json:"leeway,omitempty"`          // Clock skew allowance for exp/nbf (default: 30s)
+}
+
+// httpAuthError is returned by an authenticator when a request is rejected
+type httpAuthError struct {
+	status int
+	reason string
+}
+
+func (e *httpAuthError) Error() string {
+	return e.reason
+}
+
+func unauthorized(format string, args ...interface{}) error {
+	return &httpAuthError{status: http.StatusUnauthorized, reason: fmt.Sprintf(format, args...)}
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return &httpAuthError{status: http.StatusForbidden, reason: fmt.Sprintf(format, args...)}
+}
+
+// httpAuthenticator verifies a request and returns the tenant it belongs to, if known
+type httpAuthenticator interface {
+	authenticate(r *http.Request, body []byte) (tenantID string, err error)
+}
+
+// newHTTPAuthenticator builds the authenticator for a config; nil config disables auth
+func newHTTPAuthenticator(config *HTTPAuthConfig) (httpAuthenticator, error) {
+	if config == nil {
+		return nil, nil
+	}
+	switch config.Type {
+	case HTTPAuthHMAC:
+		return newHMACAuthenticator(config)
+	case HTTPAuthAPIKey:
+		return newAPIKeyAuthenticator(config)
+	case HTTPAuthJWT:
+		return newJWTAuthenticator(config)
+	default:
+		return nil, fmt.Errorf("unsupported auth type %q (must be hmac, api_key or jwt)", config.Type)
+	}
+}
+
+// hmacAuthenticator verifies shared-secret request signatures
+type hmacAuthenticator struct {
+	style           string
+	secret          []byte
+	signatureHeader string
+	timestampHeader string
+	tolerance       time.Duration
+	now             func() time.Time
+}
+
+func newHMACAuthenticator(config *HTTPAuthConfig) (*hmacAuthenticator, error) {
+	secret := config.Secret
+	if config.SecretEnv != "" {
+		secret = os.Getenv(config.SecretEnv)
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("hmac auth requires secret or secret_env")
+	}
+
+	tolerance := 5 * time.Minute
+	if config.Tolerance != "" {
+		parsed, err := time.ParseDuration(config.Tolerance)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid hmac tolerance %q", config.Tolerance)
+		}
+		tolerance = parsed
+	}
+
+	auth := &hmacAuthenticator{
+		style:     config.Style,
+		secret:    []byte(secret),
+		tolerance: tolerance,
+		now:       time.Now,
+	}
+	switch config.Style {
+	case HMACStyleGitHub:
+		auth.signatureHeader = "X-Hub-Signature-256"
+	case HMACStyleStripe:
+		auth.signatureHeader = "Stripe-Signature"
+	case HMACStyleShopify:
+		auth.signatureHeader = "X-Shopify-Hmac-Sha256"
+	case HMACStyleGeneric, "":
+		auth.style = HMACStyleGeneric
+		auth.signatureHeader = config.SignatureHeader
+		if auth.signatureHeader == "" {
+			auth.signatureHeader = "X-Signature"
+		}
+		auth.timestampHeader = config.TimestampHeader
+	default:
+		return nil, fmt.Errorf("unsupported hmac style %q (must be github, stripe, shopify or generic)", config.Style)
+	}
+	return auth, nil
+}
+
+func (a *hmacAuthenticator) authenticate(r *http.Request, body []byte) (string, error) {
+	header := r.Header.Get(a.signatureHeader)
+	if header == "" {
+		return "", unauthorized("missing %s header", a.signatureHeader)
+	}
+
+	switch a.style {
+	case HMACStyleGitHub:
+		signature, ok := strings.CutPrefix(header, "sha256=")
+		if !ok || !a.validHex(signature, body) {
+			return "", unauthorized("invalid signature")
+		}
+
+	case HMACStyleShopify:
+		expected, err := base64.StdEncoding.DecodeString(header)
+		if err != nil || !hmac.Equal(expected, a.sum(body)) {
+			return "", unauthorized("invalid signature")
+		}
+
+	case HMACStyleStripe:
+		var timestamp string
+		var signatures []string
+		for _, part := range strings.Split(header, ",") {
+			key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch key {
+			case "t":
+				timestamp = value
+			case "v1":
+				signatures = append(signatures, value)
+			}
+		}
+		if err := a.checkTimestamp(timestamp); err != nil {
+			return "", err
+		}
+		signed := append([]byte(timestamp+"."), body...)
+		for _, signature := range signatures {
+			if a.validHex(signature, signed) {
+				return "", nil
+			}
+		}
+		return "", unauthorized("invalid signature")
+
+	default:
+		signed := body
+		if a.timestampHeader != "" {
+			timestamp := r.Header.Get(a.timestampHeader)
+			if err := a.checkTimestamp(timestamp); err != nil {
+				return "", err
+			}
+			signed = append([]byte(timestamp+"."), body...)
+		}
+		if !a.validHex(strings.TrimPrefix(header, "sha256="), signed) {
+			return "", unauthorized("invalid signature")
+		}
+	}
+	return "", nil
+}
+
+// checkTimestamp rejects missing, malformed or stale Unix timestamps to prevent replays
+func (a *hmacAuthenticator) checkTimestamp(timestamp string) error {
+	if timestamp == "" {
+		return unauthorized("missing signature timestamp")
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return unauthorized("invalid signature timestamp %q", timestamp)
+	}
+	age := a.now().Sub(time.Unix(seconds, 0))
+	if age > a.tolerance || age < -a.tolerance {
+		return unauthorized("signature timestamp outside tolerance (%s)", age.Round(time.Second))
+	}
+	return nil
+}
+
+func (a *hmacAuthenticator) sum(data []byte) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+func (a *hmacAuthenticator) validHex(signature string, data []byte) bool {
+	expected, err := hex.DecodeString(signature)
+	return err == nil && hmac.Equal(expected, a.sum(data))
+}
+
+// apiKeyAuthenticator matches a static per-tenant API key
+type apiKeyAuthenticator struct {
+	header string
+	keys   map[string]string // tenant ID -> key
+}
+
+func newAPIKeyAuthenticator(config *HTTPAuthConfig) (*apiKeyAuthenticator, error) {
+	if len(config.APIKeys) == 0 {
+		return nil, fmt.Errorf("api_key auth requires at least one entry in api_keys")
+	}
+	for tenant, key := range config.APIKeys {
+		if key == "" {
+			return nil, fmt.Errorf("empty API key for tenant %q", tenant)
+		}
+	}
+	header := config.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	return &apiKeyAuthenticator{header: header, keys: config.APIKeys}, nil
+}
+
+func (a *apiKeyAuthenticator) authenticate(r *http.Request, _ []byte) (string, error) {
+	provided := r.Header.Get(a.header)
+	if provided == "" {
+		return "", unauthorized("missing %s header", a.header)
+	}
+
+	// Compare against every key so timing does not reveal which tenants exist
+	matched := ""
+	for tenant, key := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(key)) == 1 {
+			matched = tenant
+		}
+	}
+	if matched == "" {
+		return "", unauthorized("invalid API key")
+	}
+	return matched, nil
+}
+
+// jwtAuthenticator validates bearer tokens against keys from a local JWKS file
+type jwtAuthenticator struct {
+	keys           map[string]interface{} // kid -> public key
+	parser         *jwt.Parser
+	tenantClaim    string
+	requiredScopes []string
+}
+
+func newJWTAuthenticator(config *HTTPAuthConfig) (*jwtAuthenticator, error) {
+	if config.JWKSFile == "" {
+		return nil, fmt.Errorf("jwt auth requires jwks_file")
+	}
+	keys, err := loadJWKS(config.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+
+	leeway := 30 * time.Second
+	if config.Leeway != "" {
+		parsed, err := time.ParseDuration(config.Leeway)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid jwt leeway %q", config.Leeway)
+		}
+		leeway = parsed
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(leeway),
+	}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if config.Audience != "" {
+		options = append(options, jwt.WithAudience(config.Audience))
+	}
+
+	return &jwtAuthenticator{
+		keys:           keys,
+		parser:         jwt.NewParser(options...),
+		tenantClaim:    config.TenantClaim,
+		requiredScopes: config.RequiredScopes,
+	}, nil
+}
+
+func (a *jwtAuthenticator) authenticate(r *http.Request, _ []byte) (string, error) {
+	authorization := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(authorization, "Bearer ")
+	if !ok || token == "" {
+		return "", unauthorized("missing bearer token")
+	}
+
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(token, claims, a.keyFunc); err != nil {
+		return "", unauthorized("invalid token: %v", err)
+	}
+
+	granted := tokenScopes(claims)
+	for _, scope := range a.requiredScopes {
+		if !granted[scope] {
+			return "", forbidden("token missing required scope %q", scope)
+		}
+	}
+
+	if a.tenantClaim == "" {
+		return "", nil
+	}
+	tenant, _ := claims[a.tenantClaim].(string)
+	if tenant == "" {
+		return "", forbidden("token missing tenant claim %q", a.tenantClaim)
+	}
+	return tenant, nil
+}
+
+func (a *jwtAuthenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(a.keys) == 1 {
+		for _, key := range a.keys {
+			return key, nil
+		}
+	}
+	key, ok := a.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+// tokenScopes collects scopes from the space-separated "scope" claim or the "scp" array
+func tokenScopes(claims jwt.MapClaims) map[string]bool {
+	scopes := make(map[string]bool)
+	if scope, ok := claims["scope"].(string); ok {
+		for _, s := range strings.Fields(scope) {
+			scopes[s] = true
+		}
+	}
+	if scp, ok := claims["scp"].([]interface{}); ok {
+		for _, s := range scp {
+			if str, ok := s.(string); ok {
+				scopes[str] = true
+			}
+		}
+	}
+	return scopes
+}
+
+// jsonWebKey holds the JWK fields needed for RSA, EC and Ed25519 public keys
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// loadJWKS reads the public signing keys from a JWKS file, indexed by key ID
+func loadJWKS(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS file: %w", err)
+	}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS file: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for i, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %d (%q): %w", i, jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS file %s contains no signing keys", path)
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return key, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
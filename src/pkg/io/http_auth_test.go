@@ -0,0 +1,362 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func hmacHex(secret, data string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(data))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// authStatus runs an authenticator and returns the HTTP status it implies (200 on success)
+func authStatus(t *testing.T, auth httpAuthenticator, r *http.Request, body string) (int, string) {
+	t.Helper()
+	tenant, err := auth.authenticate(r, []byte(body))
+	if err == nil {
+		return http.StatusOK, tenant
+	}
+	var authErr *httpAuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("authenticate() returned non-auth error: %v", err)
+	}
+	return authErr.status, ""
+}
+
+func TestHMACAuthenticator_Styles(t *testing.T) {
+	const secret = "whsec_test"
+	const body = `{"id":1}`
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name    string
+		config  HTTPAuthConfig
+		headers map[string]string
+		want    int
+	}{
+		{"github valid", HTTPAuthConfig{Style: "github"},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex(secret, body)}, http.StatusOK},
+		{"github wrong secret", HTTPAuthConfig{Style: "github"},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + hmacHex("other", body)}, http.StatusUnauthorized},
+		{"github missing prefix", HTTPAuthConfig{Style: "github"},
+			map[string]string{"X-Hub-Signature-256": hmacHex(secret, body)}, http.StatusUnauthorized},
+		{"shopify valid", HTTPAuthConfig{Style: "shopify"},
+			map[string]string{"X-Shopify-Hmac-Sha256": func() string {
+				raw, _ := hex.DecodeString(hmacHex(secret, body))
+				return base64.StdEncoding.EncodeToString(raw)
+			}()}, http.StatusOK},
+		{"shopify missing header", HTTPAuthConfig{Style: "shopify"}, nil, http.StatusUnauthorized},
+		{"stripe valid", HTTPAuthConfig{Style: "stripe"},
+			map[string]string{"Stripe-Signature": "t=" + ts + ",v1=deadbeef,v1=" + hmacHex(secret, ts+"."+body)}, http.StatusOK},
+		{"stripe stale timestamp", HTTPAuthConfig{Style: "stripe"},
+			map[string]string{"Stripe-Signature": "t=" + stale + ",v1=" + hmacHex(secret, stale+"."+body)}, http.StatusUnauthorized},
+		{"stripe stale within custom tolerance", HTTPAuthConfig{Style: "stripe", Tolerance: "15m"},
+			map[string]string{"Stripe-Signature": "t=" + stale + ",v1=" + hmacHex(secret, stale+"."+body)}, http.StatusOK},
+		{"stripe signature without timestamp", HTTPAuthConfig{Style: "stripe"},
+			map[string]string{"Stripe-Signature": "v1=" + hmacHex(secret, body)}, http.StatusUnauthorized},
+		{"generic body only", HTTPAuthConfig{},
+			map[string]string{"X-Signature": hmacHex(secret, body)}, http.StatusOK},
+		{"generic with timestamp", HTTPAuthConfig{SignatureHeader: "X-Sig", TimestampHeader: "X-Timestamp"},
+			map[string]string{"X-Sig": "sha256=" + hmacHex(secret, ts+"."+body), "X-Timestamp": ts}, http.StatusOK},
+		{"generic timestamp tampered", HTTPAuthConfig{SignatureHeader: "X-Sig", TimestampHeader: "X-Timestamp"},
+			map[string]string{"X-Sig": hmacHex(secret, ts+"."+body), "X-Timestamp": strconv.FormatInt(now.Unix()+1, 10)}, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			config.Type = HTTPAuthHMAC
+			config.Secret = secret
+			auth, err := newHMACAuthenticator(&config)
+			if err != nil {
+				t.Fatalf("newHMACAuthenticator() error = %v", err)
+			}
+			auth.now = func() time.Time { return now }
+
+			r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			for k, v := range tt.headers {
+				r.Header.Set(k, v)
+			}
+			if got, _ := authStatus(t, auth, r, body); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewHTTPAuthenticator_InvalidConfig(t *testing.T) {
+	t.Setenv("EMPTY_WEBHOOK_SECRET", "")
+	tests := map[string]HTTPAuthConfig{
+		"unknown type":        {Type: "basic"},
+		"hmac without secret": {Type: HTTPAuthHMAC, SecretEnv: "EMPTY_WEBHOOK_SECRET"},
+		"hmac bad style":      {Type: HTTPAuthHMAC, Secret: "s", Style: "paypal"},
+		"hmac bad tolerance":  {Type: HTTPAuthHMAC, Secret: "s", Tolerance: "-1m"},
+		"api_key no keys":     {Type: HTTPAuthAPIKey},
+		"api_key empty key":   {Type: HTTPAuthAPIKey, APIKeys: map[string]string{"acme": ""}},
+		"jwt without jwks":    {Type: HTTPAuthJWT},
+		"jwt missing jwks":    {Type: HTTPAuthJWT, JWKSFile: "/nonexistent/jwks.json"},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newHTTPAuthenticator(&config); err == nil {
+				t.Error("newHTTPAuthenticator() should fail")
+			}
+		})
+	}
+}
+
+func TestHMACAuthenticator_SecretFromEnv(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "from-env")
+	auth, err := newHMACAuthenticator(&HTTPAuthConfig{Type: HTTPAuthHMAC, Style: "github", SecretEnv: "WEBHOOK_SECRET"})
+	if err != nil {
+		t.Fatalf("newHMACAuthenticator() error = %v", err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	r.Header.Set("X-Hub-Signature-256", "sha256="+hmacHex("from-env", "x"))
+	if got, _ := authStatus(t, auth, r, "x"); got != http.StatusOK {
+		t.Errorf("status = %d, want 200", got)
+	}
+}
+
+func TestAPIKeyAuthenticator(t *testing.T) {
+	auth, err := newAPIKeyAuthenticator(&HTTPAuthConfig{
+		Type:    HTTPAuthAPIKey,
+		Header:  "X-Partner-Key",
+		APIKeys: map[string]string{"acme": "key-acme", "globex": "key-globex"},
+	})
+	if err != nil {
+		t.Fatalf("newAPIKeyAuthenticator() error = %v", err)
+	}
+
+	tests := []struct {
+		key        string
+		wantStatus int
+		wantTenant string
+	}{
+		{"key-acme", http.StatusOK, "acme"},
+		{"key-globex", http.StatusOK, "globex"},
+		{"key-unknown", http.StatusUnauthorized, ""},
+		{"", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+		if tt.key != "" {
+			r.Header.Set("X-Partner-Key", tt.key)
+		}
+		status, tenant := authStatus(t, auth, r, "")
+		if status != tt.wantStatus || tenant != tt.wantTenant {
+			t.Errorf("key %q: got (%d, %q), want (%d, %q)", tt.key, status, tenant, tt.wantStatus, tt.wantTenant)
+		}
+	}
+}
+
+// writeJWKS writes a JWKS file with one RSA and one EC key and returns its path
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) string {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+	set := map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "rsa-1", "use": "sig", "alg": "RS256",
+				"n": encode(rsaKey.N.Bytes()),
+				"e": encode(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			{
+				"kty": "EC", "kid": "ec-1", "crv": "P-256",
+				"x": encode(ecKey.X.FillBytes(make([]byte, 32))),
+				"y": encode(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+			{"kty": "oct", "kid": "enc-only", "use": "enc"},
+		},
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("Failed to marshal JWKS: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+	return path
+}
+
+func signJWT(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate EC key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+
+	auth, err := newJWTAuthenticator(&HTTPAuthConfig{
+		Type:           HTTPAuthJWT,
+		JWKSFile:       writeJWKS(t, rsaKey, ecKey),
+		Issuer:         "https://idp.example",
+		Audience:       "vrsky",
+		TenantClaim:    "tenant_id",
+		RequiredScopes: []string{"webhooks:write"},
+	})
+	if err != nil {
+		t.Fatalf("newJWTAuthenticator() error = %v", err)
+	}
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":       "https://idp.example",
+			"aud":       "vrsky",
+			"exp":       time.Now().Add(time.Hour).Unix(),
+			"tenant_id": "acme",
+			"scope":     "webhooks:read webhooks:write",
+		}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{"rsa valid", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, valid()), http.StatusOK},
+		{"ec valid with scp array", "Bearer " + signJWT(t, jwt.SigningMethodES256, "ec-1", ecKey,
+			jwt.MapClaims{
+				"iss": "https://idp.example", "aud": "vrsky", "exp": time.Now().Add(time.Hour).Unix(),
+				"tenant_id": "acme", "scp": []string{"webhooks:write"},
+			}), http.StatusOK},
+		{"missing header", "", http.StatusUnauthorized},
+		{"not bearer", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"unknown signer", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", otherKey, valid()), http.StatusUnauthorized},
+		{"unknown kid", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, valid()), http.StatusUnauthorized},
+		{"hs256 not accepted", "Bearer " + signJWT(t, jwt.SigningMethodHS256, "rsa-1", []byte("secret"), valid()), http.StatusUnauthorized},
+		{"expired", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("exp", time.Now().Add(-time.Hour).Unix())), http.StatusUnauthorized},
+		{"no expiry", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("exp", nil)), http.StatusUnauthorized},
+		{"wrong issuer", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("iss", "https://evil.example")), http.StatusUnauthorized},
+		{"wrong audience", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("aud", "other")), http.StatusUnauthorized},
+		{"missing scope", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("scope", "webhooks:read")), http.StatusForbidden},
+		{"missing tenant", "Bearer " + signJWT(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, with("tenant_id", nil)), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			status, tenant := authStatus(t, auth, r, "")
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if status == http.StatusOK && tenant != "acme" {
+				t.Errorf("tenant = %q, want acme", tenant)
+			}
+		})
+	}
+}
+
+func TestHTTPInput_RejectsUnauthenticatedWebhooks(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input, err := NewHTTPInput([]byte(`{"port":"8770","auth":{"type":"api_key","api_keys":{"acme":"secret-key"}}}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	go func() {
+		_ = input.Start(ctx)
+	}()
+	defer input.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	post := func(key string) int {
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:8770/webhook", bytes.NewReader([]byte(`{"n":1}`)))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-API-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send webhook: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := post(""); status != http.StatusUnauthorized {
+		t.Errorf("No key: status = %d, want 401", status)
+	}
+	if status := post("wrong"); status != http.StatusUnauthorized {
+		t.Errorf("Wrong key: status = %d, want 401", status)
+	}
+	if status := post("secret-key"); status != http.StatusAccepted {
+		t.Errorf("Valid key: status = %d, want 202", status)
+	}
+
+	// Only the authenticated request is enqueued, tagged with its tenant
+	env, err := input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if env.TenantID != "acme" {
+		t.Errorf("TenantID = %q, want acme", env.TenantID)
+	}
+
+	readCtx, readCancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer readCancel()
+	if _, err := input.Read(readCtx); err == nil {
+		t.Error("Unauthenticated webhook was enqueued")
+	}
+}
+
+func TestNewHTTPInput_InvalidAuth(t *testing.T) {
+	if _, err := NewHTTPInput([]byte(`{"port":"8771","auth":{"type":"hmac"}}`)); err == nil {
+		t.Error("NewHTTPInput() should reject hmac auth without a secret")
+	}
+}
@@ -0,0 +1,132 @@
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestHTTPOutput_WriteBatch(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string][]json.RawMessage) // By request path
+	var batchSizes []string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		var items []json.RawMessage
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &items); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		bodies[r.URL.Path] = append(bodies[r.URL.Path], items...)
+		batchSizes = append(batchSizes, r.Header.Get("X-Batch-Size"))
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer backend.Close()
+
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `/bulk/{{.TenantID}}"}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	var envs []*envelope.Envelope
+	for i, payload := range []string{`{"n":1}`, `{"n":2}`, `not json`, `{"n":4}`} {
+		env := envelope.New()
+		env.ID = "msg-" + string(rune('a'+i))
+		env.TenantID = []string{"acme", "globex"}[i%2]
+		env.Payload = []byte(payload)
+		envs = append(envs, env)
+	}
+	if err := output.WriteBatch(context.Background(), envs); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+
+	// One request per rendered URL, elements in envelope order
+	if len(batchSizes) != 2 || batchSizes[0] != "2" || batchSizes[1] != "2" {
+		t.Errorf("Requests with X-Batch-Size %v, want two batches of 2", batchSizes)
+	}
+	if got := bodies["/bulk/acme"]; len(got) != 2 || string(got[0]) != `{"n":1}` || string(got[1]) != `"not json"` {
+		t.Errorf("acme batch = %s", got)
+	}
+	if got := bodies["/bulk/globex"]; len(got) != 2 || string(got[0]) != `{"n":2}` || string(got[1]) != `{"n":4}` {
+		t.Errorf("globex batch = %s", got)
+	}
+}
+
+func TestHTTPOutput_WriteBatchFailures(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		io.WriteString(w, `{"error":"line 2 invalid"}`)
+	}))
+	defer backend.Close()
+
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `/bulk/{{.Payload.region}}"}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	good := envelope.New()
+	good.Payload = []byte(`{"region":"eu"}`)
+	missing := envelope.New()
+	missing.Payload = []byte(`{}`)
+	err = output.WriteBatch(context.Background(), []*envelope.Envelope{good, missing})
+	if !component.IsPermanent(err) {
+		t.Fatalf("WriteBatch() error = %v, want a permanent error", err)
+	}
+	if good.LastError == "" || missing.LastError == "" {
+		t.Errorf("LastError not set on every envelope: %q, %q", good.LastError, missing.LastError)
+	}
+
+	if failed := component.BatchFailures(err, 2); !component.IsPermanent(failed[0]) || !component.IsPermanent(failed[1]) {
+		t.Errorf("BatchFailures() = %v, want both envelopes failed permanently", failed)
+	}
+
+	// A retryable failure anywhere makes the whole batch retryable
+	mixed := component.NewBatchError(map[int]error{0: err, 1: context.DeadlineExceeded})
+	if component.IsPermanent(mixed) {
+		t.Errorf("NewBatchError() = %v, should not be permanent", mixed)
+	}
+	if component.NewBatchError(nil) != nil {
+		t.Error("NewBatchError(nil) should be nil")
+	}
+}
+
+func TestHTTPOutput_WriteBatchReportsEachEnvelope(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer backend.Close()
+
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `/bulk/{{.Payload.region}}"}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	var envs []*envelope.Envelope
+	for _, payload := range []string{`{"region":"eu"}`, `{}`, `{"region":"us"}`} {
+		env := envelope.New()
+		env.Payload = []byte(payload)
+		envs = append(envs, env)
+	}
+	err = output.WriteBatch(context.Background(), envs)
+	var batchErr *component.BatchError
+	if !errors.As(err, &batchErr) {
+		t.Fatalf("WriteBatch() error = %v, want a *BatchError", err)
+	}
+	if len(batchErr.Failed) != 1 || !component.IsPermanent(batchErr.Failed[1]) {
+		t.Errorf("Failed = %v, want only envelope 1, permanently", batchErr.Failed)
+	}
+}
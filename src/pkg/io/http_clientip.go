@@ -0,0 +1,183 @@
+package io
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// HTTPClientIPConfig controls how the HTTP input determines and filters the client IP
+type HTTPClientIPConfig struct {
+	TrustedProxies []string `json:"trusted_proxies,omitempty"` // CIDRs or IPs whose forwarding headers are believed (default: none)
+	Allow          []string `json:"allow,omitempty"`           // Only these CIDRs or IPs may call the input (default: everyone)
+	Deny           []string `json:"deny,omitempty"`            // These CIDRs or IPs are always refused
+}
+
+// clientIPResolver finds the client IP behind trusted reverse proxies and applies the allow/deny lists
+type clientIPResolver struct {
+	trusted []netip.Prefix
+	allow   []netip.Prefix
+	deny    []netip.Prefix
+}
+
+func newClientIPResolver(config HTTPClientIPConfig) (*clientIPResolver, error) {
+	var r clientIPResolver
+	var err error
+	if r.trusted, err = parsePrefixes(config.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("trusted_proxies: %w", err)
+	}
+	if r.allow, err = parsePrefixes(config.Allow); err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	if r.deny, err = parsePrefixes(config.Deny); err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	return &r, nil
+}
+
+// parsePrefixes parses CIDRs, treating a bare IP as a single-address prefix
+func parsePrefixes(values []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(values))
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			addr, err := netip.ParseAddr(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IP %q", value)
+			}
+			addr = addr.Unmap()
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", value)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func containsAddr(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address of the original client. Forwarding headers are only
+// read when the peer is a trusted proxy; the hop list is then walked right to left,
+// skipping trusted proxies, so entries prepended by the client cannot spoof the result.
+// RFC 7239 Forwarded takes precedence over X-Forwarded-For, then X-Real-IP.
+func (c *clientIPResolver) clientIP(r *http.Request) netip.Addr {
+	peer := remoteAddr(r)
+	if !peer.IsValid() || !containsAddr(c.trusted, peer) {
+		return peer
+	}
+
+	hops := forwardedFor(r.Header.Values("Forwarded"))
+	if hops == nil {
+		hops = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+	if hops == nil {
+		if realIP, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err == nil {
+			return realIP.Unmap()
+		}
+		return peer
+	}
+
+	client := peer
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseHop(hops[i])
+		if err != nil {
+			// Unknown or obfuscated hop: the last trusted proxy is the best we know
+			return client
+		}
+		client = hop
+		if !containsAddr(c.trusted, hop) {
+			return hop
+		}
+	}
+	return client
+}
+
+// allowed reports whether the client IP passes the deny and allow lists
+func (c *clientIPResolver) allowed(addr netip.Addr) bool {
+	if containsAddr(c.deny, addr) {
+		return false
+	}
+	return len(c.allow) == 0 || containsAddr(c.allow, addr)
+}
+
+func remoteAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
+
+// xForwardedFor splits X-Forwarded-For headers into hops, oldest first
+func xForwardedFor(headers []string) []string {
+	var hops []string
+	for _, header := range headers {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedFor extracts the for= node of every element of RFC 7239 Forwarded headers,
+// oldest first. An element without for= yields an empty (unknown) hop.
+func forwardedFor(headers []string) []string {
+	var hops []string
+	for _, header := range headers {
+		for _, element := range splitUnquoted(header, ',') {
+			hop := ""
+			for _, pair := range splitUnquoted(element, ';') {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(name, "for") {
+					hop = strings.Trim(value, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// splitUnquoted splits s on sep, ignoring separators inside quoted strings
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseHop parses a forwarded node: an IP, optionally with a port, IPv6 optionally bracketed
+func parseHop(hop string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(hop, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid forwarded node %q", hop)
+	}
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,120 @@
+package io
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewClientIPResolver_InvalidConfig(t *testing.T) {
+	tests := map[string]HTTPClientIPConfig{
+		"bad proxy": {TrustedProxies: []string{"10.0.0.0/33"}},
+		"bad allow": {Allow: []string{"example.com"}},
+		"bad deny":  {Deny: []string{"1.2.3"}},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newClientIPResolver(config); err == nil {
+				t.Error("newClientIPResolver() should fail")
+			}
+		})
+	}
+}
+
+func TestClientIPResolver_ClientIP(t *testing.T) {
+	resolver, err := newClientIPResolver(HTTPClientIPConfig{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}})
+	if err != nil {
+		t.Fatalf("newClientIPResolver() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		peer    string
+		headers map[string][]string
+		want    string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer ignores headers", "203.0.113.7:5000",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}}, "203.0.113.7"},
+		{"single proxy", "10.0.0.5:5000",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		{"spoofed entry is skipped", "10.0.0.5:5000",
+			map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.1, 10.0.0.9"}}, "198.51.100.1"},
+		{"multiple header lines", "10.0.0.5:5000",
+			map[string][]string{"X-Forwarded-For": {"1.1.1.1", "198.51.100.1"}}, "198.51.100.1"},
+		{"all hops trusted", "10.0.0.5:5000",
+			map[string][]string{"X-Forwarded-For": {"10.1.1.1, 10.2.2.2"}}, "10.1.1.1"},
+		{"garbage hop stops at last proxy", "10.0.0.5:5000",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1, nonsense, 10.0.0.9"}}, "10.0.0.9"},
+		{"forwarded header", "10.0.0.5:5000",
+			map[string][]string{"Forwarded": {`for=1.1.1.1, for="198.51.100.1:4711";proto=https;by=10.0.0.5`}}, "198.51.100.1"},
+		{"forwarded ipv6", "[2001:db8::1]:5000",
+			map[string][]string{"Forwarded": {`For="[2001:db8:cafe::17]:4711"`}}, "2001:db8:cafe::17"},
+		{"forwarded wins over xff", "10.0.0.5:5000",
+			map[string][]string{"Forwarded": {"for=198.51.100.1"}, "X-Forwarded-For": {"198.51.100.2"}}, "198.51.100.1"},
+		{"obfuscated forwarded node", "10.0.0.5:5000",
+			map[string][]string{"Forwarded": {"for=_hidden"}}, "10.0.0.5"},
+		{"x-real-ip from proxy", "10.0.0.5:5000",
+			map[string][]string{"X-Real-Ip": {"198.51.100.3"}}, "198.51.100.3"},
+		{"ipv4-mapped peer", "[::ffff:10.0.0.5]:5000",
+			map[string][]string{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+			r.RemoteAddr = tt.peer
+			for name, values := range tt.headers {
+				r.Header[name] = values
+			}
+			if got := resolver.clientIP(r).String(); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPInput_IPAllowDeny(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input := startSyncInput(t, ctx, 8784, `"client_ip":{"trusted_proxies":["127.0.0.1","::1"],
+		"allow":["198.51.100.0/24"],"deny":["198.51.100.66"]}`)
+
+	send := func(xff string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:8784/webhook", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", xff)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send webhook: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := send("198.51.100.10"); status != http.StatusAccepted {
+		t.Errorf("Allowed client status = %d, want 202", status)
+	}
+	if status := send("198.51.100.66"); status != http.StatusForbidden {
+		t.Errorf("Denied client status = %d, want 403", status)
+	}
+	if status := send("203.0.113.7"); status != http.StatusForbidden {
+		t.Errorf("Client outside allow list status = %d, want 403", status)
+	}
+	if got := input.rejectedCount(http.StatusForbidden); got != 2 {
+		t.Errorf("Rejected 403 count = %d, want 2", got)
+	}
+
+	// The envelope records the resolved client, not the raw header
+	env, err := input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if want := "http-input:198.51.100.10"; env.StepHistory[len(env.StepHistory)-1] != want {
+		t.Errorf("StepHistory = %v, want last entry %s", env.StepHistory, want)
+	}
+}
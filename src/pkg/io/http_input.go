@@ -2,33 +2,70 @@ package io
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ValueRetail/vrsky/pkg/component"
 	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
 	"github.com/google/uuid"
 )
 
 // HTTPInput listens for webhooks on a configured HTTP port
 type HTTPInput struct {
 	port      string
+	routes    []*httpRoute
+	overload  *overloadPolicy
+	clientIPs *clientIPResolver
+	rateLimit *rateLimiter
+	headers   []string // Request headers copied into metadata
+	syncWait  time.Duration
+	tlsConfig *tls.Config
 	server    *http.Server
 	messages  chan *envelope.Envelope
-	closeOnce sync.Once
+	cancel    context.CancelFunc
+	drained   chan struct{} // Closed once the server has stopped accepting webhooks
+	spillDone chan struct{} // Closed once the spill drainer has stopped; nil without one
+	drainOnce sync.Once
 	closed    bool
 	mu        sync.Mutex
+	pipeline  string // Pipeline label on metrics
+
+	rejectedMu sync.Mutex
+	rejected   map[int]int64 // Rejected requests by response status
 }
 
 // NewHTTPInput creates a new HTTP input handler
 func NewHTTPInput(configJSON json.RawMessage) (*HTTPInput, error) {
 	var config struct {
-		Port string `json:"port"`
+		Port       string             `json:"port"`
+		Auth       *HTTPAuthConfig    `json:"auth,omitempty"`
+		Routes     []HTTPRouteConfig  `json:"routes,omitempty"`
+		BufferSize int                `json:"buffer_size,omitempty"`
+		Overload   HTTPOverloadConfig `json:"overload,omitempty"`
+
+		Validation HTTPValidationConfig `json:"validation,omitempty"` // Body size, content type and schema limits
+		ClientIP   HTTPClientIPConfig   `json:"client_ip,omitempty"`  // Trusted proxies and IP allow/deny lists
+		RateLimit  *HTTPRateLimitConfig `json:"rate_limit,omitempty"` // Per-source token bucket throttling
+
+		// Request headers copied into envelope metadata as header.<lowercase name>
+		MetadataHeaders []string `json:"metadata_headers,omitempty"`
+
+		// Sync makes routes wait for the pipeline's reply instead of answering 202 right away
+		Sync        bool   `json:"sync,omitempty"`
+		SyncTimeout string `json:"sync_timeout,omitempty"` // Maximum wait before falling back to 202 (default: 10s)
+
+		TLS *TLSServerConfig `json:"tls,omitempty"` // Serve HTTPS, optionally verifying client certificates
 	}
 
 	if err := json.Unmarshal(configJSON, &config); err != nil {
@@ -38,53 +75,249 @@ func NewHTTPInput(configJSON json.RawMessage) (*HTTPInput, error) {
 	if config.Port == "" {
 		config.Port = "8000"
 	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = 100
+	}
+
+	overload, err := newOverloadPolicy(config.Overload)
+	if err != nil {
+		return nil, fmt.Errorf("http overload config: %w", err)
+	}
+
+	syncWait := 10 * time.Second
+	if config.SyncTimeout != "" {
+		syncWait, err = time.ParseDuration(config.SyncTimeout)
+		if err != nil || syncWait <= 0 {
+			return nil, fmt.Errorf("invalid http sync_timeout %q", config.SyncTimeout)
+		}
+	}
+
+	auth, err := newHTTPAuthenticator(config.Auth)
+	if err != nil {
+		return nil, fmt.Errorf("http auth config: %w", err)
+	}
+	authType := "none"
+	if config.Auth != nil {
+		authType = config.Auth.Type
+	}
+
+	validator, err := newBodyValidator(config.Validation)
+	if err != nil {
+		return nil, fmt.Errorf("http validation config: %w", err)
+	}
+
+	clientIPs, err := newClientIPResolver(config.ClientIP)
+	if err != nil {
+		return nil, fmt.Errorf("http client_ip config: %w", err)
+	}
+
+	rateLimit, err := newRateLimiter(config.RateLimit)
+	if err != nil {
+		return nil, fmt.Errorf("http rate_limit config: %w", err)
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLS != nil {
+		tlsConfig, err = newServerTLSConfig(config.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("http tls config: %w", err)
+		}
+	}
+
+	// Without a route table, keep the single POST /webhook endpoint
+	if len(config.Routes) == 0 {
+		config.Routes = []HTTPRouteConfig{{Path: "/webhook", Method: http.MethodPost}}
+	}
+	routes := make([]*httpRoute, 0, len(config.Routes))
+	for _, routeConfig := range config.Routes {
+		route, err := newHTTPRoute(routeConfig, auth, authType)
+		if err != nil {
+			return nil, fmt.Errorf("http route config: %w", err)
+		}
+		route.sync = config.Sync
+		if routeConfig.Sync != nil {
+			route.sync = *routeConfig.Sync
+		}
+		route.validator = validator
+		if routeConfig.Validation != nil {
+			route.validator, err = newBodyValidator(*routeConfig.Validation)
+			if err != nil {
+				return nil, fmt.Errorf("http route %s validation config: %w", routeConfig.Path, err)
+			}
+		}
+		routes = append(routes, route)
+	}
 
 	return &HTTPInput{
-		port:     config.Port,
-		messages: make(chan *envelope.Envelope, 100),
+		port:      config.Port,
+		routes:    routes,
+		overload:  overload,
+		clientIPs: clientIPs,
+		rateLimit: rateLimit,
+		headers:   config.MetadataHeaders,
+		syncWait:  syncWait,
+		tlsConfig: tlsConfig,
+		messages:  make(chan *envelope.Envelope, config.BufferSize),
+		drained:   make(chan struct{}),
+		rejected:  make(map[int]int64),
 	}, nil
 }
 
-// Start begins listening for HTTP webhooks
+// Start begins listening for HTTP webhooks. It returns once the port is bound; the server
+// runs until ctx is cancelled or the input is drained or closed.
 func (h *HTTPInput) Start(ctx context.Context) error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook", h.handleWebhook)
+	server := &http.Server{
+		Addr:      ":" + h.port,
+		Handler:   http.HandlerFunc(h.handleRequest),
+		TLSConfig: h.tlsConfig,
+	}
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("http server: %w", err)
+	}
 
-	h.server = &http.Server{
-		Addr:    ":" + h.port,
-		Handler: mux,
+	ctx, cancel := context.WithCancel(ctx)
+	var spillDone chan struct{}
+	if h.overload.spill != nil {
+		spillDone = make(chan struct{})
 	}
+	h.mu.Lock()
+	h.server = server
+	h.cancel = cancel
+	h.spillDone = spillDone
+	h.mu.Unlock()
 
 	go func() {
 		<-ctx.Done()
-		_ = h.server.Close()
+		_ = server.Close()
 	}()
 
-	slog.Info("HTTP input started", "port", h.port, "endpoint", "POST /webhook")
+	// Feed webhooks spilled during earlier overloads (or before a restart) back into the buffer
+	if spillDone != nil {
+		go func() {
+			defer close(spillDone)
+			h.overload.spill.drain(ctx, h.messages)
+		}()
+	}
 
-	if err := h.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		slog.Error("HTTP server error", "error", err)
-		return fmt.Errorf("http server: %w", err)
+	for _, route := range h.routes {
+		slog.Info("HTTP input route", "endpoint", route.method+" "+route.pattern, "auth", route.authType, "sync", route.sync)
 	}
+	slog.Info("HTTP input started", "port", h.port, "routes", len(h.routes),
+		"buffer_size", cap(h.messages), "overload", h.overload.mode, "tls", h.tlsConfig != nil)
+
+	go func() {
+		var err error
+		if h.tlsConfig != nil {
+			// Certificates come from TLSConfig so they can be reloaded
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("HTTP server error", "error", err)
+		}
+	}()
 
 	return nil
 }
 
+// handleRequest dispatches a request to the first matching route
+func (h *HTTPInput) handleRequest(w http.ResponseWriter, r *http.Request) {
+	if !h.clientIPs.allowed(h.clientIPs.clientIP(r)) {
+		h.reject(w, r, http.StatusForbidden, "client IP not allowed")
+		return
+	}
+
+	route, params, allowed := findRoute(h.routes, r)
+	if route == nil {
+		if len(allowed) > 0 {
+			w.Header().Set("Allow", strings.Join(allowed, ", "))
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	h.handleWebhook(w, r, route, params)
+}
+
 // handleWebhook processes incoming webhook requests
-func (h *HTTPInput) handleWebhook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusMethodNotAllowed)
+func (h *HTTPInput) handleWebhook(w http.ResponseWriter, r *http.Request, route *httpRoute, params map[string]string) {
+	defer r.Body.Close()
+	validator := route.validator
+
+	// Throttle noisy sources before doing any work for them
+	clientIP := h.getClientIP(r)
+	if h.rateLimit != nil && h.rateLimit.byIP() && h.throttle(w, r, "ip:"+clientIP) {
 		return
 	}
 
-	// Read body
-	body, err := io.ReadAll(r.Body)
+	// Refuse oversized or unsupported bodies before reading them
+	if r.ContentLength > validator.maxBodySize {
+		h.reject(w, r, http.StatusRequestEntityTooLarge, "body exceeds max_body_size",
+			"content_length", r.ContentLength, "max_body_size", validator.maxBodySize)
+		return
+	}
+	if err := validator.checkContentType(r.Header.Get("Content-Type")); err != nil {
+		h.reject(w, r, http.StatusUnsupportedMediaType, err.Error())
+		return
+	}
+
+	// Read body, never more than the limit (Content-Length may be absent or wrong)
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, validator.maxBodySize))
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			h.reject(w, r, http.StatusRequestEntityTooLarge, "body exceeds max_body_size",
+				"max_body_size", validator.maxBodySize)
+			return
+		}
 		slog.Error("Failed to read request body", "error", err)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	defer r.Body.Close()
+
+	// Authenticate before anything is enqueued
+	authTenantID, err := route.authenticate(r, body)
+	if err != nil {
+		// Failed attempts count against the client IP, so guessing credentials is throttled too
+		if h.rateLimit != nil && !h.rateLimit.byIP() && h.throttle(w, r, "ip:"+clientIP) {
+			return
+		}
+		var authErr *httpAuthError
+		if !errors.As(err, &authErr) {
+			authErr = &httpAuthError{status: http.StatusUnauthorized, reason: err.Error()}
+		}
+		if authErr.status == http.StatusUnauthorized && route.authType == HTTPAuthJWT {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		}
+		h.reject(w, r, authErr.status, authErr.reason)
+		return
+	}
+
+	// Credentials bound to a tenant may only post to that tenant's routes
+	tenantID := route.resolve(route.tenantID, params)
+	if authTenantID != "" {
+		if tenantID != "" && tenantID != authTenantID {
+			h.reject(w, r, http.StatusForbidden, "credentials belong to another tenant")
+			return
+		}
+		tenantID = authTenantID
+	}
+
+	// Limits by API key or tenant apply once those are verified
+	if h.rateLimit != nil && !h.rateLimit.byIP() && h.throttle(w, r, h.rateLimit.sourceKey(r, clientIP, route.auth, tenantID)) {
+		return
+	}
+
+	// Only authenticated payloads are worth validating in depth
+	if details, err := validator.validate(body); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		h.reject(w, r, http.StatusUnprocessableEntity, err.Error(), "violations", details)
+		_ = json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "violations": details})
+		return
+	}
 
 	// Wrap in envelope
 	env, err := h.wrapPayloadInEnvelope(r, body)
@@ -93,20 +326,111 @@ func (h *HTTPInput) handleWebhook(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	env.TenantID = tenantID
+	env.IntegrationID = route.resolve(route.integrationID, params)
+	env.Metadata = map[string]string{"route": route.pattern, "path": r.URL.Path}
+	for name, value := range params {
+		env.Metadata["param."+name] = value
+	}
+	for _, name := range h.headers {
+		if value := r.Header.Get(name); value != "" {
+			env.Metadata["header."+strings.ToLower(name)] = value
+		}
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		env.Metadata["tls_client_subject"] = r.TLS.PeerCertificates[0].Subject.String()
+	}
 
-	// Send to message channel (non-blocking, fire-and-forget)
-	select {
-	case h.messages <- env:
-		slog.Info("Webhook queued", "id", env.ID)
-	default:
-		// Channel full, drop message (fire-and-forget philosophy)
-		slog.Warn("Message channel full, dropping webhook", "id", env.ID)
+	// Register before enqueueing so a fast reply cannot be missed
+	var replyChan <-chan *Reply
+	if route.sync {
+		var cancelReply func()
+		replyChan, cancelReply = replies.register(env.ID)
+		defer cancelReply()
 	}
 
-	// Return 202 Accepted immediately (fire-and-forget)
+	// Hand off to the buffer; when it is full the overload mode decides
+	if !h.overload.enqueue(r.Context(), h.messages, env) {
+		metrics.Dropped(h.pipeline, "http-input", env, "rejected")
+		w.Header().Set("Retry-After", h.overload.retryAfterSeconds())
+		h.reject(w, r, h.overload.status, "input buffer full")
+		return
+	}
+	metrics.SetQueueDepth(h.pipeline, "http-input", len(h.messages))
+
+	if route.sync {
+		h.writeReply(w, r, env.ID, replyChan)
+		return
+	}
+
+	// Return 202 Accepted once the webhook is buffered (fire-and-forget)
 	w.WriteHeader(http.StatusAccepted)
 }
 
+// reject answers with status, counting the rejection and logging it with the client IP
+func (h *HTTPInput) reject(w http.ResponseWriter, r *http.Request, status int, reason string, attrs ...any) {
+	h.rejectedMu.Lock()
+	h.rejected[status]++
+	total := h.rejected[status]
+	h.rejectedMu.Unlock()
+
+	attrs = append([]any{"source_ip", h.getClientIP(r), "path", r.URL.Path, "status", status,
+		"reason", reason, "rejected_total", total}, attrs...)
+	slog.Warn("Rejected webhook", attrs...)
+	w.WriteHeader(status)
+}
+
+// throttle rejects the request with 429 when the bucket for key is empty
+func (h *HTTPInput) throttle(w http.ResponseWriter, r *http.Request, key string) bool {
+	ok, delay, throttled := h.rateLimit.allow(key)
+	if ok {
+		return false
+	}
+	metrics.Throttled(h.pipeline, "http-input", h.rateLimit.key)
+	w.Header().Set("Retry-After", retryAfterHeader(delay))
+	h.reject(w, r, http.StatusTooManyRequests, "rate limit exceeded", "rate_limit_key", key, "throttled", throttled)
+	return true
+}
+
+// rejectedCount returns how many requests were rejected with status
+func (h *HTTPInput) rejectedCount(status int) int64 {
+	h.rejectedMu.Lock()
+	defer h.rejectedMu.Unlock()
+	return h.rejected[status]
+}
+
+// writeReply waits for the pipeline's reply and writes it as the response. If no reply
+// arrives within the sync timeout the webhook is still being processed, so answer 202.
+func (h *HTTPInput) writeReply(w http.ResponseWriter, r *http.Request, id string, replyChan <-chan *Reply) {
+	timer := time.NewTimer(h.syncWait)
+	defer timer.Stop()
+
+	w.Header().Set("X-Message-ID", id)
+
+	select {
+	case reply := <-replyChan:
+		for name, values := range reply.Headers {
+			w.Header()[name] = values
+		}
+		status := reply.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		w.WriteHeader(status)
+		if _, err := w.Write(reply.Payload); err != nil {
+			slog.Warn("Failed to write reply", "id", id, "error", err)
+		}
+		slog.Info("Webhook answered synchronously", "id", id, "status", status)
+
+	case <-timer.C:
+		slog.Warn("No reply within sync timeout, answering 202", "id", id, "timeout", h.syncWait)
+		w.WriteHeader(http.StatusAccepted)
+
+	case <-r.Context().Done():
+		slog.Warn("Client went away while waiting for reply", "id", id)
+	}
+}
+
 // wrapPayloadInEnvelope creates an envelope from the webhook payload
 func (h *HTTPInput) wrapPayloadInEnvelope(r *http.Request, body []byte) (*envelope.Envelope, error) {
 	env := envelope.New()
@@ -125,8 +449,11 @@ func (h *HTTPInput) wrapPayloadInEnvelope(r *http.Request, body []byte) (*envelo
 	}
 	env.Source = "http"
 
+	// Continue the sender's trace, if it sent one
+	tracing.Extract(r.Header.Get(tracing.TraceparentHeader), env)
+
 	// Extract source IP
-	sourceIP := getClientIP(r)
+	sourceIP := h.getClientIP(r)
 
 	// Record step in history
 	env.StepHistory = append(env.StepHistory, fmt.Sprintf("http-input:%s", sourceIP))
@@ -136,32 +463,18 @@ func (h *HTTPInput) wrapPayloadInEnvelope(r *http.Request, body []byte) (*envelo
 		"source_ip", sourceIP,
 		"content_type", env.ContentType,
 		"payload_size", env.PayloadSize,
+		"trace_id", env.TraceID,
 	)
 
 	return env, nil
 }
 
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (proxy)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		ips := xff
-		if idx := len(ips) - 1; idx >= 0 {
-			if ips[idx] == ' ' {
-				ips = ips[:idx]
-			}
-		}
-		return ips
-	}
-
-	// Check X-Real-IP header
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
+// getClientIP returns the client IP, looking through trusted proxies
+func (h *HTTPInput) getClientIP(r *http.Request) string {
+	if addr := h.clientIPs.clientIP(r); addr.IsValid() {
+		return addr.String()
 	}
-
-	// Use remote address
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	return ip
+	return r.RemoteAddr
 }
 
 // Read returns the next envelope from the webhook channel
@@ -170,8 +483,65 @@ func (h *HTTPInput) Read(ctx context.Context) (*envelope.Envelope, error) {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	case env := <-h.messages:
+		metrics.SetQueueDepth(h.pipeline, "http-input", len(h.messages))
 		return env, nil
+	case <-h.drained:
+		// Webhooks accepted before the drain are still handed out
+		select {
+		case env := <-h.messages:
+			metrics.SetQueueDepth(h.pipeline, "http-input", len(h.messages))
+			return env, nil
+		default:
+			return nil, component.ErrInputDrained
+		}
+	}
+}
+
+// CheckHealth reports whether the input is accepting webhooks
+func (h *HTTPInput) CheckHealth(ctx context.Context) error {
+	h.mu.Lock()
+	started, closed := h.server != nil, h.closed
+	h.mu.Unlock()
+	select {
+	case <-h.drained:
+		return fmt.Errorf("HTTP input drained")
+	default:
+	}
+	if !started || closed {
+		return fmt.Errorf("HTTP input not listening")
 	}
+	return nil
+}
+
+// Drain stops accepting webhooks and waits up to ctx for requests in progress to finish.
+// Webhooks already accepted stay buffered for Read, which then returns
+// component.ErrInputDrained. Webhooks spilled to disk are left for the next start.
+func (h *HTTPInput) Drain(ctx context.Context) error {
+	h.mu.Lock()
+	server, cancel, spillDone := h.server, h.cancel, h.spillDone
+	h.mu.Unlock()
+
+	var err error
+	if server != nil {
+		slog.Info("HTTP input draining", "buffered", len(h.messages))
+		err = server.Shutdown(ctx)
+	}
+	if cancel != nil {
+		cancel() // Stops the spill drainer
+	}
+	if spillDone != nil {
+		// A webhook the drainer queues before it stops must be in the buffer before Read
+		// can report the input drained, since its spill file is deleted
+		<-spillDone
+	}
+	h.drainOnce.Do(func() { close(h.drained) })
+	return err
+}
+
+// SetPipeline labels the input's metrics with the pipeline it runs in
+func (h *HTTPInput) SetPipeline(name string) {
+	h.pipeline = name
+	h.overload.pipeline = name
 }
 
 // Close gracefully shuts down the HTTP server
@@ -185,6 +555,11 @@ func (h *HTTPInput) Close() error {
 
 	h.closed = true
 
+	// Stop the spill drainer once in-flight requests are done
+	if h.cancel != nil {
+		defer h.cancel()
+	}
+
 	if h.server != nil {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
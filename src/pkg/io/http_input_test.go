@@ -4,9 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"testing"
 	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
 )
 
 func TestHTTPInput_NewHTTPInput(t *testing.T) {
@@ -207,3 +211,59 @@ func TestHTTPInput_ContextCancellation(t *testing.T) {
 
 	input.Close()
 }
+
+func TestGenericProducer_OrderByMetadataHeader(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input, err := NewHTTPInput([]byte(`{"port":"8797","metadata_headers":["X-Customer-ID"]}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	output := &componenttest.Output{Delay: 5 * time.Millisecond}
+	producer := component.New(input, output)
+	if err := producer.Configure([]byte(`{"workers":4,"order_by":"header.X-Customer-ID"}`)); err != nil {
+		t.Fatalf("Configure() error = %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		producer.Process(ctx, input, output)
+		close(done)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 10; i++ {
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:8797/webhook", bytes.NewReader([]byte(fmt.Sprintf(`{"seq":%d}`, i))))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Customer-ID", fmt.Sprintf("c-%d", i%2))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stopCancel()
+	producer.Stop(stopCtx)
+	cancel()
+	<-done
+
+	written := make(map[string][]string)
+	for _, env := range output.Written() {
+		key := component.FieldValue(env, "header.X-Customer-ID")
+		written[key] = append(written[key], string(env.Payload))
+	}
+	want := map[string]string{
+		"c-0": `[{"seq":0} {"seq":2} {"seq":4} {"seq":6} {"seq":8}]`,
+		"c-1": `[{"seq":1} {"seq":3} {"seq":5} {"seq":7} {"seq":9}]`,
+	}
+	for key, payloads := range want {
+		if got := fmt.Sprint(written[key]); got != payloads {
+			t.Errorf("Written for %s = %s, want %s", key, got, payloads)
+		}
+	}
+	if len(written) != len(want) {
+		t.Errorf("Written keys %v, want only c-0 and c-1", written)
+	}
+}
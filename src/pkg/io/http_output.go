@@ -8,28 +8,53 @@ import (
 	"io"
 	"log/slog"
 	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/ValueRetail/vrsky/pkg/component"
 	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
+	"github.com/google/uuid"
 )
 
 // HTTPOutputConfig defines the configuration for HTTP Output
+// URL, method, header values and body are Go templates over the envelope (see httpRequestData).
 type HTTPOutputConfig struct {
-	URL     string            `json:"url"`               // Target HTTP endpoint
+	URL     string            `json:"url"`               // Target HTTP endpoint, e.g. https://api.example.com/orders/{{.Payload.orderId}}
 	Method  string            `json:"method,omitempty"`  // HTTP method (default: POST)
 	Timeout int               `json:"timeout,omitempty"` // Request timeout in seconds (default: 30)
 	Retries int               `json:"retries,omitempty"` // Number of retries (default: 1)
 	Headers map[string]string `json:"headers,omitempty"` // Additional headers
+	Body    string            `json:"body,omitempty"`    // Request body (default: the raw payload)
+	TLS     *TLSClientConfig  `json:"tls,omitempty"`     // CA bundle, client certificate and SNI override
+
+	// Retry-After from 408/429/5xx responses replaces the backoff, up to this limit (default: 60s)
+	MaxRetryAfter string `json:"max_retry_after,omitempty"`
+
+	Auth *HTTPOutputAuthConfig `json:"auth,omitempty"` // Basic auth or OAuth2 tokens
 }
 
 // HTTPOutput writes messages to an HTTP endpoint with retry logic
 type HTTPOutput struct {
-	url      string
-	method   string
-	timeout  time.Duration
-	maxRetry int
-	headers  map[string]string
-	client   *http.Client
+	url           string
+	timeout       time.Duration
+	maxRetry      int
+	maxRetryAfter time.Duration
+	request       *httpRequestTemplate
+	auth          httpOutputAuth
+	client        *http.Client
+	tls           *clientTLS
+	tlsMu         sync.Mutex
+	tlsHTTP       *swappableTransport
+
+	failureMu   sync.Mutex
+	lastFailure error // Why the last delivery failed with a retryable error; nil after any response
+
+	pipeline string // Pipeline label on metrics
 }
 
 // NewHTTPOutput creates a new HTTP output writer from JSON config
@@ -48,17 +73,86 @@ func NewHTTPOutput(configJSON json.RawMessage) (*HTTPOutput, error) {
 		return nil, fmt.Errorf("HTTP output URL is required")
 	}
 
+	request, err := newHTTPRequestTemplate(config)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP output config: %w", err)
+	}
+
+	maxRetryAfter := 60 * time.Second
+	if config.MaxRetryAfter != "" {
+		maxRetryAfter, err = time.ParseDuration(config.MaxRetryAfter)
+		if err != nil || maxRetryAfter < 0 {
+			return nil, fmt.Errorf("invalid HTTP output max_retry_after %q", config.MaxRetryAfter)
+		}
+	}
+
 	timeout := time.Duration(config.Timeout) * time.Second
-	return &HTTPOutput{
-		url:      config.URL,
-		method:   config.Method,
-		timeout:  timeout,
-		maxRetry: config.Retries,
-		headers:  config.Headers,
+	output := &HTTPOutput{
+		url:           config.URL,
+		timeout:       timeout,
+		maxRetry:      config.Retries,
+		maxRetryAfter: maxRetryAfter,
+		request:       request,
 		client: &http.Client{
 			Timeout: timeout,
 		},
-	}, nil
+	}
+
+	if config.TLS != nil {
+		clientTLS, err := newClientTLS(config.TLS)
+		if err != nil {
+			return nil, fmt.Errorf("HTTP output tls config: %w", err)
+		}
+		output.tls = clientTLS
+		output.tlsHTTP = &swappableTransport{}
+		output.tlsHTTP.current.Store(output.newTransport())
+		output.client.Transport = output.tlsHTTP
+	}
+
+	auth, err := newHTTPOutputAuth(config.Auth, output.client)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP output auth config: %w", err)
+	}
+	output.auth = auth
+
+	return output, nil
+}
+
+// swappableTransport lets the transport be replaced while requests are in flight
+type swappableTransport struct {
+	current atomic.Pointer[http.Transport]
+}
+
+func (t *swappableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.current.Load().RoundTrip(req)
+}
+
+func (t *swappableTransport) CloseIdleConnections() {
+	t.current.Load().CloseIdleConnections()
+}
+
+// newTransport creates a transport using the current TLS files
+func (h *HTTPOutput) newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = h.tls.config()
+	return transport
+}
+
+// refreshTLS swaps in a new transport when the CA bundle changed on disk. Client
+// certificates are picked per handshake and need no new transport.
+func (h *HTTPOutput) refreshTLS() {
+	if h.tls == nil {
+		return
+	}
+	h.tlsMu.Lock()
+	defer h.tlsMu.Unlock()
+
+	if !h.tls.changed() {
+		return
+	}
+	old := h.tlsHTTP.current.Swap(h.newTransport())
+	old.CloseIdleConnections()
+	slog.Info("HTTP output CA bundle reloaded", "url", h.url)
 }
 
 // Start initializes the HTTP output (no-op for HTTP)
@@ -67,29 +161,133 @@ func (h *HTTPOutput) Start(ctx context.Context) error {
 	return nil
 }
 
-// Write sends the envelope to the configured HTTP endpoint with retries
+// Write sends the envelope to the configured HTTP endpoint. Network errors, 408, 429 and
+// 5xx responses are retried with exponential backoff, or after the endpoint's Retry-After.
+// Other responses are permanent failures returned as *component.PermanentError.
 func (h *HTTPOutput) Write(ctx context.Context, env *envelope.Envelope) error {
 	if h.url == "" {
 		return fmt.Errorf("HTTP output URL not configured")
 	}
 
+	// Render the request once; a template that cannot be rendered will not succeed on retry
+	method, url, headers, body, err := h.request.render(env)
+	if err != nil {
+		replies.deliver(env.ID, &Reply{Status: http.StatusBadGateway})
+		env.LastError = err.Error()
+		return &component.PermanentError{Err: fmt.Errorf("failed to render HTTP request for message %s: %w", env.ID, err)}
+	}
+
+	return h.send(ctx, env, method, url, headers, body)
+}
+
+// WriteBatch sends the envelopes as JSON arrays, one request for each distinct rendered
+// method, URL and headers. Each element is the envelope's rendered body, or the body as a
+// JSON string when it is not JSON. Envelopes a synchronous caller is waiting for are sent
+// on their own so the caller gets its own reply. A failed request fails every envelope
+// in it, which the returned *component.BatchError reports.
+func (h *HTTPOutput) WriteBatch(ctx context.Context, envs []*envelope.Envelope) error {
+	type batchRequest struct {
+		method, url string
+		headers     map[string]string
+		indexes     []int
+		envs        []*envelope.Envelope
+		items       []json.RawMessage
+	}
+	var (
+		requests []*batchRequest
+		byKey    = make(map[string]*batchRequest)
+		failed   = make(map[int]error)
+	)
+	for i, env := range envs {
+		if replies.expecting(env.ID) {
+			if err := h.Write(ctx, env); err != nil {
+				failed[i] = err
+			}
+			continue
+		}
+		method, url, headers, body, err := h.request.render(env)
+		if err != nil {
+			env.LastError = err.Error()
+			failed[i] = &component.PermanentError{Err: fmt.Errorf("failed to render HTTP request for message %s: %w", env.ID, err)}
+			continue
+		}
+		item := json.RawMessage(body)
+		if !json.Valid(body) {
+			item, _ = json.Marshal(string(body))
+		}
+
+		names := make([]string, 0, len(headers))
+		for name := range headers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		key := method + " " + url
+		for _, name := range names {
+			key += "\n" + name + ": " + headers[name]
+		}
+		request := byKey[key]
+		if request == nil {
+			request = &batchRequest{method: method, url: url, headers: headers}
+			byKey[key] = request
+			requests = append(requests, request)
+		}
+		request.indexes = append(request.indexes, i)
+		request.envs = append(request.envs, env)
+		request.items = append(request.items, item)
+	}
+
+	for _, request := range requests {
+		body, err := json.Marshal(request.items)
+		if err != nil {
+			for _, i := range request.indexes {
+				failed[i] = &component.PermanentError{Err: fmt.Errorf("failed to encode HTTP batch: %w", err)}
+			}
+			continue
+		}
+		headers := map[string]string{"X-Batch-Size": strconv.Itoa(len(request.envs))}
+		for name, value := range request.headers {
+			headers[name] = value
+		}
+		// The request continues the first message's trace
+		batch := &envelope.Envelope{ID: uuid.New().String(), ContentType: "application/json", TraceParent: request.envs[0].TraceParent}
+		err = h.send(ctx, batch, request.method, request.url, headers, body)
+		for _, env := range request.envs {
+			env.LastError = batch.LastError
+		}
+		if err != nil {
+			err = fmt.Errorf("batch %s of %d messages: %w", batch.ID, len(request.envs), err)
+			for _, i := range request.indexes {
+				failed[i] = err
+			}
+		}
+	}
+	return component.NewBatchError(failed)
+}
+
+// send delivers a rendered request, retrying as described on Write
+func (h *HTTPOutput) send(ctx context.Context, env *envelope.Envelope, method, url string, headers map[string]string, body []byte) error {
 	slog.Debug("Writing to HTTP endpoint",
-		"url", h.url,
-		"method", h.method,
+		"url", url,
+		"method", method,
 		"message_id", env.ID)
 
-	// Create request with payload
-	req, err := http.NewRequestWithContext(ctx, h.method, h.url, nil)
+	h.refreshTLS()
+
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
-		return fmt.Errorf("failed to create HTTP request: %w", err)
+		return &component.PermanentError{Err: fmt.Errorf("failed to create HTTP request: %w", err)}
 	}
 
-	// Retry logic with exponential backoff
 	var lastErr error
-	for attempt := 0; attempt < h.maxRetry; attempt++ {
+	attempt := 0
+	for ; attempt < h.maxRetry; attempt++ {
+		if attempt > 0 {
+			metrics.Retried(h.pipeline, "http-output", env)
+		}
+
 		// Create fresh request body for retry
-		req.Body = io.NopCloser(bytes.NewReader(env.Payload))
-		req.ContentLength = int64(len(env.Payload))
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
 
 		// Set content type
 		if env.ContentType != "" {
@@ -99,64 +297,170 @@ func (h *HTTPOutput) Write(ctx context.Context, env *envelope.Envelope) error {
 		}
 
 		// Add custom headers
-		for k, v := range h.headers {
+		for k, v := range headers {
 			req.Header.Set(k, v)
 		}
 
-		// Add X-Message-ID header for tracking
+		// Add X-Message-ID header for tracking, and the trace context so the endpoint can continue the trace
 		req.Header.Set("X-Message-ID", env.ID)
+		if env.TraceParent != "" {
+			req.Header.Set(tracing.TraceparentHeader, env.TraceParent)
+		}
 
 		slog.Debug("HTTP request attempt",
 			"attempt", attempt+1,
-			"url", h.url,
+			"url", url,
 			"message_id", env.ID)
 
-		// Send request
-		resp, err := h.client.Do(req)
+		wait := time.Duration(1<<uint(attempt)) * time.Second
+
+		resp, err := h.do(req, body)
 		if err != nil {
 			lastErr = err
+			env.LastError = err.Error()
 			slog.Debug("HTTP request failed", "error", err, "attempt", attempt+1)
-			// Backoff before retry
-			if attempt < h.maxRetry-1 {
-				waitTime := time.Duration(1<<uint(attempt)) * time.Second
-				select {
-				case <-time.After(waitTime):
-				case <-ctx.Done():
-					return ctx.Err()
-				}
-			}
-			continue
-		}
-
-		// Check response status
-		defer resp.Body.Close()
-		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		} else if resp.StatusCode >= 200 && resp.StatusCode < 300 {
 			slog.Info("Message sent successfully via HTTP",
-				"url", h.url,
+				"url", url,
 				"status", resp.StatusCode,
 				"message_id", env.ID)
+			deliverHTTPReply(env.ID, resp)
+			resp.Body.Close()
+			h.setLastFailure(nil)
 			return nil
-		}
+		} else {
+			// Keep the error body for diagnosis and a possible reply, then release the connection
+			respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxReplySize))
+			resp.Body.Close()
 
-		// Non-success status - retry or fail
-		lastErr = fmt.Errorf("HTTP %d: %s", resp.StatusCode, resp.Status)
-		slog.Debug("HTTP request returned error status",
-			"status", resp.StatusCode,
-			"attempt", attempt+1,
-			"message_id", env.ID)
+			statusErr := &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: truncateErrorBody(respBody)}
+			lastErr = statusErr
+			env.LastError = statusErr.Error()
+			slog.Debug("HTTP request returned error status",
+				"status", resp.StatusCode,
+				"attempt", attempt+1,
+				"message_id", env.ID)
+
+			if !retryableStatus(resp.StatusCode) {
+				h.setLastFailure(nil) // The endpoint answered; the message was the problem
+				// A synchronous caller gets the endpoint's error response
+				deliverReply(env.ID, resp, respBody)
+				slog.Warn("HTTP endpoint rejected message permanently",
+					"url", url,
+					"status", resp.StatusCode,
+					"message_id", env.ID)
+				return &component.PermanentError{Err: fmt.Errorf("failed to write to HTTP: %w", statusErr)}
+			}
+
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > h.maxRetryAfter {
+					// Not worth holding the pipeline for; leave it to redelivery
+					deliverReply(env.ID, resp, respBody)
+					attempt++
+					break
+				}
+				wait = retryAfter
+			}
+			if attempt == h.maxRetry-1 {
+				// Out of retries: a synchronous caller gets the endpoint's error response
+				deliverReply(env.ID, resp, respBody)
+			}
+		}
 
 		// Backoff before retry
 		if attempt < h.maxRetry-1 {
-			waitTime := time.Duration(1<<uint(attempt)) * time.Second
 			select {
-			case <-time.After(waitTime):
+			case <-time.After(wait):
 			case <-ctx.Done():
 				return ctx.Err()
 			}
 		}
 	}
 
-	return fmt.Errorf("failed to write to HTTP after %d attempts: %w", h.maxRetry, lastErr)
+	// Nothing answered; a no-op unless a synchronous caller is waiting
+	replies.deliver(env.ID, &Reply{Status: http.StatusBadGateway})
+	h.setLastFailure(lastErr)
+
+	return fmt.Errorf("failed to write to HTTP after %d attempts: %w", attempt, lastErr)
+}
+
+// do sends the request with the configured credentials. When the endpoint rejects an
+// OAuth2 token with 401, the request is sent once more with a fresh token.
+func (h *HTTPOutput) do(req *http.Request, body []byte) (*http.Response, error) {
+	if h.auth == nil {
+		return h.client.Do(req)
+	}
+	if err := h.auth.authorize(req); err != nil {
+		return nil, err
+	}
+	resp, err := h.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || !h.auth.rejected(req) {
+		return resp, err
+	}
+
+	resp.Body.Close()
+	slog.Info("HTTP output credentials rejected, retrying with a new token", "url", req.URL.String())
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	if err := h.auth.authorize(req); err != nil {
+		return nil, err
+	}
+	return h.client.Do(req)
+}
+
+// maxReplySize caps how much of a response body is returned to a synchronous caller
+const maxReplySize = 10 << 20
+
+// hopByHopHeaders are not forwarded when a response is relayed as a reply
+var hopByHopHeaders = []string{"Connection", "Content-Length", "Keep-Alive", "Transfer-Encoding", "Trailer", "Upgrade"}
+
+// deliverHTTPReply relays the endpoint's response to a synchronous caller, if one is waiting
+func deliverHTTPReply(id string, resp *http.Response) {
+	if !replies.expecting(id) {
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReplySize))
+	if err != nil {
+		slog.Warn("Failed to read HTTP response for reply", "message_id", id, "error", err)
+		replies.deliver(id, &Reply{Status: http.StatusBadGateway})
+		return
+	}
+	deliverReply(id, resp, body)
+}
+
+// deliverReply relays a response whose body was already read
+func deliverReply(id string, resp *http.Response, body []byte) {
+	if !replies.expecting(id) {
+		return
+	}
+	headers := resp.Header.Clone()
+	for _, name := range hopByHopHeaders {
+		headers.Del(name)
+	}
+	replies.deliver(id, &Reply{Status: resp.StatusCode, Headers: headers, Payload: body})
+}
+
+// setLastFailure records the outcome of a delivery for CheckHealth
+func (h *HTTPOutput) setLastFailure(err error) {
+	h.failureMu.Lock()
+	defer h.failureMu.Unlock()
+	h.lastFailure = err
+}
+
+// CheckHealth fails while the endpoint is unreachable: the last delivery ran out of retries
+// on network errors or retryable statuses. It sends no requests of its own, as the URL may
+// depend on the message.
+func (h *HTTPOutput) CheckHealth(ctx context.Context) error {
+	h.failureMu.Lock()
+	defer h.failureMu.Unlock()
+	if h.lastFailure != nil {
+		return fmt.Errorf("last delivery failed: %w", h.lastFailure)
+	}
+	return nil
+}
+
+// SetPipeline labels the output's metrics with the pipeline it runs in
+func (h *HTTPOutput) SetPipeline(name string) {
+	h.pipeline = name
 }
 
 // Close closes the HTTP client
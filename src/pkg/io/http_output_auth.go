@@ -0,0 +1,259 @@
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Supported HTTP output authentication types
+const (
+	OutputAuthBasic             = "basic"
+	OutputAuthClientCredentials = "client_credentials" // OAuth2 client credentials grant
+	OutputAuthRefreshToken      = "refresh_token"      // OAuth2 refresh token grant
+)
+
+// HTTPOutputAuthConfig configures the credentials the HTTP output sends, selected by Type
+type HTTPOutputAuthConfig struct {
+	Type string `json:"type"` // "basic", "client_credentials" or "refresh_token"
+
+	// Basic auth
+	Username    string `json:"username,omitempty"`
+	Password    string `json:"password,omitempty"`
+	PasswordEnv string `json:"password_env,omitempty"` // Environment variable holding the password
+
+	// OAuth2
+	TokenURL        string            `json:"token_url,omitempty"`         // Token endpoint
+	ClientID        string            `json:"client_id,omitempty"`         // Required for client_credentials
+	ClientSecret    string            `json:"client_secret,omitempty"`     // Client secret
+	ClientSecretEnv string            `json:"client_secret_env,omitempty"` // Environment variable holding the client secret
+	Scopes          []string          `json:"scopes,omitempty"`            // Requested scopes
+	Params          map[string]string `json:"params,omitempty"`            // Extra token request parameters (e.g. audience)
+	RefreshToken    string            `json:"refresh_token,omitempty"`     // Refresh token grant only
+	RefreshTokenEnv string            `json:"refresh_token_env,omitempty"` // Environment variable holding the refresh token
+	CredentialsIn   string            `json:"credentials_in,omitempty"`    // Where client credentials go: header (HTTP Basic, default) or body
+	RefreshBefore   string            `json:"refresh_before,omitempty"`    // Renew tokens this long before they expire (default: 60s)
+}
+
+// httpOutputAuth adds credentials to outgoing requests
+type httpOutputAuth interface {
+	authorize(req *http.Request) error
+	// rejected is called when the endpoint answered 401 to req. It reports whether
+	// new credentials are available, making one more attempt worthwhile.
+	rejected(req *http.Request) bool
+}
+
+// newHTTPOutputAuth builds the authenticator for a config; nil config sends no credentials.
+// Token requests go through client so they share the output's TLS settings.
+func newHTTPOutputAuth(config *HTTPOutputAuthConfig, client *http.Client) (httpOutputAuth, error) {
+	if config == nil {
+		return nil, nil
+	}
+	switch config.Type {
+	case OutputAuthBasic:
+		password := config.Password
+		if config.PasswordEnv != "" {
+			password = os.Getenv(config.PasswordEnv)
+		}
+		if config.Username == "" {
+			return nil, fmt.Errorf("basic auth requires username")
+		}
+		return &basicOutputAuth{username: config.Username, password: password}, nil
+	case OutputAuthClientCredentials, OutputAuthRefreshToken:
+		return newOAuth2TokenSource(config, client)
+	default:
+		return nil, fmt.Errorf("unsupported auth type %q (must be basic, client_credentials or refresh_token)", config.Type)
+	}
+}
+
+type basicOutputAuth struct {
+	username string
+	password string
+}
+
+func (a *basicOutputAuth) authorize(req *http.Request) error {
+	req.SetBasicAuth(a.username, a.password)
+	return nil
+}
+
+func (a *basicOutputAuth) rejected(*http.Request) bool {
+	return false
+}
+
+// oauth2TokenSource fetches access tokens and caches them until shortly before they expire.
+// Refresh tokens rotated by the server replace the configured one.
+type oauth2TokenSource struct {
+	grant         string
+	tokenURL      string
+	clientID      string
+	clientSecret  string
+	scopes        []string
+	params        map[string]string
+	inBody        bool
+	refreshBefore time.Duration
+	client        *http.Client
+	now           func() time.Time
+
+	mu           sync.Mutex
+	refreshToken string
+	accessToken  string
+	renewAt      time.Time // Zero when the server did not say when the token expires
+}
+
+func newOAuth2TokenSource(config *HTTPOutputAuthConfig, client *http.Client) (*oauth2TokenSource, error) {
+	s := &oauth2TokenSource{
+		grant:         config.Type,
+		tokenURL:      config.TokenURL,
+		clientID:      config.ClientID,
+		clientSecret:  config.ClientSecret,
+		scopes:        config.Scopes,
+		params:        config.Params,
+		refreshToken:  config.RefreshToken,
+		refreshBefore: 60 * time.Second,
+		client:        client,
+		now:           time.Now,
+	}
+	if config.ClientSecretEnv != "" {
+		s.clientSecret = os.Getenv(config.ClientSecretEnv)
+	}
+	if config.RefreshTokenEnv != "" {
+		s.refreshToken = os.Getenv(config.RefreshTokenEnv)
+	}
+
+	if err := checkRequestURL(s.tokenURL); err != nil {
+		return nil, fmt.Errorf("%s auth token_url: %w", s.grant, err)
+	}
+	if s.grant == OutputAuthClientCredentials && (s.clientID == "" || s.clientSecret == "") {
+		return nil, fmt.Errorf("client_credentials auth requires client_id and client_secret")
+	}
+	if s.grant == OutputAuthRefreshToken && s.refreshToken == "" {
+		return nil, fmt.Errorf("refresh_token auth requires refresh_token")
+	}
+	switch config.CredentialsIn {
+	case "", "header":
+	case "body":
+		s.inBody = true
+	default:
+		return nil, fmt.Errorf("unsupported credentials_in %q (must be header or body)", config.CredentialsIn)
+	}
+	if config.RefreshBefore != "" {
+		d, err := time.ParseDuration(config.RefreshBefore)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid refresh_before %q", config.RefreshBefore)
+		}
+		s.refreshBefore = d
+	}
+	return s, nil
+}
+
+func (s *oauth2TokenSource) authorize(req *http.Request) error {
+	token, err := s.token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// rejected drops the token the endpoint refused so the next authorize fetches a new one.
+// A token already replaced by a concurrent request is left alone.
+func (s *oauth2TokenSource) rejected(req *http.Request) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.Header.Get("Authorization") == "Bearer "+s.accessToken {
+		s.accessToken = ""
+	}
+	return true
+}
+
+// token returns a cached access token, fetching a new one when it is missing or about to expire.
+// The lock is held during the fetch so concurrent writers share a single token request.
+func (s *oauth2TokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && (s.renewAt.IsZero() || s.now().Before(s.renewAt)) {
+		return s.accessToken, nil
+	}
+	if err := s.fetch(ctx); err != nil {
+		return "", fmt.Errorf("fetch OAuth2 token from %s: %w", s.tokenURL, err)
+	}
+	return s.accessToken, nil
+}
+
+// fetch requests a new access token
+func (s *oauth2TokenSource) fetch(ctx context.Context) error {
+	form := url.Values{"grant_type": {s.grant}}
+	if s.grant == OutputAuthRefreshToken {
+		form.Set("refresh_token", s.refreshToken)
+	}
+	if len(s.scopes) > 0 {
+		form.Set("scope", strings.Join(s.scopes, " "))
+	}
+	for name, value := range s.params {
+		form.Set(name, value)
+	}
+	if s.inBody && s.clientID != "" {
+		form.Set("client_id", s.clientID)
+		form.Set("client_secret", s.clientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if !s.inBody && s.clientID != "" {
+		// RFC 6749 section 2.3.1: credentials are form-encoded before Basic encoding
+		req.SetBasicAuth(url.QueryEscape(s.clientID), url.QueryEscape(s.clientSecret))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		AccessToken      string      `json:"access_token"`
+		ExpiresIn        json.Number `json:"expires_in"`
+		RefreshToken     string      `json:"refresh_token"`
+		Error            string      `json:"error"`
+		ErrorDescription string      `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil && resp.StatusCode < 300 {
+		return fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || result.AccessToken == "" {
+		if result.Error != "" {
+			return fmt.Errorf("HTTP %d: %s %s", resp.StatusCode, result.Error, result.ErrorDescription)
+		}
+		return fmt.Errorf("HTTP %d: no access_token in response", resp.StatusCode)
+	}
+
+	s.accessToken = result.AccessToken
+	s.renewAt = time.Time{}
+	if seconds, err := result.ExpiresIn.Int64(); err == nil && seconds > 0 {
+		// Short-lived tokens are renewed halfway through instead of on every request
+		lifetime := time.Duration(seconds) * time.Second
+		s.renewAt = s.now().Add(lifetime - min(s.refreshBefore, lifetime/2))
+	}
+	if result.RefreshToken != "" {
+		s.refreshToken = result.RefreshToken
+	}
+	slog.Info("Fetched OAuth2 token", "token_url", s.tokenURL, "grant", s.grant, "expires_in", result.ExpiresIn)
+	return nil
+}
@@ -0,0 +1,232 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// fakeOAuth2 is a token endpoint plus an API that only accepts its current token
+type fakeOAuth2 struct {
+	mu        sync.Mutex
+	issued    int
+	expiresIn int
+	valid     map[string]bool
+	forms     []map[string]string
+	basicUser string
+	refresh   string // Expected refresh token; rotated on every use
+	server    *httptest.Server
+}
+
+func newFakeOAuth2(t *testing.T, expiresIn int) *fakeOAuth2 {
+	f := &fakeOAuth2{expiresIn: expiresIn, valid: make(map[string]bool), refresh: "refresh-0"}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeOAuth2) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path != "/token" {
+		if !f.valid[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")] {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	form := make(map[string]string)
+	for name := range r.PostForm {
+		form[name] = r.PostForm.Get(name)
+	}
+	f.forms = append(f.forms, form)
+	f.basicUser, _, _ = r.BasicAuth()
+
+	w.Header().Set("Content-Type", "application/json")
+	if form["grant_type"] == OutputAuthRefreshToken {
+		if form["refresh_token"] != f.refresh {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_grant","error_description":"refresh token revoked"}`)
+			return
+		}
+		f.refresh = fmt.Sprintf("refresh-%d", f.issued+1)
+	}
+	f.issued++
+	token := fmt.Sprintf("token-%d", f.issued)
+	f.valid[token] = true
+	fmt.Fprintf(w, `{"access_token":%q,"token_type":"Bearer","expires_in":%d,"refresh_token":%q}`, token, f.expiresIn, f.refresh)
+}
+
+func (f *fakeOAuth2) revokeAll() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.valid = make(map[string]bool)
+}
+
+func (f *fakeOAuth2) tokensIssued() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.issued
+}
+
+func writeTestEnvelope(t *testing.T, output *HTTPOutput) error {
+	t.Helper()
+	env := envelope.New()
+	env.ID = "msg-auth"
+	env.Payload = []byte(`{}`)
+	return output.Write(context.Background(), env)
+}
+
+func TestNewHTTPOutputAuth_InvalidConfig(t *testing.T) {
+	tests := map[string]HTTPOutputAuthConfig{
+		"unknown type":       {Type: "digest"},
+		"basic without user": {Type: OutputAuthBasic, Password: "secret"},
+		"missing token url":  {Type: OutputAuthClientCredentials, ClientID: "id", ClientSecret: "secret"},
+		"missing secret":     {Type: OutputAuthClientCredentials, TokenURL: "https://idp.example.com/token", ClientID: "id"},
+		"missing refresh":    {Type: OutputAuthRefreshToken, TokenURL: "https://idp.example.com/token", RefreshTokenEnv: "EMPTY_REFRESH_TOKEN"},
+		"bad credentials_in": {Type: OutputAuthClientCredentials, TokenURL: "https://idp.example.com/token", ClientID: "id", ClientSecret: "s", CredentialsIn: "query"},
+		"bad refresh_before": {Type: OutputAuthClientCredentials, TokenURL: "https://idp.example.com/token", ClientID: "id", ClientSecret: "s", RefreshBefore: "soon"},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newHTTPOutputAuth(&config, http.DefaultClient); err == nil {
+				t.Error("newHTTPOutputAuth() should fail")
+			}
+		})
+	}
+}
+
+func TestHTTPOutput_ClientCredentials(t *testing.T) {
+	fake := newFakeOAuth2(t, 3600)
+	output, err := NewHTTPOutput([]byte(`{"url":"` + fake.server.URL + `/api","auth":{"type":"client_credentials",
+		"token_url":"` + fake.server.URL + `/token","client_id":"vrsky","client_secret":"s3cret",
+		"scopes":["orders.write","orders.read"],"params":{"audience":"partner-api"}}}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := writeTestEnvelope(t, output); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	if fake.tokensIssued() != 1 {
+		t.Errorf("%d token requests, want 1 cached token", fake.tokensIssued())
+	}
+	form := fake.forms[0]
+	if form["grant_type"] != "client_credentials" || form["scope"] != "orders.write orders.read" || form["audience"] != "partner-api" {
+		t.Errorf("Token request form = %v", form)
+	}
+	if fake.basicUser != "vrsky" || form["client_secret"] != "" {
+		t.Errorf("Client credentials should be sent with HTTP Basic, got user %q form %v", fake.basicUser, form)
+	}
+
+	// A token the API no longer accepts is replaced once, without failing the write
+	fake.revokeAll()
+	if err := writeTestEnvelope(t, output); err != nil {
+		t.Fatalf("Write() after revocation error = %v", err)
+	}
+	if fake.tokensIssued() != 2 {
+		t.Errorf("%d token requests after revocation, want 2", fake.tokensIssued())
+	}
+}
+
+func TestOAuth2TokenSource_RenewsBeforeExpiry(t *testing.T) {
+	fake := newFakeOAuth2(t, 300)
+	source, err := newOAuth2TokenSource(&HTTPOutputAuthConfig{
+		Type: OutputAuthClientCredentials, TokenURL: fake.server.URL + "/token",
+		ClientID: "vrsky", ClientSecret: "s3cret", CredentialsIn: "body", RefreshBefore: "1m",
+	}, http.DefaultClient)
+	if err != nil {
+		t.Fatalf("newOAuth2TokenSource() error = %v", err)
+	}
+	now := time.Now()
+	source.now = func() time.Time { return now }
+
+	first, err := source.token(context.Background())
+	if err != nil {
+		t.Fatalf("token() error = %v", err)
+	}
+	if form := fake.forms[0]; form["client_id"] != "vrsky" || form["client_secret"] != "s3cret" {
+		t.Errorf("credentials_in body: form = %v", form)
+	}
+
+	now = now.Add(3*time.Minute + 59*time.Second)
+	if token, _ := source.token(context.Background()); token != first {
+		t.Errorf("Token renewed too early: %s", token)
+	}
+	now = now.Add(2 * time.Second) // Within refresh_before of the 5 minute expiry
+	if token, _ := source.token(context.Background()); token == first {
+		t.Error("Token not renewed before expiry")
+	}
+}
+
+func TestHTTPOutput_RefreshTokenRotation(t *testing.T) {
+	fake := newFakeOAuth2(t, 3600)
+	t.Setenv("PARTNER_REFRESH_TOKEN", "refresh-0")
+	output, err := NewHTTPOutput([]byte(`{"url":"` + fake.server.URL + `/api","auth":{"type":"refresh_token",
+		"token_url":"` + fake.server.URL + `/token","refresh_token_env":"PARTNER_REFRESH_TOKEN"}}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	if err := writeTestEnvelope(t, output); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	// The rotated refresh token must be used for the next grant
+	fake.revokeAll()
+	if err := writeTestEnvelope(t, output); err != nil {
+		t.Fatalf("Write() after revocation error = %v", err)
+	}
+	if got := fake.forms[1]["refresh_token"]; got != "refresh-1" {
+		t.Errorf("Second grant used refresh token %q, want the rotated refresh-1", got)
+	}
+}
+
+func TestHTTPOutput_TokenEndpointError(t *testing.T) {
+	fake := newFakeOAuth2(t, 3600)
+	output, err := NewHTTPOutput([]byte(`{"url":"` + fake.server.URL + `/api","auth":{"type":"refresh_token",
+		"token_url":"` + fake.server.URL + `/token","refresh_token":"stale"}}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	err = writeTestEnvelope(t, output)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("Write() error = %v, want the token endpoint's invalid_grant", err)
+	}
+}
+
+func TestHTTPOutput_BasicAuth(t *testing.T) {
+	var user, password string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ = r.BasicAuth()
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer backend.Close()
+
+	t.Setenv("PARTNER_PASSWORD", "hunter2")
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `","auth":{"type":"basic","username":"vrsky","password_env":"PARTNER_PASSWORD"}}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	if err := writeTestEnvelope(t, output); err == nil {
+		t.Error("Write() should fail on 401")
+	}
+	if user != "vrsky" || password != "hunter2" {
+		t.Errorf("Basic auth = %q:%q", user, password)
+	}
+}
@@ -0,0 +1,312 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+)
+
+// Overload modes for the HTTP input when its buffer is full
+const (
+	OverloadReject = "reject" // answer 503/429 with Retry-After immediately
+	OverloadBlock  = "block"  // wait up to block_timeout for buffer space, then reject
+	OverloadSpill  = "spill"  // write to a local on-disk queue drained back into the buffer
+	OverloadDrop   = "drop"   // answer 202 and discard the payload (legacy behaviour)
+)
+
+// HTTPOverloadConfig controls what the HTTP input does when its buffer is full
+type HTTPOverloadConfig struct {
+	Mode          string `json:"mode,omitempty"`            // reject, block, spill or drop (default: reject)
+	Status        int    `json:"status,omitempty"`          // 429 or 503 (default: 503)
+	RetryAfter    string `json:"retry_after,omitempty"`     // Retry-After sent with rejections (default: 5s)
+	BlockTimeout  string `json:"block_timeout,omitempty"`   // Block mode only (default: 5s)
+	SpillDir      string `json:"spill_dir,omitempty"`       // Spill mode only (required)
+	SpillMaxFiles int    `json:"spill_max_files,omitempty"` // Spill mode only; reject beyond this (default: 10000)
+}
+
+// overloadPolicy is the compiled overload config
+type overloadPolicy struct {
+	mode         string
+	status       int
+	retryAfter   time.Duration
+	blockTimeout time.Duration
+	spill        *spillQueue
+	pipeline     string // Pipeline label on metrics
+}
+
+func newOverloadPolicy(config HTTPOverloadConfig) (*overloadPolicy, error) {
+	policy := &overloadPolicy{
+		mode:         config.Mode,
+		status:       config.Status,
+		retryAfter:   5 * time.Second,
+		blockTimeout: 5 * time.Second,
+	}
+	if policy.mode == "" {
+		policy.mode = OverloadReject
+	}
+	if policy.status == 0 {
+		policy.status = http.StatusServiceUnavailable
+	}
+	if policy.status != http.StatusServiceUnavailable && policy.status != http.StatusTooManyRequests {
+		return nil, fmt.Errorf("overload status must be 429 or 503, got %d", policy.status)
+	}
+	if config.RetryAfter != "" {
+		d, err := time.ParseDuration(config.RetryAfter)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid overload retry_after %q", config.RetryAfter)
+		}
+		policy.retryAfter = d
+	}
+	if config.BlockTimeout != "" {
+		d, err := time.ParseDuration(config.BlockTimeout)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid overload block_timeout %q", config.BlockTimeout)
+		}
+		policy.blockTimeout = d
+	}
+
+	switch policy.mode {
+	case OverloadReject, OverloadBlock, OverloadDrop:
+	case OverloadSpill:
+		if config.SpillDir == "" {
+			return nil, fmt.Errorf("overload mode spill requires spill_dir")
+		}
+		maxFiles := config.SpillMaxFiles
+		if maxFiles <= 0 {
+			maxFiles = 10000
+		}
+		spill, err := newSpillQueue(config.SpillDir, maxFiles)
+		if err != nil {
+			return nil, err
+		}
+		policy.spill = spill
+	default:
+		return nil, fmt.Errorf("unsupported overload mode %q (must be reject, block, spill or drop)", policy.mode)
+	}
+	return policy, nil
+}
+
+// retryAfterSeconds formats the Retry-After header value, rounding up to whole seconds
+func (p *overloadPolicy) retryAfterSeconds() string {
+	return retryAfterHeader(p.retryAfter)
+}
+
+// enqueue hands an envelope to the buffer according to the overload mode.
+// It returns false if the request must be rejected so the sender retries.
+func (p *overloadPolicy) enqueue(ctx context.Context, messages chan *envelope.Envelope, env *envelope.Envelope) bool {
+	// While spilled envelopes are pending, keep spilling so order is preserved
+	if p.spill == nil || p.spill.pending() == 0 {
+		select {
+		case messages <- env:
+			slog.Info("Webhook queued", "id", env.ID)
+			return true
+		default:
+		}
+	}
+
+	switch p.mode {
+	case OverloadBlock:
+		timer := time.NewTimer(p.blockTimeout)
+		defer timer.Stop()
+		select {
+		case messages <- env:
+			slog.Info("Webhook queued after waiting for buffer space", "id", env.ID)
+			return true
+		case <-timer.C:
+			slog.Warn("Message channel full, rejecting webhook", "id", env.ID, "waited", p.blockTimeout)
+			return false
+		case <-ctx.Done():
+			slog.Warn("Client went away while waiting for buffer space", "id", env.ID)
+			return false
+		}
+
+	case OverloadSpill:
+		if err := p.spill.push(env); err != nil {
+			slog.Error("Failed to spill webhook, rejecting", "id", env.ID, "error", err)
+			return false
+		}
+		slog.Info("Webhook spilled to disk", "id", env.ID, "pending", p.spill.pending())
+		return true
+
+	case OverloadDrop:
+		slog.Warn("Message channel full, dropping webhook", "id", env.ID)
+		metrics.Dropped(p.pipeline, "http-input", env, "buffer_full")
+		return true
+
+	default:
+		slog.Warn("Message channel full, rejecting webhook", "id", env.ID)
+		return false
+	}
+}
+
+// spillQueue is a directory of envelope files drained back into the buffer in FIFO order.
+// Files survive restarts and are picked up again on the next Start.
+type spillQueue struct {
+	dir      string
+	maxFiles int
+	count    atomic.Int64
+	seq      atomic.Uint64
+	notify   chan struct{}
+	mu       sync.Mutex // serializes pushes against the file limit
+
+	// Delivered files that could be neither removed nor renamed aside. They are not counted,
+	// so they neither hold up the buffer nor take places in the queue. Only drain uses it.
+	stuck map[string]struct{}
+}
+
+func newSpillQueue(dir string, maxFiles int) (*spillQueue, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, fmt.Errorf("create spill directory: %w", err)
+	}
+	q := &spillQueue{dir: dir, maxFiles: maxFiles, notify: make(chan struct{}, 1), stuck: make(map[string]struct{})}
+	files, err := q.files()
+	if err != nil {
+		return nil, err
+	}
+	q.count.Store(int64(len(files)))
+	return q, nil
+}
+
+func (q *spillQueue) pending() int64 {
+	return q.count.Load()
+}
+
+// push writes an envelope atomically (temp file + rename) so the drainer never sees partial files
+func (q *spillQueue) push(env *envelope.Envelope) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.count.Load() >= int64(q.maxFiles) {
+		return fmt.Errorf("spill queue full (%d files)", q.maxFiles)
+	}
+
+	data, err := envelope.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("marshal envelope: %w", err)
+	}
+	name := fmt.Sprintf("%020d-%010d.json", time.Now().UnixNano(), q.seq.Add(1))
+	tmpPath := filepath.Join(q.dir, "."+name+".tmp")
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("create spill file: %w", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("write spill file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("sync spill file: %w", err)
+	}
+	file.Close()
+	if err := os.Rename(tmpPath, filepath.Join(q.dir, name)); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("rename spill file: %w", err)
+	}
+
+	q.count.Add(1)
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// files lists spilled envelopes oldest first
+func (q *spillQueue) files() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("read spill directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && strings.HasSuffix(entry.Name(), ".json") && !strings.HasPrefix(entry.Name(), ".") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// drain moves spilled envelopes into the buffer until ctx is cancelled
+func (q *spillQueue) drain(ctx context.Context, messages chan *envelope.Envelope) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		names, err := q.files()
+		if err != nil {
+			slog.Error("Failed to list spill queue", "error", err)
+		}
+		for _, name := range names {
+			if _, ok := q.stuck[name]; ok {
+				continue
+			}
+			path := filepath.Join(q.dir, name)
+			data, err := os.ReadFile(path)
+			if err != nil {
+				slog.Error("Failed to read spilled webhook", "file", name, "error", err)
+				continue
+			}
+			env, err := envelope.Unmarshal(data)
+			if err != nil {
+				// Keep the file aside instead of blocking the queue on it
+				slog.Error("Corrupt spilled webhook, quarantining", "file", name, "error", err)
+				if err := os.Rename(path, path+".corrupt"); err == nil {
+					q.count.Add(-1)
+				}
+				continue
+			}
+
+			select {
+			case messages <- env:
+			case <-ctx.Done():
+				return
+			}
+			q.finish(name)
+			slog.Info("Spilled webhook queued", "id", env.ID, "pending", q.pending())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// finish removes a drained spill file. A file that cannot be removed is renamed aside, or
+// failing that skipped from then on, so its webhook is never queued twice.
+func (q *spillQueue) finish(name string) {
+	path := filepath.Join(q.dir, name)
+	err := os.Remove(path)
+	if err == nil {
+		q.count.Add(-1)
+		return
+	}
+	slog.Error("Failed to remove drained spill file", "file", name, "error", err)
+
+	if err := os.Rename(path, path+".delivered"); err == nil {
+		q.count.Add(-1)
+		return
+	}
+	// The file stays until it is cleaned up by hand, but its webhook is no longer pending
+	slog.Error("Failed to move drained spill file aside, skipping it", "file", name, "error", err)
+	q.stuck[name] = struct{}{}
+	q.count.Add(-1)
+}
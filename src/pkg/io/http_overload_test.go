@@ -0,0 +1,298 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestNewOverloadPolicy_InvalidConfig(t *testing.T) {
+	tests := map[string]HTTPOverloadConfig{
+		"unknown mode":       {Mode: "queue"},
+		"bad status":         {Status: 500},
+		"bad retry_after":    {RetryAfter: "soon"},
+		"bad block_timeout":  {Mode: OverloadBlock, BlockTimeout: "0s"},
+		"spill without path": {Mode: OverloadSpill},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newOverloadPolicy(config); err == nil {
+				t.Error("newOverloadPolicy() should fail")
+			}
+		})
+	}
+}
+
+func TestOverloadPolicy_Modes(t *testing.T) {
+	newEnv := func(id string) *envelope.Envelope {
+		env := envelope.New()
+		env.ID = id
+		return env
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		policy, _ := newOverloadPolicy(HTTPOverloadConfig{Status: 429, RetryAfter: "1500ms"})
+		messages := make(chan *envelope.Envelope, 1)
+		if !policy.enqueue(context.Background(), messages, newEnv("1")) {
+			t.Fatal("First envelope should be buffered")
+		}
+		if policy.enqueue(context.Background(), messages, newEnv("2")) {
+			t.Error("Second envelope should be rejected")
+		}
+		if policy.status != http.StatusTooManyRequests || policy.retryAfterSeconds() != "2" {
+			t.Errorf("status/Retry-After = %d/%s, want 429/2", policy.status, policy.retryAfterSeconds())
+		}
+	})
+
+	t.Run("block waits for space", func(t *testing.T) {
+		policy, _ := newOverloadPolicy(HTTPOverloadConfig{Mode: OverloadBlock, BlockTimeout: "2s"})
+		messages := make(chan *envelope.Envelope, 1)
+		messages <- newEnv("1")
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			<-messages
+		}()
+		if !policy.enqueue(context.Background(), messages, newEnv("2")) {
+			t.Error("Envelope should be buffered once space frees up")
+		}
+	})
+
+	t.Run("block times out", func(t *testing.T) {
+		policy, _ := newOverloadPolicy(HTTPOverloadConfig{Mode: OverloadBlock, BlockTimeout: "50ms"})
+		messages := make(chan *envelope.Envelope, 1)
+		messages <- newEnv("1")
+		start := time.Now()
+		if policy.enqueue(context.Background(), messages, newEnv("2")) {
+			t.Error("Envelope should be rejected after block_timeout")
+		}
+		if time.Since(start) < 50*time.Millisecond {
+			t.Error("enqueue() returned before block_timeout")
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		policy, _ := newOverloadPolicy(HTTPOverloadConfig{Mode: OverloadDrop})
+		messages := make(chan *envelope.Envelope, 1)
+		messages <- newEnv("1")
+		if !policy.enqueue(context.Background(), messages, newEnv("2")) {
+			t.Error("Drop mode should accept the request")
+		}
+		if len(messages) != 1 {
+			t.Errorf("Buffer has %d envelopes, want 1", len(messages))
+		}
+	})
+
+	t.Run("spill limit", func(t *testing.T) {
+		policy, err := newOverloadPolicy(HTTPOverloadConfig{Mode: OverloadSpill, SpillDir: t.TempDir(), SpillMaxFiles: 1})
+		if err != nil {
+			t.Fatalf("newOverloadPolicy() error = %v", err)
+		}
+		messages := make(chan *envelope.Envelope)
+		if !policy.enqueue(context.Background(), messages, newEnv("1")) {
+			t.Fatal("First envelope should be spilled")
+		}
+		if policy.enqueue(context.Background(), messages, newEnv("2")) {
+			t.Error("Envelope beyond spill_max_files should be rejected")
+		}
+	})
+}
+
+func TestHTTPInput_RejectsWhenBufferFull(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input, err := NewHTTPInput([]byte(`{"port":"8773","buffer_size":1}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	go func() {
+		_ = input.Start(ctx)
+	}()
+	defer input.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	post := func() *http.Response {
+		resp, err := http.Post("http://localhost:8773/webhook", "application/json", bytes.NewReader([]byte(`{}`)))
+		if err != nil {
+			t.Fatalf("Failed to send webhook: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := post(); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("First webhook: status = %d, want 202", resp.StatusCode)
+	}
+	resp := post()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Second webhook: status = %d, want 503", resp.StatusCode)
+	}
+	if resp.Header.Get("Retry-After") != "5" {
+		t.Errorf("Retry-After = %q, want 5", resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestHTTPInput_SpillsAndDrainsInOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	spillDir := t.TempDir()
+
+	// A webhook spilled before a restart is delivered first
+	leftover, err := newSpillQueue(spillDir, 100)
+	if err != nil {
+		t.Fatalf("newSpillQueue() error = %v", err)
+	}
+	env := envelope.New()
+	env.ID = "leftover"
+	env.Payload = []byte(`{"n":0}`)
+	if err := leftover.push(env); err != nil {
+		t.Fatalf("push() error = %v", err)
+	}
+
+	input, err := NewHTTPInput([]byte(fmt.Sprintf(
+		`{"port":"8774","buffer_size":1,"overload":{"mode":"spill","spill_dir":%q}}`, spillDir)))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	go func() {
+		_ = input.Start(ctx)
+	}()
+	defer input.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 1; i <= 4; i++ {
+		resp, err := http.Post("http://localhost:8774/webhook", "application/json",
+			bytes.NewReader([]byte(fmt.Sprintf(`{"n":%d}`, i))))
+		if err != nil {
+			t.Fatalf("Failed to send webhook: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Webhook %d: status = %d, want 202", i, resp.StatusCode)
+		}
+	}
+
+	for i := 0; i <= 4; i++ {
+		env, err := input.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		if want := fmt.Sprintf(`{"n":%d}`, i); string(env.Payload) != want {
+			t.Errorf("Envelope %d payload = %s, want %s", i, env.Payload, want)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		entries, _ := os.ReadDir(spillDir)
+		if len(entries) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Spill directory still has %d files", len(entries))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestSpillQueue_UnremovableFileNotQueuedTwice(t *testing.T) {
+	dir := t.TempDir()
+	q, err := newSpillQueue(dir, 100)
+	if err != nil {
+		t.Fatalf("newSpillQueue() error = %v", err)
+	}
+	q.count.Store(2)
+
+	// Non-empty directories stand in for files that cannot be removed
+	mkdirNonEmpty := func(name string) {
+		if err := os.MkdirAll(filepath.Join(dir, name, "x"), 0750); err != nil {
+			t.Fatalf("MkdirAll() error = %v", err)
+		}
+	}
+
+	// Renamed aside when it cannot be removed
+	mkdirNonEmpty("a.json")
+	q.finish("a.json")
+	if _, err := os.Stat(filepath.Join(dir, "a.json.delivered")); err != nil {
+		t.Errorf("Drained file not renamed aside: %v", err)
+	}
+	if q.pending() != 1 {
+		t.Errorf("pending() = %d, want 1", q.pending())
+	}
+
+	// Skipped when it cannot be renamed either, but no longer pending
+	mkdirNonEmpty("b.json")
+	mkdirNonEmpty("b.json.delivered")
+	q.finish("b.json")
+	if _, ok := q.stuck["b.json"]; !ok {
+		t.Error("Unmovable file not skipped by later drains")
+	}
+	if q.pending() != 0 {
+		t.Errorf("pending() = %d, want 0", q.pending())
+	}
+
+	// So webhooks go straight to an empty buffer instead of being spilled behind it
+	policy := &overloadPolicy{mode: OverloadSpill, spill: q}
+	messages := make(chan *envelope.Envelope, 1)
+	if !policy.enqueue(context.Background(), messages, envelope.New()) || len(messages) != 1 {
+		t.Error("Webhook spilled while only a stuck file was left")
+	}
+}
+
+func TestHTTPInput_DrainKeepsSpilledWebhooks(t *testing.T) {
+	// The spill drainer must not queue a webhook, and delete its file, after Read has
+	// reported the input drained
+	for round := 0; round < 20; round++ {
+		spillDir := t.TempDir()
+		queue, err := newSpillQueue(spillDir, 100)
+		if err != nil {
+			t.Fatalf("newSpillQueue() error = %v", err)
+		}
+		for i := 0; i < 20; i++ {
+			if err := queue.push(envelope.New()); err != nil {
+				t.Fatalf("push() error = %v", err)
+			}
+		}
+
+		input, err := NewHTTPInput([]byte(fmt.Sprintf(
+			`{"port":"8798","buffer_size":1,"overload":{"mode":"spill","spill_dir":%q}}`, spillDir)))
+		if err != nil {
+			t.Fatalf("NewHTTPInput() error = %v", err)
+		}
+		if err := input.Start(context.Background()); err != nil {
+			t.Fatalf("Start() error = %v", err)
+		}
+
+		read := make(chan int)
+		go func() {
+			n := 0
+			for {
+				if _, err := input.Read(context.Background()); err != nil {
+					read <- n
+					return
+				}
+				n++
+			}
+		}()
+		time.Sleep(time.Duration(round%5) * time.Millisecond)
+		input.Drain(context.Background())
+		n := <-read
+		time.Sleep(20 * time.Millisecond)
+		input.Close()
+
+		left, _ := queue.files()
+		if n+len(left) != 20 {
+			t.Fatalf("Round %d: %d webhooks read and %d left on disk, want 20 in all", round, n, len(left))
+		}
+	}
+}
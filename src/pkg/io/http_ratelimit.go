@@ -0,0 +1,191 @@
+package io
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Rate limit keys for the HTTP input: each distinct key gets its own token bucket. API
+// keys and tenants are only used once authentication has verified them; other requests
+// are limited by client IP.
+const (
+	RateLimitByIP     = "ip"      // client IP (resolved through trusted proxies)
+	RateLimitByAPIKey = "api_key" // API key checked by api_key auth
+	RateLimitByTenant = "tenant"  // tenant of an authenticated request
+)
+
+// defaultRateLimitMaxSources caps the number of token buckets kept at once
+const defaultRateLimitMaxSources = 10000
+
+// HTTPRateLimitConfig throttles each source of the HTTP input to a steady rate
+type HTTPRateLimitConfig struct {
+	Key        string  `json:"key,omitempty"`         // ip, api_key or tenant (default: ip)
+	Rate       float64 `json:"rate"`                  // Sustained requests per second per key (required)
+	Burst      int     `json:"burst,omitempty"`       // Requests allowed at once above the rate (default: rate rounded up, at least 1)
+	Header     string  `json:"header,omitempty"`      // api_key only; header carrying the key (default: X-API-Key)
+	MaxSources int     `json:"max_sources,omitempty"` // Buckets kept at once; the least recently seen is dropped beyond it (default: 10000)
+}
+
+// rateLimiter keeps one token bucket per key. Buckets idle for longer than it takes
+// to refill completely are forgotten, and at most maxSources are kept, so memory follows
+// the number of active sources. Buckets are kept in order of use, so finding the idle
+// or least recently seen ones does not scan every source.
+type rateLimiter struct {
+	key        string
+	header     string
+	limit      rate.Limit
+	burst      int
+	maxSources int
+
+	mu        sync.Mutex
+	buckets   map[string]*list.Element // Values are *rateBucket
+	recent    *list.List               // Most recently seen bucket first
+	lastSweep time.Time
+	idleAfter time.Duration
+	throttled int64 // Throttled requests across all keys
+	now       func() time.Time
+}
+
+type rateBucket struct {
+	key       string
+	limiter   *rate.Limiter
+	lastSeen  time.Time
+	throttled int64
+}
+
+func newRateLimiter(config *HTTPRateLimitConfig) (*rateLimiter, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if config.Rate <= 0 {
+		return nil, fmt.Errorf("rate_limit rate must be positive")
+	}
+	if config.Burst < 0 {
+		return nil, fmt.Errorf("rate_limit burst must not be negative")
+	}
+	if config.MaxSources < 0 {
+		return nil, fmt.Errorf("rate_limit max_sources must not be negative")
+	}
+
+	l := &rateLimiter{
+		key:        config.Key,
+		header:     config.Header,
+		limit:      rate.Limit(config.Rate),
+		burst:      config.Burst,
+		maxSources: config.MaxSources,
+		buckets:    make(map[string]*list.Element),
+		recent:     list.New(),
+		now:        time.Now,
+	}
+	if l.maxSources == 0 {
+		l.maxSources = defaultRateLimitMaxSources
+	}
+	switch l.key {
+	case "":
+		l.key = RateLimitByIP
+	case RateLimitByIP, RateLimitByAPIKey, RateLimitByTenant:
+	default:
+		return nil, fmt.Errorf("unsupported rate_limit key %q (must be ip, api_key or tenant)", l.key)
+	}
+	if l.header == "" {
+		l.header = "X-API-Key"
+	}
+	if l.burst == 0 {
+		l.burst = int(math.Max(1, math.Ceil(config.Rate)))
+	}
+	l.idleAfter = time.Duration(float64(l.burst) / config.Rate * float64(time.Second))
+	if l.idleAfter < time.Minute {
+		l.idleAfter = time.Minute
+	}
+	l.lastSweep = l.now()
+	return l, nil
+}
+
+// byIP reports whether every request is limited by client IP. Such requests are limited
+// before authentication; limits by API key or tenant wait for it, so a client cannot pick
+// a fresh bucket by sending made-up values.
+func (l *rateLimiter) byIP() bool {
+	return l.key == RateLimitByIP
+}
+
+// sourceKey identifies the source of a request that auth accepted (nil when the route has
+// no authentication). API keys are hashed so they never show up in logs.
+func (l *rateLimiter) sourceKey(r *http.Request, clientIP string, auth httpAuthenticator, tenantID string) string {
+	switch l.key {
+	case RateLimitByAPIKey:
+		// Only a key the authenticator checked identifies the source
+		if apiKeyAuth, ok := auth.(*apiKeyAuthenticator); ok && strings.EqualFold(apiKeyAuth.header, l.header) {
+			if apiKey := r.Header.Get(l.header); apiKey != "" {
+				return fmt.Sprintf("api_key:%x", sha256.Sum256([]byte(apiKey)))[:24]
+			}
+		}
+	case RateLimitByTenant:
+		if auth != nil && tenantID != "" {
+			return "tenant:" + tenantID
+		}
+	}
+	return "ip:" + clientIP
+}
+
+// allow takes a token for the key. When the bucket is empty it returns false, the time
+// until a token is available and how often the key was throttled while active.
+func (l *rateLimiter) allow(key string) (bool, time.Duration, int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= l.idleAfter {
+		for e := l.recent.Back(); e != nil && now.Sub(e.Value.(*rateBucket).lastSeen) >= l.idleAfter; e = l.recent.Back() {
+			l.remove(e)
+		}
+		l.lastSweep = now
+	}
+
+	var bucket *rateBucket
+	if e, ok := l.buckets[key]; ok {
+		bucket = e.Value.(*rateBucket)
+		l.recent.MoveToFront(e)
+	} else {
+		if len(l.buckets) >= l.maxSources {
+			l.remove(l.recent.Back())
+		}
+		bucket = &rateBucket{key: key, limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.buckets[key] = l.recent.PushFront(bucket)
+	}
+	bucket.lastSeen = now
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		bucket.throttled++
+		l.throttled++
+		return false, delay, bucket.throttled
+	}
+	return true, 0, bucket.throttled
+}
+
+// remove forgets the bucket held by e
+func (l *rateLimiter) remove(e *list.Element) {
+	delete(l.buckets, l.recent.Remove(e).(*rateBucket).key)
+}
+
+// throttledTotal returns how many requests were throttled since start
+func (l *rateLimiter) throttledTotal() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.throttled
+}
+
+// retryAfterHeader formats a Retry-After header value, rounding up to whole seconds
+func retryAfterHeader(delay time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(delay.Seconds())))
+}
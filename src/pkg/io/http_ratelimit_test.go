@@ -0,0 +1,233 @@
+package io
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+)
+
+func TestNewRateLimiter_InvalidConfig(t *testing.T) {
+	tests := map[string]HTTPRateLimitConfig{
+		"missing rate":   {},
+		"negative burst": {Rate: 1, Burst: -1},
+		"unknown key":    {Rate: 1, Key: "user"},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newRateLimiter(&config); err == nil {
+				t.Error("newRateLimiter() should fail")
+			}
+		})
+	}
+}
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter, err := newRateLimiter(&HTTPRateLimitConfig{Rate: 2, Burst: 3})
+	if err != nil {
+		t.Fatalf("newRateLimiter() error = %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+
+	for i := 0; i < 3; i++ {
+		if ok, _, _ := limiter.allow("ip:a"); !ok {
+			t.Fatalf("Request %d within burst throttled", i+1)
+		}
+	}
+	ok, delay, throttled := limiter.allow("ip:a")
+	if ok || delay != 500*time.Millisecond || throttled != 1 {
+		t.Errorf("allow() beyond burst = %v, %s, %d; want false, 500ms, 1", ok, delay, throttled)
+	}
+	if ok, _, _ := limiter.allow("ip:b"); !ok {
+		t.Error("Another key should have its own bucket")
+	}
+
+	// Tokens refill at the configured rate
+	now = now.Add(500 * time.Millisecond)
+	if ok, _, _ := limiter.allow("ip:a"); !ok {
+		t.Error("Token should be available after refill")
+	}
+	if limiter.throttledTotal() != 1 {
+		t.Errorf("throttledTotal() = %d, want 1", limiter.throttledTotal())
+	}
+
+	// Idle buckets are swept once they would be full again anyway
+	now = now.Add(2 * time.Minute)
+	limiter.allow("ip:c")
+	if len(limiter.buckets) != 1 || limiter.recent.Len() != 1 {
+		t.Errorf("%d buckets after sweep, want 1", len(limiter.buckets))
+	}
+}
+
+func TestRateLimiter_MaxSources(t *testing.T) {
+	limiter, err := newRateLimiter(&HTTPRateLimitConfig{Rate: 1, Burst: 1, MaxSources: 2})
+	if err != nil {
+		t.Fatalf("newRateLimiter() error = %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+	limiter.now = func() time.Time { return now }
+	limiter.lastSweep = now
+
+	// ip:a is seen again after ip:b, so ip:b is the one dropped for ip:c
+	for _, key := range []string{"ip:a", "ip:b", "ip:a", "ip:c"} {
+		limiter.allow(key)
+		now = now.Add(time.Second)
+	}
+	if len(limiter.buckets) != 2 || limiter.recent.Len() != 2 {
+		t.Errorf("%d buckets, want at most 2", len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets["ip:b"]; ok {
+		t.Error("Least recently seen bucket should be dropped first")
+	}
+	if _, ok := limiter.buckets["ip:a"]; !ok {
+		t.Error("Recently seen bucket was dropped")
+	}
+}
+
+func TestRateLimiter_SourceKey(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/webhook", nil)
+	r.Header.Set("X-Partner-Key", "secret-key")
+	apiKeyAuth := &apiKeyAuthenticator{header: "X-Partner-Key"}
+
+	byKey, _ := newRateLimiter(&HTTPRateLimitConfig{Rate: 1, Key: RateLimitByAPIKey, Header: "X-Partner-Key"})
+	key := byKey.sourceKey(r, "198.51.100.1", apiKeyAuth, "")
+	if !strings.HasPrefix(key, "api_key:") || strings.Contains(key, "secret") {
+		t.Errorf("API key source = %q, want a hashed key", key)
+	}
+	if key := byKey.sourceKey(r, "198.51.100.1", nil, ""); key != "ip:198.51.100.1" {
+		t.Errorf("Unverified API key source = %q, want client IP", key)
+	}
+	if key := byKey.sourceKey(r, "198.51.100.1", &apiKeyAuthenticator{header: "X-API-Key"}, ""); key != "ip:198.51.100.1" {
+		t.Errorf("API key in a header auth did not check, source = %q, want client IP", key)
+	}
+	r.Header.Del("X-Partner-Key")
+	if key := byKey.sourceKey(r, "198.51.100.1", apiKeyAuth, ""); key != "ip:198.51.100.1" {
+		t.Errorf("Missing API key source = %q, want client IP", key)
+	}
+
+	byTenant, _ := newRateLimiter(&HTTPRateLimitConfig{Rate: 1, Key: RateLimitByTenant})
+	if key := byTenant.sourceKey(r, "198.51.100.1", apiKeyAuth, "acme"); key != "tenant:acme" {
+		t.Errorf("Tenant source = %q", key)
+	}
+	if key := byTenant.sourceKey(r, "198.51.100.1", nil, "acme"); key != "ip:198.51.100.1" {
+		t.Errorf("Unauthenticated tenant source = %q, want client IP", key)
+	}
+}
+
+func TestHTTPInput_RateLimitByTenant(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input := startSyncInput(t, ctx, 8785, `"rate_limit":{"key":"tenant","rate":0.5,"burst":2},
+		"auth":{"type":"api_key","api_keys":{"noisy":"noisy-key","quiet":"quiet-key"}},
+		"routes":[{"path":"/hooks/{tenant}/{integration}"}]`)
+
+	send := func(tenant, apiKey string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:8785/hooks/"+tenant+"/orders", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send webhook: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		if resp := send("noisy", "noisy-key"); resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("Request %d status = %d, want 202", i+1, resp.StatusCode)
+		}
+	}
+	throttledBefore := throttledMetric(t, "tenant")
+	resp := send("noisy", "noisy-key")
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Status beyond burst = %d, want 429", resp.StatusCode)
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err != nil || seconds < 1 || seconds > 2 {
+		t.Errorf("Retry-After = %q, want 1-2 seconds", resp.Header.Get("Retry-After"))
+	}
+
+	// Other tenants are unaffected by the noisy one
+	if resp := send("quiet", "quiet-key"); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Other tenant status = %d, want 202", resp.StatusCode)
+	}
+	if got := input.rejectedCount(http.StatusTooManyRequests); got != 1 {
+		t.Errorf("Rejected 429 count = %d, want 1", got)
+	}
+	if got := input.rateLimit.throttledTotal(); got != 1 {
+		t.Errorf("throttledTotal() = %d, want 1", got)
+	}
+	if got := throttledMetric(t, "tenant"); got != throttledBefore+1 {
+		t.Errorf("Throttled metric = %v, want %v", got, throttledBefore+1)
+	}
+}
+
+func TestHTTPInput_RateLimitUnverifiedSourcesByIP(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// One route has no auth, so its {tenant} is unverified; the other checks API keys
+	startSyncInput(t, ctx, 8796, `"rate_limit":{"key":"tenant","rate":0.5,"burst":2},
+		"routes":[{"path":"/open/{tenant}"},
+			{"path":"/hooks/{tenant}","auth":{"type":"api_key","api_keys":{"acme":"acme-key"}}}]`)
+
+	send := func(path, apiKey string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:8796"+path, strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", apiKey)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send webhook: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Rotating the tenant in the path does not get a fresh bucket
+	for i, tenant := range []string{"a", "b"} {
+		if status := send("/open/"+tenant, ""); status != http.StatusAccepted {
+			t.Fatalf("Request %d status = %d, want 202", i+1, status)
+		}
+	}
+	if status := send("/open/c", ""); status != http.StatusTooManyRequests {
+		t.Errorf("Rotated tenant status = %d, want 429", status)
+	}
+
+	// Failed authentication is charged to the same client IP
+	if status := send("/hooks/acme", "guess"); status != http.StatusTooManyRequests {
+		t.Errorf("Failed authentication status = %d, want 429 once the IP is throttled", status)
+	}
+
+	// A verified tenant has its own bucket
+	if status := send("/hooks/acme", "acme-key"); status != http.StatusAccepted {
+		t.Errorf("Authenticated tenant status = %d, want 202", status)
+	}
+}
+
+// throttledMetric returns the HTTP input's throttled request count for a rate limit key
+func throttledMetric(t *testing.T, key string) float64 {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	prefix := `vrsky_requests_throttled_total{component="http-input",key="` + key + `",pipeline=""} `
+	for _, line := range strings.Split(recorder.Body.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			value, err := strconv.ParseFloat(strings.TrimPrefix(line, prefix), 64)
+			if err != nil {
+				t.Fatalf("Bad metric line %q", line)
+			}
+			return value
+		}
+	}
+	return 0
+}
@@ -0,0 +1,84 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxErrorBodySize caps how much of an error response is kept in Envelope.LastError
+const maxErrorBodySize = 1024
+
+// HTTPStatusError is a non-2xx response from an HTTP endpoint
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string // Truncated response body
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Body == "" {
+		return "HTTP " + e.Status
+	}
+	return fmt.Sprintf("HTTP %s: %s", e.Status, e.Body)
+}
+
+// retryableStatus reports whether a later attempt could succeed: timeouts, throttling and
+// server errors. Other statuses mean the request itself is wrong and will keep failing.
+func retryableStatus(status int) bool {
+	switch {
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	case status == http.StatusNotImplemented, status == http.StatusHTTPVersionNotSupported:
+		return false
+	default:
+		return status >= 500
+	}
+}
+
+// parseRetryAfter reads a Retry-After header in either delay-seconds or HTTP-date form
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if errors.Is(err, strconv.ErrRange) && !strings.HasPrefix(value, "-") {
+		seconds, err = math.MaxInt64, nil
+	}
+	if err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		// Clamp before converting so a huge value cannot overflow into a negative delay
+		if seconds > int64(math.MaxInt64/time.Second) {
+			return time.Duration(math.MaxInt64), true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if delay := at.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// truncateErrorBody keeps the start of a response body for error messages, without
+// splitting a UTF-8 character
+func truncateErrorBody(body []byte) string {
+	if len(body) <= maxErrorBodySize {
+		return strings.TrimSpace(string(body))
+	}
+	cut := maxErrorBodySize
+	for cut > 0 && !utf8.RuneStart(body[cut]) {
+		cut--
+	}
+	return strings.TrimSpace(string(body[:cut])) + "…"
+}
@@ -0,0 +1,162 @@
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestRetryableStatus(t *testing.T) {
+	tests := map[int]bool{
+		400: false, 401: false, 404: false, 409: false, 422: false,
+		408: true, 429: true, 500: true, 502: true, 503: true, 504: true,
+		501: false, 505: false,
+	}
+	for status, want := range tests {
+		if got := retryableStatus(status); got != want {
+			t.Errorf("retryableStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 2, 3, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"120", 2 * time.Minute, true},
+		{"0", 0, true},
+		{"Tue, 03 Feb 2026 10:00:30 GMT", 30 * time.Second, true},
+		{"Tue, 03 Feb 2026 09:00:00 GMT", 0, true},
+		{"", 0, false},
+		{"-5", 0, false},
+		{"soon", 0, false},
+		{"9300000000000", time.Duration(math.MaxInt64), true},
+		{"99999999999999999999", time.Duration(math.MaxInt64), true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestTruncateErrorBody(t *testing.T) {
+	long := strings.Repeat("é", maxErrorBodySize)
+	got := truncateErrorBody([]byte(long))
+	if !strings.HasSuffix(got, "…") || len(got) > maxErrorBodySize+len("…") {
+		t.Errorf("truncateErrorBody() returned %d bytes", len(got))
+	}
+	if !strings.HasPrefix(strings.TrimSuffix(got, "…"), "éé") || strings.ContainsRune(got, '�') {
+		t.Error("truncateErrorBody() split a UTF-8 character")
+	}
+}
+
+// statusSequence answers with the given statuses in turn, then 200
+func statusSequence(t *testing.T, header http.Header, statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		call := int(atomic.AddInt32(&calls, 1))
+		if call > len(statuses) {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		for name, values := range header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(statuses[call-1])
+		fmt.Fprintf(w, `{"error":"attempt %d failed"}`, call)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func TestHTTPOutput_PermanentFailure(t *testing.T) {
+	server, calls := statusSequence(t, nil, http.StatusBadRequest)
+	output, err := NewHTTPOutput([]byte(`{"url":"` + server.URL + `","retries":3}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	env := envelope.New()
+	env.ID = "msg-400"
+	err = output.Write(context.Background(), env)
+	if !component.IsPermanent(err) {
+		t.Fatalf("Write() error = %v, want a permanent error", err)
+	}
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("Write() error = %v, want an HTTPStatusError with 400", err)
+	}
+	if *calls != 1 {
+		t.Errorf("%d attempts, want 1 (400 is not retryable)", *calls)
+	}
+	if !strings.Contains(env.LastError, "400") || !strings.Contains(env.LastError, "attempt 1 failed") {
+		t.Errorf("LastError = %q, want status and response body", env.LastError)
+	}
+}
+
+func TestHTTPOutput_RetryAfter(t *testing.T) {
+	server, calls := statusSequence(t, http.Header{"Retry-After": {"0"}},
+		http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	output, err := NewHTTPOutput([]byte(`{"url":"` + server.URL + `","retries":3}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	start := time.Now()
+	env := envelope.New()
+	if err := output.Write(context.Background(), env); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if *calls != 3 {
+		t.Errorf("%d attempts, want 3", *calls)
+	}
+	// Retry-After: 0 replaces the 1s and 2s backoff
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Write() took %s, Retry-After was not honoured", elapsed)
+	}
+	if !strings.Contains(env.LastError, "429") {
+		t.Errorf("LastError = %q, want the last failure", env.LastError)
+	}
+}
+
+func TestHTTPOutput_RetryAfterBeyondLimit(t *testing.T) {
+	// A value too large for a time.Duration must not wrap around to an immediate retry
+	for _, retryAfter := range []string{"3600", "9300000000000"} {
+		t.Run(retryAfter, func(t *testing.T) {
+			server, calls := statusSequence(t, http.Header{"Retry-After": {retryAfter}}, http.StatusTooManyRequests)
+			output, err := NewHTTPOutput([]byte(`{"url":"` + server.URL + `","retries":3,"max_retry_after":"10s"}`))
+			if err != nil {
+				t.Fatalf("NewHTTPOutput() error = %v", err)
+			}
+
+			err = output.Write(context.Background(), envelope.New())
+			if err == nil || component.IsPermanent(err) {
+				t.Fatalf("Write() error = %v, want a retryable error", err)
+			}
+			if *calls != 1 {
+				t.Errorf("%d attempts, want 1 (Retry-After beyond max_retry_after)", *calls)
+			}
+		})
+	}
+}
+
+func TestNewHTTPOutput_InvalidMaxRetryAfter(t *testing.T) {
+	if _, err := NewHTTPOutput([]byte(`{"url":"http://example.com","max_retry_after":"never"}`)); err == nil {
+		t.Error("NewHTTPOutput() should reject an invalid max_retry_after")
+	}
+}
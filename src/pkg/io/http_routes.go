@@ -0,0 +1,166 @@
+package io
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// HTTPRouteConfig maps a request path to the integration it belongs to
+type HTTPRouteConfig struct {
+	Path          string          `json:"path"`                     // e.g. /hooks/{tenant}/{integration}
+	Method        string          `json:"method,omitempty"`         // HTTP method (default: POST)
+	TenantID      string          `json:"tenant_id,omitempty"`      // Fixed tenant ID or "{param}" (default: {tenant} if present)
+	IntegrationID string          `json:"integration_id,omitempty"` // Fixed integration ID or "{param}" (default: {integration} if present)
+	Auth          *HTTPAuthConfig `json:"auth,omitempty"`           // Overrides the input-level auth for this route
+	Sync          *bool           `json:"sync,omitempty"`           // Overrides the input-level sync setting for this route
+
+	Validation *HTTPValidationConfig `json:"validation,omitempty"` // Replaces the input-level validation for this route
+}
+
+var routeParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// httpRoute is a compiled route; segments are either literals or {param} placeholders
+type httpRoute struct {
+	pattern       string
+	method        string
+	segments      []string
+	tenantID      string
+	integrationID string
+	auth          httpAuthenticator
+	authType      string
+	sync          bool
+	validator     *bodyValidator
+}
+
+// newHTTPRoute compiles a route config. Routes without their own auth use the input-level one.
+func newHTTPRoute(config HTTPRouteConfig, auth httpAuthenticator, authType string) (*httpRoute, error) {
+	if !strings.HasPrefix(config.Path, "/") {
+		return nil, fmt.Errorf("route path %q must start with /", config.Path)
+	}
+
+	route := &httpRoute{
+		pattern:       config.Path,
+		method:        strings.ToUpper(config.Method),
+		segments:      splitRoutePath(config.Path),
+		tenantID:      config.TenantID,
+		integrationID: config.IntegrationID,
+		auth:          auth,
+		authType:      authType,
+	}
+	if route.method == "" {
+		route.method = http.MethodPost
+	}
+
+	params := make(map[string]bool)
+	for _, segment := range route.segments {
+		name, isParam := routeParam(segment)
+		if !isParam {
+			if strings.ContainsAny(segment, "{}") {
+				return nil, fmt.Errorf("route %s: invalid segment %q", config.Path, segment)
+			}
+			continue
+		}
+		if !routeParamName.MatchString(name) {
+			return nil, fmt.Errorf("route %s: invalid parameter name %q", config.Path, name)
+		}
+		if params[name] {
+			return nil, fmt.Errorf("route %s: duplicate parameter %q", config.Path, name)
+		}
+		params[name] = true
+	}
+
+	// Default tenant/integration to the conventional parameter names
+	if route.tenantID == "" && params["tenant"] {
+		route.tenantID = "{tenant}"
+	}
+	if route.integrationID == "" && params["integration"] {
+		route.integrationID = "{integration}"
+	}
+	for _, value := range []string{route.tenantID, route.integrationID} {
+		if name, isParam := routeParam(value); isParam && !params[name] {
+			return nil, fmt.Errorf("route %s: references unknown parameter %q", config.Path, value)
+		}
+	}
+
+	if config.Auth != nil {
+		routeAuth, err := newHTTPAuthenticator(config.Auth)
+		if err != nil {
+			return nil, fmt.Errorf("route %s auth: %w", config.Path, err)
+		}
+		route.auth = routeAuth
+		route.authType = config.Auth.Type
+	}
+	return route, nil
+}
+
+// match returns the path parameters if the request path matches the route
+func (r *httpRoute) match(path string) (map[string]string, bool) {
+	segments := splitRoutePath(path)
+	if len(segments) != len(r.segments) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, segment := range r.segments {
+		if name, isParam := routeParam(segment); isParam {
+			if segments[i] == "" {
+				return nil, false
+			}
+			params[name] = segments[i]
+			continue
+		}
+		if segments[i] != segment {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// authenticate verifies the request when the route has auth and returns the caller's tenant
+func (r *httpRoute) authenticate(req *http.Request, body []byte) (string, error) {
+	if r.auth == nil {
+		return "", nil
+	}
+	return r.auth.authenticate(req, body)
+}
+
+// resolve expands a fixed value or {param} reference
+func (r *httpRoute) resolve(value string, params map[string]string) string {
+	if name, isParam := routeParam(value); isParam {
+		return params[name]
+	}
+	return value
+}
+
+func splitRoutePath(path string) []string {
+	trimmed := strings.Trim(path, "/")
+	if trimmed == "" {
+		return nil
+	}
+	return strings.Split(trimmed, "/")
+}
+
+func routeParam(segment string) (string, bool) {
+	if len(segment) > 2 && strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		return segment[1 : len(segment)-1], true
+	}
+	return "", false
+}
+
+// findRoute picks the first route matching the path and method. If the path matches
+// but the method does not, the allowed methods are returned instead.
+func findRoute(routes []*httpRoute, r *http.Request) (*httpRoute, map[string]string, []string) {
+	var allowed []string
+	for _, route := range routes {
+		params, ok := route.match(r.URL.Path)
+		if !ok {
+			continue
+		}
+		if route.method == r.Method {
+			return route, params, nil
+		}
+		allowed = append(allowed, route.method)
+	}
+	return nil, nil, allowed
+}
@@ -0,0 +1,167 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPRoute_InvalidConfig(t *testing.T) {
+	tests := map[string]HTTPRouteConfig{
+		"relative path":           {Path: "hooks"},
+		"duplicate parameter":     {Path: "/hooks/{id}/{id}"},
+		"invalid parameter name":  {Path: "/hooks/{tenant-id}"},
+		"partial placeholder":     {Path: "/hooks/x{tenant}"},
+		"unknown tenant param":    {Path: "/hooks/{integration}", TenantID: "{tenant}"},
+		"unknown integration ref": {Path: "/hooks/{tenant}", IntegrationID: "{flow}"},
+		"invalid route auth":      {Path: "/hooks", Auth: &HTTPAuthConfig{Type: "basic"}},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newHTTPRoute(config, nil, "none"); err == nil {
+				t.Error("newHTTPRoute() should fail")
+			}
+		})
+	}
+}
+
+func TestFindRoute(t *testing.T) {
+	var routes []*httpRoute
+	for _, config := range []HTTPRouteConfig{
+		{Path: "/hooks/shopify/orders", TenantID: "acme", IntegrationID: "shopify-orders"},
+		{Path: "/hooks/{tenant}/{integration}"},
+		{Path: "/hooks/{tenant}/{integration}", Method: "put"},
+		{Path: "/partners/{partner}/events", TenantID: "{partner}", IntegrationID: "partner-events"},
+	} {
+		route, err := newHTTPRoute(config, nil, "none")
+		if err != nil {
+			t.Fatalf("newHTTPRoute(%s) error = %v", config.Path, err)
+		}
+		routes = append(routes, route)
+	}
+
+	tests := []struct {
+		method          string
+		path            string
+		wantPattern     string
+		wantTenant      string
+		wantIntegration string
+		wantAllowed     string
+	}{
+		{"POST", "/hooks/shopify/orders", "/hooks/shopify/orders", "acme", "shopify-orders", ""},
+		{"POST", "/hooks/globex/billing", "/hooks/{tenant}/{integration}", "globex", "billing", ""},
+		{"PUT", "/hooks/globex/billing/", "/hooks/{tenant}/{integration}", "globex", "billing", ""},
+		{"POST", "/partners/initech/events", "/partners/{partner}/events", "initech", "partner-events", ""},
+		{"GET", "/hooks/globex/billing", "", "", "", "POST PUT"},
+		{"POST", "/hooks/globex", "", "", "", ""},
+		{"POST", "/hooks/globex/billing/extra", "", "", "", ""},
+		{"POST", "/webhook", "", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			route, params, allowed := findRoute(routes, r)
+			if tt.wantPattern == "" {
+				if route != nil {
+					t.Fatalf("Matched %s, want no match", route.pattern)
+				}
+				if got := strings.Join(allowed, " "); got != tt.wantAllowed {
+					t.Errorf("allowed = %q, want %q", got, tt.wantAllowed)
+				}
+				return
+			}
+			if route == nil {
+				t.Fatalf("No route matched, want %s", tt.wantPattern)
+			}
+			if route.pattern != tt.wantPattern {
+				t.Errorf("pattern = %s, want %s", route.pattern, tt.wantPattern)
+			}
+			if got := route.resolve(route.tenantID, params); got != tt.wantTenant {
+				t.Errorf("tenant = %q, want %q", got, tt.wantTenant)
+			}
+			if got := route.resolve(route.integrationID, params); got != tt.wantIntegration {
+				t.Errorf("integration = %q, want %q", got, tt.wantIntegration)
+			}
+		})
+	}
+}
+
+func TestHTTPInput_Routes(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input, err := NewHTTPInput([]byte(`{
+		"port": "8772",
+		"routes": [
+			{"path": "/hooks/{tenant}/{integration}"},
+			{"path": "/secure/{tenant}/orders", "integration_id": "orders",
+			 "auth": {"type": "api_key", "api_keys": {"acme": "acme-key", "globex": "globex-key"}}}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	go func() {
+		_ = input.Start(ctx)
+	}()
+	defer input.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	send := func(method, path, apiKey string) int {
+		req, _ := http.NewRequest(method, "http://localhost:8772"+path, bytes.NewReader([]byte(`{"ok":true}`)))
+		req.Header.Set("Content-Type", "application/json")
+		if apiKey != "" {
+			req.Header.Set("X-API-Key", apiKey)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := send(http.MethodPost, "/hooks/acme/shopify", ""); status != http.StatusAccepted {
+		t.Fatalf("Route with params: status = %d, want 202", status)
+	}
+	env, err := input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if env.TenantID != "acme" || env.IntegrationID != "shopify" {
+		t.Errorf("TenantID/IntegrationID = %q/%q, want acme/shopify", env.TenantID, env.IntegrationID)
+	}
+	if env.Metadata["route"] != "/hooks/{tenant}/{integration}" || env.Metadata["path"] != "/hooks/acme/shopify" {
+		t.Errorf("Unexpected metadata: %v", env.Metadata)
+	}
+
+	if status := send(http.MethodPost, "/webhook", ""); status != http.StatusNotFound {
+		t.Errorf("Unknown path: status = %d, want 404", status)
+	}
+	if status := send(http.MethodGet, "/hooks/acme/shopify", ""); status != http.StatusMethodNotAllowed {
+		t.Errorf("Wrong method: status = %d, want 405", status)
+	}
+
+	// Route-level auth, and keys are bound to the tenant in the path
+	if status := send(http.MethodPost, "/secure/acme/orders", ""); status != http.StatusUnauthorized {
+		t.Errorf("Secure route without key: status = %d, want 401", status)
+	}
+	if status := send(http.MethodPost, "/secure/acme/orders", "globex-key"); status != http.StatusForbidden {
+		t.Errorf("Secure route with other tenant's key: status = %d, want 403", status)
+	}
+	if status := send(http.MethodPost, "/secure/acme/orders", "acme-key"); status != http.StatusAccepted {
+		t.Fatalf("Secure route with key: status = %d, want 202", status)
+	}
+	env, err = input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if env.TenantID != "acme" || env.IntegrationID != "orders" {
+		t.Errorf("TenantID/IntegrationID = %q/%q, want acme/orders", env.TenantID, env.IntegrationID)
+	}
+}
@@ -0,0 +1,163 @@
+package io
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// missingValue is what text/template prints for a key missing from a map[string]any
+const missingValue = "<no value>"
+
+// httpRequestData is the data available to HTTP output templates: the same fields as
+// filename templates plus the payload
+type httpRequestData struct {
+	fileNameData
+	Payload any    // The payload decoded as JSON, e.g. {{.Payload.orderId}}; nil if it is not JSON
+	Body    string // The raw payload
+}
+
+// httpRequestTemplate renders the method, URL, headers and body of an HTTP output request
+type httpRequestTemplate struct {
+	method  *template.Template
+	url     *template.Template
+	headers map[string]*template.Template
+	body    *template.Template // nil sends the raw payload
+
+	decodePayload bool // Some template uses .Payload
+}
+
+func newHTTPRequestTemplate(config HTTPOutputConfig) (*httpRequestTemplate, error) {
+	var t httpRequestTemplate
+	var err error
+	if t.method, err = parseRequestTemplate("method", config.Method); err != nil {
+		return nil, err
+	}
+	if t.url, err = parseRequestTemplate("url", config.URL); err != nil {
+		return nil, err
+	}
+	if config.Body != "" {
+		if t.body, err = parseRequestTemplate("body", config.Body); err != nil {
+			return nil, err
+		}
+	}
+	t.headers = make(map[string]*template.Template, len(config.Headers))
+	for name, value := range config.Headers {
+		if t.headers[name], err = parseRequestTemplate("header "+name, value); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, text := range append([]string{config.Method, config.URL, config.Body}, mapValues(config.Headers)...) {
+		if strings.Contains(text, ".Payload") {
+			t.decodePayload = true
+		}
+	}
+
+	// A URL without actions must be valid as is
+	if !strings.Contains(config.URL, "{{") {
+		if err := checkRequestURL(config.URL); err != nil {
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+func parseRequestTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(templateFuncs()).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %w", name, err)
+	}
+	return tmpl, nil
+}
+
+func mapValues(m map[string]string) []string {
+	values := make([]string, 0, len(m))
+	for _, value := range m {
+		values = append(values, value)
+	}
+	return values
+}
+
+// render builds the request parts for an envelope
+func (t *httpRequestTemplate) render(env *envelope.Envelope) (method, target string, headers map[string]string, body []byte, err error) {
+	data := httpRequestData{
+		fileNameData: newFileNameData(env, env.Source),
+		Body:         string(env.Payload),
+	}
+	if t.decodePayload {
+		decoder := json.NewDecoder(bytes.NewReader(env.Payload))
+		decoder.UseNumber() // Keep large IDs exact
+		if err := decoder.Decode(&data.Payload); err != nil {
+			data.Payload = nil
+		}
+	}
+
+	if method, err = executeRequestTemplate(t.method, data); err != nil {
+		return "", "", nil, nil, err
+	}
+	method = strings.ToUpper(strings.TrimSpace(method))
+	if method == "" || strings.ContainsAny(method, " \t/") {
+		return "", "", nil, nil, fmt.Errorf("invalid method %q", method)
+	}
+
+	if target, err = executeRequestTemplate(t.url, data); err != nil {
+		return "", "", nil, nil, err
+	}
+	target = strings.TrimSpace(target)
+	if err := checkRequestURL(target); err != nil {
+		return "", "", nil, nil, err
+	}
+
+	headers = make(map[string]string, len(t.headers))
+	for name, tmpl := range t.headers {
+		value, err := executeRequestTemplate(tmpl, data)
+		if err != nil {
+			return "", "", nil, nil, err
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return "", "", nil, nil, fmt.Errorf("header %s: value contains a line break", name)
+		}
+		headers[name] = value
+	}
+
+	body = env.Payload
+	if t.body != nil {
+		rendered, err := executeRequestTemplate(t.body, data)
+		if err != nil {
+			return "", "", nil, nil, err
+		}
+		body = []byte(rendered)
+	}
+	return method, target, headers, body, nil
+}
+
+// executeRequestTemplate renders a template, failing when it referenced a missing
+// payload field rather than sending "<no value>" to the endpoint
+func executeRequestTemplate(tmpl *template.Template, data httpRequestData) (string, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("%s template: %w", tmpl.Name(), err)
+	}
+	if strings.Contains(buf.String(), missingValue) {
+		return "", fmt.Errorf("%s template: references a field missing from the payload", tmpl.Name())
+	}
+	return buf.String(), nil
+}
+
+// checkRequestURL rejects URLs the HTTP client cannot send to
+func checkRequestURL(target string) error {
+	parsed, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", target, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("invalid URL %q: must be an absolute http or https URL", target)
+	}
+	return nil
+}
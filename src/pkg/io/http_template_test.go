@@ -0,0 +1,122 @@
+package io
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+func TestNewHTTPOutput_InvalidTemplates(t *testing.T) {
+	tests := map[string]string{
+		"unclosed action":  `{"url":"http://example.com/{{.ID"}`,
+		"unknown function": `{"url":"http://example.com/{{nope .ID}}"}`,
+		"relative url":     `{"url":"/orders"}`,
+		"unsupported url":  `{"url":"ftp://example.com/orders"}`,
+		"bad header":       `{"url":"http://example.com","headers":{"X-Tenant":"{{.TenantID"}}`,
+		"bad body":         `{"url":"http://example.com","body":"{{end}}"}`,
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewHTTPOutput([]byte(config)); err == nil {
+				t.Error("NewHTTPOutput() should fail")
+			}
+		})
+	}
+}
+
+func TestHTTPRequestTemplate_Render(t *testing.T) {
+	request, err := newHTTPRequestTemplate(HTTPOutputConfig{
+		Method:  `{{if .Payload.deleted}}DELETE{{else}}put{{end}}`,
+		URL:     `https://partner.example.com/{{.TenantID}}/orders/{{pathescape .Payload.orderId}}?src={{urlquery .Metadata.path}}`,
+		Headers: map[string]string{"X-Region": `{{default "eu" .Metadata.region}}`, "X-Line": `{{.JSON "lines.0.sku"}}`},
+		Body:    `{"id":{{tojson .Payload.orderId}},"ref":"{{.ID}}","total":{{.Payload.total}}}`,
+	})
+	if err != nil {
+		t.Fatalf("newHTTPRequestTemplate() error = %v", err)
+	}
+
+	env := envelope.New()
+	env.ID = "msg-1"
+	env.TenantID = "acme"
+	env.Payload = []byte(`{"orderId":"A/42","total":12345678901234567,"lines":[{"sku":"X1"}]}`)
+	env.Metadata = map[string]string{"path": "/hooks/acme"}
+
+	method, target, headers, body, err := request.render(env)
+	if err != nil {
+		t.Fatalf("render() error = %v", err)
+	}
+	if method != "PUT" {
+		t.Errorf("method = %q, want PUT", method)
+	}
+	if want := "https://partner.example.com/acme/orders/A%2F42?src=%2Fhooks%2Facme"; target != want {
+		t.Errorf("url = %q, want %q", target, want)
+	}
+	if headers["X-Region"] != "eu" || headers["X-Line"] != "X1" {
+		t.Errorf("headers = %v", headers)
+	}
+	if want := `{"id":"A/42","ref":"msg-1","total":12345678901234567}`; string(body) != want {
+		t.Errorf("body = %s, want %s", body, want)
+	}
+
+	env.Payload = []byte(`{"orderId":"A-1","total":1,"deleted":true,"lines":[{"sku":"X2"}]}`)
+	if method, _, _, _, err := request.render(env); err != nil || method != "DELETE" {
+		t.Errorf("render() method = %q, %v; want DELETE", method, err)
+	}
+
+	// A missing payload field must never produce a request to the wrong URL
+	env.Payload = []byte(`{"total":1,"lines":[{"sku":"X3"}]}`)
+	if _, _, _, _, err := request.render(env); err == nil {
+		t.Error("render() should fail when a payload field is missing")
+	}
+	env.Payload = []byte(`not json`)
+	if _, _, _, _, err := request.render(env); err == nil {
+		t.Error("render() should fail when the payload is not JSON")
+	}
+}
+
+func TestHTTPOutput_TemplatedRequest(t *testing.T) {
+	var gotMethod, gotPath, gotHeader, gotBody string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotMethod, gotPath, gotHeader = r.Method, r.URL.Path, r.Header.Get("X-Tenant")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer backend.Close()
+
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `/orders/{{.Payload.orderId}}","method":"PUT",
+		"headers":{"X-Tenant":"{{.TenantID}}"}}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	env := envelope.New()
+	env.ID = "msg-2"
+	env.TenantID = "acme"
+	env.ContentType = "application/json"
+	env.Payload = []byte(`{"orderId":1001,"status":"shipped"}`)
+	if err := output.Write(context.Background(), env); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if gotMethod != http.MethodPut || gotPath != "/orders/1001" || gotHeader != "acme" {
+		t.Errorf("Request = %s %s X-Tenant=%s", gotMethod, gotPath, gotHeader)
+	}
+	if gotBody != string(env.Payload) {
+		t.Errorf("Body = %s, want the raw payload", gotBody)
+	}
+
+	// Render failures are not retried against some other URL
+	env.Payload = []byte(`{"status":"shipped"}`)
+	gotPath = ""
+	if err := output.Write(context.Background(), env); err == nil || !strings.Contains(err.Error(), "render") {
+		t.Errorf("Write() error = %v, want a render error", err)
+	}
+	if gotPath != "" {
+		t.Errorf("Request sent to %s despite the render error", gotPath)
+	}
+}
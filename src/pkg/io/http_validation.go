@@ -0,0 +1,124 @@
+package io
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// defaultMaxBodySize caps webhook bodies when no max_body_size is configured
+const defaultMaxBodySize = 10 * 1024 * 1024
+
+// HTTPValidationConfig limits what the HTTP input accepts as a webhook body
+type HTTPValidationConfig struct {
+	MaxBodySize         int64    `json:"max_body_size,omitempty"`         // Maximum body size in bytes (default: 10MB)
+	AllowedContentTypes []string `json:"allowed_content_types,omitempty"` // Accepted media types, e.g. application/json or text/* (default: any)
+	JSONSchemaFile      string   `json:"json_schema_file,omitempty"`      // JSON Schema the body must satisfy (optional)
+}
+
+// bodyValidator enforces a validation config on incoming requests
+type bodyValidator struct {
+	maxBodySize  int64
+	contentTypes []string
+	schema       *jsonschema.Schema
+}
+
+func newBodyValidator(config HTTPValidationConfig) (*bodyValidator, error) {
+	v := &bodyValidator{maxBodySize: config.MaxBodySize}
+	if v.maxBodySize < 0 {
+		return nil, fmt.Errorf("max_body_size must not be negative")
+	}
+	if v.maxBodySize == 0 {
+		v.maxBodySize = defaultMaxBodySize
+	}
+
+	for _, contentType := range config.AllowedContentTypes {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed content type %q: %w", contentType, err)
+		}
+		v.contentTypes = append(v.contentTypes, mediaType)
+	}
+
+	if config.JSONSchemaFile != "" {
+		schema, err := jsonschema.Compile(config.JSONSchemaFile)
+		if err != nil {
+			return nil, fmt.Errorf("compile JSON schema %s: %w", config.JSONSchemaFile, err)
+		}
+		v.schema = schema
+	}
+	return v, nil
+}
+
+// checkContentType reports whether the request's media type is allowed. A missing
+// Content-Type is treated as application/json, matching the envelope default.
+func (v *bodyValidator) checkContentType(header string) error {
+	if len(v.contentTypes) == 0 {
+		return nil
+	}
+	if header == "" {
+		header = "application/json"
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("malformed content type %q", header)
+	}
+	for _, allowed := range v.contentTypes {
+		if allowed == mediaType || allowed == "*/*" {
+			return nil
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return nil
+		}
+	}
+	return fmt.Errorf("content type %s is not allowed", mediaType)
+}
+
+// validate checks the body against the JSON schema, if one is configured. The returned
+// details list every failed constraint by location so senders can fix their payload.
+func (v *bodyValidator) validate(body []byte) (details []string, err error) {
+	if v.schema == nil {
+		return nil, nil
+	}
+	// Numbers must stay json.Number for exact schema checks
+	var doc any
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("body is not valid JSON: %w", err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("body is not valid JSON: trailing data after the document")
+	}
+	if err := v.schema.Validate(doc); err != nil {
+		var validationErr *jsonschema.ValidationError
+		if !errors.As(err, &validationErr) {
+			return nil, err
+		}
+		return schemaViolations(validationErr), fmt.Errorf("body does not match JSON schema")
+	}
+	return nil, nil
+}
+
+// schemaViolations flattens a validation error into its leaf causes
+func schemaViolations(err *jsonschema.ValidationError) []string {
+	if len(err.Causes) == 0 {
+		location := err.InstanceLocation
+		if location == "" {
+			location = "/"
+		}
+		return []string{location + ": " + err.Message}
+	}
+	var violations []string
+	for _, cause := range err.Causes {
+		violations = append(violations, schemaViolations(cause)...)
+	}
+	sort.Strings(violations)
+	return violations
+}
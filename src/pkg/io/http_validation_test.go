@@ -0,0 +1,199 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const orderSchema = `{
+	"type": "object",
+	"required": ["sku", "quantity"],
+	"properties": {
+		"sku": {"type": "string"},
+		"quantity": {"type": "integer", "minimum": 1}
+	}
+}`
+
+func writeSchema(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "order.schema.json")
+	if err := os.WriteFile(path, []byte(orderSchema), 0o644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	return path
+}
+
+func TestNewBodyValidator_InvalidConfig(t *testing.T) {
+	badSchema := filepath.Join(t.TempDir(), "bad.json")
+	if err := os.WriteFile(badSchema, []byte(`{"type": 42}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]HTTPValidationConfig{
+		"negative size":       {MaxBodySize: -1},
+		"invalid media type":  {AllowedContentTypes: []string{"not a type"}},
+		"missing schema file": {JSONSchemaFile: filepath.Join(t.TempDir(), "missing.json")},
+		"invalid schema":      {JSONSchemaFile: badSchema},
+	}
+	for name, config := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newBodyValidator(config); err == nil {
+				t.Error("newBodyValidator() should fail")
+			}
+		})
+	}
+}
+
+func TestBodyValidator_CheckContentType(t *testing.T) {
+	validator, err := newBodyValidator(HTTPValidationConfig{
+		AllowedContentTypes: []string{"application/json", "text/*"},
+	})
+	if err != nil {
+		t.Fatalf("newBodyValidator() error = %v", err)
+	}
+	if validator.maxBodySize != defaultMaxBodySize {
+		t.Errorf("maxBodySize = %d, want default %d", validator.maxBodySize, defaultMaxBodySize)
+	}
+
+	tests := map[string]bool{
+		"application/json":                true,
+		"Application/JSON; charset=utf-8": true,
+		"":                                true, // Treated as application/json
+		"text/csv":                        true,
+		"application/xml":                 false,
+		"textual/plain":                   false,
+		"garbage;;":                       false,
+	}
+	for contentType, allowed := range tests {
+		if err := validator.checkContentType(contentType); (err == nil) != allowed {
+			t.Errorf("checkContentType(%q) error = %v, want allowed = %v", contentType, err, allowed)
+		}
+	}
+
+	open, _ := newBodyValidator(HTTPValidationConfig{})
+	if err := open.checkContentType("application/octet-stream"); err != nil {
+		t.Errorf("Without allowed_content_types every type should pass, got %v", err)
+	}
+}
+
+func TestBodyValidator_Validate(t *testing.T) {
+	validator, err := newBodyValidator(HTTPValidationConfig{JSONSchemaFile: writeSchema(t)})
+	if err != nil {
+		t.Fatalf("newBodyValidator() error = %v", err)
+	}
+
+	if _, err := validator.validate([]byte(`{"sku":"A","quantity":2}`)); err != nil {
+		t.Errorf("Valid body rejected: %v", err)
+	}
+	for _, body := range []string{`{"sku":`, `{"sku":"A","quantity":2} trailing`} {
+		if _, err := validator.validate([]byte(body)); err == nil {
+			t.Errorf("Malformed body %q accepted", body)
+		}
+	}
+
+	details, err := validator.validate([]byte(`{"sku":7,"quantity":0}`))
+	if err == nil {
+		t.Fatal("Body violating the schema accepted")
+	}
+	if len(details) != 2 || !strings.HasPrefix(details[0], "/quantity") || !strings.HasPrefix(details[1], "/sku") {
+		t.Errorf("Violations = %q", details)
+	}
+}
+
+func TestHTTPInput_BodyValidation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input := startSyncInput(t, ctx, 8783, `"validation":{"max_body_size":64,"allowed_content_types":["application/json"]},
+		"routes":[
+			{"path":"/webhook"},
+			{"path":"/orders","validation":{"json_schema_file":`+jsonString(writeSchema(t))+`}}]`)
+
+	send := func(path, contentType, body string, chunked bool) (*http.Response, string) {
+		t.Helper()
+		var reader io.Reader = bytes.NewReader([]byte(body))
+		if chunked {
+			// Hide the length so the limit has to be enforced while reading
+			reader = struct{ *strings.Reader }{strings.NewReader(body)}
+		}
+		req, _ := http.NewRequest(http.MethodPost, "http://localhost:8783"+path, reader)
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to send webhook: %v", err)
+		}
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return resp, string(respBody)
+	}
+
+	large := `{"data":"` + strings.Repeat("x", 100) + `"}`
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+		chunked     bool
+		want        int
+	}{
+		{"accepted", "/webhook", "application/json", `{"ok":true}`, false, http.StatusAccepted},
+		{"too large", "/webhook", "application/json", large, false, http.StatusRequestEntityTooLarge},
+		{"too large without length", "/webhook", "application/json", large, true, http.StatusRequestEntityTooLarge},
+		{"unsupported type", "/webhook", "application/xml", `<ok/>`, false, http.StatusUnsupportedMediaType},
+		{"route replaces limits", "/orders", "application/xml", `{"sku":"A","quantity":1}`, false, http.StatusAccepted},
+		{"schema violation", "/orders", "application/json", `{"sku":"A","quantity":0}`, false, http.StatusUnprocessableEntity},
+		{"not JSON", "/orders", "application/json", `{"sku":`, false, http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := send(tt.path, tt.contentType, tt.body, tt.chunked)
+			if resp.StatusCode != tt.want {
+				t.Fatalf("Status = %d, want %d (%s)", resp.StatusCode, tt.want, body)
+			}
+			if tt.name == "schema violation" {
+				var result struct {
+					Error      string   `json:"error"`
+					Violations []string `json:"violations"`
+				}
+				if err := json.Unmarshal([]byte(body), &result); err != nil || len(result.Violations) != 1 {
+					t.Errorf("422 body = %s", body)
+				}
+			}
+		})
+	}
+
+	if got := input.rejectedCount(http.StatusRequestEntityTooLarge); got != 2 {
+		t.Errorf("Rejected 413 count = %d, want 2", got)
+	}
+	if got := input.rejectedCount(http.StatusUnsupportedMediaType); got != 1 {
+		t.Errorf("Rejected 415 count = %d, want 1", got)
+	}
+	if got := input.rejectedCount(http.StatusUnprocessableEntity); got != 2 {
+		t.Errorf("Rejected 422 count = %d, want 2", got)
+	}
+
+	// Only the two accepted webhooks reach the pipeline
+	for i := 0; i < 2; i++ {
+		if _, err := input.Read(ctx); err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+	}
+	select {
+	case env := <-input.messages:
+		t.Errorf("Rejected webhook was enqueued: %s", env.Payload)
+	default:
+	}
+}
+
+func jsonString(s string) string {
+	encoded, _ := json.Marshal(s)
+	return string(encoded)
+}
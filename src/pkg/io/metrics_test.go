@@ -0,0 +1,85 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/admin"
+	"github.com/ValueRetail/vrsky/pkg/component"
+)
+
+func TestMetrics_ProcessingLoop(t *testing.T) {
+	var requests atomic.Int32
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first message fails once before it is delivered, the second is rejected
+		switch requests.Add(1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 3:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer backend.Close()
+
+	input, err := NewHTTPInput([]byte(`{"port":"8791","routes":[{"path":"/hooks/{tenant}/{integration}"}]}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `","retries":2}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	producer := component.New(input, output)
+	producer.SetTypes("http", "http")
+	producer.SetPipeline("orders")
+
+	server := admin.NewServer(":8792", producer.Health)
+	if err := server.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer server.Close(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go producer.Process(ctx, input, output)
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Post("http://localhost:8791/hooks/metrics-tenant/orders", "application/json", bytes.NewReader([]byte(`{"n":1}`)))
+		if err != nil {
+			t.Fatalf("POST error = %v", err)
+		}
+		resp.Body.Close()
+		time.Sleep(1500 * time.Millisecond) // The retry backs off for a second
+	}
+
+	resp, err := http.Get("http://localhost:8792/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	defer resp.Body.Close()
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+
+	labels := `component="http-input",integration="orders",pipeline="orders",tenant="metrics-tenant"`
+	outLabels := `component="http-output",integration="orders",pipeline="orders",tenant="metrics-tenant"`
+	for _, want := range []string{
+		`vrsky_messages_received_total{` + labels + `} 2`,
+		`vrsky_messages_written_total{` + outLabels + `} 1`,
+		`vrsky_messages_failed_total{component="http-output",integration="orders",permanent="true",pipeline="orders",tenant="metrics-tenant"} 1`,
+		`vrsky_write_retries_total{` + outLabels + `} 1`,
+		`vrsky_write_duration_seconds_count{` + outLabels + `} 2`,
+		`vrsky_payload_size_bytes_count{` + labels + `} 2`,
+		`vrsky_queue_depth{component="http-input",pipeline="orders"} 0`,
+	} {
+		if !strings.Contains(body.String(), want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
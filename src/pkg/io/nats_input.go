@@ -11,14 +11,21 @@ import (
 	"github.com/google/uuid"
 	"github.com/nats-io/nats.go"
 
+	"github.com/ValueRetail/vrsky/pkg/component"
 	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
 )
 
 // NATSInputConfig defines the configuration for NATS Input
 type NATSInputConfig struct {
-	URL     string `json:"url"`               // NATS server URL
-	Topic   string `json:"topic"`             // Topic pattern to subscribe to
-	Timeout int    `json:"timeout,omitempty"` // Connection timeout in seconds (default: 30)
+	URL          string `json:"url"`                     // NATS server URL
+	Topic        string `json:"topic"`                   // Topic pattern to subscribe to
+	Timeout      int    `json:"timeout,omitempty"`       // Connection timeout in seconds (default: 30)
+	ReplyTimeout int    `json:"reply_timeout,omitempty"` // Seconds to wait for the pipeline's reply to a NATS request (default: 30)
+
+	// MaxDecompressedSize caps a compressed message's decompressed size in bytes (default: 100MB)
+	MaxDecompressedSize int64 `json:"max_decompressed_size,omitempty"`
 }
 
 // NATSInput implements the Input interface for NATS subscriptions
@@ -27,14 +34,20 @@ type NATSInput struct {
 	conn        *nats.Conn
 	sub         *nats.Subscription
 	msgChan     chan *nats.Msg
+	drained     chan struct{} // Closed once the subscription has delivered its last message
+	closed      chan struct{} // Closed by Close to release a callback waiting on msgChan
+	drainOnce   sync.Once
 	mu          sync.RWMutex
 	isConnected bool
+	pipeline    string // Pipeline label on metrics
 }
 
 // NewNATSInput creates a new NATS input from JSON configuration
 func NewNATSInput(configJSON json.RawMessage) (*NATSInput, error) {
 	config := NATSInputConfig{
-		Timeout: 30, // Default timeout
+		Timeout:             30, // Default timeout
+		ReplyTimeout:        30,
+		MaxDecompressedSize: defaultMaxDecompressedSize,
 	}
 
 	if err := json.Unmarshal(configJSON, &config); err != nil {
@@ -47,10 +60,15 @@ func NewNATSInput(configJSON json.RawMessage) (*NATSInput, error) {
 	if config.Topic == "" {
 		return nil, fmt.Errorf("NATS topic is required")
 	}
+	if config.MaxDecompressedSize <= 0 {
+		return nil, fmt.Errorf("NATS max_decompressed_size must be positive")
+	}
 
 	return &NATSInput{
 		config:  config,
 		msgChan: make(chan *nats.Msg, 100),
+		drained: make(chan struct{}),
+		closed:  make(chan struct{}),
 	}, nil
 }
 
@@ -63,35 +81,140 @@ func (n *NATSInput) Read(ctx context.Context) (*envelope.Envelope, error) {
 	}
 	n.mu.Unlock()
 
+	var msg *nats.Msg
 	select {
-	case msg := <-n.msgChan:
-		env := envelope.New()
-		env.ID = uuid.New().String()
-		env.Payload = msg.Data
-		env.ContentType = "application/octet-stream"
-		env.Source = "nats"
-		env.StepHistory = append(env.StepHistory, "nats-input:"+msg.Subject)
+	case msg = <-n.msgChan:
+		metrics.SetQueueDepth(n.pipeline, "nats-input", len(n.msgChan))
+	case <-n.drained:
+		// Messages delivered before the drain finished are still handed out
+		select {
+		case msg = <-n.msgChan:
+			metrics.SetQueueDepth(n.pipeline, "nats-input", len(n.msgChan))
+		default:
+			return nil, component.ErrInputDrained
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
-		slog.Info("Received message from NATS",
-			"id", env.ID,
-			"subject", msg.Subject,
-			"size", len(msg.Data))
+	data, err := decompressNATSMsg(msg, n.config.MaxDecompressedSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode NATS message on %s: %w", msg.Subject, err)
+	}
 
-		return env, nil
+	env := envelope.New()
+	env.ID = uuid.New().String()
+	env.Payload = data
+	env.PayloadSize = int64(len(data))
+	env.ContentType = "application/octet-stream"
+	if contentType := msg.Header.Get("Content-Type"); contentType != "" {
+		env.ContentType = contentType
+	}
+	env.Source = "nats"
+	tracing.Extract(msg.Header.Get(tracing.TraceparentHeader), env)
+	env.StepHistory = append(env.StepHistory, "nats-input:"+msg.Subject)
 
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	slog.Info("Received message from NATS",
+		"id", env.ID,
+		"subject", msg.Subject,
+		"size", len(data))
+
+	// A request (e.g. from a synchronous HTTP input upstream) gets the pipeline's reply
+	if msg.Reply != "" {
+		n.awaitReply(env.ID, msg)
 	}
+
+	return env, nil
 }
 
-// Close gracefully shuts down the NATS subscription and connection
+// awaitReply answers a NATS request once an output delivers a reply for the envelope
+func (n *NATSInput) awaitReply(id string, msg *nats.Msg) {
+	replyChan, cancel := replies.register(id)
+	timeout := time.Duration(n.config.ReplyTimeout) * time.Second
+
+	go func() {
+		defer cancel()
+		select {
+		case reply := <-replyChan:
+			if err := msg.RespondMsg(replyToNATSMsg(reply)); err != nil {
+				slog.Warn("Failed to send NATS reply", "id", id, "error", err)
+			}
+		case <-time.After(timeout):
+			slog.Warn("No reply produced for NATS request", "id", id, "timeout", timeout)
+		}
+	}()
+}
+
+// decompressNATSMsg returns the message data, decompressed according to its Content-Encoding
+// header to at most maxSize bytes
+func decompressNATSMsg(msg *nats.Msg, maxSize int64) ([]byte, error) {
+	encoding := msg.Header.Get(compressionEncodingHeader)
+	if encoding == "" {
+		return msg.Data, nil
+	}
+
+	algorithm, err := normalizeCompression(encoding)
+	if err != nil {
+		return nil, err
+	}
+	return decompress(algorithm, msg.Data, maxSize)
+}
+
+// Drain stops the subscription from taking new messages. Messages the server already sent
+// are passed on to Read, which returns component.ErrInputDrained once they are all read.
+func (n *NATSInput) Drain(ctx context.Context) error {
+	n.mu.RLock()
+	sub := n.sub
+	n.mu.RUnlock()
+	if sub == nil {
+		return nil
+	}
+
+	if err := sub.Drain(); err != nil {
+		return fmt.Errorf("failed to drain NATS subscription: %w", err)
+	}
+	// The subscription becomes invalid once its callback has handled the last pending message
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for sub.IsValid() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	n.drainOnce.Do(func() { close(n.drained) })
+	slog.Info("NATS subscription drained", "topic", n.config.Topic)
+	return nil
+}
+
+// CheckHealth reports whether the subscription is connected to the NATS server
+func (n *NATSInput) CheckHealth(ctx context.Context) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return natsConnHealth(n.conn)
+}
+
+// SetPipeline labels the input's metrics with the pipeline it runs in
+func (n *NATSInput) SetPipeline(name string) {
+	n.pipeline = name
+}
+
+// Close gracefully shuts down the NATS subscription and connection. Messages not yet
+// read are dropped; call Drain first to hand them out.
 func (n *NATSInput) Close() error {
 	n.mu.Lock()
 	defer n.mu.Unlock()
 
-	close(n.msgChan)
+	select {
+	case <-n.closed:
+		return nil
+	default:
+	}
+	// msgChan stays open: the subscription callback may still be sending on it
+	close(n.closed)
 
-	if n.sub != nil {
+	if n.sub != nil && n.sub.IsValid() {
 		if err := n.sub.Unsubscribe(); err != nil {
 			slog.Error("Failed to unsubscribe from NATS", "error", err)
 		}
@@ -109,6 +232,9 @@ func (n *NATSInput) Close() error {
 func (n *NATSInput) Start(ctx context.Context) error {
 	timeout := time.Duration(n.config.Timeout) * time.Second
 
+	// The subscription outlives Start, so it must watch the caller's context rather
+	// than the connect timeout (which is cancelled as soon as Start returns)
+	runCtx := ctx
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -120,6 +246,7 @@ func (n *NATSInput) Start(ctx context.Context) error {
 			slog.Warn("NATS disconnected", "url", n.config.URL)
 		}),
 		nats.ReconnectHandler(func(nc *nats.Conn) {
+			metrics.NATSReconnected(n.pipeline, "nats-input")
 			slog.Info("NATS reconnected", "url", n.config.URL)
 		}),
 		nats.ClosedHandler(func(nc *nats.Conn) {
@@ -136,14 +263,22 @@ func (n *NATSInput) Start(ctx context.Context) error {
 	sub, err := conn.Subscribe(n.config.Topic, func(msg *nats.Msg) {
 		select {
 		case n.msgChan <- msg:
-		case <-ctx.Done():
-			return
+			metrics.SetQueueDepth(n.pipeline, "nats-input", len(n.msgChan))
+		case <-runCtx.Done():
+			metrics.Dropped(n.pipeline, "nats-input", nil, "closed")
+		case <-n.closed:
+			metrics.Dropped(n.pipeline, "nats-input", nil, "closed")
 		}
 	})
 	if err != nil {
 		conn.Close()
 		return fmt.Errorf("failed to subscribe to topic %s: %w", n.config.Topic, err)
 	}
+	// Make sure the server has the subscription before reporting the input as started
+	if err := conn.FlushWithContext(ctx); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to subscribe to topic %s: %w", n.config.Topic, err)
+	}
 
 	n.mu.Lock()
 	n.conn = conn
@@ -0,0 +1,128 @@
+//go:build integration
+
+package io
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
+	"github.com/nats-io/nats.go"
+)
+
+func TestNATSInput_Integration_Drain(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer nc.Close()
+
+	input, err := NewNATSInput([]byte(fmt.Sprintf(`{"url":"%s","topic":"test.input.drain"}`, nats.DefaultURL)))
+	if err != nil {
+		t.Fatalf("NewNATSInput() error = %v", err)
+	}
+	if err := input.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer input.Close()
+
+	for i := 0; i < 5; i++ {
+		nc.Publish("test.input.drain", []byte(fmt.Sprintf("msg-%d", i)))
+	}
+	nc.Flush()
+	time.Sleep(50 * time.Millisecond)
+
+	if err := input.Drain(ctx); err != nil {
+		t.Fatalf("Drain() error = %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		env, err := input.Read(ctx)
+		if err != nil {
+			t.Fatalf("Read() %d error = %v", i, err)
+		}
+		if want := fmt.Sprintf("msg-%d", i); string(env.Payload) != want {
+			t.Errorf("Read() %d payload = %s, want %s", i, env.Payload, want)
+		}
+	}
+	if _, err := input.Read(ctx); !errors.Is(err, component.ErrInputDrained) {
+		t.Errorf("Read() after drain error = %v, want ErrInputDrained", err)
+	}
+}
+
+func TestNATSInput_Integration_CloseWhileDelivering(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer nc.Close()
+
+	input, err := NewNATSInput([]byte(fmt.Sprintf(`{"url":"%s","topic":"test.input.close"}`, nats.DefaultURL)))
+	if err != nil {
+		t.Fatalf("NewNATSInput() error = %v", err)
+	}
+	if err := input.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// Fill the buffer so the subscription callback blocks, then close underneath it
+	for i := 0; i < 150; i++ {
+		nc.Publish("test.input.close", []byte("x"))
+	}
+	nc.Flush()
+	time.Sleep(50 * time.Millisecond)
+	if err := input.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := input.Close(); err != nil {
+		t.Errorf("Second Close() error = %v", err)
+	}
+}
+
+func TestNATS_Integration_TraceparentPropagation(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	input, err := NewNATSInput([]byte(fmt.Sprintf(`{"url":"%s","topic":"test.trace"}`, nats.DefaultURL)))
+	if err != nil {
+		t.Fatalf("NewNATSInput() error = %v", err)
+	}
+	if err := input.Start(ctx); err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer input.Close()
+
+	output, err := NewNATSOutput([]byte(fmt.Sprintf(`{"url":"%s","subject":"test.trace"}`, nats.DefaultURL)))
+	if err != nil {
+		t.Fatalf("NewNATSOutput() error = %v", err)
+	}
+	if err := output.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer output.Close()
+
+	env := envelope.New()
+	env.ID = "msg-trace"
+	tracing.Extract(testTraceparent, env)
+	if err := output.Write(ctx, env); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	received, err := input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if received.TraceParent != testTraceparent || received.TraceID != env.TraceID {
+		t.Errorf("Received TraceParent = %q, TraceID = %q; want %q", received.TraceParent, received.TraceID, testTraceparent)
+	}
+}
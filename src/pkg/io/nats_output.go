@@ -3,21 +3,28 @@ package io
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
 
+	"github.com/ValueRetail/vrsky/pkg/component"
 	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
 )
 
 // NATSOutputConfig defines the configuration for NATS Output
 type NATSOutputConfig struct {
-	URL     string `json:"url"`               // NATS server URL
-	Subject string `json:"subject"`           // Subject to publish to
-	Timeout int    `json:"timeout,omitempty"` // Connection timeout in seconds (default: 30)
+	URL            string `json:"url"`                       // NATS server URL
+	Subject        string `json:"subject"`                   // Subject to publish to
+	Timeout        int    `json:"timeout,omitempty"`         // Connection timeout in seconds (default: 30)
+	Compression    string `json:"compression,omitempty"`     // Message compression: none, gzip or zstd (default: none)
+	RequestTimeout int    `json:"request_timeout,omitempty"` // Seconds to wait for a reply when a caller is waiting synchronously (default: 30)
 }
 
 // NATSOutput implements the Output interface for NATS publishing
@@ -26,12 +33,14 @@ type NATSOutput struct {
 	conn        *nats.Conn
 	mu          sync.RWMutex
 	isConnected bool
+	pipeline    string // Pipeline label on metrics
 }
 
 // NewNATSOutput creates a new NATS output from JSON configuration
 func NewNATSOutput(configJSON json.RawMessage) (*NATSOutput, error) {
 	config := NATSOutputConfig{
-		Timeout: 30, // Default timeout
+		Timeout:        30, // Default timeout
+		RequestTimeout: 30,
 	}
 
 	if err := json.Unmarshal(configJSON, &config); err != nil {
@@ -45,6 +54,12 @@ func NewNATSOutput(configJSON json.RawMessage) (*NATSOutput, error) {
 		return nil, fmt.Errorf("NATS subject is required")
 	}
 
+	compression, err := normalizeCompression(config.Compression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS output compression: %w", err)
+	}
+	config.Compression = compression
+
 	return &NATSOutput{
 		config: config,
 	}, nil
@@ -72,6 +87,7 @@ func (n *NATSOutput) Start(ctx context.Context) error {
 			slog.Warn("NATS disconnected", "url", n.config.URL)
 		}),
 		nats.ReconnectHandler(func(nc *nats.Conn) {
+			metrics.NATSReconnected(n.pipeline, "nats-output")
 			slog.Info("NATS reconnected", "url", n.config.URL)
 		}),
 		nats.ClosedHandler(func(nc *nats.Conn) {
@@ -96,38 +112,21 @@ func (n *NATSOutput) Start(ctx context.Context) error {
 
 // Write publishes an envelope to the NATS subject
 func (n *NATSOutput) Write(ctx context.Context, env *envelope.Envelope) error {
-	n.mu.RLock()
-	if !n.isConnected || n.conn == nil {
-		n.mu.RUnlock()
-		return fmt.Errorf("NATS not connected")
+	conn, err := n.connection()
+	if err != nil {
+		return err
 	}
-	conn := n.conn
-	n.mu.RUnlock()
 
-	// Serialize envelope to JSON
-	envJSON, err := json.Marshal(env)
+	msg, err := n.message(env)
 	if err != nil {
-		return fmt.Errorf("failed to marshal envelope: %w", err)
+		return err
 	}
 
-	slog.Debug("Publishing to NATS",
-		"subject", n.config.Subject,
-		"message_id", env.ID,
-		"size", len(envJSON))
-
-	// Publish to NATS with timeout
-	_, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	// Create NATS message with headers
-	msg := &nats.Msg{
-		Subject: n.config.Subject,
-		Data:    envJSON,
+	// A synchronous caller is waiting: send as a request and relay the reply
+	if replies.expecting(env.ID) {
+		return n.request(ctx, conn, msg, env.ID)
 	}
 
-	// Add headers (X-Message-ID for tracking)
-	msg.Reply = "" // No reply expected
-
 	if err := conn.PublishMsg(msg); err != nil {
 		slog.Error("Failed to publish to NATS",
 			"subject", n.config.Subject,
@@ -149,6 +148,154 @@ func (n *NATSOutput) Write(ctx context.Context, env *envelope.Envelope) error {
 	return nil
 }
 
+// WriteBatch publishes the envelopes without waiting, then flushes the connection once.
+// Envelopes a synchronous caller is waiting for are sent as requests. When publishing or
+// the flush fails, every envelope not yet confirmed is reported as failed in the returned
+// *component.BatchError.
+func (n *NATSOutput) WriteBatch(ctx context.Context, envs []*envelope.Envelope) error {
+	conn, err := n.connection()
+	if err != nil {
+		return err
+	}
+
+	failed := make(map[int]error)
+	var published []int
+	for i, env := range envs {
+		msg, err := n.message(env)
+		if err != nil {
+			failed[i] = err
+			continue
+		}
+		if replies.expecting(env.ID) {
+			if err := n.request(ctx, conn, msg, env.ID); err != nil {
+				failed[i] = err
+			}
+			continue
+		}
+		if err := conn.PublishMsg(msg); err != nil {
+			err = fmt.Errorf("failed to publish batch to NATS subject %s: %w", n.config.Subject, err)
+			for _, j := range published {
+				failed[j] = err
+			}
+			for j := i; j < len(envs); j++ {
+				failed[j] = err
+			}
+			return component.NewBatchError(failed)
+		}
+		published = append(published, i)
+	}
+
+	// The flush is the only confirmation that the server received the batch
+	flushCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := conn.FlushWithContext(flushCtx); err != nil {
+		err = fmt.Errorf("failed to flush NATS batch: %w", err)
+		for _, i := range published {
+			failed[i] = err
+		}
+		return component.NewBatchError(failed)
+	}
+
+	slog.Info("Batch published to NATS",
+		"subject", n.config.Subject,
+		"batch_size", len(envs),
+		"first_message_id", envs[0].ID)
+	return component.NewBatchError(failed)
+}
+
+// connection returns the live connection
+func (n *NATSOutput) connection() (*nats.Conn, error) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if !n.isConnected || n.conn == nil {
+		return nil, fmt.Errorf("NATS not connected")
+	}
+	return n.conn, nil
+}
+
+// message serializes and compresses the envelope into a NATS message
+func (n *NATSOutput) message(env *envelope.Envelope) (*nats.Msg, error) {
+	// Serialize envelope to JSON
+	envJSON, err := json.Marshal(env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	data, err := compress(n.config.Compression, envJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compress envelope: %w", err)
+	}
+
+	slog.Debug("Publishing to NATS",
+		"subject", n.config.Subject,
+		"message_id", env.ID,
+		"size", len(envJSON),
+		"compressed_size", len(data))
+
+	// Create NATS message with headers
+	msg := &nats.Msg{
+		Subject: n.config.Subject,
+		Data:    data,
+		Header:  nats.Header{},
+	}
+
+	// Add headers (X-Message-ID for tracking, traceparent to continue the trace, Content-Type
+	// of the data, which is the envelope JSON, Content-Encoding so subscribers know how to decompress)
+	msg.Header.Set("X-Message-ID", env.ID)
+	if env.TraceParent != "" {
+		msg.Header.Set(tracing.TraceparentHeader, env.TraceParent)
+	}
+	msg.Header.Set("Content-Type", "application/json")
+	if n.config.Compression != CompressionNone {
+		msg.Header.Set(compressionEncodingHeader, n.config.Compression)
+	}
+	return msg, nil
+}
+
+// request publishes the message with a reply inbox and delivers the response to the waiter
+func (n *NATSOutput) request(ctx context.Context, conn *nats.Conn, msg *nats.Msg, id string) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(n.config.RequestTimeout)*time.Second)
+	defer cancel()
+
+	resp, err := conn.RequestMsgWithContext(ctx, msg)
+	if err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			// Nobody received the message, so the caller should retry
+			replies.deliver(id, &Reply{Status: http.StatusServiceUnavailable})
+		}
+		return fmt.Errorf("NATS request on subject %s: %w", n.config.Subject, err)
+	}
+
+	replies.deliver(id, replyFromNATSMsg(resp))
+	slog.Info("Message published to NATS and reply received",
+		"subject", n.config.Subject,
+		"message_id", id)
+	return nil
+}
+
+// CheckHealth reports whether the output is connected to the NATS server
+func (n *NATSOutput) CheckHealth(ctx context.Context) error {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return natsConnHealth(n.conn)
+}
+
+// natsConnHealth fails unless conn is connected; while reconnecting, messages are only buffered
+func natsConnHealth(conn *nats.Conn) error {
+	if conn == nil {
+		return fmt.Errorf("NATS not connected")
+	}
+	if status := conn.Status(); status != nats.CONNECTED {
+		return fmt.Errorf("NATS connection %s", status)
+	}
+	return nil
+}
+
+// SetPipeline labels the output's metrics with the pipeline it runs in
+func (n *NATSOutput) SetPipeline(name string) {
+	n.pipeline = name
+}
+
 // Close gracefully shuts down the NATS connection
 func (n *NATSOutput) Close() error {
 	n.mu.Lock()
@@ -5,6 +5,8 @@ package io
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -109,3 +111,210 @@ func TestNATSOutput_Integration_PublishesToNATS(t *testing.T) {
 
 	output.Close()
 }
+
+func TestNATSOutput_Integration_CompressionRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	nc.Close()
+
+	for _, compression := range []string{"gzip", "zstd"} {
+		t.Run(compression, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			subject := "test.compressed." + compression
+			input, err := NewNATSInput([]byte(fmt.Sprintf(`{"url":"%s","topic":"%s"}`, nats.DefaultURL, subject)))
+			if err != nil {
+				t.Fatalf("NewNATSInput() error = %v", err)
+			}
+			if err := input.Start(ctx); err != nil {
+				t.Fatalf("NATSInput.Start() error = %v", err)
+			}
+			defer input.Close()
+
+			output, err := NewNATSOutput([]byte(fmt.Sprintf(`{"url":"%s","subject":"%s","compression":"%s"}`, nats.DefaultURL, subject, compression)))
+			if err != nil {
+				t.Fatalf("NewNATSOutput() error = %v", err)
+			}
+			if err := output.Start(ctx); err != nil {
+				t.Fatalf("NATSOutput.Start() error = %v", err)
+			}
+			defer output.Close()
+
+			env := envelope.New()
+			env.ID = "compressed-123"
+			env.Payload = []byte(`<order id="1"/>`)
+			env.ContentType = "application/xml"
+
+			if err := output.Write(ctx, env); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+
+			received, err := input.Read(ctx)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if received.ContentType != "application/json" {
+				t.Errorf("ContentType = %q, want application/json for the envelope", received.ContentType)
+			}
+
+			decoded, err := envelope.Unmarshal(received.Payload)
+			if err != nil {
+				t.Fatalf("Received payload is not a decompressed envelope: %v", err)
+			}
+			if decoded.ContentType != "application/xml" {
+				t.Errorf("Inner ContentType = %q, want application/xml", decoded.ContentType)
+			}
+			if decoded.ID != env.ID || string(decoded.Payload) != string(env.Payload) {
+				t.Errorf("Decoded envelope mismatch: got id=%s payload=%s", decoded.ID, decoded.Payload)
+			}
+		})
+	}
+}
+
+func TestNATSOutput_InvalidCompression(t *testing.T) {
+	_, err := NewNATSOutput([]byte(`{"url":"nats://localhost:4222","subject":"test","compression":"lz4"}`))
+	if err == nil {
+		t.Error("NewNATSOutput() should reject unsupported compression")
+	}
+}
+
+func TestNATSOutput_Integration_SyncReplyAcrossNATS(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", "orders")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"created"}`))
+	}))
+	defer backend.Close()
+
+	subject := fmt.Sprintf("test.sync.%d", time.Now().UnixNano())
+
+	// Ingress: synchronous HTTP input publishing to NATS
+	httpInput := startSyncInput(t, ctx, 8779, `"sync":true`)
+	natsOutput, err := NewNATSOutput([]byte(fmt.Sprintf(`{"url":"nats://localhost:4222","subject":%q}`, subject)))
+	if err != nil {
+		t.Fatalf("NewNATSOutput() error = %v", err)
+	}
+	if err := natsOutput.Start(ctx); err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer natsOutput.Close()
+
+	// Egress: NATS input delivering to the backend over HTTP
+	natsInput, err := NewNATSInput([]byte(fmt.Sprintf(`{"url":"nats://localhost:4222","topic":%q}`, subject)))
+	if err != nil {
+		t.Fatalf("NewNATSInput() error = %v", err)
+	}
+	if err := natsInput.Start(ctx); err != nil {
+		t.Fatalf("NATSInput.Start() error = %v", err)
+	}
+	httpOutput, err := NewHTTPOutput([]byte(fmt.Sprintf(`{"url":%q}`, backend.URL)))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+
+	go runPipeline(ctx, httpInput, natsOutput)
+	go runPipeline(ctx, natsInput, httpOutput)
+
+	resp, body := postSync(t, "http://localhost:8779/webhook")
+	if resp.StatusCode != http.StatusCreated || body != `{"status":"created"}` {
+		t.Errorf("Reply = %d %s, want 201 from the backend", resp.StatusCode, body)
+	}
+	if resp.Header.Get("X-Backend") != "orders" {
+		t.Errorf("Backend headers not relayed: %v", resp.Header)
+	}
+}
+
+func TestNATSOutput_Integration_SyncNoResponders(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	httpInput := startSyncInput(t, ctx, 8780, `"sync":true`)
+	natsOutput, err := NewNATSOutput([]byte(`{"url":"nats://localhost:4222","subject":"test.sync.nobody"}`))
+	if err != nil {
+		t.Fatalf("NewNATSOutput() error = %v", err)
+	}
+	if err := natsOutput.Start(ctx); err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer natsOutput.Close()
+
+	go runPipeline(ctx, httpInput, natsOutput)
+
+	resp, _ := postSync(t, "http://localhost:8780/webhook")
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Status = %d, want 503 when nothing subscribes", resp.StatusCode)
+	}
+}
+
+func TestNATSOutput_Integration_WriteBatch(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nc, err := nats.Connect(nats.DefaultURL)
+	if err != nil {
+		t.Skipf("NATS not available: %v", err)
+	}
+	defer nc.Close()
+
+	received := make(chan *nats.Msg, 10)
+	sub, err := nc.ChanSubscribe("test.output.batch", received)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	defer sub.Unsubscribe()
+	nc.Flush()
+
+	output, err := NewNATSOutput([]byte(fmt.Sprintf(`{"url":"%s","subject":"test.output.batch"}`, nats.DefaultURL)))
+	if err != nil {
+		t.Fatalf("NewNATSOutput() error = %v", err)
+	}
+	if err := output.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer output.Close()
+
+	var envs []*envelope.Envelope
+	for i := 0; i < 5; i++ {
+		env := envelope.New()
+		env.ID = fmt.Sprintf("batch-%d", i)
+		env.Payload = []byte(`{"test":"data"}`)
+		envs = append(envs, env)
+	}
+	if err := output.WriteBatch(ctx, envs); err != nil {
+		t.Fatalf("WriteBatch() error = %v", err)
+	}
+
+	// Every envelope is published, in order
+	for i := range envs {
+		select {
+		case msg := <-received:
+			if id := msg.Header.Get("X-Message-ID"); id != envs[i].ID {
+				t.Errorf("Message %d has ID %s, want %s", i, id, envs[i].ID)
+			}
+		case <-ctx.Done():
+			t.Fatalf("Timeout after %d of %d messages", i, len(envs))
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package io
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// replyStatusHeader carries the reply status code on NATS reply messages
+const replyStatusHeader = "Vrsky-Reply-Status"
+
+// Reply is the result of processing an envelope, returned to a caller waiting synchronously
+// (e.g. an HTTP input in sync mode). Outputs that get a response from their destination
+// deliver it as a Reply when someone is waiting for the envelope.
+type Reply struct {
+	Status  int
+	Headers http.Header
+	Payload []byte
+}
+
+// replyRegistry connects waiters to replies by envelope ID within one process.
+// NATS request/reply bridges it across processes.
+type replyRegistry struct {
+	mu      sync.Mutex
+	waiters map[string]chan *Reply
+}
+
+// replies is the process-wide registry shared by inputs and outputs
+var replies = &replyRegistry{waiters: make(map[string]chan *Reply)}
+
+// register starts waiting for a reply to the envelope. The returned cancel func
+// must be called if the waiter gives up.
+func (r *replyRegistry) register(id string) (<-chan *Reply, func()) {
+	ch := make(chan *Reply, 1)
+	r.mu.Lock()
+	r.waiters[id] = ch
+	r.mu.Unlock()
+
+	return ch, func() {
+		r.mu.Lock()
+		if r.waiters[id] == ch {
+			delete(r.waiters, id)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// expecting reports whether someone is waiting for a reply to the envelope
+func (r *replyRegistry) expecting(id string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.waiters[id]
+	return ok
+}
+
+// deliver hands the reply to the waiter, if any. Only the first reply is delivered.
+func (r *replyRegistry) deliver(id string, reply *Reply) bool {
+	r.mu.Lock()
+	ch, ok := r.waiters[id]
+	delete(r.waiters, id)
+	r.mu.Unlock()
+
+	if !ok {
+		return false
+	}
+	ch <- reply
+	return true
+}
+
+// replyToNATSMsg encodes a reply as a NATS message: status and headers in the NATS
+// headers, payload as data
+func replyToNATSMsg(reply *Reply) *nats.Msg {
+	msg := &nats.Msg{Data: reply.Payload, Header: nats.Header{}}
+	for name, values := range reply.Headers {
+		for _, value := range values {
+			msg.Header.Add(name, value)
+		}
+	}
+	msg.Header.Set(replyStatusHeader, strconv.Itoa(reply.Status))
+	return msg
+}
+
+// replyFromNATSMsg decodes a reply sent by replyToNATSMsg
+func replyFromNATSMsg(msg *nats.Msg) *Reply {
+	reply := &Reply{Status: http.StatusOK, Headers: http.Header{}, Payload: msg.Data}
+	for name, values := range msg.Header {
+		if name == replyStatusHeader {
+			if status, err := strconv.Atoi(values[0]); err == nil {
+				reply.Status = status
+			}
+			continue
+		}
+		reply.Headers[name] = values
+	}
+	return reply
+}
@@ -0,0 +1,213 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+)
+
+func TestReplyRegistry(t *testing.T) {
+	registry := &replyRegistry{waiters: make(map[string]chan *Reply)}
+
+	if registry.deliver("unknown", &Reply{Status: 200}) {
+		t.Error("deliver() without a waiter should report false")
+	}
+
+	replyChan, cancel := registry.register("msg-1")
+	if !registry.expecting("msg-1") {
+		t.Fatal("expecting() = false after register")
+	}
+	if !registry.deliver("msg-1", &Reply{Status: 201}) {
+		t.Fatal("deliver() = false with a waiter")
+	}
+	if registry.deliver("msg-1", &Reply{Status: 500}) {
+		t.Error("Only the first reply should be delivered")
+	}
+	if reply := <-replyChan; reply.Status != 201 {
+		t.Errorf("Reply status = %d, want 201", reply.Status)
+	}
+	cancel()
+
+	_, cancel = registry.register("msg-2")
+	cancel()
+	if registry.expecting("msg-2") {
+		t.Error("expecting() = true after cancel")
+	}
+}
+
+func TestReplyNATSEncoding(t *testing.T) {
+	reply := &Reply{
+		Status:  http.StatusCreated,
+		Headers: http.Header{"Content-Type": {"application/json"}, "X-Order": {"A-1"}},
+		Payload: []byte(`{"ok":true}`),
+	}
+	decoded := replyFromNATSMsg(replyToNATSMsg(reply))
+	if decoded.Status != reply.Status || string(decoded.Payload) != string(reply.Payload) {
+		t.Errorf("Decoded reply = %d %s", decoded.Status, decoded.Payload)
+	}
+	if decoded.Headers.Get("X-Order") != "A-1" || decoded.Headers.Get("Content-Type") != "application/json" {
+		t.Errorf("Decoded headers = %v", decoded.Headers)
+	}
+	if decoded.Headers.Get(replyStatusHeader) != "" {
+		t.Error("Status header should not be exposed as a reply header")
+	}
+}
+
+// runPipeline moves envelopes from input to output until ctx is done
+func runPipeline(ctx context.Context, input component.Input, output component.Output) {
+	for {
+		env, err := input.Read(ctx)
+		if err != nil {
+			return
+		}
+		_ = output.Write(ctx, env)
+	}
+}
+
+// startSyncInput starts an HTTP input on port with extra config fields
+func startSyncInput(t *testing.T, ctx context.Context, port int, extra string) *HTTPInput {
+	t.Helper()
+	input, err := NewHTTPInput([]byte(fmt.Sprintf(`{"port":"%d",%s}`, port, extra)))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	go func() {
+		_ = input.Start(ctx)
+	}()
+	t.Cleanup(func() { input.Close() })
+	time.Sleep(100 * time.Millisecond)
+	return input
+}
+
+func postSync(t *testing.T, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Post(url, "application/json", bytes.NewReader([]byte(`{"sku":"A"}`)))
+	if err != nil {
+		t.Fatalf("Failed to send webhook: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestHTTPInput_SyncReturnsOutputResponse(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"error":"unknown sku"}`))
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Order-ID", "A-42")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"received":%s}`, body)
+	}))
+	defer backend.Close()
+
+	input := startSyncInput(t, ctx, 8775, `"sync":true,"routes":[
+		{"path":"/orders"},
+		{"path":"/reject"},
+		{"path":"/async","sync":false}]`)
+
+	for _, path := range []string{"/orders", "/reject", "/async"} {
+		output, err := NewHTTPOutput([]byte(fmt.Sprintf(`{"url":%q}`, backend.URL+path)))
+		if err != nil {
+			t.Fatalf("NewHTTPOutput() error = %v", err)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			env, err := input.Read(ctx)
+			if err == nil {
+				_ = output.Write(ctx, env)
+			}
+		}()
+
+		resp, body := postSync(t, "http://localhost:8775"+path)
+		<-done
+
+		switch path {
+		case "/orders":
+			if resp.StatusCode != http.StatusCreated || body != `{"received":{"sku":"A"}}` {
+				t.Errorf("Sync reply = %d %s", resp.StatusCode, body)
+			}
+			if resp.Header.Get("X-Order-ID") != "A-42" || resp.Header.Get("Content-Type") != "application/json" {
+				t.Errorf("Reply headers not relayed: %v", resp.Header)
+			}
+			if resp.Header.Get("X-Message-ID") == "" {
+				t.Error("X-Message-ID header missing")
+			}
+		case "/reject":
+			if resp.StatusCode != http.StatusUnprocessableEntity || body != `{"error":"unknown sku"}` {
+				t.Errorf("Error reply = %d %s", resp.StatusCode, body)
+			}
+		case "/async":
+			if resp.StatusCode != http.StatusAccepted {
+				t.Errorf("Async route status = %d, want 202", resp.StatusCode)
+			}
+		}
+	}
+}
+
+func TestHTTPInput_SyncUnreachableOutput(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	input := startSyncInput(t, ctx, 8776, `"sync":true`)
+	output, err := NewHTTPOutput([]byte(`{"url":"http://127.0.0.1:1/unreachable","timeout":1}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	go runPipeline(ctx, input, output)
+
+	resp, _ := postSync(t, "http://localhost:8776/webhook")
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Status = %d, want 502", resp.StatusCode)
+	}
+}
+
+func TestHTTPInput_SyncTimeoutFallsBackTo202(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	input := startSyncInput(t, ctx, 8777, `"sync":true,"sync_timeout":"200ms"`)
+
+	start := time.Now()
+	resp, _ := postSync(t, "http://localhost:8777/webhook")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Status = %d, want 202", resp.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("Answered after %s, before the sync timeout", elapsed)
+	}
+
+	// The webhook is still delivered to the pipeline, and nobody waits for it anymore
+	env, err := input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if env.ID != resp.Header.Get("X-Message-ID") {
+		t.Errorf("X-Message-ID = %q, want %q", resp.Header.Get("X-Message-ID"), env.ID)
+	}
+	if replies.expecting(env.ID) {
+		t.Error("Waiter should be removed after the sync timeout")
+	}
+}
+
+func TestNewHTTPInput_InvalidSyncTimeout(t *testing.T) {
+	if _, err := NewHTTPInput([]byte(`{"port":"8778","sync":true,"sync_timeout":"0s"}`)); err == nil {
+		t.Error("NewHTTPInput() should reject a zero sync_timeout")
+	}
+}
@@ -0,0 +1,126 @@
+package io
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Config defines the connection settings shared by S3 Input and Output. Any
+// S3-compatible store works (AWS S3, MinIO, Ceph, ...).
+type S3Config struct {
+	Endpoint     string `json:"endpoint"`                // Endpoint URL, e.g. http://minio:9000 or https://s3.eu-west-1.amazonaws.com
+	Region       string `json:"region,omitempty"`        // Bucket region (default: us-east-1)
+	Bucket       string `json:"bucket"`                  // Bucket name
+	AccessKey    string `json:"access_key,omitempty"`    // Access key (default: AWS_ACCESS_KEY_ID)
+	SecretKey    string `json:"secret_key,omitempty"`    // Secret key (default: AWS_SECRET_ACCESS_KEY)
+	SessionToken string `json:"session_token,omitempty"` // Optional session token (default: AWS_SESSION_TOKEN)
+	Timeout      int    `json:"timeout,omitempty"`       // Request timeout in seconds (default: 30)
+}
+
+// validate applies defaults and checks required fields
+func (c *S3Config) validate() error {
+	if c.Endpoint == "" {
+		return fmt.Errorf("S3 endpoint is required")
+	}
+	if c.Bucket == "" {
+		return fmt.Errorf("S3 bucket is required")
+	}
+	if c.Region == "" {
+		c.Region = "us-east-1"
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 30
+	}
+	if c.AccessKey == "" && c.SecretKey == "" {
+		c.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		c.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if c.SessionToken == "" {
+			c.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+	}
+	if c.AccessKey == "" || c.SecretKey == "" {
+		return fmt.Errorf("S3 access_key and secret_key are required (or set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	if _, _, err := parseS3Endpoint(c.Endpoint); err != nil {
+		return err
+	}
+	return nil
+}
+
+// newClient creates the S3 client. No request is made until the client is used.
+func (c S3Config) newClient() (*minio.Client, error) {
+	host, secure, err := parseS3Endpoint(c.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, fmt.Errorf("create S3 transport: %w", err)
+	}
+	transport.ResponseHeaderTimeout = time.Duration(c.Timeout) * time.Second
+
+	client, err := minio.New(host, &minio.Options{
+		Creds:     credentials.NewStaticV4(c.AccessKey, c.SecretKey, c.SessionToken),
+		Secure:    secure,
+		Region:    c.Region,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create S3 client: %w", err)
+	}
+	return client, nil
+}
+
+// checkBucket verifies the bucket exists and the credentials can see it
+func (c S3Config) checkBucket(ctx context.Context, client *minio.Client) error {
+	if client == nil {
+		return fmt.Errorf("S3 client not started")
+	}
+	exists, err := client.BucketExists(ctx, c.Bucket)
+	if err != nil {
+		return fmt.Errorf("failed to check S3 bucket %s: %w", c.Bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("S3 bucket %s does not exist", c.Bucket)
+	}
+	return nil
+}
+
+// parseS3Endpoint splits an endpoint URL into host[:port] and whether TLS is used
+func parseS3Endpoint(endpoint string) (string, bool, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return "", false, fmt.Errorf("invalid S3 endpoint %q (expected http(s)://host[:port])", endpoint)
+	}
+	switch u.Scheme {
+	case "http":
+		return u.Host, false, nil
+	case "https":
+		return u.Host, true, nil
+	default:
+		return "", false, fmt.Errorf("invalid S3 endpoint scheme %q (must be http or https)", u.Scheme)
+	}
+}
+
+// sanitizeObjectKey cleans a rendered object key: "/" separates prefixes, each segment
+// is sanitized like a filename, and empty, "." and ".." segments are rejected so
+// templated keys cannot escape their prefix
+func sanitizeObjectKey(rawKey string) (string, error) {
+	segments := strings.Split(rawKey, "/")
+	for i, segment := range segments {
+		switch segment {
+		case "", ".", "..":
+			return "", fmt.Errorf("invalid object key %q: empty or relative path segment", rawKey)
+		}
+		segments[i] = sanitizeForFilename(segment)
+	}
+	return strings.Join(segments, "/"), nil
+}
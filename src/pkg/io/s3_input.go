@@ -0,0 +1,414 @@
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// Actions applied to an object once it has been emitted
+const (
+	S3ProcessedTag    = "tag"    // Tag the object in place (vrsky-processed=true)
+	S3ProcessedMove   = "move"   // Copy the object under processed_prefix and delete the original
+	S3ProcessedDelete = "delete" // Delete the object
+)
+
+// s3ProcessedTagKey is the object tag marking processed objects
+const s3ProcessedTagKey = "vrsky-processed"
+
+// S3InputConfig defines the configuration for S3 Input
+type S3InputConfig struct {
+	S3Config
+	Prefix          string `json:"prefix,omitempty"`           // Key prefix to list (default: whole bucket)
+	Pattern         string `json:"pattern,omitempty"`          // Glob applied to the object's base name (default: *)
+	PollInterval    string `json:"poll_interval,omitempty"`    // Listing interval (default: 5s)
+	ProcessedAction string `json:"processed_action,omitempty"` // tag, move or delete (default: tag)
+	ProcessedPrefix string `json:"processed_prefix,omitempty"` // Destination prefix for move (default: processed/)
+	ErrorPrefix     string `json:"error_prefix,omitempty"`     // Objects that fail max_retries times are moved here (default: left in place)
+	MaxRetries      int    `json:"max_retries,omitempty"`      // Read attempts per object (default: 3)
+	MaxObjectSize   int64  `json:"max_object_size,omitempty"`  // Largest object emitted, in bytes (default: 100MB)
+	BufferSize      int    `json:"buffer_size,omitempty"`      // Envelopes buffered ahead of Read (default: 100)
+}
+
+// S3Input implements the Input interface by polling a bucket prefix for new objects
+type S3Input struct {
+	config       S3InputConfig
+	pollInterval time.Duration
+	client       *minio.Client
+	messages     chan *envelope.Envelope
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	done      chan struct{}
+	mu        sync.Mutex
+	processed map[string]string // key -> ETag of objects already emitted
+	failures  map[string]int    // key -> failed read attempts
+}
+
+// NewS3Input creates a new S3 input from JSON configuration
+func NewS3Input(configJSON json.RawMessage) (*S3Input, error) {
+	config := S3InputConfig{
+		Pattern:         "*",
+		PollInterval:    "5s",
+		ProcessedAction: S3ProcessedTag,
+		MaxRetries:      3,
+		MaxObjectSize:   100 * 1024 * 1024,
+		BufferSize:      100,
+	}
+
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse S3 input config: %w", err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+
+	pollInterval, err := time.ParseDuration(config.PollInterval)
+	if err != nil || pollInterval <= 0 {
+		return nil, fmt.Errorf("invalid S3 poll_interval %q", config.PollInterval)
+	}
+	if _, err := path.Match(config.Pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid S3 pattern %q: %w", config.Pattern, err)
+	}
+
+	switch config.ProcessedAction {
+	case S3ProcessedTag, S3ProcessedDelete:
+	case S3ProcessedMove:
+		if config.ProcessedPrefix == "" {
+			config.ProcessedPrefix = "processed/"
+		}
+	default:
+		return nil, fmt.Errorf("invalid S3 processed_action %q (must be tag, move or delete)", config.ProcessedAction)
+	}
+
+	return &S3Input{
+		config:       config,
+		pollInterval: pollInterval,
+		messages:     make(chan *envelope.Envelope, config.BufferSize),
+		processed:    make(map[string]string),
+		failures:     make(map[string]int),
+	}, nil
+}
+
+// Start creates the S3 client, verifies the bucket and begins polling
+func (s *S3Input) Start(ctx context.Context) error {
+	client, err := s.config.newClient()
+	if err != nil {
+		return err
+	}
+
+	if err := s.config.checkBucket(ctx, client); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.client = client
+	s.ctx, s.cancel = context.WithCancel(ctx)
+	s.done = make(chan struct{})
+	s.mu.Unlock()
+
+	go s.pollLoop()
+
+	slog.Info("Polling S3 bucket",
+		"endpoint", s.config.Endpoint,
+		"bucket", s.config.Bucket,
+		"prefix", s.config.Prefix,
+		"pattern", s.config.Pattern,
+		"processed_action", s.config.ProcessedAction)
+
+	return nil
+}
+
+// Read returns the next object envelope
+func (s *S3Input) Read(ctx context.Context) (*envelope.Envelope, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case env, ok := <-s.messages:
+		if !ok {
+			return nil, fmt.Errorf("S3 input closed")
+		}
+		return env, nil
+	}
+}
+
+// CheckHealth reports whether the bucket can be reached
+func (s *S3Input) CheckHealth(ctx context.Context) error {
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+	return s.config.checkBucket(ctx, client)
+}
+
+// Close stops polling
+func (s *S3Input) Close() error {
+	s.mu.Lock()
+	cancel, done := s.cancel, s.done
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+		// The poller was the only sender
+		close(s.messages)
+	}
+
+	slog.Info("S3 input closed")
+	return nil
+}
+
+// pollLoop lists the bucket immediately and then on every tick
+func (s *S3Input) pollLoop() {
+	defer close(s.done)
+
+	ticker := time.NewTicker(s.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.poll()
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll emits every new matching object under the prefix, then forgets objects that are
+// no longer listed
+func (s *S3Input) poll() {
+	objects := s.client.ListObjects(s.ctx, s.config.Bucket, minio.ListObjectsOptions{
+		Prefix:    s.config.Prefix,
+		Recursive: true,
+	})
+
+	listed := make(map[string]struct{})
+	for object := range objects {
+		if object.Err != nil {
+			if s.ctx.Err() == nil {
+				slog.Error("Failed to list S3 objects", "bucket", s.config.Bucket, "prefix", s.config.Prefix, "error", object.Err)
+			}
+			return
+		}
+		listed[object.Key] = struct{}{}
+		if !s.shouldProcess(object) {
+			continue
+		}
+		if err := s.processObject(object); err != nil {
+			if s.ctx.Err() != nil {
+				return
+			}
+			slog.Error("Failed to process S3 object", "bucket", s.config.Bucket, "key", object.Key, "error", err)
+		}
+	}
+
+	// Only a complete listing shows which objects are gone
+	if s.ctx.Err() == nil {
+		s.forgetUnlisted(listed)
+	}
+}
+
+// forgetUnlisted drops the state kept for objects that were deleted or moved away, so it
+// does not grow for the life of the process
+func (s *S3Input) forgetUnlisted(listed map[string]struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key := range s.processed {
+		if _, ok := listed[key]; !ok {
+			delete(s.processed, key)
+		}
+	}
+	for key := range s.failures {
+		if _, ok := listed[key]; !ok {
+			delete(s.failures, key)
+		}
+	}
+}
+
+// shouldProcess filters listings down to new objects matching the pattern
+func (s *S3Input) shouldProcess(object minio.ObjectInfo) bool {
+	if strings.HasSuffix(object.Key, "/") {
+		return false // Folder placeholder
+	}
+	if s.underPrefix(object.Key, s.config.ProcessedPrefix) || s.underPrefix(object.Key, s.config.ErrorPrefix) {
+		return false
+	}
+	if matched, _ := path.Match(s.config.Pattern, path.Base(object.Key)); !matched {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if etag, ok := s.processed[object.Key]; ok && etag == object.ETag {
+		return false
+	}
+	return s.failures[object.Key] < s.config.MaxRetries
+}
+
+// underPrefix reports whether key lives under a configured destination prefix
+func (s *S3Input) underPrefix(key, prefix string) bool {
+	return prefix != "" && strings.HasPrefix(key, prefix)
+}
+
+// processObject reads an object, hands its envelope to Read() and marks it processed
+func (s *S3Input) processObject(object minio.ObjectInfo) error {
+	var objectTags map[string]string
+	if s.config.ProcessedAction == S3ProcessedTag {
+		current, err := s.client.GetObjectTagging(s.ctx, s.config.Bucket, object.Key, minio.GetObjectTaggingOptions{})
+		if err != nil {
+			return s.recordFailure(object, fmt.Errorf("get tags: %w", err), false)
+		}
+		objectTags = current.ToMap()
+		if objectTags[s3ProcessedTagKey] == "true" {
+			s.markSeen(object)
+			return nil
+		}
+	}
+
+	if object.Size > s.config.MaxObjectSize {
+		return s.recordFailure(object, fmt.Errorf("object size %d exceeds maximum of %d bytes", object.Size, s.config.MaxObjectSize), true)
+	}
+
+	reader, err := s.client.GetObject(s.ctx, s.config.Bucket, object.Key, minio.GetObjectOptions{})
+	if err != nil {
+		return s.recordFailure(object, fmt.Errorf("get object: %w", err), false)
+	}
+	content, err := io.ReadAll(io.LimitReader(reader, s.config.MaxObjectSize+1))
+	reader.Close()
+	if err != nil {
+		return s.recordFailure(object, fmt.Errorf("read object: %w", err), false)
+	}
+	if int64(len(content)) > s.config.MaxObjectSize {
+		return s.recordFailure(object, fmt.Errorf("object exceeds maximum of %d bytes", s.config.MaxObjectSize), true)
+	}
+
+	contentType := object.ContentType
+	if contentType == "" || contentType == "application/octet-stream" || contentType == "binary/octet-stream" {
+		contentType = contentTypeForPath(object.Key)
+	}
+
+	env := envelope.New()
+	env.ID = uuid.New().String()
+	env.Source = "s3"
+	env.Payload = content
+	env.PayloadSize = int64(len(content))
+	env.ContentType = contentType
+	env.StepHistory = append(env.StepHistory, "s3-input:"+s.config.Bucket+"/"+object.Key)
+	env.Metadata = map[string]string{
+		"filename": path.Base(object.Key),
+		"bucket":   s.config.Bucket,
+		"key":      object.Key,
+		"etag":     object.ETag,
+	}
+
+	select {
+	case s.messages <- env:
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+
+	s.markSeen(object)
+	if err := s.markProcessed(object, objectTags); err != nil {
+		// The object was delivered; it is not emitted again by this process
+		return fmt.Errorf("mark processed: %w", err)
+	}
+
+	slog.Info("Received object from S3",
+		"id", env.ID,
+		"bucket", s.config.Bucket,
+		"key", object.Key,
+		"size", len(content))
+
+	return nil
+}
+
+// markSeen remembers an object version so it is not emitted again
+func (s *S3Input) markSeen(object minio.ObjectInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.processed[object.Key] = object.ETag
+	delete(s.failures, object.Key)
+}
+
+// markProcessed applies the configured processed action
+func (s *S3Input) markProcessed(object minio.ObjectInfo, objectTags map[string]string) error {
+	switch s.config.ProcessedAction {
+	case S3ProcessedTag:
+		if objectTags == nil {
+			objectTags = make(map[string]string, 1)
+		}
+		objectTags[s3ProcessedTagKey] = "true"
+		objectTagSet, err := tags.NewTags(objectTags, true)
+		if err != nil {
+			return err
+		}
+		return s.client.PutObjectTagging(s.ctx, s.config.Bucket, object.Key, objectTagSet, minio.PutObjectTaggingOptions{})
+	case S3ProcessedMove:
+		return s.moveObject(object.Key, s.config.ProcessedPrefix)
+	case S3ProcessedDelete:
+		return s.client.RemoveObject(s.ctx, s.config.Bucket, object.Key, minio.RemoveObjectOptions{})
+	}
+	return nil
+}
+
+// moveObject copies an object under destPrefix (keeping its path below the input prefix)
+// and deletes the original
+func (s *S3Input) moveObject(key, destPrefix string) error {
+	destKey := destPrefix + strings.TrimPrefix(key, s.config.Prefix)
+	_, err := s.client.CopyObject(s.ctx,
+		minio.CopyDestOptions{Bucket: s.config.Bucket, Object: destKey},
+		minio.CopySrcOptions{Bucket: s.config.Bucket, Object: key},
+	)
+	if err != nil {
+		return fmt.Errorf("copy to %s: %w", destKey, err)
+	}
+	if err := s.client.RemoveObject(s.ctx, s.config.Bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("delete after copy: %w", err)
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt and moves the object to error_prefix once
+// max_retries is reached, or immediately for permanent failures
+func (s *S3Input) recordFailure(object minio.ObjectInfo, err error, permanent bool) error {
+	s.mu.Lock()
+	s.failures[object.Key]++
+	if permanent {
+		s.failures[object.Key] = s.config.MaxRetries
+	}
+	attempts := s.failures[object.Key]
+	s.mu.Unlock()
+
+	if attempts < s.config.MaxRetries {
+		return err
+	}
+
+	if s.config.ErrorPrefix == "" {
+		slog.Error("Giving up on S3 object", "bucket", s.config.Bucket, "key", object.Key, "attempts", attempts, "error", err)
+		return err
+	}
+	if moveErr := s.moveObject(object.Key, s.config.ErrorPrefix); moveErr != nil {
+		return fmt.Errorf("%w (move to error prefix failed: %v)", err, moveErr)
+	}
+	s.mu.Lock()
+	delete(s.failures, object.Key)
+	s.mu.Unlock()
+
+	slog.Error("Moved S3 object to error prefix", "bucket", s.config.Bucket, "key", object.Key, "prefix", s.config.ErrorPrefix, "reason", err)
+	return nil
+}
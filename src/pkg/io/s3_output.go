@@ -0,0 +1,154 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"text/template"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// S3OutputConfig defines the configuration for S3 Output
+type S3OutputConfig struct {
+	S3Config
+	KeyFormat string `json:"key_format,omitempty"` // Object key template, same syntax as FILE_OUTPUT_FILENAME_FORMAT (default: {{.ID}}.{{.Extension}})
+}
+
+// S3Output implements the Output interface by writing payloads as objects
+type S3Output struct {
+	config      S3OutputConfig
+	keyTemplate *template.Template
+	client      *minio.Client
+	mu          sync.RWMutex
+}
+
+// NewS3Output creates a new S3 output from JSON configuration
+func NewS3Output(configJSON json.RawMessage) (*S3Output, error) {
+	var config S3OutputConfig
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse S3 output config: %w", err)
+	}
+
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	if config.KeyFormat == "" {
+		config.KeyFormat = "{{.ID}}.{{.Extension}}"
+	}
+
+	keyTemplate, err := parseFileNameTemplate(config.KeyFormat)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 key_format: %w", err)
+	}
+
+	return &S3Output{
+		config:      config,
+		keyTemplate: keyTemplate,
+	}, nil
+}
+
+// Start creates the S3 client and verifies the bucket exists
+func (s *S3Output) Start(ctx context.Context) error {
+	client, err := s.config.newClient()
+	if err != nil {
+		return err
+	}
+
+	if err := s.config.checkBucket(ctx, client); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.client = client
+	s.mu.Unlock()
+
+	slog.Info("Connected to S3 for output",
+		"endpoint", s.config.Endpoint,
+		"bucket", s.config.Bucket,
+		"key_format", s.config.KeyFormat)
+
+	return nil
+}
+
+// Write uploads the envelope payload as an object under the templated key
+func (s *S3Output) Write(ctx context.Context, env *envelope.Envelope) error {
+	s.mu.RLock()
+	client := s.client
+	s.mu.RUnlock()
+	if client == nil {
+		return fmt.Errorf("S3 output not started")
+	}
+	if env == nil || env.Payload == nil {
+		return fmt.Errorf("envelope payload cannot be nil")
+	}
+
+	key, err := s.objectKey(env)
+	if err != nil {
+		return err
+	}
+
+	contentType := env.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	info, err := client.PutObject(ctx, s.config.Bucket, key, bytes.NewReader(env.Payload), int64(len(env.Payload)), minio.PutObjectOptions{
+		ContentType: contentType,
+		UserMetadata: map[string]string{
+			"Envelope-Id":    env.ID,
+			"Source":         env.Source,
+			"Tenant-Id":      env.TenantID,
+			"Integration-Id": env.IntegrationID,
+		},
+	})
+	if err != nil {
+		slog.Error("Failed to write S3 object",
+			"bucket", s.config.Bucket,
+			"key", key,
+			"message_id", env.ID,
+			"error", err)
+		return fmt.Errorf("failed to write S3 object %s: %w", key, err)
+	}
+
+	slog.Info("Wrote S3 object",
+		"bucket", s.config.Bucket,
+		"key", key,
+		"size", info.Size,
+		"etag", info.ETag,
+		"message_id", env.ID)
+
+	return nil
+}
+
+// objectKey renders the key template for an envelope
+func (s *S3Output) objectKey(env *envelope.Envelope) (string, error) {
+	var buf bytes.Buffer
+	if err := s.keyTemplate.Execute(&buf, newFileNameData(env, sanitizeForFilename(env.Source))); err != nil {
+		return "", fmt.Errorf("failed to execute key template: %w", err)
+	}
+	return sanitizeObjectKey(buf.String())
+}
+
+// CheckHealth reports whether the bucket can be reached
+func (s *S3Output) CheckHealth(ctx context.Context) error {
+	s.mu.RLock()
+	client := s.client
+	s.mu.RUnlock()
+	return s.config.checkBucket(ctx, client)
+}
+
+// Close releases the S3 client
+func (s *S3Output) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.client = nil
+	slog.Info("S3 output closed")
+	return nil
+}
@@ -0,0 +1,683 @@
+package io
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// fakeS3Object is an object stored by fakeS3
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	etag        string
+	modified    time.Time
+	metadata    http.Header
+	tags        map[string]string
+}
+
+// fakeS3 is a minimal in-memory S3 server covering the API used by S3Input and S3Output
+type fakeS3 struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]*fakeS3Object
+}
+
+func startFakeS3(t *testing.T, buckets ...string) (*fakeS3, string) {
+	t.Helper()
+	fake := &fakeS3{buckets: make(map[string]map[string]*fakeS3Object)}
+	for _, bucket := range buckets {
+		fake.buckets[bucket] = make(map[string]*fakeS3Object)
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server.URL
+}
+
+func (f *fakeS3) put(bucket, key, contentType string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sum := md5.Sum(data)
+	f.buckets[bucket][key] = &fakeS3Object{
+		data:        data,
+		contentType: contentType,
+		etag:        hex.EncodeToString(sum[:]),
+		modified:    time.Now().UTC(),
+		metadata:    http.Header{},
+		tags:        map[string]string{},
+	}
+}
+
+func (f *fakeS3) get(bucket, key string) (*fakeS3Object, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	object, ok := f.buckets[bucket][key]
+	return object, ok
+}
+
+func (f *fakeS3) keys(bucket string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var keys []string
+	for key := range f.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	bucket, ok := f.buckets[bucketName]
+	if !ok {
+		writeFakeS3Error(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	query := r.URL.Query()
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		case query.Has("location"):
+			writeFakeS3XML(w, struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Value   string   `xml:",chardata"`
+			}{Value: "us-east-1"})
+		case query.Get("list-type") == "2":
+			f.list(w, bucketName, bucket, query.Get("prefix"))
+		default:
+			writeFakeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+		}
+		return
+	}
+
+	object, exists := bucket[key]
+	switch {
+	case query.Has("tagging"):
+		if !exists {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if r.Method == http.MethodPut {
+			var tagging fakeS3Tagging
+			if err := xml.NewDecoder(r.Body).Decode(&tagging); err != nil {
+				writeFakeS3Error(w, http.StatusBadRequest, "MalformedXML")
+				return
+			}
+			object.tags = map[string]string{}
+			for _, tag := range tagging.TagSet {
+				object.tags[tag.Key] = tag.Value
+			}
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		var tagging fakeS3Tagging
+		for k, v := range object.tags {
+			tagging.TagSet = append(tagging.TagSet, fakeS3Tag{Key: k, Value: v})
+		}
+		writeFakeS3XML(w, tagging)
+
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		source, _ := url.PathUnescape(r.Header.Get("X-Amz-Copy-Source"))
+		sourceBucket, sourceKey, _ := strings.Cut(strings.TrimPrefix(source, "/"), "/")
+		original, ok := f.buckets[sourceBucket][sourceKey]
+		if !ok {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		copied := *original
+		copied.modified = time.Now().UTC()
+		copied.tags = map[string]string{}
+		bucket[key] = &copied
+		writeFakeS3XML(w, struct {
+			XMLName      xml.Name `xml:"CopyObjectResult"`
+			LastModified string   `xml:"LastModified"`
+			ETag         string   `xml:"ETag"`
+		}{LastModified: copied.modified.Format("2006-01-02T15:04:05.000Z"), ETag: `"` + copied.etag + `"`})
+
+	case r.Method == http.MethodPut:
+		data, err := readFakeS3Body(r)
+		if err != nil {
+			writeFakeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		sum := md5.Sum(data)
+		stored := &fakeS3Object{
+			data:        data,
+			contentType: r.Header.Get("Content-Type"),
+			etag:        hex.EncodeToString(sum[:]),
+			modified:    time.Now().UTC(),
+			metadata:    http.Header{},
+			tags:        map[string]string{},
+		}
+		for name, values := range r.Header {
+			if strings.HasPrefix(strings.ToLower(name), "x-amz-meta-") {
+				stored.metadata[name] = values
+			}
+		}
+		bucket[key] = stored
+		w.Header().Set("ETag", `"`+stored.etag+`"`)
+		w.WriteHeader(http.StatusOK)
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		if !exists {
+			writeFakeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("ETag", `"`+object.etag+`"`)
+		w.Header().Set("Last-Modified", object.modified.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+
+	case r.Method == http.MethodDelete:
+		delete(bucket, key)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeFakeS3Error(w, http.StatusNotImplemented, "NotImplemented")
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, bucketName string, bucket map[string]*fakeS3Object, prefix string) {
+	type content struct {
+		Key          string `xml:"Key"`
+		LastModified string `xml:"LastModified"`
+		ETag         string `xml:"ETag"`
+		Size         int64  `xml:"Size"`
+		StorageClass string `xml:"StorageClass"`
+	}
+	result := struct {
+		XMLName     xml.Name  `xml:"ListBucketResult"`
+		Name        string    `xml:"Name"`
+		Prefix      string    `xml:"Prefix"`
+		KeyCount    int       `xml:"KeyCount"`
+		MaxKeys     int       `xml:"MaxKeys"`
+		IsTruncated bool      `xml:"IsTruncated"`
+		Contents    []content `xml:"Contents"`
+	}{Name: bucketName, Prefix: prefix, MaxKeys: 1000}
+
+	var keys []string
+	for key := range bucket {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		object := bucket[key]
+		result.Contents = append(result.Contents, content{
+			Key:          key,
+			LastModified: object.modified.Format("2006-01-02T15:04:05.000Z"),
+			ETag:         `"` + object.etag + `"`,
+			Size:         int64(len(object.data)),
+			StorageClass: "STANDARD",
+		})
+	}
+	result.KeyCount = len(result.Contents)
+	writeFakeS3XML(w, result)
+}
+
+type fakeS3Tag struct {
+	Key   string `xml:"Key"`
+	Value string `xml:"Value"`
+}
+
+type fakeS3Tagging struct {
+	XMLName xml.Name    `xml:"Tagging"`
+	TagSet  []fakeS3Tag `xml:"TagSet>Tag"`
+}
+
+// readFakeS3Body reads a request body, decoding the aws-chunked streaming encoding
+// clients use for signed uploads over plain HTTP
+func readFakeS3Body(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		return io.ReadAll(r.Body)
+	}
+
+	reader := bufio.NewReader(r.Body)
+	var data []byte
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			return data, nil
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, err
+		}
+		data = append(data, chunk...)
+		if _, err := reader.Discard(2); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func writeFakeS3XML(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	xml.NewEncoder(w).Encode(v)
+}
+
+func writeFakeS3Error(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+// s3TestConfig returns a JSON config pointing at the fake server
+func s3TestConfig(t *testing.T, endpoint string, extra map[string]interface{}) json.RawMessage {
+	t.Helper()
+	config := map[string]interface{}{
+		"endpoint":   endpoint,
+		"bucket":     "vrsky",
+		"access_key": "test",
+		"secret_key": "test-secret",
+	}
+	for k, v := range extra {
+		config[k] = v
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("Failed to marshal config: %v", err)
+	}
+	return data
+}
+
+func TestS3Config_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  S3Config
+		wantErr string
+	}{
+		{"missing endpoint", S3Config{Bucket: "b", AccessKey: "a", SecretKey: "s"}, "endpoint is required"},
+		{"missing bucket", S3Config{Endpoint: "http://localhost:9000", AccessKey: "a", SecretKey: "s"}, "bucket is required"},
+		{"missing credentials", S3Config{Endpoint: "http://localhost:9000", Bucket: "b"}, "access_key and secret_key are required"},
+		{"bad scheme", S3Config{Endpoint: "ftp://localhost", Bucket: "b", AccessKey: "a", SecretKey: "s"}, "must be http or https"},
+		{"no host", S3Config{Endpoint: "localhost:9000", Bucket: "b", AccessKey: "a", SecretKey: "s"}, "invalid S3 endpoint"},
+		{"valid", S3Config{Endpoint: "https://s3.amazonaws.com", Bucket: "b", AccessKey: "a", SecretKey: "s"}, ""},
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.config
+			err := config.validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validate() error = %v", err)
+				}
+				if config.Region != "us-east-1" || config.Timeout != 30 {
+					t.Errorf("Defaults not applied: %+v", config)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("credentials from environment", func(t *testing.T) {
+		t.Setenv("AWS_ACCESS_KEY_ID", "env-key")
+		t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+		config := S3Config{Endpoint: "http://localhost:9000", Bucket: "b"}
+		if err := config.validate(); err != nil {
+			t.Fatalf("validate() error = %v", err)
+		}
+		if config.AccessKey != "env-key" || config.SecretKey != "env-secret" {
+			t.Errorf("Credentials not read from environment: %+v", config)
+		}
+	})
+}
+
+func TestSanitizeObjectKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "acme/2026/02/03/order.json", want: "acme/2026/02/03/order.json"},
+		{key: "acme/a:b*c.json", want: "acme/a_b_c.json"},
+		{key: "../escape.json", wantErr: true},
+		{key: "acme/./order.json", wantErr: true},
+		{key: "/absolute.json", wantErr: true},
+		{key: "acme//order.json", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := sanitizeObjectKey(tt.key)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("sanitizeObjectKey(%q) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("sanitizeObjectKey(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestS3Output_WritesTemplatedKeys(t *testing.T) {
+	fake, endpoint := startFakeS3(t, "vrsky")
+
+	output, err := NewS3Output(s3TestConfig(t, endpoint, map[string]interface{}{
+		"key_format": `{{.TenantID}}/{{date "2006/01/02" .CreatedAt}}/{{.JSON "order.id"}}.{{.Extension}}`,
+	}))
+	if err != nil {
+		t.Fatalf("NewS3Output() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := output.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer output.Close()
+
+	env := envelope.New()
+	env.ID = "msg-1"
+	env.TenantID = "acme"
+	env.Source = "erp"
+	env.ContentType = "application/json"
+	env.CreatedAt = time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC)
+	env.Payload = []byte(`{"order":{"id":"A-42"}}`)
+
+	if err := output.Write(ctx, env); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	object, ok := fake.get("vrsky", "acme/2026/02/03/A-42.json")
+	if !ok {
+		t.Fatalf("Object not written, bucket contains %v", fake.keys("vrsky"))
+	}
+	if string(object.data) != string(env.Payload) {
+		t.Errorf("Object data = %q, want %q", object.data, env.Payload)
+	}
+	if object.contentType != "application/json" {
+		t.Errorf("Content-Type = %q, want application/json", object.contentType)
+	}
+	if object.metadata.Get("X-Amz-Meta-Envelope-Id") != "msg-1" {
+		t.Errorf("Envelope ID metadata missing: %v", object.metadata)
+	}
+}
+
+func TestS3Output_RejectsEscapingKeys(t *testing.T) {
+	_, endpoint := startFakeS3(t, "vrsky")
+
+	output, err := NewS3Output(s3TestConfig(t, endpoint, map[string]interface{}{
+		"key_format": `{{.Metadata.folder}}/{{.ID}}.{{.Extension}}`,
+	}))
+	if err != nil {
+		t.Fatalf("NewS3Output() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := output.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer output.Close()
+
+	env := envelope.New()
+	env.ID = "msg-1"
+	env.Payload = []byte("x")
+	env.Metadata = map[string]string{"folder": ".."}
+
+	if err := output.Write(ctx, env); err == nil {
+		t.Error("Write() should reject keys with relative path segments")
+	}
+}
+
+func TestS3Output_MissingBucket(t *testing.T) {
+	_, endpoint := startFakeS3(t)
+
+	output, err := NewS3Output(s3TestConfig(t, endpoint, nil))
+	if err != nil {
+		t.Fatalf("NewS3Output() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := output.Start(ctx); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Start() error = %v, want missing bucket", err)
+	}
+}
+
+func TestNewS3Input_InvalidConfig(t *testing.T) {
+	for name, extra := range map[string]map[string]interface{}{
+		"processed action": {"processed_action": "archive"},
+		"poll interval":    {"poll_interval": "soon"},
+		"pattern":          {"pattern": "[a-"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewS3Input(s3TestConfig(t, "http://localhost:9000", extra)); err == nil {
+				t.Error("NewS3Input() should fail")
+			}
+		})
+	}
+}
+
+// readS3Envelope reads one envelope or fails the test
+func readS3Envelope(t *testing.T, input *S3Input) *envelope.Envelope {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	env, err := input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	return env
+}
+
+// expectNoS3Envelope fails the test if another envelope arrives within a few polls
+func expectNoS3Envelope(t *testing.T, input *S3Input) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if env, err := input.Read(ctx); err == nil {
+		t.Errorf("Unexpected envelope for %s", env.Metadata["key"])
+	}
+}
+
+// waitForS3 polls until cond holds
+func waitForS3(t *testing.T, description string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", description)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestS3Input_TagsProcessedObjects(t *testing.T) {
+	fake, endpoint := startFakeS3(t, "vrsky")
+	fake.put("vrsky", "inbox/stock.csv", "", []byte("sku,qty\nA,1\n"))
+	fake.put("vrsky", "inbox/readme.txt", "text/plain", []byte("ignore me"))
+	fake.put("vrsky", "inbox/old.csv", "text/csv", []byte("sku,qty\n"))
+	old, _ := fake.get("vrsky", "inbox/old.csv")
+	old.tags[s3ProcessedTagKey] = "true"
+	old.tags["owner"] = "partner"
+
+	input, err := NewS3Input(s3TestConfig(t, endpoint, map[string]interface{}{
+		"prefix":        "inbox/",
+		"pattern":       "*.csv",
+		"poll_interval": "50ms",
+	}))
+	if err != nil {
+		t.Fatalf("NewS3Input() error = %v", err)
+	}
+	if err := input.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer input.Close()
+
+	env := readS3Envelope(t, input)
+	if string(env.Payload) != "sku,qty\nA,1\n" {
+		t.Errorf("Payload = %q", env.Payload)
+	}
+	if env.ContentType != "text/csv" {
+		t.Errorf("ContentType = %q, want text/csv (from extension)", env.ContentType)
+	}
+	if env.Source != "s3" || env.Metadata["key"] != "inbox/stock.csv" || env.Metadata["filename"] != "stock.csv" || env.Metadata["bucket"] != "vrsky" {
+		t.Errorf("Unexpected source/metadata: %q %v", env.Source, env.Metadata)
+	}
+
+	waitForS3(t, "processed tag", func() bool {
+		object, _ := fake.get("vrsky", "inbox/stock.csv")
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+		return object.tags[s3ProcessedTagKey] == "true"
+	})
+
+	// Already tagged and non-matching objects are never emitted, nor is stock.csv again
+	expectNoS3Envelope(t, input)
+	if old.tags["owner"] != "partner" {
+		t.Errorf("Existing tags should be preserved: %v", old.tags)
+	}
+}
+
+func TestS3Input_MovesProcessedObjects(t *testing.T) {
+	fake, endpoint := startFakeS3(t, "vrsky")
+	fake.put("vrsky", "inbox/2026/orders.json", "application/json", []byte(`{"id":1}`))
+
+	input, err := NewS3Input(s3TestConfig(t, endpoint, map[string]interface{}{
+		"prefix":           "inbox/",
+		"poll_interval":    "50ms",
+		"processed_action": "move",
+		"processed_prefix": "done/",
+	}))
+	if err != nil {
+		t.Fatalf("NewS3Input() error = %v", err)
+	}
+	if err := input.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer input.Close()
+
+	env := readS3Envelope(t, input)
+	if env.ContentType != "application/json" {
+		t.Errorf("ContentType = %q, want application/json", env.ContentType)
+	}
+
+	waitForS3(t, "object move", func() bool {
+		_, moved := fake.get("vrsky", "done/2026/orders.json")
+		_, original := fake.get("vrsky", "inbox/2026/orders.json")
+		return moved && !original
+	})
+	expectNoS3Envelope(t, input)
+}
+
+func TestS3Input_DeletesProcessedObjects(t *testing.T) {
+	fake, endpoint := startFakeS3(t, "vrsky")
+	fake.put("vrsky", "a.txt", "text/plain", []byte("a"))
+
+	input, err := NewS3Input(s3TestConfig(t, endpoint, map[string]interface{}{
+		"poll_interval":    "50ms",
+		"processed_action": "delete",
+	}))
+	if err != nil {
+		t.Fatalf("NewS3Input() error = %v", err)
+	}
+	if err := input.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer input.Close()
+
+	readS3Envelope(t, input)
+	waitForS3(t, "object deletion", func() bool {
+		return len(fake.keys("vrsky")) == 0
+	})
+}
+
+func TestS3Input_ForgetsObjectsNoLongerListed(t *testing.T) {
+	fake, endpoint := startFakeS3(t, "vrsky")
+	fake.put("vrsky", "inbox/a.txt", "text/plain", []byte("a"))
+
+	input, err := NewS3Input(s3TestConfig(t, endpoint, map[string]interface{}{
+		"prefix":           "inbox/",
+		"poll_interval":    "50ms",
+		"processed_action": "move",
+		"processed_prefix": "done/",
+	}))
+	if err != nil {
+		t.Fatalf("NewS3Input() error = %v", err)
+	}
+	if err := input.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer input.Close()
+
+	// Once moved out of the prefix, the object is no longer remembered
+	readS3Envelope(t, input)
+	waitForS3(t, "processed state pruned", func() bool {
+		input.mu.Lock()
+		defer input.mu.Unlock()
+		return len(input.processed) == 0
+	})
+	expectNoS3Envelope(t, input)
+}
+
+func TestS3Input_OversizedObjectMovedToErrorPrefix(t *testing.T) {
+	fake, endpoint := startFakeS3(t, "vrsky")
+	fake.put("vrsky", "inbox/huge.bin", "", []byte("0123456789"))
+	fake.put("vrsky", "inbox/small.bin", "", []byte("0123"))
+
+	input, err := NewS3Input(s3TestConfig(t, endpoint, map[string]interface{}{
+		"prefix":          "inbox/",
+		"poll_interval":   "50ms",
+		"max_object_size": 4,
+		"error_prefix":    "failed/",
+	}))
+	if err != nil {
+		t.Fatalf("NewS3Input() error = %v", err)
+	}
+	if err := input.Start(context.Background()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer input.Close()
+
+	env := readS3Envelope(t, input)
+	if env.Metadata["key"] != "inbox/small.bin" {
+		t.Errorf("Emitted %s, want inbox/small.bin", env.Metadata["key"])
+	}
+	waitForS3(t, "move to error prefix", func() bool {
+		_, moved := fake.get("vrsky", "failed/huge.bin")
+		return moved
+	})
+	expectNoS3Envelope(t, input)
+}
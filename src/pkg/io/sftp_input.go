@@ -0,0 +1,42 @@
+package io
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// NewSFTPConsumer creates a FileConsumer that polls a directory on a remote SFTP server.
+// FILE_INPUT_* variables keep their meaning (FILE_INPUT_DIR, FILE_INPUT_ARCHIVE_DIR and
+// FILE_INPUT_ERROR_DIR are remote paths); the connection is configured with
+// FILE_INPUT_SFTP_* variables.
+func NewSFTPConsumer(logger *slog.Logger) (*FileConsumer, error) {
+	return newSFTPConsumer(logger, os.Getenv)
+}
+
+// newSFTPConsumer creates an SFTP consumer from the FILE_INPUT_* settings getenv returns
+func newSFTPConsumer(logger *slog.Logger, getenv func(string) string) (*FileConsumer, error) {
+	if getenv("FILE_INPUT_DIR") == "" {
+		return nil, fmt.Errorf("FILE_INPUT_DIR is required for SFTP input")
+	}
+
+	config, err := lookupSFTPConfig(getenv, "FILE_INPUT_SFTP_")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SFTP input configuration: %w", err)
+	}
+
+	consumer, err := newFileConsumer(logger, getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newSFTPFileStore(config, consumer.logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SFTP input configuration: %w", err)
+	}
+	consumer.store = store
+	consumer.source = "SFTPConsumer"
+	consumer.component = "sftp-input"
+
+	return consumer, nil
+}
@@ -0,0 +1,39 @@
+package io
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// NewSFTPProducer creates a FileProducer that writes files to a remote SFTP server.
+// FILE_OUTPUT_* variables keep their meaning (FILE_OUTPUT_DIR is a remote path); the
+// connection is configured with FILE_OUTPUT_SFTP_* variables.
+func NewSFTPProducer(logger *slog.Logger) (*FileProducer, error) {
+	return newSFTPProducer(logger, os.Getenv)
+}
+
+// newSFTPProducer creates an SFTP producer from the FILE_OUTPUT_* settings getenv returns
+func newSFTPProducer(logger *slog.Logger, getenv func(string) string) (*FileProducer, error) {
+	if getenv("FILE_OUTPUT_DIR") == "" {
+		return nil, fmt.Errorf("FILE_OUTPUT_DIR is required for SFTP output")
+	}
+
+	config, err := lookupSFTPConfig(getenv, "FILE_OUTPUT_SFTP_")
+	if err != nil {
+		return nil, fmt.Errorf("invalid SFTP output configuration: %w", err)
+	}
+
+	producer, err := newFileProducer(logger, getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newSFTPFileStore(config, producer.logger)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SFTP output configuration: %w", err)
+	}
+	producer.store = store
+
+	return producer, nil
+}
@@ -0,0 +1,389 @@
+package io
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpConfig holds the connection settings for an SFTP server
+type sftpConfig struct {
+	Host                  string
+	Port                  int
+	User                  string
+	Password              string
+	PrivateKeyFile        string
+	PrivateKeyPassphrase  string
+	KnownHostsFile        string
+	InsecureIgnoreHostKey bool
+	Timeout               time.Duration
+}
+
+// lookupSFTPConfig reads SFTP connection settings with the given prefix from getenv
+// (e.g. FILE_INPUT_SFTP_HOST for prefix "FILE_INPUT_SFTP_")
+func lookupSFTPConfig(getenv func(string) string, prefix string) (sftpConfig, error) {
+	cfg := sftpConfig{
+		Host:                  getenv(prefix + "HOST"),
+		Port:                  22,
+		User:                  getenv(prefix + "USER"),
+		Password:              getenv(prefix + "PASSWORD"),
+		PrivateKeyFile:        getenv(prefix + "PRIVATE_KEY_FILE"),
+		PrivateKeyPassphrase:  getenv(prefix + "PRIVATE_KEY_PASSPHRASE"),
+		KnownHostsFile:        getenv(prefix + "KNOWN_HOSTS_FILE"),
+		InsecureIgnoreHostKey: getenv(prefix+"INSECURE_IGNORE_HOST_KEY") == "true",
+		Timeout:               30 * time.Second,
+	}
+
+	if portStr := getenv(prefix + "PORT"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port <= 0 || port > 65535 {
+			return sftpConfig{}, fmt.Errorf("invalid %sPORT %q", prefix, portStr)
+		}
+		cfg.Port = port
+	}
+
+	if timeoutStr := getenv(prefix + "TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil || timeout <= 0 {
+			return sftpConfig{}, fmt.Errorf("invalid %sTIMEOUT %q", prefix, timeoutStr)
+		}
+		cfg.Timeout = timeout
+	}
+
+	if cfg.Host == "" {
+		return sftpConfig{}, fmt.Errorf("%sHOST is required", prefix)
+	}
+	if cfg.User == "" {
+		return sftpConfig{}, fmt.Errorf("%sUSER is required", prefix)
+	}
+	if cfg.Password == "" && cfg.PrivateKeyFile == "" {
+		return sftpConfig{}, fmt.Errorf("%sPASSWORD or %sPRIVATE_KEY_FILE is required", prefix, prefix)
+	}
+	if cfg.KnownHostsFile == "" && !cfg.InsecureIgnoreHostKey {
+		return sftpConfig{}, fmt.Errorf("%sKNOWN_HOSTS_FILE is required (or set %sINSECURE_IGNORE_HOST_KEY=true)", prefix, prefix)
+	}
+
+	return cfg, nil
+}
+
+// clientConfig builds the SSH client configuration, loading keys from disk
+func (c sftpConfig) clientConfig() (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	if c.PrivateKeyFile != "" {
+		keyData, err := os.ReadFile(c.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read private key: %w", err)
+		}
+		var signer ssh.Signer
+		if c.PrivateKeyPassphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(keyData, []byte(c.PrivateKeyPassphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(keyData)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if c.Password != "" {
+		auth = append(auth, ssh.Password(c.Password))
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !c.InsecureIgnoreHostKey {
+		callback, err := knownhosts.New(c.KnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("load known hosts: %w", err)
+		}
+		hostKeyCallback = callback
+	}
+
+	return &ssh.ClientConfig{
+		User:            c.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         c.Timeout,
+	}, nil
+}
+
+// address returns the host:port to dial
+func (c sftpConfig) address() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// sftpFileStore is the fileStore backed by a remote SFTP server. The connection is
+// established on first use and re-established transparently after it drops, so a
+// server restart only fails the operations in flight.
+type sftpFileStore struct {
+	config       sftpConfig
+	clientConfig *ssh.ClientConfig
+	logger       *slog.Logger
+
+	mu      sync.Mutex
+	sshConn *ssh.Client
+	client  *sftp.Client
+}
+
+// newSFTPFileStore validates the configuration and loads keys; it does not connect
+func newSFTPFileStore(config sftpConfig, logger *slog.Logger) (*sftpFileStore, error) {
+	clientConfig, err := config.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &sftpFileStore{config: config, clientConfig: clientConfig, logger: logger}, nil
+}
+
+// sftpClient returns the current client, dialing the server if not connected
+func (s *sftpFileStore) sftpClient() (*sftp.Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.client != nil {
+		return s.client, nil
+	}
+
+	sshConn, err := ssh.Dial("tcp", s.config.address(), s.clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connect to SFTP server %s: %w", s.config.address(), err)
+	}
+	client, err := sftp.NewClient(sshConn)
+	if err != nil {
+		sshConn.Close()
+		return nil, fmt.Errorf("start SFTP session on %s: %w", s.config.address(), err)
+	}
+
+	s.sshConn = sshConn
+	s.client = client
+	s.logger.Info("Connected to SFTP server", "addr", s.config.address(), "user", s.config.User)
+
+	// Forget the connection once it drops so the next operation reconnects
+	go func() {
+		err := sshConn.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.sshConn == sshConn {
+			s.sshConn = nil
+			s.client = nil
+			s.logger.Warn("SFTP connection lost", "addr", s.config.address(), "err", err)
+		}
+	}()
+
+	return client, nil
+}
+
+func (s *sftpFileStore) Glob(pattern string) ([]string, error) {
+	client, err := s.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Glob(pattern)
+}
+
+func (s *sftpFileStore) ReadDir(dir string) ([]os.FileInfo, error) {
+	client, err := s.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.ReadDir(dir)
+}
+
+func (s *sftpFileStore) Stat(p string) (os.FileInfo, error) {
+	client, err := s.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Stat(p)
+}
+
+func (s *sftpFileStore) Open(p string) (io.ReadCloser, error) {
+	client, err := s.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.Open(p)
+}
+
+func (s *sftpFileStore) ReadFile(p string) ([]byte, error) {
+	file, err := s.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+func (s *sftpFileStore) WriteFile(p string, data []byte, perm os.FileMode) error {
+	file, err := s.Create(p, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *sftpFileStore) Create(p string, perm os.FileMode) (storeFile, error) {
+	client, err := s.sftpClient()
+	if err != nil {
+		return nil, err
+	}
+	file, err := client.OpenFile(p, os.O_CREATE|os.O_WRONLY|os.O_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(perm); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("set permissions: %w", err)
+	}
+	_, canSync := client.HasExtension("fsync@openssh.com")
+	return &sftpStoreFile{File: file, canSync: canSync}, nil
+}
+
+func (s *sftpFileStore) MkdirAll(p string, perm os.FileMode) error {
+	client, err := s.sftpClient()
+	if err != nil {
+		return err
+	}
+	// The SFTP server applies its own umask to new directories
+	return client.MkdirAll(p)
+}
+
+func (s *sftpFileStore) Rename(oldPath, newPath string) error {
+	client, err := s.sftpClient()
+	if err != nil {
+		return err
+	}
+	// Plain SFTP rename fails when the target exists; prefer POSIX semantics to match os.Rename
+	if _, ok := client.HasExtension("posix-rename@openssh.com"); ok {
+		return client.PosixRename(oldPath, newPath)
+	}
+	return client.Rename(oldPath, newPath)
+}
+
+func (s *sftpFileStore) Remove(p string) error {
+	client, err := s.sftpClient()
+	if err != nil {
+		return err
+	}
+	return client.Remove(p)
+}
+
+func (s *sftpFileStore) RemoveAll(p string) error {
+	client, err := s.sftpClient()
+	if err != nil {
+		return err
+	}
+	return client.RemoveAll(p)
+}
+
+func (s *sftpFileStore) ResolvePath(p string) (string, error) {
+	client, err := s.sftpClient()
+	if err != nil {
+		return "", err
+	}
+	if !path.IsAbs(p) {
+		wd, err := client.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("resolve working directory: %w", err)
+		}
+		p = path.Join(wd, p)
+	}
+	p = path.Clean(p)
+
+	// Existing paths are canonicalized by the server, which resolves symlinks. The file
+	// may not exist yet, in which case its directory is resolved instead.
+	if resolved, exists, err := s.realPath(client, p); err != nil || exists {
+		return resolved, err
+	}
+	resolvedDir, exists, err := s.realPath(client, path.Dir(p))
+	if err != nil || !exists {
+		return p, err
+	}
+	return path.Join(resolvedDir, path.Base(p)), nil
+}
+
+// realPath canonicalizes an existing path on the server
+func (s *sftpFileStore) realPath(client *sftp.Client, p string) (string, bool, error) {
+	if _, err := client.Stat(p); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("stat %s: %w", p, err)
+	}
+	resolved, err := client.RealPath(p)
+	if err != nil {
+		return "", false, fmt.Errorf("resolve symlinks: %w", err)
+	}
+	return resolved, true, nil
+}
+
+func (s *sftpFileStore) FreeSpace(p string) (int64, error) {
+	client, err := s.sftpClient()
+	if err != nil {
+		return 0, err
+	}
+	if _, ok := client.HasExtension("statvfs@openssh.com"); !ok {
+		return 0, errFreeSpaceUnknown
+	}
+	stat, err := client.StatVFS(p)
+	if err != nil {
+		return 0, fmt.Errorf("check disk space: %w", err)
+	}
+	if stat.Bavail > math.MaxInt64 || stat.Frsize > math.MaxInt64 {
+		return math.MaxInt64, nil
+	}
+	return freeBytes(int64(stat.Bavail), int64(stat.Frsize)), nil
+}
+
+func (s *sftpFileStore) Describe() string {
+	return "sftp://" + s.config.address()
+}
+
+func (s *sftpFileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	if s.client != nil {
+		errs = append(errs, s.client.Close())
+	}
+	if s.sshConn != nil {
+		if err := s.sshConn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	s.client = nil
+	s.sshConn = nil
+	return errors.Join(errs...)
+}
+
+// sftpStoreFile adapts an SFTP file to storeFile. Servers without the fsync extension
+// provide no durability guarantee beyond a successful close, so Sync is a no-op there.
+type sftpStoreFile struct {
+	*sftp.File
+	canSync bool
+}
+
+func (f *sftpStoreFile) Sync() error {
+	if !f.canSync {
+		return nil
+	}
+	return f.File.Sync()
+}
@@ -0,0 +1,420 @@
+package io
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+const (
+	testSFTPUser     = "partner"
+	testSFTPPassword = "s3cret"
+)
+
+// testSFTPServer is an in-process SSH server exposing the local file system over SFTP
+type testSFTPServer struct {
+	listener net.Listener
+	hostKey  ssh.PublicKey
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func startTestSFTPServer(t *testing.T) *testSFTPServer {
+	t.Helper()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate host key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(privateKey)
+	if err != nil {
+		t.Fatalf("Failed to create host key signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == testSFTPUser && string(password) == testSFTPPassword {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(signer)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	server := &testSFTPServer{listener: listener, hostKey: signer.PublicKey()}
+	t.Cleanup(server.close)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			server.mu.Lock()
+			server.conns = append(server.conns, conn)
+			server.mu.Unlock()
+			go server.serve(conn, config)
+		}
+	}()
+
+	return server
+}
+
+func (s *testSFTPServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, channelRequests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			for req := range channelRequests {
+				isSFTP := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+				req.Reply(isSFTP, nil)
+				if isSFTP {
+					server, err := sftp.NewServer(channel)
+					if err != nil {
+						channel.Close()
+						return
+					}
+					server.Serve()
+					server.Close()
+				}
+			}
+		}()
+	}
+}
+
+// dropConnections closes every open client connection, simulating a server restart
+func (s *testSFTPServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		conn.Close()
+	}
+	s.conns = nil
+}
+
+func (s *testSFTPServer) close() {
+	s.listener.Close()
+	s.dropConnections()
+}
+
+func (s *testSFTPServer) port() string {
+	return strconv.Itoa(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+// writeKnownHosts writes a known_hosts file trusting the given host key for the server
+func (s *testSFTPServer) writeKnownHosts(t *testing.T, hostKey ssh.PublicKey) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{s.listener.Addr().String()}, hostKey)
+	if err := os.WriteFile(path, []byte(line+"\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write known_hosts: %v", err)
+	}
+	return path
+}
+
+// setSFTPEnv points the SFTP connection variables with the given prefix at the server
+func (s *testSFTPServer) setSFTPEnv(t *testing.T, prefix string) {
+	t.Helper()
+	t.Setenv(prefix+"HOST", "127.0.0.1")
+	t.Setenv(prefix+"PORT", s.port())
+	t.Setenv(prefix+"USER", testSFTPUser)
+	t.Setenv(prefix+"PASSWORD", testSFTPPassword)
+	t.Setenv(prefix+"KNOWN_HOSTS_FILE", s.writeKnownHosts(t, s.hostKey))
+}
+
+func TestLoadSFTPConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing host",
+			env:     map[string]string{"USER": "u", "PASSWORD": "p", "INSECURE_IGNORE_HOST_KEY": "true"},
+			wantErr: "HOST is required",
+		},
+		{
+			name:    "missing credentials",
+			env:     map[string]string{"HOST": "h", "USER": "u", "INSECURE_IGNORE_HOST_KEY": "true"},
+			wantErr: "PASSWORD or TEST_SFTP_PRIVATE_KEY_FILE is required",
+		},
+		{
+			name:    "missing host key verification",
+			env:     map[string]string{"HOST": "h", "USER": "u", "PASSWORD": "p"},
+			wantErr: "KNOWN_HOSTS_FILE is required",
+		},
+		{
+			name:    "invalid port",
+			env:     map[string]string{"HOST": "h", "USER": "u", "PASSWORD": "p", "INSECURE_IGNORE_HOST_KEY": "true", "PORT": "ssh"},
+			wantErr: "invalid TEST_SFTP_PORT",
+		},
+		{
+			name: "valid",
+			env:  map[string]string{"HOST": "h", "USER": "u", "PASSWORD": "p", "INSECURE_IGNORE_HOST_KEY": "true", "PORT": "2222", "TIMEOUT": "5s"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			getenv := func(name string) string { return tt.env[strings.TrimPrefix(name, "TEST_SFTP_")] }
+			cfg, err := lookupSFTPConfig(getenv, "TEST_SFTP_")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("lookupSFTPConfig() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("lookupSFTPConfig() error = %v", err)
+			}
+			if cfg.address() != "h:2222" || cfg.Timeout != 5*time.Second {
+				t.Errorf("Unexpected config: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestSFTPFileStore_RejectsUnknownHostKey(t *testing.T) {
+	server := startTestSFTPServer(t)
+
+	otherKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	otherPublicKey, err := ssh.NewPublicKey(otherKey)
+	if err != nil {
+		t.Fatalf("Failed to convert key: %v", err)
+	}
+
+	port, _ := strconv.Atoi(server.port())
+	store, err := newSFTPFileStore(sftpConfig{
+		Host:           "127.0.0.1",
+		Port:           port,
+		User:           testSFTPUser,
+		Password:       testSFTPPassword,
+		KnownHostsFile: server.writeKnownHosts(t, otherPublicKey),
+		Timeout:        5 * time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatalf("newSFTPFileStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.Stat(t.TempDir()); err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Errorf("Stat() error = %v, want host key mismatch", err)
+	}
+}
+
+func TestSFTPFileStore_ReconnectsAfterConnectionLoss(t *testing.T) {
+	server := startTestSFTPServer(t)
+	dir := t.TempDir()
+
+	port, _ := strconv.Atoi(server.port())
+	store, err := newSFTPFileStore(sftpConfig{
+		Host:           "127.0.0.1",
+		Port:           port,
+		User:           testSFTPUser,
+		Password:       testSFTPPassword,
+		KnownHostsFile: server.writeKnownHosts(t, server.hostKey),
+		Timeout:        5 * time.Second,
+	}, slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError})))
+	if err != nil {
+		t.Fatalf("newSFTPFileStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if err := store.WriteFile(filepath.Join(dir, "a.txt"), []byte("a"), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	server.dropConnections()
+
+	// Operations may fail until the drop is noticed, then the store reconnects
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		content, err := store.ReadFile(filepath.Join(dir, "a.txt"))
+		if err == nil {
+			if string(content) != "a" {
+				t.Errorf("ReadFile() = %q, want %q", content, "a")
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Store did not reconnect: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestSFTPProducer_WritesRemoteFiles(t *testing.T) {
+	server := startTestSFTPServer(t)
+	remoteDir := t.TempDir()
+
+	server.setSFTPEnv(t, "FILE_OUTPUT_SFTP_")
+	t.Setenv("FILE_OUTPUT_DIR", remoteDir)
+	t.Setenv("FILE_OUTPUT_FILENAME_FORMAT", `{{.TenantID}}-{{.JSON "order.id"}}.{{.Extension}}`)
+	t.Setenv("FILE_OUTPUT_CREATE_SUBDIRS", "true")
+	t.Setenv("FILE_OUTPUT_ORGANIZE_BY", "source")
+	t.Setenv("FILE_OUTPUT_COMPRESSION", "gzip")
+	t.Setenv("FILE_OUTPUT_PERMISSIONS", "0600")
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	producer, err := NewSFTPProducer(logger)
+	if err != nil {
+		t.Fatalf("NewSFTPProducer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := producer.Start(ctx); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer producer.Close()
+
+	payload := []byte(`{"order":{"id":"A-42"}}`)
+	env := envelope.New()
+	env.ID = "msg-1"
+	env.TenantID = "acme"
+	env.Source = "erp"
+	env.ContentType = "application/json"
+	env.Payload = payload
+
+	if err := producer.Write(ctx, env); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	written := filepath.Join(remoteDir, "erp", "acme-A-42.json.gz")
+	info, err := os.Stat(written)
+	if err != nil {
+		t.Fatalf("Expected remote file %s: %v", written, err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("Permissions = %o, want 600", info.Mode().Perm())
+	}
+	raw, err := os.ReadFile(written)
+	if err != nil {
+		t.Fatalf("Failed to read remote file: %v", err)
+	}
+	content, err := decompress(CompressionGzip, raw, defaultMaxDecompressedSize)
+	if err != nil || string(content) != string(payload) {
+		t.Errorf("Remote content = %q (err=%v), want %q", content, err, payload)
+	}
+
+}
+
+func TestSFTPConsumer_RequiresRemoteDir(t *testing.T) {
+	t.Setenv("FILE_INPUT_DIR", "")
+	if _, err := NewSFTPConsumer(nil); err == nil {
+		t.Error("NewSFTPConsumer() should require FILE_INPUT_DIR")
+	}
+
+	t.Setenv("FILE_INPUT_DIR", "/upload")
+	t.Setenv("FILE_INPUT_SFTP_HOST", "")
+	if _, err := NewSFTPConsumer(nil); err == nil || !strings.Contains(err.Error(), "FILE_INPUT_SFTP_HOST") {
+		t.Errorf("NewSFTPConsumer() error = %v, want missing host", err)
+	}
+}
+
+func TestSFTPConsumer_ProcessesRemoteFiles(t *testing.T) {
+	server := startTestSFTPServer(t)
+	remoteDir := t.TempDir()
+	archiveDir := t.TempDir()
+	errorDir := t.TempDir()
+
+	server.setSFTPEnv(t, "FILE_INPUT_SFTP_")
+	t.Setenv("FILE_INPUT_DIR", remoteDir)
+	t.Setenv("FILE_INPUT_PATTERN", "*.csv")
+	t.Setenv("FILE_INPUT_POLL_INTERVAL", "100ms")
+	t.Setenv("FILE_INPUT_ARCHIVE_DIR", archiveDir)
+	t.Setenv("FILE_INPUT_ERROR_DIR", errorDir)
+	t.Setenv("FILE_INPUT_EXPAND_ARCHIVES", "true")
+
+	past := time.Now().Add(-time.Minute)
+	drop := filepath.Join(remoteDir, "stock.csv")
+	if err := os.WriteFile(drop, []byte("sku,qty\nA,1\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write drop: %v", err)
+	}
+	if err := os.Chtimes(drop, past, past); err != nil {
+		t.Fatalf("Failed to backdate drop: %v", err)
+	}
+	writeTestZip(t, filepath.Join(remoteDir, "evil.zip"), []testArchiveEntry{
+		{"../../etc/cron.d/evil", "pwned"},
+	})
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelError}))
+	consumer, err := NewSFTPConsumer(logger)
+	if err != nil {
+		t.Fatalf("NewSFTPConsumer() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := consumer.Start(ctx); err != nil {
+		t.Skipf("Consumer could not start (NATS required): %v", err)
+	}
+	defer consumer.Close()
+
+	env, err := consumer.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(env.Payload) != "sku,qty\nA,1\n" || env.ContentType != "text/csv" {
+		t.Errorf("Unexpected envelope: payload=%q contentType=%q", env.Payload, env.ContentType)
+	}
+	if env.Source != "SFTPConsumer" || env.Metadata["filename"] != "stock.csv" {
+		t.Errorf("Unexpected source/metadata: %q %v", env.Source, env.Metadata)
+	}
+
+	today := time.Now().Format("2006-01-02")
+	for _, want := range []string{
+		filepath.Join(archiveDir, today, "stock.csv"),
+		filepath.Join(errorDir, today, "evil.zip"),
+		filepath.Join(errorDir, today, "evil.zip.error"),
+	} {
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			if _, err := os.Stat(want); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("Expected remote file %s", want)
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package io
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// templateFuncs returns the helper functions available to user-supplied templates
+func templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"lower":   strings.ToLower,
+		"upper":   strings.ToUpper,
+		"trim":    strings.TrimSpace,
+		"replace": func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+		"slug":    slugify,
+		"date":    func(layout string, t time.Time) string { return t.Format(layout) },
+		"utc":     func(t time.Time) time.Time { return t.UTC() },
+		"default": func(def string, s string) string {
+			if s == "" {
+				return def
+			}
+			return s
+		},
+		"pathescape": url.PathEscape,
+		"tojson": func(v any) (string, error) {
+			encoded, err := json.Marshal(v)
+			return string(encoded), err
+		},
+	}
+}
+
+// slugify lowercases s and collapses every run of non-alphanumeric characters into a single dash
+func slugify(s string) string {
+	var b strings.Builder
+	pendingDash := false
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if pendingDash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			pendingDash = false
+			b.WriteRune(r)
+			continue
+		}
+		pendingDash = true
+	}
+	return b.String()
+}
+
+// lookupJSONPath resolves a dotted path (e.g. "order.lines.0.sku") inside a JSON payload.
+// Numeric segments index into arrays. Scalars are returned in their plain string form,
+// objects and arrays as compact JSON.
+func lookupJSONPath(payload []byte, path string) (string, error) {
+	var value any
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return "", fmt.Errorf("payload is not valid JSON: %w", err)
+	}
+
+	if path != "" {
+		for _, segment := range strings.Split(path, ".") {
+			switch node := value.(type) {
+			case map[string]any:
+				next, ok := node[segment]
+				if !ok {
+					return "", fmt.Errorf("json path %q: key %q not found", path, segment)
+				}
+				value = next
+			case []any:
+				idx, err := strconv.Atoi(segment)
+				if err != nil || idx < 0 || idx >= len(node) {
+					return "", fmt.Errorf("json path %q: invalid array index %q", path, segment)
+				}
+				value = node[idx]
+			default:
+				return "", fmt.Errorf("json path %q: cannot descend into %T at %q", path, value, segment)
+			}
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return "", fmt.Errorf("json path %q: %w", path, err)
+		}
+		return string(encoded), nil
+	}
+}
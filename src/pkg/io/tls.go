@@ -0,0 +1,251 @@
+package io
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSServerConfig enables HTTPS (and optionally mTLS) on the HTTP input
+type TLSServerConfig struct {
+	CertFile       string `json:"cert_file"`                 // PEM certificate chain
+	KeyFile        string `json:"key_file"`                  // PEM private key
+	ClientCAFile   string `json:"client_ca_file,omitempty"`  // CA bundle for verifying client certificates (enables mTLS)
+	ClientAuth     string `json:"client_auth,omitempty"`     // require (default with client_ca_file) or optional
+	MinVersion     string `json:"min_version,omitempty"`     // 1.2 (default) or 1.3
+	ReloadInterval string `json:"reload_interval,omitempty"` // How often files are checked for changes (default: 10s)
+}
+
+// TLSClientConfig customizes TLS for the HTTP output
+type TLSClientConfig struct {
+	CAFile             string `json:"ca_file,omitempty"`              // CA bundle for verifying the server (default: system roots)
+	CertFile           string `json:"cert_file,omitempty"`            // Client certificate for mTLS
+	KeyFile            string `json:"key_file,omitempty"`             // Client private key for mTLS
+	ServerName         string `json:"server_name,omitempty"`          // SNI and verification name override
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"` // Skip server verification (development only)
+	MinVersion         string `json:"min_version,omitempty"`          // 1.2 (default) or 1.3
+	ReloadInterval     string `json:"reload_interval,omitempty"`      // How often files are checked for changes (default: 10s)
+}
+
+// certReloader serves a certificate and CA pool loaded from disk, reloading them when
+// the files change. Checks happen lazily on handshakes, at most once per interval.
+// A failed reload keeps the previous material so a half-written file never breaks TLS.
+type certReloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+
+	mu        sync.Mutex
+	lastCheck time.Time
+	modTimes  map[string]time.Time
+	cert      *tls.Certificate
+	pool      *x509.CertPool
+}
+
+func newCertReloader(certFile, keyFile, caFile, interval string) (*certReloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("cert_file and key_file must be set together")
+	}
+	r := &certReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		interval: 10 * time.Second,
+		modTimes: make(map[string]time.Time),
+	}
+	if interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid reload_interval %q", interval)
+		}
+		r.interval = d
+	}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	r.lastCheck = time.Now()
+	return r, nil
+}
+
+// load reads all files and records their modification times
+func (r *certReloader) load() error {
+	if r.certFile != "" {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("load certificate: %w", err)
+		}
+		r.cert = &cert
+	}
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in CA file %s", r.caFile)
+		}
+		r.pool = pool
+	}
+	for _, path := range []string{r.certFile, r.keyFile, r.caFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			r.modTimes[path] = info.ModTime()
+		}
+	}
+	return nil
+}
+
+// refresh reloads the files if any changed since the last check
+func (r *certReloader) refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.lastCheck) < r.interval {
+		return
+	}
+	r.lastCheck = time.Now()
+
+	changed := false
+	for path, modTime := range r.modTimes {
+		info, err := os.Stat(path)
+		if err == nil && !info.ModTime().Equal(modTime) {
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+
+	previousCert, previousPool := r.cert, r.pool
+	if err := r.load(); err != nil {
+		r.cert, r.pool = previousCert, previousPool
+		slog.Error("Failed to reload TLS files, keeping previous certificates", "cert_file", r.certFile, "ca_file", r.caFile, "error", err)
+		return
+	}
+	slog.Info("Reloaded TLS files", "cert_file", r.certFile, "ca_file", r.caFile)
+}
+
+func (r *certReloader) certificate() *tls.Certificate {
+	r.refresh()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cert
+}
+
+func (r *certReloader) caPool() *x509.CertPool {
+	r.refresh()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.pool
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS min_version %q (must be 1.2 or 1.3)", version)
+	}
+}
+
+// newServerTLSConfig builds a server TLS config whose certificate and client CAs follow the files on disk
+func newServerTLSConfig(config *TLSServerConfig) (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("tls requires cert_file and key_file")
+	}
+	minVersion, err := parseTLSVersion(config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := newCertReloader(config.CertFile, config.KeyFile, config.ClientCAFile, config.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: minVersion,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return reloader.certificate(), nil
+		},
+	}
+	if config.ClientCAFile == "" {
+		if config.ClientAuth != "" {
+			return nil, fmt.Errorf("tls client_auth requires client_ca_file")
+		}
+		return base, nil
+	}
+
+	switch config.ClientAuth {
+	case "", "require":
+		base.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		base.ClientAuth = tls.VerifyClientCertIfGiven
+	default:
+		return nil, fmt.Errorf("unsupported tls client_auth %q (must be require or optional)", config.ClientAuth)
+	}
+
+	// Hand out a per-handshake copy so reloaded client CAs take effect without a restart
+	return &tls.Config{
+		MinVersion: minVersion,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cfg := base.Clone()
+			cfg.ClientCAs = reloader.caPool()
+			return cfg, nil
+		},
+	}, nil
+}
+
+// clientTLS builds client TLS configs whose client certificate and CA bundle follow the
+// files on disk. The client certificate is picked per handshake; RootCAs is fixed once a
+// transport uses a config, so callers check changed() and rebuild their transport.
+type clientTLS struct {
+	base     *tls.Config
+	reloader *certReloader
+	pool     *x509.CertPool
+}
+
+func newClientTLS(config *TLSClientConfig) (*clientTLS, error) {
+	minVersion, err := parseTLSVersion(config.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := newCertReloader(config.CertFile, config.KeyFile, config.CAFile, config.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion:         minVersion,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CertFile != "" {
+		base.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.certificate(), nil
+		}
+	}
+	return &clientTLS{base: base, reloader: reloader}, nil
+}
+
+// config returns a TLS config using the current CA bundle
+func (c *clientTLS) config() *tls.Config {
+	cfg := c.base.Clone()
+	c.pool = c.reloader.caPool()
+	cfg.RootCAs = c.pool
+	return cfg
+}
+
+// changed reports whether the CA bundle was reloaded since the last config()
+func (c *clientTLS) changed() bool {
+	return c.reloader.caPool() != c.pool
+}
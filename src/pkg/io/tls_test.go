@@ -0,0 +1,291 @@
+package io
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// testCA is a throwaway certificate authority for TLS tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+var testSerial = big.NewInt(1)
+
+func nextSerial() *big.Int {
+	testSerial = new(big.Int).Add(testSerial, big.NewInt(1))
+	return testSerial
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          nextSerial(),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create CA certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a leaf certificate and key signed by the CA to dir/<name>.crt and .key
+func (ca *testCA) issue(t *testing.T, dir, name string, dnsNames []string, ips []net.IP, client bool) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	usage := x509.ExtKeyUsageServerAuth
+	if client {
+		usage = x509.ExtKeyUsageClientAuth
+	}
+	template := &x509.Certificate{
+		SerialNumber: nextSerial(),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	writeTouched(t, certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	writeTouched(t, keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+	return certPath, keyPath
+}
+
+// writeTouched writes a file and bumps its modification time so reloads notice the change
+// even on filesystems with coarse timestamps
+func writeTouched(t *testing.T, path string, data []byte) {
+	t.Helper()
+	previous := time.Time{}
+	if info, err := os.Stat(path); err == nil {
+		previous = info.ModTime()
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+	if !previous.IsZero() {
+		next := previous.Add(time.Second)
+		if err := os.Chtimes(path, next, next); err != nil {
+			t.Fatalf("Failed to touch %s: %v", path, err)
+		}
+	}
+}
+
+// peerCommonName dials addr and returns the CN of the certificate the server presents
+func peerCommonName(t *testing.T, addr string) string {
+	t.Helper()
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("TLS dial error = %v", err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+}
+
+func TestTLSConfig_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	certFile, keyFile := ca.issue(t, dir, "server", []string{"localhost"}, nil, false)
+
+	serverTests := map[string]TLSServerConfig{
+		"missing key":              {CertFile: certFile},
+		"missing files":            {CertFile: "/nonexistent.crt", KeyFile: "/nonexistent.key"},
+		"bad version":              {CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"},
+		"client_auth without CA":   {CertFile: certFile, KeyFile: keyFile, ClientAuth: "require"},
+		"unknown client_auth":      {CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, ClientAuth: "always"},
+		"bad reload interval":      {CertFile: certFile, KeyFile: keyFile, ReloadInterval: "often"},
+		"CA file without any cert": {CertFile: certFile, KeyFile: keyFile, ClientCAFile: keyFile},
+	}
+	for name, config := range serverTests {
+		t.Run("server "+name, func(t *testing.T) {
+			if _, err := newServerTLSConfig(&config); err == nil {
+				t.Error("newServerTLSConfig() should fail")
+			}
+		})
+	}
+
+	clientTests := map[string]TLSClientConfig{
+		"cert without key": {CertFile: certFile},
+		"missing CA file":  {CAFile: "/nonexistent.pem"},
+		"bad version":      {MinVersion: "tls1.3"},
+	}
+	for name, config := range clientTests {
+		t.Run("client "+name, func(t *testing.T) {
+			if _, err := newClientTLS(&config); err == nil {
+				t.Error("newClientTLS() should fail")
+			}
+		})
+	}
+}
+
+func TestHTTPInput_MutualTLS(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	ca := newTestCA(t, "vrsky-test-ca")
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTouched(t, caFile, ca.pem)
+	serverCert, serverKey := ca.issue(t, dir, "server", []string{"localhost"}, []net.IP{net.ParseIP("127.0.0.1")}, false)
+	clientCert, clientKey := ca.issue(t, dir, "partner-acme", nil, nil, true)
+
+	input, err := NewHTTPInput([]byte(fmt.Sprintf(
+		`{"port":"8781","tls":{"cert_file":%q,"key_file":%q,"client_ca_file":%q,"reload_interval":"10ms"}}`,
+		serverCert, serverKey, caFile)))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	go func() {
+		_ = input.Start(ctx)
+	}()
+	defer input.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	env := envelope.New()
+	env.ID = "tls-1"
+	env.ContentType = "application/json"
+	env.Payload = []byte(`{"ok":true}`)
+
+	// A client with a certificate from the trusted CA gets through
+	output, err := NewHTTPOutput([]byte(fmt.Sprintf(
+		`{"url":"https://localhost:8781/webhook","tls":{"ca_file":%q,"cert_file":%q,"key_file":%q}}`,
+		caFile, clientCert, clientKey)))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	if err := output.Write(ctx, env); err != nil {
+		t.Fatalf("Write() with client certificate error = %v", err)
+	}
+	received, err := input.Read(ctx)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if received.Metadata["tls_client_subject"] != "CN=partner-acme" {
+		t.Errorf("tls_client_subject = %q, want CN=partner-acme", received.Metadata["tls_client_subject"])
+	}
+
+	// Without a client certificate the handshake is refused
+	noCert, err := NewHTTPOutput([]byte(fmt.Sprintf(`{"url":"https://localhost:8781/webhook","tls":{"ca_file":%q}}`, caFile)))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	if err := noCert.Write(ctx, env); err == nil {
+		t.Error("Write() without client certificate should fail")
+	}
+
+	// A rotated server certificate is picked up without a restart
+	if cn := peerCommonName(t, "localhost:8781"); cn != "server" {
+		t.Fatalf("Initial server certificate CN = %q", cn)
+	}
+	rotatedCert, rotatedKey := ca.issue(t, dir, "server-rotated", []string{"localhost"}, nil, false)
+	certPEM, _ := os.ReadFile(rotatedCert)
+	keyPEM, _ := os.ReadFile(rotatedKey)
+	writeTouched(t, serverKey, keyPEM)
+	writeTouched(t, serverCert, certPEM)
+	time.Sleep(50 * time.Millisecond)
+	deadline := time.Now().Add(2 * time.Second)
+	for peerCommonName(t, "localhost:8781") != "server-rotated" {
+		if time.Now().After(deadline) {
+			t.Fatal("Server certificate was not reloaded")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestHTTPOutput_TLSServerNameAndCAReload(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	dir := t.TempDir()
+	serverCA := newTestCA(t, "server-ca")
+	otherCA := newTestCA(t, "other-ca")
+	serverCert, serverKey := serverCA.issue(t, dir, "ingest", []string{"ingest.vrsky.internal"}, nil, false)
+
+	input, err := NewHTTPInput([]byte(fmt.Sprintf(`{"port":"8782","tls":{"cert_file":%q,"key_file":%q}}`, serverCert, serverKey)))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	go func() {
+		_ = input.Start(ctx)
+	}()
+	defer input.Close()
+	time.Sleep(100 * time.Millisecond)
+
+	env := envelope.New()
+	env.ID = "sni-1"
+	env.Payload = []byte("x")
+
+	serverCAFile := filepath.Join(dir, "server-ca.pem")
+	writeTouched(t, serverCAFile, serverCA.pem)
+
+	// The certificate does not cover 127.0.0.1, so SNI/verification must use the override
+	plain, _ := NewHTTPOutput([]byte(fmt.Sprintf(`{"url":"https://127.0.0.1:8782/webhook","tls":{"ca_file":%q}}`, serverCAFile)))
+	if err := plain.Write(ctx, env); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Write() without server_name error = %v, want certificate error", err)
+	}
+	override, _ := NewHTTPOutput([]byte(fmt.Sprintf(
+		`{"url":"https://127.0.0.1:8782/webhook","tls":{"ca_file":%q,"server_name":"ingest.vrsky.internal"}}`, serverCAFile)))
+	if err := override.Write(ctx, env); err != nil {
+		t.Errorf("Write() with server_name error = %v", err)
+	}
+
+	// Start with the wrong CA bundle, then fix it on disk
+	bundle := filepath.Join(dir, "bundle.pem")
+	writeTouched(t, bundle, otherCA.pem)
+	output, err := NewHTTPOutput([]byte(fmt.Sprintf(
+		`{"url":"https://127.0.0.1:8782/webhook","tls":{"ca_file":%q,"server_name":"ingest.vrsky.internal","reload_interval":"10ms"}}`, bundle)))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	if err := output.Write(ctx, env); err == nil {
+		t.Fatal("Write() with untrusted server CA should fail")
+	}
+	writeTouched(t, bundle, serverCA.pem)
+	time.Sleep(50 * time.Millisecond)
+	if err := output.Write(ctx, env); err != nil {
+		t.Errorf("Write() after CA bundle reload error = %v", err)
+	}
+}
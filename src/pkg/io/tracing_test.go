@@ -0,0 +1,132 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/tracing"
+	"github.com/ValueRetail/vrsky/pkg/tracing/tracingtest"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracing_HTTPInputToHTTPOutput(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+	exporter := tracingtest.UseInMemory()
+
+	received := make(chan string, 1)
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get("traceparent")
+	}))
+	defer backend.Close()
+
+	input, err := NewHTTPInput([]byte(`{"port":"8793"}`))
+	if err != nil {
+		t.Fatalf("NewHTTPInput() error = %v", err)
+	}
+	output, err := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `"}`))
+	if err != nil {
+		t.Fatalf("NewHTTPOutput() error = %v", err)
+	}
+	producer := component.New(input, output)
+	producer.SetTypes("http", "http")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go producer.Process(ctx, input, output)
+	time.Sleep(100 * time.Millisecond)
+
+	req, _ := http.NewRequest(http.MethodPost, "http://localhost:8793/webhook", bytes.NewReader([]byte(`{}`)))
+	req.Header.Set("traceparent", testTraceparent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("POST error = %v", err)
+	}
+	resp.Body.Close()
+
+	var traceparent string
+	select {
+	case traceparent = <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Backend received nothing")
+	}
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stopCancel()
+	producer.Stop(stopCtx)
+
+	// The backend continues the sender's trace from the write span
+	spans := exporter.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "http-input process" || spans[1].Name != "http-output write" {
+		t.Fatalf("Spans = %v, want the process and the write", spans)
+	}
+	process, write := spans[0], spans[1]
+	if process.SpanContext.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		process.Parent.SpanID().String() != "00f067aa0ba902b7" || !process.Parent.IsRemote() {
+		t.Errorf("Process span parent = %v, want the sender's span", process.Parent)
+	}
+	if write.Parent.SpanID() != process.SpanContext.SpanID() || write.SpanKind != trace.SpanKindProducer {
+		t.Errorf("Write span parent = %v, want the process span", write.Parent)
+	}
+	want := "00-4bf92f3577b34da6a3ce929d0e0e4736-" + write.SpanContext.SpanID().String() + "-01"
+	if traceparent != want {
+		t.Errorf("Backend traceparent = %q, want %q", traceparent, want)
+	}
+}
+
+func TestTracing_FailedWriteSpan(t *testing.T) {
+	provider := otel.GetTracerProvider()
+	t.Cleanup(func() { otel.SetTracerProvider(provider) })
+	exporter := tracingtest.UseInMemory()
+
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer backend.Close()
+	output, _ := NewHTTPOutput([]byte(`{"url":"` + backend.URL + `"}`))
+
+	env := envelope.New()
+	input := componenttest.NewInput(env)
+	producer := component.New(input, output)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	producer.Process(ctx, input, output)
+	producer.Stop(context.Background())
+
+	// Without an incoming trace the process span starts one, and the envelope records it
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans recorded, want 2", len(spans))
+	}
+	write := spans[1]
+	if write.Status.Code.String() != "Error" || !strings.Contains(write.Status.Description, "400") {
+		t.Errorf("Write span status = %v, want the 400 error", write.Status)
+	}
+	if env.TraceID == "" || env.TraceID != write.SpanContext.TraceID().String() {
+		t.Errorf("Envelope TraceID = %q, want the write span's trace", env.TraceID)
+	}
+}
+
+func TestTracing_InvalidTraceparentStartsNewTrace(t *testing.T) {
+	env := envelope.New()
+	tracing.Extract("00-not-a-trace", env)
+	if env.TraceParent != "" || env.TraceID != "" {
+		t.Errorf("TraceParent = %q, TraceID = %q; want an invalid header ignored", env.TraceParent, env.TraceID)
+	}
+
+	tracing.Extract(testTraceparent, env)
+	if env.TraceParent != testTraceparent || env.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("TraceParent = %q, TraceID = %q; want the header's trace", env.TraceParent, env.TraceID)
+	}
+}
@@ -0,0 +1,161 @@
+// Package metrics records Prometheus metrics for inputs, outputs and the processing loop.
+// The admin server serves them at /metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// Component labels name the input or output type and its direction, e.g. "http-input"
+// or "nats-output". Every metric is also labelled with the pipeline the component runs
+// in, empty outside a pipeline, so pipelines with the same types keep separate series.
+// Message metrics are also labelled with the envelope's tenant and integration.
+var (
+	componentLabels = []string{"pipeline", "component"}
+	messageLabels   = []string{"pipeline", "component", "tenant", "integration"}
+)
+
+var (
+	registry = prometheus.NewRegistry()
+
+	received = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vrsky",
+		Name:      "messages_received_total",
+		Help:      "Messages read from inputs.",
+	}, messageLabels)
+
+	written = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vrsky",
+		Name:      "messages_written_total",
+		Help:      "Messages delivered by outputs.",
+	}, messageLabels)
+
+	failed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vrsky",
+		Name:      "messages_failed_total",
+		Help:      "Messages outputs failed to deliver, after retries.",
+	}, append(messageLabels, "permanent"))
+
+	dropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vrsky",
+		Name:      "messages_dropped_total",
+		Help:      "Messages discarded or turned away without being delivered.",
+	}, append(messageLabels, "reason"))
+
+	payloadSize = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "vrsky",
+		Name:      "payload_size_bytes",
+		Help:      "Payload size of messages received and written.",
+		Buckets:   prometheus.ExponentialBuckets(64, 4, 10), // 64B to 16MB
+	}, messageLabels)
+
+	writeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "vrsky",
+		Name:      "write_duration_seconds",
+		Help:      "Time taken by output writes, including retries.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10), // 1ms to 4m
+	}, messageLabels)
+
+	retries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vrsky",
+		Name:      "write_retries_total",
+		Help:      "Delivery attempts repeated after a retryable failure.",
+	}, messageLabels)
+
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "vrsky",
+		Name:      "queue_depth",
+		Help:      "Messages buffered by an input and not yet read.",
+	}, componentLabels)
+
+	natsReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vrsky",
+		Name:      "nats_reconnects_total",
+		Help:      "Reconnections to the NATS server.",
+	}, componentLabels)
+
+	throttled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "vrsky",
+		Name:      "requests_throttled_total",
+		Help:      "Requests rejected by an input's rate limit.",
+	}, append(componentLabels, "key"))
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		received, written, failed, dropped, payloadSize, writeDuration, retries, queueDepth, natsReconnects, throttled,
+	)
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// labels returns the message labels for env, which may be nil when the message was not parsed
+func labels(pipeline, component string, env *envelope.Envelope) []string {
+	if env == nil {
+		return []string{pipeline, component, "", ""}
+	}
+	return []string{pipeline, component, env.TenantID, env.IntegrationID}
+}
+
+// Received counts a message read from an input
+func Received(pipeline, component string, env *envelope.Envelope) {
+	values := labels(pipeline, component, env)
+	received.WithLabelValues(values...).Inc()
+	payloadSize.WithLabelValues(values...).Observe(float64(len(env.Payload)))
+}
+
+// Written counts a message an output delivered in elapsed
+func Written(pipeline, component string, env *envelope.Envelope, elapsed time.Duration) {
+	values := labels(pipeline, component, env)
+	written.WithLabelValues(values...).Inc()
+	payloadSize.WithLabelValues(values...).Observe(float64(len(env.Payload)))
+	writeDuration.WithLabelValues(values...).Observe(elapsed.Seconds())
+}
+
+// Failed counts a message an output gave up on after elapsed
+func Failed(pipeline, component string, env *envelope.Envelope, permanent bool, elapsed time.Duration) {
+	values := labels(pipeline, component, env)
+	permanentLabel := "false"
+	if permanent {
+		permanentLabel = "true"
+	}
+	failed.WithLabelValues(append(values, permanentLabel)...).Inc()
+	writeDuration.WithLabelValues(values...).Observe(elapsed.Seconds())
+}
+
+// Dropped counts a message discarded for reason, e.g. a full buffer
+func Dropped(pipeline, component string, env *envelope.Envelope, reason string) {
+	dropped.WithLabelValues(append(labels(pipeline, component, env), reason)...).Inc()
+}
+
+// Retried counts a repeated delivery attempt
+func Retried(pipeline, component string, env *envelope.Envelope) {
+	retries.WithLabelValues(labels(pipeline, component, env)...).Inc()
+}
+
+// SetQueueDepth records how many messages an input holds
+func SetQueueDepth(pipeline, component string, depth int) {
+	queueDepth.WithLabelValues(pipeline, component).Set(float64(depth))
+}
+
+// NATSReconnected counts a reconnection to the NATS server
+func NATSReconnected(pipeline, component string) {
+	natsReconnects.WithLabelValues(pipeline, component).Inc()
+}
+
+// Throttled counts a request rejected by a rate limit keyed by key, e.g. "ip"
+func Throttled(pipeline, component, key string) {
+	throttled.WithLabelValues(pipeline, component, key).Inc()
+}
@@ -0,0 +1,205 @@
+// Package pipeline loads pipeline definitions and runs one or more pipelines in a process
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+)
+
+// Definition is a pipeline definition file: YAML, or JSON, which is read the same way
+type Definition struct {
+	Pipelines []Spec `yaml:"pipelines" json:"pipelines"`
+}
+
+// Spec defines one pipeline: an input, stages run on every envelope, and an output
+type Spec struct {
+	Name string `yaml:"name" json:"name"`
+
+	// Envelopes without a tenant or integration ID get the pipeline's
+	TenantID      string `yaml:"tenant_id,omitempty" json:"tenant_id,omitempty"`
+	IntegrationID string `yaml:"integration_id,omitempty" json:"integration_id,omitempty"`
+
+	Input  ComponentSpec `yaml:"input" json:"input"`
+	Stages []StageSpec   `yaml:"stages,omitempty" json:"stages,omitempty"`
+	Output ComponentSpec `yaml:"output" json:"output"`
+
+	// Processing is a component.ProcessingConfig: workers, order_by and batch
+	Processing map[string]any `yaml:"processing,omitempty" json:"processing,omitempty"`
+
+	ErrorHandling ErrorHandling `yaml:"error_handling,omitempty" json:"error_handling,omitempty"`
+}
+
+// ComponentSpec selects an input or output type and its configuration, the same JSON
+// object INPUT_CONFIG or OUTPUT_CONFIG would hold
+type ComponentSpec struct {
+	Type   string         `yaml:"type" json:"type"`
+	Config map[string]any `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+// StageSpec selects a built-in stage type and its configuration
+type StageSpec struct {
+	Type   string         `yaml:"type" json:"type"`
+	Config map[string]any `yaml:"config,omitempty" json:"config,omitempty"`
+}
+
+// ErrorHandling decides what happens to envelopes that cannot be delivered. Without a
+// dead letter output they are logged and dropped.
+type ErrorHandling struct {
+	DeadLetter *ComponentSpec `yaml:"dead_letter,omitempty" json:"dead_letter,omitempty"`
+
+	// Retryable also dead-letters envelopes the output failed to deliver after its
+	// retries; by default only envelopes it rejected permanently are
+	Retryable bool `yaml:"retryable,omitempty" json:"retryable,omitempty"`
+}
+
+// FieldError is a validation failure at a field of the definition, e.g.
+// "pipelines[1].output.type"
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// fieldErrorf returns a FieldError for field
+func fieldErrorf(field, format string, args ...any) *FieldError {
+	return &FieldError{Field: field, Message: fmt.Sprintf(format, args...)}
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// LoadFile reads and validates the pipeline definition at path
+func LoadFile(path string) (*Definition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline definition: %w", err)
+	}
+	definition, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("pipeline definition %s: %w", path, err)
+	}
+	return definition, nil
+}
+
+// Parse reads and validates a pipeline definition. Unknown fields are rejected, and every
+// validation failure is returned, joined, as a *FieldError.
+func Parse(data []byte) (*Definition, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var definition Definition
+	if err := decoder.Decode(&definition); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fieldErrorf("pipelines", "at least one pipeline is required")
+		}
+		return nil, err
+	}
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+// Validate checks the definition without creating any components
+func (d *Definition) Validate() error {
+	if len(d.Pipelines) == 0 {
+		return fieldErrorf("pipelines", "at least one pipeline is required")
+	}
+
+	var errs []error
+	names := make(map[string]int)
+	for i, spec := range d.Pipelines {
+		path := fmt.Sprintf("pipelines[%d]", i)
+		switch {
+		case spec.Name == "":
+			errs = append(errs, fieldErrorf(path+".name", "is required"))
+		case !validName.MatchString(spec.Name):
+			errs = append(errs, fieldErrorf(path+".name", "%q must be lowercase letters, digits, - and _", spec.Name))
+		default:
+			if first, ok := names[spec.Name]; ok {
+				errs = append(errs, fieldErrorf(path+".name", "%q is already used by pipelines[%d]", spec.Name, first))
+			}
+			names[spec.Name] = i
+		}
+		errs = append(errs, spec.validate(path)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Spec) validate(path string) []error {
+	var errs []error
+	if err := s.Input.validate(path+".input", inputTypes); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.Output.validate(path+".output", outputTypes); err != nil {
+		errs = append(errs, err)
+	}
+	for i, stage := range s.Stages {
+		if _, err := newStage(stage); err != nil {
+			errs = append(errs, stageError(fmt.Sprintf("%s.stages[%d]", path, i), err))
+		}
+	}
+	if s.Processing != nil {
+		var processing component.ProcessingConfig
+		if err := decodeConfig(s.Processing, &processing); err != nil {
+			errs = append(errs, fieldErrorf(path+".processing", "%v", err))
+		} else if err := processing.Validate(); err != nil {
+			errs = append(errs, fieldErrorf(path+".processing", "%v", err))
+		}
+	}
+	if s.ErrorHandling.DeadLetter != nil {
+		if err := s.ErrorHandling.DeadLetter.validate(path+".error_handling.dead_letter", outputTypes); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Types accepted by the io factory
+var (
+	inputTypes  = []string{"http", "nats", "file", "sftp", "s3"}
+	outputTypes = []string{"http", "nats", "sftp", "s3"}
+)
+
+func (c *ComponentSpec) validate(path string, types []string) error {
+	if c.Type == "" {
+		return fieldErrorf(path+".type", "is required")
+	}
+	for _, t := range types {
+		if c.Type == t {
+			return nil
+		}
+	}
+	return fieldErrorf(path+".type", "unknown type %q (must be one of %s)", c.Type, strings.Join(types, ", "))
+}
+
+// decodeConfig decodes a configuration object into target, rejecting unknown fields
+func decodeConfig(config map[string]any, target any) error {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(target)
+}
+
+// configJSON returns the component configuration as the JSON the io factory takes
+func (c *ComponentSpec) configJSON() (json.RawMessage, error) {
+	if c.Config == nil {
+		return json.RawMessage(`{}`), nil
+	}
+	return json.Marshal(c.Config)
+}
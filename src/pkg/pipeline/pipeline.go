@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/io"
+)
+
+// Pipeline is a built pipeline: its components and the producer that runs them
+type Pipeline struct {
+	Name       string
+	Input      component.Input
+	Output     component.Output
+	DeadLetter component.Output // nil without error_handling.dead_letter
+	Producer   *component.GenericProducer
+}
+
+// Build creates the components of every pipeline. Errors in a component's configuration
+// are *FieldErrors pointing at it.
+func (d *Definition) Build() ([]*Pipeline, error) {
+	pipelines := make([]*Pipeline, 0, len(d.Pipelines))
+	for i, spec := range d.Pipelines {
+		pipeline, err := spec.build(fmt.Sprintf("pipelines[%d]", i))
+		if err != nil {
+			return nil, err
+		}
+		pipelines = append(pipelines, pipeline)
+	}
+	return pipelines, nil
+}
+
+func (s *Spec) build(path string) (*Pipeline, error) {
+	inputConfig, err := s.Input.configJSON()
+	if err != nil {
+		return nil, fieldErrorf(path+".input.config", "%v", err)
+	}
+	input, err := io.NewInput(s.Input.Type, inputConfig)
+	if err != nil {
+		return nil, fieldErrorf(path+".input.config", "%v", err)
+	}
+
+	outputConfig, err := s.Output.configJSON()
+	if err != nil {
+		return nil, fieldErrorf(path+".output.config", "%v", err)
+	}
+	output, err := io.NewOutput(s.Output.Type, outputConfig)
+	if err != nil {
+		return nil, fieldErrorf(path+".output.config", "%v", err)
+	}
+
+	producer := component.New(input, output)
+	producer.SetTypes(s.Input.Type, s.Output.Type)
+	if s.Processing != nil {
+		processing, err := (&ComponentSpec{Config: s.Processing}).configJSON()
+		if err != nil {
+			return nil, fieldErrorf(path+".processing", "%v", err)
+		}
+		if err := producer.Configure(processing); err != nil {
+			return nil, fieldErrorf(path+".processing", "%v", err)
+		}
+	}
+
+	var stages []component.Stage
+	if s.TenantID != "" || s.IntegrationID != "" {
+		stages = append(stages, &defaultsStage{tenantID: s.TenantID, integrationID: s.IntegrationID})
+	}
+	for i, spec := range s.Stages {
+		stage, err := newStage(spec)
+		if err != nil {
+			return nil, stageError(fmt.Sprintf("%s.stages[%d]", path, i), err)
+		}
+		stages = append(stages, stage)
+	}
+	producer.SetStages(stages...)
+
+	pipeline := &Pipeline{Name: s.Name, Input: input, Output: output, Producer: producer}
+	if deadLetter := s.ErrorHandling.DeadLetter; deadLetter != nil {
+		config, err := deadLetter.configJSON()
+		if err != nil {
+			return nil, fieldErrorf(path+".error_handling.dead_letter.config", "%v", err)
+		}
+		pipeline.DeadLetter, err = io.NewOutput(deadLetter.Type, config)
+		if err != nil {
+			return nil, fieldErrorf(path+".error_handling.dead_letter.config", "%v", err)
+		}
+		producer.SetDeadLetter(pipeline.DeadLetter, s.ErrorHandling.Retryable)
+	}
+	producer.SetPipeline(s.Name)
+
+	if err := producer.Start(context.Background()); err != nil {
+		return nil, fmt.Errorf("pipeline %s: %w", s.Name, err)
+	}
+	return pipeline, nil
+}
+
+// Run processes every pipeline concurrently until ctx is cancelled or they are stopped.
+// It returns as soon as a pipeline fails, leaving the others running.
+func Run(ctx context.Context, pipelines []*Pipeline) error {
+	errs := make(chan error, len(pipelines))
+	for _, p := range pipelines {
+		go func(p *Pipeline) {
+			slog.Info("Pipeline starting", "pipeline", p.Name)
+			if err := p.Producer.Process(ctx, p.Input, p.Output); err != nil {
+				errs <- fmt.Errorf("pipeline %s: %w", p.Name, err)
+				return
+			}
+			errs <- nil
+		}(p)
+	}
+	for range pipelines {
+		if err := <-errs; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop drains and stops every pipeline concurrently, within ctx
+func Stop(ctx context.Context, pipelines []*Pipeline) {
+	var wg sync.WaitGroup
+	for _, p := range pipelines {
+		wg.Add(1)
+		go func(p *Pipeline) {
+			defer wg.Done()
+			p.Producer.Stop(ctx)
+			slog.Info("Pipeline stopped", "pipeline", p.Name)
+		}(p)
+	}
+	wg.Wait()
+}
+
+// Stalled returns an error naming the first pipeline whose loop has made no progress for
+// longer than threshold while holding messages
+func Stalled(pipelines []*Pipeline, threshold time.Duration) error {
+	for _, p := range pipelines {
+		if err := p.Producer.Stalled(threshold); err != nil {
+			return fmt.Errorf("pipeline %s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Health returns the worst health of the pipelines: stopped, then unhealthy, then draining
+func Health(pipelines []*Pipeline) component.HealthStatus {
+	rank := map[component.HealthStatus]int{
+		component.HealthHealthy:   0,
+		component.HealthDraining:  1,
+		component.HealthUnhealthy: 2,
+		component.HealthStopped:   3,
+	}
+	worst := component.HealthHealthy
+	for _, p := range pipelines {
+		if health := p.Producer.Health(); rank[health] > rank[worst] {
+			worst = health
+		}
+	}
+	return worst
+}
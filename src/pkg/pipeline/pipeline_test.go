@@ -0,0 +1,390 @@
+package pipeline_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/component/componenttest"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+	"github.com/ValueRetail/vrsky/pkg/metrics"
+	"github.com/ValueRetail/vrsky/pkg/pipeline"
+)
+
+func TestPipeline_ParseYAML(t *testing.T) {
+	definition, err := pipeline.Parse([]byte(`
+pipelines:
+  - name: orders
+    tenant_id: acme
+    input:
+      type: http
+      config: {port: "8080"}
+    stages:
+      - type: filter
+        config: {field: metadata.kind, equals: order}
+    output:
+      type: nats
+      config: {url: "nats://localhost:4222", subject: orders}
+    processing: {workers: 4, order_by: tenant_id}
+    error_handling:
+      dead_letter:
+        type: nats
+        config: {url: "nats://localhost:4222", subject: orders.dead}
+  - name: refunds
+    input: {type: nats, config: {url: "nats://localhost:4222", subject: refunds}}
+    output: {type: http, config: {url: "http://localhost:8081"}}
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(definition.Pipelines) != 2 {
+		t.Fatalf("%d pipelines parsed, want 2", len(definition.Pipelines))
+	}
+	orders := definition.Pipelines[0]
+	if orders.Name != "orders" || orders.TenantID != "acme" || orders.Input.Config["port"] != "8080" ||
+		len(orders.Stages) != 1 || orders.ErrorHandling.DeadLetter.Config["subject"] != "orders.dead" {
+		t.Errorf("Pipeline = %+v, not what the file defines", orders)
+	}
+}
+
+func TestPipeline_ParseJSON(t *testing.T) {
+	_, err := pipeline.Parse([]byte(`{"pipelines": [{"name": "orders",
+		"input": {"type": "http", "config": {"port": "8080"}},
+		"output": {"type": "http", "config": {"url": "http://localhost:8081"}}}]}`))
+	if err != nil {
+		t.Errorf("Parse() error = %v", err)
+	}
+}
+
+func TestPipeline_ValidationErrors(t *testing.T) {
+	tests := []struct {
+		name       string
+		definition string
+		want       []string
+	}{
+		{
+			name:       "empty",
+			definition: ``,
+			want:       []string{"pipelines: at least one pipeline is required"},
+		},
+		{
+			name: "missing name and types",
+			definition: `
+pipelines:
+  - input: {}
+    output: {type: ftp}`,
+			want: []string{
+				"pipelines[0].name: is required",
+				"pipelines[0].input.type: is required",
+				`pipelines[0].output.type: unknown type "ftp"`,
+			},
+		},
+		{
+			name: "duplicate name",
+			definition: `
+pipelines:
+  - {name: orders, input: {type: http}, output: {type: http}}
+  - {name: orders, input: {type: http}, output: {type: http}}`,
+			want: []string{`pipelines[1].name: "orders" is already used by pipelines[0]`},
+		},
+		{
+			name: "invalid name",
+			definition: `
+pipelines:
+  - {name: Orders, input: {type: http}, output: {type: http}}`,
+			want: []string{`pipelines[0].name: "Orders" must be lowercase`},
+		},
+		{
+			name: "bad stages",
+			definition: `
+pipelines:
+  - name: orders
+    input: {type: http}
+    output: {type: http}
+    stages:
+      - type: set_metadata
+      - type: filter
+        config: {field: body, equals: x}
+      - type: filter
+        config: {field: tenant_id}
+      - type: transform`,
+			want: []string{
+				"pipelines[0].stages[0].config.values: at least one value is required",
+				`pipelines[0].stages[1].config.field: "body" must be`,
+				"pipelines[0].stages[2].config: exactly one of equals or not_equals is required",
+				`pipelines[0].stages[3].type: unknown stage type "transform"`,
+			},
+		},
+		{
+			name: "bad processing",
+			definition: `
+pipelines:
+  - name: orders
+    input: {type: http}
+    output: {type: http}
+    processing: {workers: -1}`,
+			want: []string{"pipelines[0].processing: workers must not be negative"},
+		},
+		{
+			name: "bad dead letter",
+			definition: `
+pipelines:
+  - name: orders
+    input: {type: http}
+    output: {type: http}
+    error_handling:
+      dead_letter: {type: file}`,
+			want: []string{`pipelines[0].error_handling.dead_letter.type: unknown type "file"`},
+		},
+		{
+			name: "unknown field",
+			definition: `
+pipelines:
+  - name: orders
+    input: {type: http}
+    outputs: {type: http}`,
+			want: []string{"line 5: field outputs not found"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pipeline.Parse([]byte(tt.definition))
+			if err == nil {
+				t.Fatal("Parse() succeeded, want an error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("Parse() error = %q, want it to contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestPipeline_ComponentErrorPointsAtField(t *testing.T) {
+	definition, err := pipeline.Parse([]byte(`
+pipelines:
+  - name: orders
+    input: {type: http, config: {port: "8080"}}
+    output: {type: http, config: {method: POST}}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	_, err = definition.Build()
+	var fieldErr *pipeline.FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "pipelines[0].output.config" {
+		t.Errorf("Build() error = %v, want a field error at pipelines[0].output.config", err)
+	}
+}
+
+func TestPipeline_FileConfig(t *testing.T) {
+	t.Setenv("FILE_INPUT_DIR", "")
+	dir := filepath.Join(t.TempDir(), "incoming")
+	definition, err := pipeline.Parse([]byte(`
+pipelines:
+  - name: orders
+    input: {type: file, config: {dir: "` + dir + `", poll_interval: 1s}}
+    output: {type: http, config: {url: "http://localhost:1"}}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	pipelines, err := definition.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	// The directory is only created by Start, so the health check names the one configured
+	err = pipelines[0].Input.(component.HealthChecker).CheckHealth(context.Background())
+	if err == nil || !strings.Contains(err.Error(), dir) {
+		t.Errorf("CheckHealth() error = %v, want it to name %s", err, dir)
+	}
+
+	definition, _ = pipeline.Parse([]byte(`
+pipelines:
+  - name: refunds
+    input: {type: file, config: {dri: /data}}
+    output: {type: http, config: {url: "http://localhost:1"}}`))
+	_, err = definition.Build()
+	var fieldErr *pipeline.FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Field != "pipelines[0].input.config" || !strings.Contains(err.Error(), "dri") {
+		t.Errorf("Build() error = %v, want the unknown field dri at pipelines[0].input.config", err)
+	}
+}
+
+func TestPipeline_StagesAndDefaultIDs(t *testing.T) {
+	definition, err := pipeline.Parse([]byte(`
+pipelines:
+  - name: orders
+    tenant_id: acme
+    integration_id: shop
+    input: {type: http, config: {port: "8794"}}
+    stages:
+      - type: filter
+        config: {field: metadata.kind, equals: order}
+      - type: set_metadata
+        config: {values: {source: shop}}
+    output: {type: http, config: {url: "http://localhost:1"}}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	pipelines, err := definition.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	order := envelope.New()
+	order.Metadata = map[string]string{"kind": "order"}
+	otherTenant := envelope.New()
+	otherTenant.TenantID = "other"
+	otherTenant.Metadata = map[string]string{"kind": "order"}
+	refund := envelope.New()
+	refund.Metadata = map[string]string{"kind": "refund"}
+
+	input := componenttest.NewInput(order, otherTenant, refund)
+	output := &componenttest.Output{}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	pipelines[0].Producer.Process(ctx, input, output)
+
+	// The refund is filtered out; the others keep their own tenant or get the pipeline's
+	written := output.Written()
+	if len(written) != 2 {
+		t.Fatalf("%d envelopes written, want 2", len(written))
+	}
+	if written[0].TenantID != "acme" || written[0].IntegrationID != "shop" || written[1].TenantID != "other" {
+		t.Errorf("Tenants = %q, %q; want acme and other", written[0].TenantID, written[1].TenantID)
+	}
+	for _, env := range written {
+		if env.Metadata["source"] != "shop" {
+			t.Errorf("Metadata = %v, want source set by the stage", env.Metadata)
+		}
+	}
+}
+
+func TestPipeline_DeadLetterOnPermanentFailure(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer backend.Close()
+	deadLettered := make(chan string, 1)
+	deadLetter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deadLettered <- r.Header.Get("X-Message-ID")
+	}))
+	defer deadLetter.Close()
+
+	definition, err := pipeline.Parse([]byte(`
+pipelines:
+  - name: orders
+    input: {type: http, config: {port: "8794"}}
+    output: {type: http, config: {url: "` + backend.URL + `"}}
+    error_handling:
+      dead_letter: {type: http, config: {url: "` + deadLetter.URL + `"}}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	pipelines, err := definition.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	env := envelope.New()
+	env.ID = "order-1"
+	input := componenttest.NewInput(env)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go pipelines[0].Producer.Process(ctx, input, pipelines[0].Output)
+
+	select {
+	case id := <-deadLettered:
+		if id != env.ID {
+			t.Errorf("Dead letter received %q, want %q", id, env.ID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Rejected envelope was not dead-lettered")
+	}
+	pipeline.Stop(context.Background(), pipelines)
+}
+
+func TestPipeline_RunsSeveralPipelines(t *testing.T) {
+	received := make(chan string, 2)
+	newBackend := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- name
+		}))
+	}
+	orders, refunds := newBackend("orders"), newBackend("refunds")
+	defer orders.Close()
+	defer refunds.Close()
+
+	definition, err := pipeline.Parse([]byte(`
+pipelines:
+  - name: orders
+    input: {type: http, config: {port: "8794"}}
+    output: {type: http, config: {url: "` + orders.URL + `"}}
+  - name: refunds
+    input: {type: http, config: {port: "8795"}}
+    output: {type: http, config: {url: "` + refunds.URL + `"}}`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	pipelines, err := definition.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if health := pipeline.Health(pipelines); health != component.HealthHealthy {
+		t.Errorf("Health() = %v, want healthy", health)
+	}
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- pipeline.Run(context.Background(), pipelines) }()
+	time.Sleep(100 * time.Millisecond)
+
+	for _, port := range []string{"8794", "8795"} {
+		resp, err := http.Post("http://localhost:"+port+"/webhook", "application/json", bytes.NewReader([]byte(`{}`)))
+		if err != nil {
+			t.Fatalf("POST to %s error = %v", port, err)
+		}
+		resp.Body.Close()
+	}
+
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		select {
+		case name := <-received:
+			got[name] = true
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Backends received %v, want both", got)
+		}
+	}
+	if !got["orders"] || !got["refunds"] {
+		t.Errorf("Backends received %v, want both", got)
+	}
+
+	stopCtx, stopCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer stopCancel()
+	pipeline.Stop(stopCtx, pipelines)
+	if err := <-runErr; err != nil {
+		t.Errorf("Run() error = %v, want nil after Stop", err)
+	}
+	if health := pipeline.Health(pipelines); health != component.HealthStopped {
+		t.Errorf("Health() = %v, want stopped", health)
+	}
+
+	// Pipelines with the same input and output types keep separate series
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	for _, name := range []string{"orders", "refunds"} {
+		want := `vrsky_messages_written_total{component="http-output",integration="",pipeline="` + name + `",tenant=""} 1`
+		if !strings.Contains(recorder.Body.String(), want) {
+			t.Errorf("/metrics is missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ValueRetail/vrsky/pkg/component"
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// Built-in stage types
+const (
+	StageSetMetadata = "set_metadata" // Adds fixed metadata values
+	StageFilter      = "filter"       // Passes on only envelopes whose field matches
+)
+
+// newStage creates the stage spec describes. Errors are *FieldErrors relative to the stage.
+func newStage(spec StageSpec) (component.Stage, error) {
+	switch spec.Type {
+	case StageSetMetadata:
+		var config struct {
+			Values map[string]string `json:"values"`
+		}
+		if err := decodeConfig(spec.Config, &config); err != nil {
+			return nil, fieldErrorf("config", "%v", err)
+		}
+		if len(config.Values) == 0 {
+			return nil, fieldErrorf("config.values", "at least one value is required")
+		}
+		return setMetadataStage(config.Values), nil
+
+	case StageFilter:
+		var config struct {
+			Field     string  `json:"field"`
+			Equals    *string `json:"equals"`
+			NotEquals *string `json:"not_equals"`
+		}
+		if err := decodeConfig(spec.Config, &config); err != nil {
+			return nil, fieldErrorf("config", "%v", err)
+		}
+		if !component.ValidField(config.Field) {
+			return nil, fieldErrorf("config.field", "%q must be tenant_id, integration_id, metadata.<key> or header.<name>", config.Field)
+		}
+		if (config.Equals == nil) == (config.NotEquals == nil) {
+			return nil, fieldErrorf("config", "exactly one of equals or not_equals is required")
+		}
+		if config.Equals != nil {
+			return &filterStage{field: config.Field, value: *config.Equals, keep: true}, nil
+		}
+		return &filterStage{field: config.Field, value: *config.NotEquals, keep: false}, nil
+
+	case "":
+		return nil, fieldErrorf("type", "is required")
+	default:
+		return nil, fieldErrorf("type", "unknown stage type %q (must be %s or %s)", spec.Type, StageSetMetadata, StageFilter)
+	}
+}
+
+// stageError places a stage error at path
+func stageError(path string, err error) error {
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		return fieldErrorf(path+"."+fieldErr.Field, "%s", fieldErr.Message)
+	}
+	return fieldErrorf(path, "%v", err)
+}
+
+// setMetadataStage adds its values to every envelope's metadata
+type setMetadataStage map[string]string
+
+func (s setMetadataStage) Process(ctx context.Context, env *envelope.Envelope) (*envelope.Envelope, error) {
+	if env.Metadata == nil {
+		env.Metadata = make(map[string]string, len(s))
+	}
+	for key, value := range s {
+		env.Metadata[key] = value
+	}
+	return env, nil
+}
+
+// filterStage keeps envelopes whose field equals value, or with keep false, those whose
+// field does not
+type filterStage struct {
+	field string
+	value string
+	keep  bool
+}
+
+func (s *filterStage) Process(ctx context.Context, env *envelope.Envelope) (*envelope.Envelope, error) {
+	if (component.FieldValue(env, s.field) == s.value) != s.keep {
+		return nil, nil
+	}
+	return env, nil
+}
+
+// defaultsStage gives envelopes the pipeline's tenant and integration IDs when they have none
+type defaultsStage struct {
+	tenantID      string
+	integrationID string
+}
+
+func (s *defaultsStage) Process(ctx context.Context, env *envelope.Envelope) (*envelope.Envelope, error) {
+	if env.TenantID == "" {
+		env.TenantID = s.tenantID
+	}
+	if env.IntegrationID == "" {
+		env.IntegrationID = s.integrationID
+	}
+	return env, nil
+}
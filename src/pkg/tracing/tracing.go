@@ -0,0 +1,119 @@
+// Package tracing creates OpenTelemetry spans for the processing loop and carries the
+// W3C trace context across NATS and HTTP on the envelope.
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/ValueRetail/vrsky/pkg/envelope"
+)
+
+// Exporters accepted by Setup
+const (
+	ExporterNone = "none" // Spans are not recorded; trace context is still passed on
+	ExporterOTLP = "otlp" // OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_* variables
+)
+
+// TraceparentHeader is the W3C header carrying the trace context
+const TraceparentHeader = "traceparent"
+
+// The trace context format is fixed to W3C, whatever global propagator is installed
+var propagator = propagation.TraceContext{}
+
+// Setup installs the global tracer provider for exporter and returns a function that
+// flushes and stops it. serviceName is used unless OTEL_SERVICE_NAME is set.
+func Setup(ctx context.Context, serviceName, exporter string) (func(context.Context) error, error) {
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+	default:
+		return nil, fmt.Errorf("unsupported tracing exporter %q (must be none or otlp)", exporter)
+	}
+
+	client, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(client),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer for VRSky spans from the global provider
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/ValueRetail/vrsky")
+}
+
+// Start starts a span for handling env as a child of the trace context stored on it, and
+// stores the new span's context on env for the next step
+func Start(ctx context.Context, name string, kind trace.SpanKind, env *envelope.Envelope) (context.Context, trace.Span) {
+	ctx, span := Tracer().Start(Context(ctx, env), name,
+		trace.WithSpanKind(kind),
+		trace.WithAttributes(
+			attribute.String("messaging.message.id", env.ID),
+			attribute.String("vrsky.tenant_id", env.TenantID),
+			attribute.String("vrsky.integration_id", env.IntegrationID),
+		))
+	SetEnvelope(ctx, env)
+	return ctx, span
+}
+
+// End ends span, marking it failed when err is not nil
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Context returns ctx with the trace context stored on env as the remote parent
+func Context(ctx context.Context, env *envelope.Envelope) context.Context {
+	if env.TraceParent == "" {
+		return ctx
+	}
+	return propagator.Extract(ctx, propagation.MapCarrier{TraceparentHeader: env.TraceParent})
+}
+
+// SetEnvelope stores the trace context of ctx on env, so the next step continues the trace
+func SetEnvelope(ctx context.Context, env *envelope.Envelope) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	env.TraceParent = carrier.Get(TraceparentHeader)
+	env.TraceID = spanContext.TraceID().String()
+}
+
+// Extract reads a traceparent header value received by an input onto env. Invalid values
+// are ignored, so a bad header starts a new trace instead of failing the message.
+func Extract(traceparent string, env *envelope.Envelope) {
+	if traceparent == "" {
+		return
+	}
+	SetEnvelope(Context(context.Background(), &envelope.Envelope{TraceParent: traceparent}), env)
+}
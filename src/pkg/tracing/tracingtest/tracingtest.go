@@ -0,0 +1,16 @@
+// Package tracingtest collects the spans of the processing loop in memory for tests
+package tracingtest
+
+import (
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// UseInMemory installs a tracer provider that keeps finished spans in memory. Callers
+// restore the previous global provider when they are done.
+func UseInMemory() *tracetest.InMemoryExporter {
+	exporter := tracetest.NewInMemoryExporter()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	return exporter
+}